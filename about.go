@@ -0,0 +1,130 @@
+package mssqlmcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const aboutResourceURI = "mssql://about"
+
+// aboutDatabase is the organizational context an operator gives for the
+// database in the MSSQL_ABOUT_FILE JSON object.
+type aboutDatabase struct {
+	Name      string   `json:"name"`
+	Purpose   string   `json:"purpose"`
+	Owner     string   `json:"owner"`
+	Contact   string   `json:"contact"`
+	Freshness string   `json:"freshness"`
+	Caveats   []string `json:"caveats"`
+	Notes     string   `json:"notes"`
+}
+
+// registerAboutResource serves the description in MSSQL_ABOUT_FILE as
+// mssql://about. The file is read on every request so edits apply without a
+// restart.
+func registerAboutResource(s *server.MCPServer) {
+	config, err := getDbConfig()
+	if err != nil || config.AboutFile == "" {
+		return
+	}
+	if _, err := loadAbout(config.AboutFile); err != nil {
+		log.Printf("Could not load the database description from %s: %v", config.AboutFile, err)
+		return
+	}
+
+	s.AddResource(
+		mcp.NewResource(aboutResourceURI, "About this database",
+			mcp.WithResourceDescription("What the database is for, who owns it, how fresh its data is and caveats to respect when analysing it. Read this before querying."),
+			mcp.WithMIMEType("text/markdown"),
+		),
+		func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			about, err := loadAbout(config.AboutFile)
+			if err != nil {
+				return nil, err
+			}
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      request.Params.URI,
+					MIMEType: "text/markdown",
+					Text:     about.render(config.Database),
+				},
+			}, nil
+		},
+	)
+	log.Printf("Registered %s", aboutResourceURI)
+}
+
+// aboutInstructions returns the description in MSSQL_ABOUT_FILE for the
+// server's instructions, or an empty string when there is none.
+func aboutInstructions() string {
+	config, err := getDbConfig()
+	if err != nil || config.AboutFile == "" {
+		return ""
+	}
+	about, err := loadAbout(config.AboutFile)
+	if err != nil {
+		return ""
+	}
+	return about.render(config.Database) + fmt.Sprintf("\nRespect this context when querying; it stays available as the %s resource.\n", aboutResourceURI)
+}
+
+func loadAbout(path string) (*aboutDatabase, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var about aboutDatabase
+	if err := json.Unmarshal(content, &about); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	if about.Purpose == "" && about.Notes == "" {
+		return nil, errors.New("the description needs at least a purpose or notes")
+	}
+	return &about, nil
+}
+
+// render presents the description as markdown, leaving out what was not
+// given.
+func (about *aboutDatabase) render(database string) string {
+	name := about.Name
+	if name == "" {
+		name = database
+	}
+
+	var document strings.Builder
+	document.WriteString(fmt.Sprintf("# About %s\n\n", name))
+	if about.Purpose != "" {
+		document.WriteString(about.Purpose + "\n\n")
+	}
+	for _, field := range [][2]string{
+		{"Owner", about.Owner},
+		{"Contact", about.Contact},
+		{"Data freshness", about.Freshness},
+	} {
+		if field[1] != "" {
+			document.WriteString(fmt.Sprintf("- **%s:** %s\n", field[0], field[1]))
+		}
+	}
+	if about.Owner != "" || about.Contact != "" || about.Freshness != "" {
+		document.WriteString("\n")
+	}
+	if len(about.Caveats) > 0 {
+		document.WriteString("## Caveats\n\n")
+		for _, caveat := range about.Caveats {
+			document.WriteString("- " + caveat + "\n")
+		}
+		document.WriteString("\n")
+	}
+	if about.Notes != "" {
+		document.WriteString("## Notes\n\n" + about.Notes + "\n")
+	}
+	return strings.TrimRight(document.String(), "\n") + "\n"
+}
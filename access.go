@@ -0,0 +1,125 @@
+package mssqlmcp
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// objectMatches reports whether schema.object matches one of the patterns,
+// such as sales.* or dbo.Orders; a pattern without a schema stands for one
+// in dbo. Matching ignores case and [brackets].
+func objectMatches(patterns []string, schema, object string) bool {
+	name := strings.ToLower(schema + "." + object)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.NewReplacer("[", "", "]", "").Replace(pattern))
+		if !strings.Contains(pattern, ".") {
+			pattern = "dbo." + pattern
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// objectAccessible reports whether MSSQL_ALLOWED_OBJECTS and
+// MSSQL_DENIED_OBJECTS let queries and tools reference an object. Denied
+// patterns win; when allowed patterns are set, other objects are refused
+// except the catalog views in sys and INFORMATION_SCHEMA.
+func objectAccessible(config *DbConfig, schema, object string) bool {
+	if objectMatches(config.DeniedObjects, schema, object) {
+		return false
+	}
+	if len(config.AllowedObjects) == 0 || objectMatches(config.AllowedObjects, schema, object) {
+		return true
+	}
+	return strings.EqualFold(schema, "sys") || strings.EqualFold(schema, "INFORMATION_SCHEMA")
+}
+
+// checkObjectAccess refuses a query naming a table, view or function that
+// objectAccessible does not permit. Objects are found by parsing the query,
+// so tables a view or procedure reads internally are not checked; deny the
+// view as well. A query whose table sources cannot all be read is refused,
+// and so is a call such as Doc.value(...) that cannot be told from one of a
+// function in schema Doc when that is not permitted: qualify the column with
+// its table's alias. With MSSQL_ALLOWED_OBJECTS set, objects of other
+// databases are refused as they cannot be matched.
+func checkObjectAccess(config *DbConfig, query string) error {
+	if len(config.AllowedObjects) == 0 && len(config.DeniedObjects) == 0 {
+		return nil
+	}
+	calls, ok := procedureCalls(query)
+	if !ok {
+		return errors.New("dynamic SQL cannot be checked against the object access policy (MSSQL_ALLOWED_OBJECTS, MSSQL_DENIED_OBJECTS)")
+	}
+	references, err := resolveObjectReferences(query)
+	if err != nil {
+		return fmt.Errorf("%v, so the query cannot be checked against the object access policy (MSSQL_ALLOWED_OBJECTS, MSSQL_DENIED_OBJECTS)", err)
+	}
+	for _, reference := range append(references, calls...) {
+		parts := reference.Parts
+		if reference.IsTemporary() || strings.HasPrefix(reference.Name(), "@") || reference.IsBuiltin() {
+			continue
+		}
+		if len(parts) > 2 && len(config.AllowedObjects) > 0 {
+			return fmt.Errorf("%s is in another database; only objects matching MSSQL_ALLOWED_OBJECTS may be referenced", reference.Name())
+		}
+		schema, object := "dbo", parts[len(parts)-1]
+		if len(parts) >= 2 && parts[len(parts)-2] != "" {
+			schema = parts[len(parts)-2]
+		}
+		if !objectAccessible(config, schema, object) {
+			return fmt.Errorf("%s is not accessible under the object access policy (MSSQL_ALLOWED_OBJECTS, MSSQL_DENIED_OBJECTS)", formatObjectName(schema, object))
+		}
+	}
+	return nil
+}
+
+// procedureCalls returns the procedures a query calls with EXEC, or as the
+// first statement of a batch without it. It is false when the query runs
+// dynamic SQL, through EXEC of a string or variable or sp_executesql, whose
+// objects cannot be known.
+func procedureCalls(query string) ([]objectReference, bool) {
+	tokens := significantTokens(tokenizeSQL(query))
+	var calls []objectReference
+	for i, t := range tokens {
+		start := i
+		switch {
+		case i == 0 && isNameToken(t) && !isStatementWord(t):
+		case t.isKeyword("EXEC") || t.isKeyword("EXECUTE"):
+			// EXECUTE AS, and the permission in GRANT EXECUTE ON
+			if i+1 < len(tokens) && tokens[i+1].isKeyword("AS") {
+				continue
+			}
+			if i > 0 && (tokens[i-1].Text == "," || tokens[i-1].isKeyword("GRANT") || tokens[i-1].isKeyword("DENY") || tokens[i-1].isKeyword("REVOKE")) {
+				continue
+			}
+			start = i + 1
+			// EXEC @return_code = procedure
+			if start+1 < len(tokens) && strings.HasPrefix(tokens[start].Text, "@") && tokens[start+1].Text == "=" {
+				start += 2
+			}
+		default:
+			continue
+		}
+		reference, _, ok := parseObjectReference(tokens, start, false)
+		if !ok || strings.EqualFold(reference.Parts[len(reference.Parts)-1], "sp_executesql") {
+			return nil, false
+		}
+		calls = append(calls, reference)
+	}
+	return calls, true
+}
+
+// isStatementWord reports whether a word that is not reserved starts a
+// statement rather than naming a procedure, as THROW does.
+func isStatementWord(t sqlToken) bool {
+	for _, word := range []string{"THROW", "RECEIVE", "SEND", "MOVE", "GET", "ENABLE", "DISABLE"} {
+		if t.isKeyword(word) {
+			return true
+		}
+	}
+	return false
+}
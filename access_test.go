@@ -0,0 +1,54 @@
+package mssqlmcp
+
+import "testing"
+
+func TestObjectAccess(t *testing.T) {
+	t.Setenv("MSSQL_DENIED_OBJECTS", "dbo.Salaries,hr.*")
+
+	config := testConfig(t)
+	for query, allowed := range map[string]bool{
+		"SELECT * FROM dbo.Orders AS Salaries":                                             true,
+		"UPDATE Salaries SET Note = 'x' FROM dbo.Orders AS Salaries":                       true,
+		"SELECT * FROM dbo.Orders WITH (NOLOCK), dbo.Customers c TABLESAMPLE (10 PERCENT)": true,
+		"SELECT j.* FROM dbo.Orders o CROSS APPLY OPENJSON(o.Note) WITH (a int) AS j":      true,
+		"SELECT o.Doc.value('(/a)[1]', 'int') FROM dbo.Orders o":                           true,
+		"SELECT * FROM dbo.Salaries":                                                       false,
+		"SELECT * FROM (dbo.Salaries s JOIN dbo.Orders o ON 1 = 1)":                        false,
+		"DELETE dbo.Salaries WHERE id = 1":                                                 false,
+		"DELETE TOP (5) FROM dbo.Salaries":                                                 false,
+		"INSERT dbo.Salaries (id) VALUES (1)":                                              false,
+		"SELECT * FROM dbo.Orders AS Salaries CROSS JOIN Salaries":                         false,
+		"SELECT * FROM dbo.Orders o WHERE EXISTS (SELECT 1 FROM Salaries)":                 false,
+		"SELECT * FROM dbo.Orders WITH (NOLOCK), dbo.Salaries":                             false,
+		"SELECT * FROM dbo.Orders o WITH (NOLOCK), dbo.Salaries":                           false,
+		"SELECT * FROM dbo.Orders (NOLOCK), dbo.Salaries":                                  false,
+		"SELECT * FROM Salaries (NOLOCK)":                                                  false,
+		"SELECT * FROM dbo.Orders TABLESAMPLE (10 PERCENT) REPEATABLE (1), dbo.Salaries":   false,
+		"SELECT * FROM dbo.Orders FOR SYSTEM_TIME ALL, dbo.Salaries":                       false,
+		"SELECT * FROM dbo.Orders FOR SYSTEM_TIME AS OF @t AS h, dbo.Salaries":             false,
+		"SELECT * FROM (SELECT 1 AS x) AS d, dbo.Salaries":                                 false,
+		"SELECT * FROM @ids i, dbo.Salaries":                                               false,
+		"SELECT * FROM (dbo.Orders a JOIN dbo.Orders b ON 1 = 1), dbo.Salaries":            false,
+		"SELECT * FROM dbo.Orders o JOIN dbo.Customers c ON c.id = o.id, dbo.Salaries":     false,
+		"SELECT * FROM CONTAINSTABLE(dbo.Salaries, Note, 'x') AS k":                        false,
+		"SELECT * FROM FREETEXTTABLE(Salaries, *, 'x') k":                                  false,
+		"SELECT * FROM CHANGETABLE(CHANGES dbo.Salaries, 0) AS c":                          false,
+		"SELECT dbo.Salaries(o.id) FROM dbo.Orders o":                                      false,
+		"SELECT hr.MonthlyPay(1)":                                                          false,
+		"SELECT * FROM dbo.Orders o WHERE o.Total > hr.Threshold()":                        false,
+		"SELECT Salaries.hr.Pay() FROM dbo.Orders AS Salaries":                             false,
+		"SELECT * FROM dbo.Orders o CROSS APPLY hr.Payslips(o.id) p":                       false,
+		"SELECT * FROM dbo.Orders PIVOT (SUM(Total) FOR Note IN ([a])) AS p, dbo.Salaries": false,
+		"SELECT * FROM ::fn_virtualfilestats(1, 1)":                                        false,
+		"EXEC @rc = dbo.usp_Report @year = 2024":                                           true,
+		"GRANT EXECUTE ON dbo.Salaries TO reporting":                                       true,
+		"EXEC dbo.Salaries":                 false,
+		"Salaries 1":                        false,
+		"EXEC ('SELECT * FROM dbo.Orders')": false,
+		"EXEC sp_executesql N'SELECT 1'":    false,
+	} {
+		if err := checkObjectAccess(config, query); (err == nil) != allowed {
+			t.Errorf("checkObjectAccess(%q) = %v, want allowed %v", query, err, allowed)
+		}
+	}
+}
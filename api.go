@@ -0,0 +1,70 @@
+package mssqlmcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Table names a base table, as ListTables returns it.
+type Table struct {
+	Schema string
+	Name   string
+}
+
+// ListTables returns the base tables of the configured database.
+func ListTables() ([]Table, error) {
+	names, err := listBaseTables()
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]Table, len(names))
+	for i, name := range names {
+		tables[i] = Table{Schema: name[0], Name: name[1]}
+	}
+	return tables, nil
+}
+
+// CallTool calls a tool of the server in-process as an MCP client would, so
+// the call goes through the same checks and formatting. A client session in
+// ctx, as server.WithContext puts it there, keeps its own sticky session.
+func CallTool(ctx context.Context, s *server.MCPServer, name string, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	message, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": mcp.JSONRPC_VERSION,
+		"id":      1,
+		"method":  string(mcp.MethodToolsCall),
+		"params":  map[string]interface{}{"name": name, "arguments": arguments},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch response := s.HandleMessage(ctx, message).(type) {
+	case mcp.JSONRPCResponse:
+		switch result := response.Result.(type) {
+		case *mcp.CallToolResult:
+			return result, nil
+		case mcp.CallToolResult:
+			return &result, nil
+		}
+		return nil, fmt.Errorf("unexpected result %T from %s", response.Result, name)
+	case mcp.JSONRPCError:
+		return nil, fmt.Errorf("%s", response.Error.Message)
+	default:
+		return nil, fmt.Errorf("unexpected response %T from %s", response, name)
+	}
+}
+
+// CloseSession releases the sticky session of a client session, rolling back
+// any transaction it left open.
+func CloseSession(id string) {
+	sessionsMu.Lock()
+	sess, ok := sessions[id]
+	sessionsMu.Unlock()
+	if ok {
+		releaseSession(sess, "client closed")
+	}
+}
@@ -0,0 +1,74 @@
+package mssqlmcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// awsSecretProvider reads a login from AWS Secrets Manager
+// (MSSQL_AWS_SECRET_ID), such as the secret RDS keeps for a SQL Server
+// instance's master user. The AWS SDK finds credentials and the region
+// through its default chain (environment, shared config and credentials
+// files, SSO, web identity, ECS task and EC2 instance roles); the secret's
+// ARN supplies the region when the chain has none. MSSQL_AWS_ENDPOINT
+// overrides the service endpoint, e.g. for a VPC endpoint.
+type awsSecretProvider struct {
+	secretID     string
+	versionStage string
+	client       *secretsmanager.Client
+}
+
+func newAWSSecretProvider() (SecretProvider, error) {
+	secretID := os.Getenv("MSSQL_AWS_SECRET_ID")
+	if secretID == "" {
+		return nil, errors.New("the aws secret provider needs MSSQL_AWS_SECRET_ID")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), SECRET_PROVIDER_TIMEOUT)
+	defer cancel()
+	awsConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS configuration: %v", err)
+	}
+	// arn:aws:secretsmanager:<region>:<account>:secret:<name>
+	if parts := strings.Split(secretID, ":"); awsConfig.Region == "" && len(parts) > 3 && parts[0] == "arn" {
+		awsConfig.Region = parts[3]
+	}
+	if awsConfig.Region == "" {
+		return nil, errors.New("the aws secret provider needs AWS_REGION, a region in the AWS config file or a secret ARN")
+	}
+
+	endpoint := strings.TrimRight(os.Getenv("MSSQL_AWS_ENDPOINT"), "/")
+	client := secretsmanager.NewFromConfig(awsConfig, func(options *secretsmanager.Options) {
+		if endpoint != "" {
+			options.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	return awsSecretProvider{
+		secretID:     secretID,
+		versionStage: os.Getenv("MSSQL_AWS_SECRET_VERSION_STAGE"),
+		client:       client,
+	}, nil
+}
+
+func (p awsSecretProvider) Credentials(ctx context.Context) (Credentials, error) {
+	input := &secretsmanager.GetSecretValueInput{SecretId: aws.String(p.secretID)}
+	if p.versionStage != "" {
+		input.VersionStage = aws.String(p.versionStage)
+	}
+	secret, err := p.client.GetSecretValue(ctx, input)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("reading secret %s: %v", p.secretID, err)
+	}
+	if secret.SecretString != nil {
+		return parseSecretValue(*secret.SecretString), nil
+	}
+	return parseSecretValue(string(secret.SecretBinary)), nil
+}
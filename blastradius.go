@@ -0,0 +1,109 @@
+package mssqlmcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkWriteFilters refuses UPDATE and DELETE statements without a WHERE
+// clause, which change every row of their table, unless
+// MSSQL_ALLOW_UNFILTERED_WRITES is set. Statements filtered only through a
+// join still need a WHERE clause; WHERE 1 = 1 states the intent to change
+// every row.
+func checkWriteFilters(config *DbConfig, statement string) error {
+	if config.UnfilteredWrites {
+		return nil
+	}
+	tokens := significantTokens(tokenizeSQL(statement))
+	for i, t := range tokens {
+		if !t.isKeyword("UPDATE") && !t.isKeyword("DELETE") {
+			continue
+		}
+		// MERGE actions, ON DELETE CASCADE, FOR UPDATE cursors, trigger
+		// events, permissions, UPDATE STATISTICS and UPDATE(column)
+		if i > 0 {
+			previous := tokens[i-1]
+			if previous.Text == "," || previous.Text == "(" || previous.isKeyword("THEN") || previous.isKeyword("ON") || previous.isKeyword("FOR") ||
+				previous.isKeyword("AFTER") || previous.isKeyword("OF") || previous.isKeyword("GRANT") || previous.isKeyword("DENY") || previous.isKeyword("REVOKE") {
+				continue
+			}
+		}
+		if i+1 < len(tokens) && (tokens[i+1].isKeyword("STATISTICS") || tokens[i+1].Text == "(") {
+			continue
+		}
+		if !hasWhereClause(tokens, i) {
+			return fmt.Errorf("%s without a WHERE clause would change every row; add a WHERE clause, or WHERE 1 = 1 to change them all on purpose", strings.ToUpper(t.Text))
+		}
+	}
+	return nil
+}
+
+// hasWhereClause reports whether the UPDATE or DELETE at tokens[start] has a
+// WHERE clause of its own, looking up to where the next statement begins.
+func hasWhereClause(tokens []sqlToken, start int) bool {
+	depth := tokens[start].Depth
+	for i := start + 1; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.Depth < depth {
+			return false
+		}
+		if t.Depth > depth {
+			continue
+		}
+		switch {
+		case t.isKeyword("WHERE"):
+			return true
+		case t.Text == ";":
+			return false
+		}
+		for _, keyword := range []string{"SELECT", "INSERT", "UPDATE", "DELETE", "MERGE", "CREATE", "ALTER", "DROP",
+			"EXEC", "EXECUTE", "DECLARE", "IF", "BEGIN", "END", "PRINT", "RETURN", "TRUNCATE"} {
+			if t.isKeyword(keyword) {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// guardAffectedRows wraps a single UPDATE or DELETE statement so it is rolled
+// back when it changes more rows than MSSQL_MAX_AFFECTED_ROWS. The statement
+// runs in a transaction of its own, or a savepoint inside the caller's, and
+// is committed only when the row count is within the limit. Other
+// statements, and all of them when no limit is set, are returned unchanged.
+func guardAffectedRows(config *DbConfig, statement string) string {
+	if config.MaxAffectedRows <= 0 {
+		return statement
+	}
+	if verb := statementVerb(statement); verb != "UPDATE" && verb != "DELETE" {
+		return statement
+	}
+	tokens := significantTokens(tokenizeSQL(statement))
+	for i, t := range tokens {
+		if t.Text == ";" && i != len(tokens)-1 {
+			return statement
+		}
+	}
+	if last := tokens[len(tokens)-1]; last.Text == ";" {
+		statement = statement[:last.Pos]
+	}
+
+	return fmt.Sprintf(`DECLARE @mcp_outer int = @@TRANCOUNT, @mcp_affected int, @mcp_message nvarchar(2048);
+BEGIN TRY
+IF @mcp_outer = 0 BEGIN TRANSACTION; ELSE SAVE TRANSACTION mcp_guard;
+%s
+;SET @mcp_affected = @@ROWCOUNT;
+IF @mcp_affected > %d
+BEGIN
+SET @mcp_message = CONCAT(N'%s', @mcp_affected, N'%s');
+THROW 50000, @mcp_message, 1;
+END;
+IF @mcp_outer = 0 COMMIT TRANSACTION;
+END TRY
+BEGIN CATCH
+IF @mcp_outer = 0 AND @@TRANCOUNT > 0 ROLLBACK TRANSACTION;
+ELSE IF XACT_STATE() = 1 ROLLBACK TRANSACTION mcp_guard;
+THROW;
+END CATCH;`, statement, config.MaxAffectedRows,
+		"The statement was rolled back: it changed ", fmt.Sprintf(" rows, more than the %d MSSQL_MAX_AFFECTED_ROWS allows", config.MaxAffectedRows))
+}
@@ -0,0 +1,132 @@
+package mssqlmcp
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rows kept before columns start being dropped to fit the output budget
+const MIN_BUDGET_ROWS = 10
+
+// Tokens set aside for the note describing what was omitted
+const BUDGET_NOTE_TOKENS = 100
+
+// estimateTokens approximates the LLM tokens of a text at four characters per
+// token, which is close for English and SQL results.
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/4 + 1
+}
+
+// renderWithinBudget formats results and, when they exceed budget tokens,
+// drops trailing rows until they fit. Should fewer than MIN_BUDGET_ROWS rows
+// fit, the widest columns are dropped first. A warning describes what was
+// left out. A budget of zero or less disables shaping.
+func renderWithinBudget(data map[string]interface{}, format string, delimiter rune, budget int) (string, error) {
+	full, err := renderResults(data, format, delimiter)
+	if err != nil || budget <= 0 || estimateTokens(full) <= budget {
+		return full, err
+	}
+
+	// Only result sets can be shaped; write summaries are already small
+	columns, ok := data["columns"].([]string)
+	rows, _ := data["rows"].([]map[string]interface{})
+	if !ok || len(rows) == 0 {
+		return full, nil
+	}
+
+	minRows := MIN_BUDGET_ROWS
+	if len(rows) < minRows {
+		minRows = len(rows)
+	}
+
+	kept := columns
+	var dropped []string
+	for {
+		shaped := withColumns(data, kept)
+
+		// Binary search for the most rows that fit
+		low, high := 0, len(rows)
+		for low < high {
+			mid := (low + high + 1) / 2
+			shaped["rows"] = rows[:mid]
+			text, err := renderResults(shaped, format, delimiter)
+			if err != nil {
+				return "", err
+			}
+			if estimateTokens(text)+BUDGET_NOTE_TOKENS <= budget {
+				low = mid
+			} else {
+				high = mid - 1
+			}
+		}
+
+		if low >= minRows || len(kept) == 1 {
+			shaped["rows"] = rows[:low]
+			note := fmt.Sprintf("Output shortened to fit about %d tokens (MSSQL_MAX_OUTPUT_TOKENS): showing %d of %d rows", budget, low, len(rows))
+			if len(dropped) > 0 {
+				note += "; columns omitted: " + strings.Join(dropped, ", ")
+			}
+			note += "."
+			if id, ok := data["resultId"].(int); ok {
+				note += fmt.Sprintf(" The full result is kept as result #%d; use get_result to page through it.", id)
+			} else {
+				note += " Select fewer columns or rows to see the rest."
+			}
+			warnings, _ := data["warnings"].([]string)
+			shaped["warnings"] = append([]string{note}, warnings...)
+			return renderResults(shaped, format, delimiter)
+		}
+
+		widest := widestColumn(kept, rows[:minRows])
+		dropped = append(dropped, widest)
+		var remaining []string
+		for _, column := range kept {
+			if column != widest {
+				remaining = append(remaining, column)
+			}
+		}
+		kept = remaining
+	}
+}
+
+// withColumns returns a copy of a result restricted to some of its columns.
+// Rows keep their other values, which rendering ignores.
+func withColumns(data map[string]interface{}, columns []string) map[string]interface{} {
+	shaped := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		shaped[key] = value
+	}
+	shaped["columns"] = columns
+
+	if columnTypes, ok := data["columnTypes"].([]columnInfo); ok {
+		keep := make(map[string]bool, len(columns))
+		for _, column := range columns {
+			keep[column] = true
+		}
+		var kept []columnInfo
+		for _, columnType := range columnTypes {
+			if keep[columnType.Name] {
+				kept = append(kept, columnType)
+			}
+		}
+		shaped["columnTypes"] = kept
+	}
+	return shaped
+}
+
+// widestColumn returns the column whose values take the most characters in
+// the sample rows.
+func widestColumn(columns []string, rows []map[string]interface{}) string {
+	widest, widestLength := columns[0], -1
+	for _, column := range columns {
+		length := utf8.RuneCountInString(column)
+		for _, row := range rows {
+			length += utf8.RuneCountInString(displayValue(row[column], ""))
+		}
+		if length > widestLength {
+			widest, widestLength = column, length
+		}
+	}
+	return widest
+}
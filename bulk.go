@@ -0,0 +1,425 @@
+package mssqlmcp
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Rows sent per bulk copy batch unless the caller chooses otherwise
+const DEFAULT_BULK_BATCH_SIZE = 5000
+
+// Rows shown when previewing a bulk load
+const BULK_PREVIEW_ROWS = 5
+
+// bulkLoad is a CSV file mapped onto the columns of a table.
+type bulkLoad struct {
+	Schema  string
+	Table   string
+	Path    string
+	Fields  []int    // CSV field loaded into each column
+	Columns []string // target columns
+	Types   []string // DATA_TYPE of each target column
+	// Headers of the file mapped to each column, for the preview
+	Headers []string
+	// Columns of the table the file does not fill
+	Unfilled []string
+}
+
+// resolveImportPath maps a requested file path to an existing file inside
+// MSSQL_IMPORT_ROOT. Relative paths are taken from that root.
+func resolveImportPath(config *DbConfig, requested string) (string, error) {
+	if config.ImportRoot == "" {
+		return "", errors.New("loading files is disabled (set MSSQL_IMPORT_ROOT to enable it)")
+	}
+
+	root, err := filepath.EvalSymlinks(config.ImportRoot)
+	if err != nil {
+		return "", err
+	}
+	path := requested
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+
+	relative, err := filepath.Rel(root, path)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the import root", requested)
+	}
+	return path, nil
+}
+
+// planBulkLoad maps the header of a CSV file onto the columns of a table,
+// through mapping (CSV header to column name) when given, otherwise by
+// matching names regardless of case.
+func planBulkLoad(schema, table, path string, mapping map[string]string, delimiter rune) (*bulkLoad, error) {
+	columns, err := getTableColumns(schema, table)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(columns))
+	names := make(map[string]string, len(columns))
+	for _, column := range columns {
+		name := fmt.Sprintf("%v", column["COLUMN_NAME"])
+		types[strings.ToLower(name)] = strings.ToLower(fmt.Sprintf("%v", column["DATA_TYPE"]))
+		names[strings.ToLower(name)] = name
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = delimiter
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading the header of %s: %v", filepath.Base(path), err)
+	}
+
+	load := &bulkLoad{Schema: schema, Table: table, Path: path}
+	filled := make(map[string]bool)
+	var unknown []string
+	for i, field := range header {
+		field = strings.TrimSpace(strings.TrimPrefix(field, "\ufeff"))
+		target := field
+		if mapping != nil {
+			var ok bool
+			if target, ok = mapping[field]; !ok {
+				continue
+			}
+		}
+		column, ok := names[strings.ToLower(target)]
+		if !ok {
+			unknown = append(unknown, target)
+			continue
+		}
+		if filled[strings.ToLower(column)] {
+			return nil, fmt.Errorf("column %s is filled from more than one CSV field", column)
+		}
+		filled[strings.ToLower(column)] = true
+		load.Fields = append(load.Fields, i)
+		load.Columns = append(load.Columns, column)
+		load.Types = append(load.Types, types[strings.ToLower(column)])
+		load.Headers = append(load.Headers, field)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%s.%s has no column %s; map the CSV fields with columns", schema, table, strings.Join(unknown, ", "))
+	}
+	for source := range mapping {
+		found := false
+		for _, field := range load.Headers {
+			found = found || field == source
+		}
+		if !found {
+			return nil, fmt.Errorf("the CSV header has no field %s", source)
+		}
+	}
+	if len(load.Columns) == 0 {
+		return nil, errors.New("no CSV field maps to a column of the table")
+	}
+	for _, column := range columns {
+		name := fmt.Sprintf("%v", column["COLUMN_NAME"])
+		if !filled[strings.ToLower(name)] {
+			load.Unfilled = append(load.Unfilled, name)
+		}
+	}
+	return load, nil
+}
+
+// eachRow reads the CSV records after the header, converted to the types of
+// their columns, stopping at the first error.
+func (b *bulkLoad) eachRow(delimiter rune, fn func(line int, values []interface{}) error) error {
+	file, err := os.Open(b.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	if _, err := reader.Read(); err != nil {
+		return err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		values := make([]interface{}, len(b.Columns))
+		for i, field := range b.Fields {
+			if field >= len(record) {
+				continue
+			}
+			values[i], err = bulkValue(b.Types[i], record[field])
+			if err != nil {
+				return fmt.Errorf("line %d, column %s: %v", line, b.Columns[i], err)
+			}
+		}
+		if err := fn(line, values); err != nil {
+			return err
+		}
+	}
+}
+
+// bulkValue converts a CSV field to what bulk copy expects for a column
+// type. Empty fields are NULL except in character columns.
+func bulkValue(dataType, text string) (interface{}, error) {
+	switch dataType {
+	case "char", "varchar", "nchar", "nvarchar", "text", "ntext", "xml":
+		return text, nil
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	switch dataType {
+	case "tinyint", "smallint", "int", "bigint":
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", dataType, text)
+		}
+		return n, nil
+	case "float", "real":
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", dataType, text)
+		}
+		return f, nil
+	case "bit":
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bit %q", text)
+		}
+		return b, nil
+	case "binary", "varbinary", "image":
+		data, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(text, "0x"), "0X"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q (expected hex)", dataType, text)
+		}
+		return data, nil
+	case "uniqueidentifier":
+		var id mssql.UniqueIdentifier
+		if err := id.Scan(text); err != nil {
+			return nil, fmt.Errorf("invalid uniqueidentifier %q", text)
+		}
+		value, err := id.Value()
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	// Dates, times and decimals are parsed by the driver from text
+	return text, nil
+}
+
+// preview reads the whole file, checking every value converts, and renders
+// the mapping, the first rows and the row count.
+func (b *bulkLoad) preview(delimiter rune) (string, error) {
+	var rows []map[string]interface{}
+	count := 0
+	err := b.eachRow(delimiter, func(line int, values []interface{}) error {
+		count++
+		if len(rows) < BULK_PREVIEW_ROWS {
+			row := make(map[string]interface{}, len(values))
+			for i, value := range values {
+				if data, ok := value.([]byte); ok {
+					value = "0x" + hex.EncodeToString(data)
+					var id mssql.UniqueIdentifier
+					if b.Types[i] == "uniqueidentifier" && id.Scan(data) == nil {
+						value = id.String()
+					}
+				}
+				row[b.Columns[i]] = value
+			}
+			rows = append(rows, row)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Would load %d rows from %s into %s.\n\nColumns:\n", count, filepath.Base(b.Path), formatObjectName(b.Schema, b.Table)))
+	for i, column := range b.Columns {
+		text.WriteString(fmt.Sprintf("- %s -> %s (%s)\n", b.Headers[i], column, b.Types[i]))
+	}
+	if len(b.Unfilled) > 0 {
+		text.WriteString(fmt.Sprintf("Not in the file, so left to their defaults or NULL: %s\n", strings.Join(b.Unfilled, ", ")))
+	}
+	if len(rows) > 0 {
+		formatted, err := formatResults(map[string]interface{}{"columns": b.Columns, "rows": rows})
+		if err != nil {
+			return "", err
+		}
+		text.WriteString(fmt.Sprintf("\nFirst %d rows:\n%s\n", len(rows), strings.TrimRight(formatted, "\n")))
+	}
+	text.WriteString("\nNothing was loaded; repeat the call with confirm=true to load the file.")
+	return text.String(), nil
+}
+
+// copyIn loads the file with the bulk copy protocol in one transaction, so a
+// failure leaves the table as it was.
+func (b *bulkLoad) copyIn(ctx context.Context, config *DbConfig, delimiter rune, batchSize int) (int64, error) {
+	db, err := getConnection(config)
+	if err != nil {
+		return 0, fmt.Errorf("database connection error: %v", err)
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	options := mssql.BulkOptions{RowsPerBatch: batchSize, CheckConstraints: true, FireTriggers: true, KeepNulls: true}
+	stmt, err := tx.PrepareContext(ctx, mssql.CopyIn(formatObjectName(b.Schema, b.Table), options, b.Columns...))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	err = b.eachRow(delimiter, func(line int, values []interface{}) error {
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// Executing without values sends the buffered rows
+	result, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	loaded, _ := result.RowsAffected()
+	return loaded, tx.Commit()
+}
+
+// registerBulkInsertTool adds a tool loading CSV files into tables with the
+// bulk copy protocol.
+func registerBulkInsertTool(s *server.MCPServer) {
+	bulkTool := mcp.NewTool("bulk_insert",
+		mcp.WithDescription("Load a CSV file into a table with bulk copy, far faster than INSERT statements. The first call previews the column mapping and first rows and checks every value converts; repeat it with confirm=true to load. The file must be inside MSSQL_IMPORT_ROOT and have a header row; the load is one transaction."),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Target table, optionally schema-qualified"),
+		),
+		mcp.WithString("csv_path",
+			mcp.Required(),
+			mcp.Description("Path of the CSV file, relative to MSSQL_IMPORT_ROOT or absolute inside it"),
+		),
+		mcp.WithObject("columns",
+			mcp.Description("Map of CSV header to table column, e.g. {\"order_no\": \"OrderID\"}; only mapped fields are loaded. Without it, fields load into the columns of the same name."),
+		),
+		mcp.WithString("delimiter",
+			mcp.Description("Field delimiter: one character, or \"tab\" (default ,)"),
+		),
+		mcp.WithNumber("batch_size",
+			mcp.Description(fmt.Sprintf("Rows sent per bulk copy batch (default %d)", DEFAULT_BULK_BATCH_SIZE)),
+		),
+		mcp.WithBoolean("confirm",
+			mcp.Description("Load the file; without it the load is only previewed"),
+		),
+	)
+
+	s.AddTool(bulkTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, _ := request.Params.Arguments["table"].(string)
+		requested, _ := request.Params.Arguments["csv_path"].(string)
+		if name == "" || requested == "" {
+			return mcp.NewToolResultError("Table and csv_path are required"), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		// Bulk copy bypasses the rewriting that keeps writes inside a tenant
+		if config.TenancyModel != "" {
+			return mcp.NewToolResultError("bulk_insert is not available with tenant isolation (MSSQL_TENANCY_MODEL)"), nil
+		}
+
+		schema, table, err := resolveObjectName(name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		// Bulk copy sends no statement of its own; it is checked as the INSERT
+		// it amounts to
+		if err := checkPolicies(config, writeAccess, "INSERT INTO "+formatObjectName(schema, table)+" DEFAULT VALUES"); err != nil {
+			return notPermitted("Statement", err), nil
+		}
+		path, err := resolveImportPath(config, requested)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error opening file: %v", err)), nil
+		}
+
+		delimiter := ','
+		if text, _ := request.Params.Arguments["delimiter"].(string); text != "" {
+			if delimiter, err = parseDelimiter(text); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Invalid delimiter: %v", err)), nil
+			}
+		}
+		batchSize := DEFAULT_BULK_BATCH_SIZE
+		if value, ok := request.Params.Arguments["batch_size"].(float64); ok && value >= 1 {
+			batchSize = int(value)
+		}
+		var mapping map[string]string
+		if columns, ok := request.Params.Arguments["columns"].(map[string]interface{}); ok && len(columns) > 0 {
+			mapping = make(map[string]string, len(columns))
+			for field, column := range columns {
+				mapping[field] = fmt.Sprintf("%v", column)
+			}
+		}
+
+		load, err := planBulkLoad(schema, table, path, mapping, delimiter)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error mapping file: %v", err)), nil
+		}
+
+		if confirmed, _ := request.Params.Arguments["confirm"].(bool); !confirmed {
+			preview, err := load.preview(delimiter)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Error reading file: %v", err)), nil
+			}
+			return mcp.NewToolResultText(preview), nil
+		}
+
+		log.Printf("Bulk loading %s into %s.%s", path, schema, table)
+		start := time.Now()
+		loaded, err := load.copyIn(ctx, config, delimiter, batchSize)
+		if err != nil {
+			log.Printf("Error bulk loading %s: %v", path, err)
+			return mcp.NewToolResultError(fmt.Sprintf("Error loading file: %v; nothing was loaded", err)), nil
+		}
+
+		summary := executionSummary{RowsAffected: &loaded, ElapsedMs: time.Since(start).Milliseconds()}
+		summary.Server, summary.Database = executionSource(config)
+		return mcp.NewToolResultText(fmt.Sprintf("Loaded %d rows from %s into %s.\n%s", loaded, filepath.Base(path), formatObjectName(schema, table), summary.String())), nil
+	})
+}
@@ -0,0 +1,235 @@
+package mssqlmcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Cassette modes (MSSQL_CASSETTE_MODE). Recording runs queries against the
+// database and appends each query with its result to MSSQL_CASSETTE; replay
+// answers queries from that file alone, so demos, client tests and bug
+// reproductions work without a database and give the same results each time.
+const (
+	cassetteRecord = "record"
+	cassetteReplay = "replay"
+)
+
+// cassetteEntry is one recorded query and its outcome, stored as a line of
+// JSON.
+type cassetteEntry struct {
+	Query         string          `json:"query"`
+	Args          json.RawMessage `json:"args,omitempty"`
+	MaxRows       int             `json:"maxRows,omitempty"`
+	Columns       []string        `json:"columns,omitempty"`
+	ColumnTypes   []columnInfo    `json:"columnTypes,omitempty"`
+	Rows          [][]interface{} `json:"rows,omitempty"`
+	Truncated     bool            `json:"truncated,omitempty"`
+	EstimatedRows int64           `json:"estimatedRows,omitempty"`
+	Warnings      []string        `json:"warnings,omitempty"`
+	RowCount      *int64          `json:"rowCount,omitempty"`
+	OutputColumns []string        `json:"outputColumns,omitempty"`
+	OutputRows    [][]interface{} `json:"outputRows,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+var (
+	cassetteMu sync.Mutex
+	// Replayed entries by key, with the position of the next one to serve
+	cassetteEntries  map[string][]*cassetteEntry
+	cassettePosition map[string]int
+)
+
+// withCassette runs a query through the configured cassette: in replay mode
+// the recorded outcome is returned without calling run, in record mode the
+// outcome of run is appended to the cassette, and otherwise run is called as
+// is. A query recorded several times replays its outcomes in order, the last
+// one repeating.
+func withCassette(config *DbConfig, query string, maxRows int, args []interface{}, run func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	if config.CassetteMode == "" {
+		return run()
+	}
+
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		encodedArgs = nil
+	}
+	key := cassetteKey(query, encodedArgs, maxRows)
+
+	switch config.CassetteMode {
+	case cassetteReplay:
+		entry, err := replayEntry(config, key)
+		if err != nil {
+			return nil, err
+		}
+		return entry.result()
+	case cassetteRecord:
+		data, err := run()
+		entry := newCassetteEntry(query, encodedArgs, maxRows, data, err)
+		if recordErr := recordEntry(config, entry); recordErr != nil {
+			return nil, fmt.Errorf("recording to cassette: %v", recordErr)
+		}
+		return data, err
+	}
+	return nil, fmt.Errorf("invalid MSSQL_CASSETTE_MODE %q (expected record or replay)", config.CassetteMode)
+}
+
+// cassetteKey identifies a query by its text, arguments and row limit.
+func cassetteKey(query string, args []byte, maxRows int) string {
+	return fmt.Sprintf("%s\x00%s\x00%d", query, args, maxRows)
+}
+
+// newCassetteEntry captures the outcome of a query. Continuation tokens are
+// not kept, since the held result set cannot be replayed.
+func newCassetteEntry(query string, args json.RawMessage, maxRows int, data map[string]interface{}, err error) *cassetteEntry {
+	entry := &cassetteEntry{Query: query, Args: args, MaxRows: maxRows}
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	if columns, ok := data["columns"].([]string); ok {
+		entry.Columns = columns
+		entry.ColumnTypes, _ = data["columnTypes"].([]columnInfo)
+		rows, _ := data["rows"].([]map[string]interface{})
+		entry.Rows = rowArrays(columns, rows)
+	}
+	if rowCount, ok := data["rowCount"].(int64); ok {
+		entry.RowCount = &rowCount
+		if columns, ok := data["outputColumns"].([]string); ok {
+			entry.OutputColumns = columns
+			rows, _ := data["outputRows"].([]map[string]interface{})
+			entry.OutputRows = rowArrays(columns, rows)
+		}
+	}
+	entry.Truncated = data["truncated"] == true
+	entry.EstimatedRows, _ = data["estimatedRows"].(int64)
+	entry.Warnings, _ = data["warnings"].([]string)
+	return entry
+}
+
+// result rebuilds the outcome of a recorded query.
+func (entry *cassetteEntry) result() (map[string]interface{}, error) {
+	if entry.Error != "" {
+		return nil, errors.New(entry.Error)
+	}
+
+	data := make(map[string]interface{})
+	if entry.Columns != nil {
+		data["columns"] = entry.Columns
+		data["columnTypes"] = entry.ColumnTypes
+		data["rows"] = rowMaps(entry.Columns, entry.Rows)
+	}
+	if entry.RowCount != nil {
+		data["rowCount"] = *entry.RowCount
+		if entry.OutputColumns != nil {
+			data["outputColumns"] = entry.OutputColumns
+			data["outputRows"] = rowMaps(entry.OutputColumns, entry.OutputRows)
+		}
+	}
+	if entry.Truncated {
+		data["truncated"] = true
+	}
+	if entry.EstimatedRows > 0 {
+		data["estimatedRows"] = entry.EstimatedRows
+	}
+	if len(entry.Warnings) > 0 {
+		data["warnings"] = entry.Warnings
+	}
+	return data, nil
+}
+
+// rowMaps converts value arrays back to rows keyed by column name.
+func rowMaps(columns []string, rows [][]interface{}) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(rows))
+	for i, values := range rows {
+		row := make(map[string]interface{}, len(columns))
+		for j, column := range columns {
+			if j < len(values) {
+				row[column] = values[j]
+			}
+		}
+		result[i] = row
+	}
+	return result
+}
+
+// recordEntry appends an entry to the cassette file.
+func recordEntry(config *DbConfig, entry *cassetteEntry) error {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+
+	file, err := os.OpenFile(config.CassetteFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(encoded, '\n'))
+	return err
+}
+
+// replayEntry returns the next recorded outcome of a query, loading the
+// cassette on first use.
+func replayEntry(config *DbConfig, key string) (*cassetteEntry, error) {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+
+	if cassetteEntries == nil {
+		entries, err := loadCassette(config.CassetteFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading cassette: %v", err)
+		}
+		cassetteEntries, cassettePosition = entries, make(map[string]int)
+	}
+
+	entries := cassetteEntries[key]
+	if len(entries) == 0 {
+		return nil, errors.New("query not found in cassette; record it first")
+	}
+	position := cassettePosition[key]
+	if position < len(entries)-1 {
+		cassettePosition[key] = position + 1
+	}
+	return entries[position], nil
+}
+
+// loadCassette reads a cassette file, grouping entries by query key in the
+// order they were recorded.
+func loadCassette(path string) (map[string][]*cassetteEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make(map[string][]*cassetteEntry)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		// Numbers stay exact rather than becoming float64
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.UseNumber()
+		var entry cassetteEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		key := cassetteKey(entry.Query, entry.Args, entry.MaxRows)
+		entries[key] = append(entries[key], &entry)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,105 @@
+package mssqlmcp
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// statementAccess is what a tool lets the statements it runs change.
+type statementAccess int
+
+const (
+	// readAccess permits reads only.
+	readAccess statementAccess = iota
+	// localWriteAccess also permits filling table variables and #temp
+	// tables, which leave the database untouched, as execute_sql does.
+	localWriteAccess
+	// writeAccess permits the writes execute_write allows: to tables
+	// matching MSSQL_WRITABLE_TABLES, and UPDATE and DELETE with a WHERE
+	// clause.
+	writeAccess
+	// procedureAccess permits calling the procedures procedureAllowed lets
+	// through, whatever they change.
+	procedureAccess
+)
+
+// errWriteDenied refuses a write through a tool that only reads.
+var errWriteDenied = errors.New("write operations are not permitted")
+
+// policyCheck is one of the configured checks a statement must pass.
+type policyCheck struct {
+	name  string
+	check func(*DbConfig, string) error
+}
+
+// checkStatement applies the checks every tool sending a user's SQL to the
+// server runs first: checkPolicies, then the tenant scope. It returns the
+// statement rewritten to the tenant's data, which is what must run.
+func checkStatement(config *DbConfig, access statementAccess, requestedTenant, query string) (string, error) {
+	if err := checkPolicies(config, access, query); err != nil {
+		return "", err
+	}
+
+	// On multi-tenant databases the statement only sees the tenant's rows
+	tenant, err := tenantScope(config, requestedTenant)
+	if err != nil {
+		return "", err
+	}
+	scoped, err := scopeQuery(config, tenant, query)
+	if err != nil {
+		log.Printf("Statement denied by tenant scope: %s", truncateString(query, 100))
+		return "", err
+	}
+	return scoped, nil
+}
+
+// checkPolicies applies, in this order, the read-only gate for the access
+// a tool has, the external data policy, MSSQL_QUERY_POLICY_FILE, the object
+// access lists and, for writes, MSSQL_WRITABLE_TABLES and the WHERE clause
+// requirement. Tools generating their own SQL check it with this and scope it
+// with rowFilterClause; user SQL goes through checkStatement. Refusals are
+// logged.
+func checkPolicies(config *DbConfig, access statementAccess, query string) error {
+	switch access {
+	case readAccess:
+		if isWriteOperation(query) {
+			log.Printf("Attempted write operation denied: %s", truncateString(query, 100))
+			return errWriteDenied
+		}
+	case localWriteAccess:
+		if local, _ := localWrites(query); isWriteOperation(query) && !local {
+			log.Printf("Attempted write operation denied: %s", truncateString(query, 100))
+			return errWriteDenied
+		}
+	}
+
+	checks := []policyCheck{
+		{"external data policy", checkExternalDataPolicy},
+		{"query policy", checkQueryPolicy},
+		{"object access policy", checkObjectAccess},
+	}
+	if access == writeAccess {
+		checks = append(checks,
+			policyCheck{"writable tables", checkWritableTables},
+			policyCheck{"write filter requirement", checkWriteFilters})
+	}
+	for _, c := range checks {
+		if err := c.check(config, query); err != nil {
+			log.Printf("Statement denied by %s: %s", c.name, truncateString(query, 100))
+			return err
+		}
+	}
+	return nil
+}
+
+// notPermitted reports a refusal of checkStatement as a tool error, e.g.
+// "Query not permitted: ..." for kind "Query".
+func notPermitted(kind string, err error) *mcp.CallToolResult {
+	if errors.Is(err, errWriteDenied) {
+		return mcp.NewToolResultError("Write operations (CREATE, ALTER, DROP, INSERT, UPDATE, DELETE, etc.) are not permitted for security reasons.")
+	}
+	return mcp.NewToolResultError(fmt.Sprintf("%s not permitted: %v", kind, err))
+}
@@ -0,0 +1,110 @@
+package mssqlmcp
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// paramFlags collects repeated --param name=value flags.
+type paramFlags map[string]interface{}
+
+func (p paramFlags) String() string {
+	return fmt.Sprintf("%v", map[string]interface{}(p))
+}
+
+// Set reads a value as JSON when it parses, so numbers and {value, type}
+// objects bind as they do from a tool call, and as a string otherwise.
+func (p paramFlags) Set(flagValue string) error {
+	name, text, ok := strings.Cut(flagValue, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %q", flagValue)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		value = text
+	}
+	p[strings.TrimPrefix(name, "@")] = value
+	return nil
+}
+
+// runQueryCommand implements "mssql_mcp_server_go query SQL": it calls the
+// execute_sql tool of the configured server in-process, so the query goes
+// through the same policy checks and formatting as from an MCP client, and
+// prints the result. It returns the process exit status.
+func runQueryCommand(s *server.MCPServer, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "", fmt.Sprintf("output format: %s (default from MSSQL_OUTPUT_FORMAT)", strings.Join(outputFormats(), ", ")))
+	queryFile := flags.String("file", "", "read the query from this file, inside MSSQL_QUERY_FILE_ROOT")
+	maxRows := flags.Int("max-rows", 0, "stop reading after this many rows (default from MSSQL_MAX_ROWS)")
+	tenant := flags.String("tenant", "", "tenant to query on a multi-tenant database")
+	params := paramFlags{}
+	flags.Var(params, "param", "bind a named parameter, e.g. --param customer=42; repeatable")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s query [flags] \"SELECT ...\"\n\nRuns one read-only query with the server's configuration and exits.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	// Flags may come before or after the query
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return 2
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(positional) > 1 || (len(positional) == 0) == (*queryFile == "") {
+		flags.Usage()
+		return 2
+	}
+
+	arguments := map[string]interface{}{}
+	if len(positional) == 1 {
+		arguments["query"] = positional[0]
+	} else {
+		arguments["query_file"] = *queryFile
+	}
+	if *format != "" {
+		arguments["format"] = *format
+	}
+	if *maxRows > 0 {
+		arguments["max_rows"] = *maxRows
+	}
+	if *tenant != "" {
+		arguments["tenant"] = *tenant
+	}
+	if len(params) > 0 {
+		arguments["params"] = map[string]interface{}(params)
+	}
+
+	result, err := CallTool(context.Background(), s, "execute_sql", arguments)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			output := stdout
+			if result.IsError {
+				output = stderr
+			}
+			fmt.Fprintln(output, strings.TrimRight(text.Text, "\n"))
+		}
+	}
+	if result.IsError {
+		return 1
+	}
+	return 0
+}
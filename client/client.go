@@ -0,0 +1,125 @@
+// Package client queries the configured SQL Server database from Go code
+// without speaking MCP over stdio. Calls run the server's tools in-process,
+// so they go through the same query policies and return the same formatted
+// results as calls from an MCP client.
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	mssqlmcp "mssql_mcp_server_go"
+)
+
+// The server is built from the MSSQL_* environment variables by the first
+// client created successfully and shared by all clients
+var (
+	sharedMu  sync.Mutex
+	sharedMCP *server.MCPServer
+)
+
+func sharedServer() (*server.MCPServer, error) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	if sharedMCP == nil {
+		s, err := mssqlmcp.NewServer()
+		if err != nil {
+			return nil, err
+		}
+		sharedMCP = s
+	}
+	return sharedMCP, nil
+}
+
+// Table names a base table.
+type Table = mssqlmcp.Table
+
+// Client calls the server's tools as one MCP client session: with sticky
+// sessions (MSSQL_STICKY_SESSIONS) it keeps a connection of its own, and
+// #temp tables and transactions are not shared with other clients.
+type Client struct {
+	server  *server.MCPServer
+	session *clientSession
+}
+
+// clientSession identifies a client to the server. Notifications are not
+// read, so the session never reports itself initialized for them.
+type clientSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *clientSession) Initialize()                                         {}
+func (s *clientSession) Initialized() bool                                   { return false }
+func (s *clientSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return s.notifications }
+func (s *clientSession) SessionID() string                                   { return s.id }
+
+// New creates a client with the tools the configuration enables. It fails
+// when the configuration is invalid.
+func New() (*Client, error) {
+	s, err := sharedServer()
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	session := &clientSession{id: "client-" + hex.EncodeToString(id), notifications: make(chan mcp.JSONRPCNotification, 1)}
+	if err := s.RegisterSession(context.Background(), session); err != nil {
+		return nil, err
+	}
+	return &Client{server: s, session: session}, nil
+}
+
+// Close ends the client's session, rolling back a transaction it left open
+// and releasing its sticky connection.
+func (c *Client) Close() error {
+	c.server.UnregisterSession(c.session.id)
+	mssqlmcp.CloseSession(c.session.id)
+	return nil
+}
+
+// ExecuteQuery runs a read-only query as the execute_sql tool does. Params
+// are bound to the @name parameters the query references, as with the
+// tool's params argument; the result is formatted per MSSQL_OUTPUT_FORMAT.
+func (c *Client) ExecuteQuery(ctx context.Context, query string, params map[string]interface{}) (string, error) {
+	arguments := map[string]interface{}{"query": query}
+	if len(params) > 0 {
+		arguments["params"] = params
+	}
+	return c.CallTool(ctx, "execute_sql", arguments)
+}
+
+// ListTables returns the base tables of the database.
+func (c *Client) ListTables(ctx context.Context) ([]Table, error) {
+	return mssqlmcp.ListTables()
+}
+
+// CallTool calls any tool by name with the arguments an MCP client would
+// pass, returning its text. A tool reporting an error returns it as error.
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	result, err := mssqlmcp.CallTool(c.server.WithContext(ctx, c.session), c.server, name, arguments)
+	if err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	for _, content := range result.Content {
+		if content, ok := content.(mcp.TextContent); ok {
+			text.WriteString(content.Text)
+		}
+	}
+	if result.IsError {
+		return "", errors.New(text.String())
+	}
+	return text.String(), nil
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// setConfiguration points the server at an address nothing listens on; the
+// tests only exercise what is decided before connecting. Credentials are
+// read again on every call, as the tests change them.
+func setConfiguration(t *testing.T) {
+	t.Setenv("MSSQL_SECRET_CACHE_SECONDS", "0")
+	t.Setenv("MSSQL_HOST", "127.0.0.1,1")
+	t.Setenv("MSSQL_USER", "reader")
+	t.Setenv("MSSQL_PASSWORD", "secret")
+	t.Setenv("MSSQL_DATABASE", "Sales")
+}
+
+func TestNewRequiresConfiguration(t *testing.T) {
+	t.Setenv("MSSQL_SECRET_CACHE_SECONDS", "0")
+	t.Setenv("MSSQL_USER", "")
+	t.Setenv("MSSQL_PASSWORD", "")
+	t.Setenv("MSSQL_DATABASE", "")
+
+	if c, err := New(); err == nil {
+		c.Close()
+		t.Fatal("New succeeded without database configuration")
+	}
+}
+
+func TestClientsHaveOwnSessions(t *testing.T) {
+	setConfiguration(t)
+
+	first, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	if first.session.SessionID() == second.session.SessionID() {
+		t.Errorf("both clients use session %s", first.session.SessionID())
+	}
+}
+
+func TestExecuteQueryRefusesWrites(t *testing.T) {
+	setConfiguration(t)
+
+	c, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.ExecuteQuery(context.Background(), "DELETE FROM dbo.Orders WHERE OrderID = @id", map[string]interface{}{"id": 1})
+	if err == nil || !strings.Contains(err.Error(), "not permitted") {
+		t.Errorf("ExecuteQuery(DELETE) = %v, want a refusal", err)
+	}
+}
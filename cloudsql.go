@@ -0,0 +1,83 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/cloudsqlconn"
+)
+
+// IP addresses of a Cloud SQL instance MSSQL_CLOUDSQL_IP_TYPE can select
+const (
+	cloudSQLPublicIP  = "public"
+	cloudSQLPrivateIP = "private"
+	cloudSQLPSC       = "psc"
+)
+
+var (
+	cloudSQLDialerMu sync.Mutex
+	// Shared by all connections, as it caches the instance's ephemeral
+	// certificates and refreshes them in the background
+	sharedCloudSQLDialer *cloudsqlconn.Dialer
+)
+
+// cloudSQLDialer connects the driver to a Cloud SQL for SQL Server instance
+// (MSSQL_CLOUDSQL_INSTANCE, "project:region:instance") through the Cloud SQL
+// Go connector. Connections are authorized with the IAM identity of
+// Application Default Credentials and encrypted with TLS by the connector, so
+// neither an authorized network nor an auth proxy sidecar is needed.
+type cloudSQLDialer struct {
+	dialer   *cloudsqlconn.Dialer
+	instance string
+	options  []cloudsqlconn.DialOption
+}
+
+// newCloudSQLDialer returns a dialer for the configured instance.
+func newCloudSQLDialer(config *DbConfig) (*cloudSQLDialer, error) {
+	var options []cloudsqlconn.DialOption
+	switch config.CloudSQLIPType {
+	case cloudSQLPublicIP:
+		options = append(options, cloudsqlconn.WithPublicIP())
+	case cloudSQLPrivateIP:
+		options = append(options, cloudsqlconn.WithPrivateIP())
+	case cloudSQLPSC:
+		options = append(options, cloudsqlconn.WithPSC())
+	}
+
+	cloudSQLDialerMu.Lock()
+	defer cloudSQLDialerMu.Unlock()
+
+	if sharedCloudSQLDialer == nil {
+		dialer, err := cloudsqlconn.NewDialer(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("creating Cloud SQL dialer: %v", err)
+		}
+		sharedCloudSQLDialer = dialer
+	}
+	return &cloudSQLDialer{dialer: sharedCloudSQLDialer, instance: config.CloudSQLInstance, options: options}, nil
+}
+
+// DialContext ignores the address from the connection string; the connector
+// looks up the instance's address itself.
+func (d *cloudSQLDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d.dialer.Dial(ctx, d.instance, d.options...)
+}
+
+// validateCloudSQLConfig checks the Cloud SQL settings.
+func validateCloudSQLConfig(config *DbConfig) error {
+	if config.CloudSQLInstance == "" {
+		return nil
+	}
+	// Projects scoped to a domain add a part: "example.com:project:region:instance"
+	if parts := strings.Split(config.CloudSQLInstance, ":"); len(parts) < 3 || len(parts) > 4 {
+		return fmt.Errorf("invalid MSSQL_CLOUDSQL_INSTANCE %q (expected project:region:instance)", config.CloudSQLInstance)
+	}
+	switch config.CloudSQLIPType {
+	case cloudSQLPublicIP, cloudSQLPrivateIP, cloudSQLPSC:
+		return nil
+	}
+	return fmt.Errorf("invalid MSSQL_CLOUDSQL_IP_TYPE %q (expected public, private or psc)", config.CloudSQLIPType)
+}
@@ -0,0 +1,9 @@
+// Command mssql_mcp_server_go serves a SQL Server database to MCP clients
+// over stdio, configured through MSSQL_* environment variables.
+package main
+
+import mssqlmcp "mssql_mcp_server_go"
+
+func main() {
+	mssqlmcp.Main()
+}
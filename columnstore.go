@@ -0,0 +1,214 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Compressed rowgroups hold up to this many rows; smaller ones were trimmed
+const COLUMNSTORE_ROWGROUP_ROWS = 1048576
+
+// registerColumnstoreTools adds a tool analysing columnstore indexes.
+func registerColumnstoreTools(s *server.MCPServer) {
+	columnstoreTool := mcp.NewTool("columnstore_health",
+		mcp.WithDescription("Analyze columnstore indexes: rowgroup states (open, closed, compressed), trimmed rowgroups and why, deleted-row percentages, and for one table how well each column's segments support segment elimination"),
+		mcp.WithString("table",
+			mcp.Description("Limit to one table, optionally schema-qualified; required for the segment elimination analysis"),
+		),
+	)
+
+	s.AddTool(columnstoreTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var schema, table string
+		if name, _ := request.Params.Arguments["table"].(string); name != "" {
+			var err error
+			schema, table, err = resolveObjectName(name)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+
+		result, err := describeColumnstores(schema, table)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error analyzing columnstore indexes: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+}
+
+// describeColumnstores renders rowgroup health per columnstore index and,
+// when a table is given, segment elimination potential per column.
+func describeColumnstores(schema, table string) (string, error) {
+	query := `SELECT OBJECT_SCHEMA_NAME(rg.object_id) + '.' + OBJECT_NAME(rg.object_id) AS table_name, i.name AS index_name, i.type_desc,
+			SUM(CASE WHEN rg.state_desc = 'COMPRESSED' THEN 1 ELSE 0 END) AS compressed,
+			SUM(CASE WHEN rg.state_desc = 'OPEN' THEN 1 ELSE 0 END) AS open_groups,
+			SUM(CASE WHEN rg.state_desc = 'CLOSED' THEN 1 ELSE 0 END) AS closed,
+			SUM(CASE WHEN rg.state_desc = 'TOMBSTONE' THEN 1 ELSE 0 END) AS tombstone,
+			SUM(CAST(rg.total_rows AS bigint)) AS total_rows,
+			SUM(CAST(rg.deleted_rows AS bigint)) AS deleted_rows,
+			AVG(CASE WHEN rg.state_desc = 'COMPRESSED' THEN CAST(rg.total_rows AS bigint) END) AS avg_compressed_rows
+		FROM sys.dm_db_column_store_row_group_physical_stats rg
+		JOIN sys.indexes i ON i.object_id = rg.object_id AND i.index_id = rg.index_id`
+	var args []interface{}
+	if table != "" {
+		query += " WHERE rg.object_id = OBJECT_ID(@p1)"
+		args = append(args, quoteIdentifier(schema)+"."+quoteIdentifier(table))
+	}
+	query += " GROUP BY rg.object_id, i.name, i.type_desc ORDER BY total_rows DESC"
+
+	groups, err := executeQuery(query, true, args...)
+	if err != nil {
+		return "", err
+	}
+	rows := groups["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		if table != "" {
+			return fmt.Sprintf("%s.%s has no columnstore index", schema, table), nil
+		}
+		return "No columnstore indexes found", nil
+	}
+
+	trimQuery := `SELECT OBJECT_SCHEMA_NAME(object_id) + '.' + OBJECT_NAME(object_id) AS table_name, trim_reason_desc, COUNT(*) AS rowgroups
+		FROM sys.dm_db_column_store_row_group_physical_stats
+		WHERE state_desc = 'COMPRESSED' AND total_rows < @p1 AND trim_reason_desc <> 'NO_TRIM'`
+	trimArgs := []interface{}{COLUMNSTORE_ROWGROUP_ROWS}
+	if table != "" {
+		trimQuery += " AND object_id = OBJECT_ID(@p2)"
+		trimArgs = append(trimArgs, args...)
+	}
+	trimQuery += " GROUP BY object_id, trim_reason_desc ORDER BY rowgroups DESC"
+	trims, err := executeQuery(trimQuery, true, trimArgs...)
+	if err != nil {
+		return "", err
+	}
+	trimReasons := make(map[string][]string)
+	for _, row := range trims["rows"].([]map[string]interface{}) {
+		name := fmt.Sprintf("%v", row["table_name"])
+		trimReasons[name] = append(trimReasons[name], fmt.Sprintf("%v: %v", row["trim_reason_desc"], row["rowgroups"]))
+	}
+
+	var result strings.Builder
+	result.WriteString("# Columnstore rowgroups\n\n")
+	for _, row := range rows {
+		total, _ := row["total_rows"].(int64)
+		deleted, _ := row["deleted_rows"].(int64)
+		result.WriteString(fmt.Sprintf("## %v.%v (%v)\n", row["table_name"], row["index_name"], row["type_desc"]))
+		result.WriteString(fmt.Sprintf("- Rowgroups: %v compressed, %v open, %v closed, %v tombstone\n", row["compressed"], row["open_groups"], row["closed"], row["tombstone"]))
+		result.WriteString(fmt.Sprintf("- Rows: %d, of which %d deleted", total, deleted))
+		if total > 0 {
+			result.WriteString(fmt.Sprintf(" (%.1f%%)", float64(deleted)*100/float64(total)))
+		}
+		result.WriteString("\n")
+		if average, ok := row["avg_compressed_rows"].(int64); ok {
+			result.WriteString(fmt.Sprintf("- Average compressed rowgroup: %d rows (maximum %d)\n", average, COLUMNSTORE_ROWGROUP_ROWS))
+		}
+		if reasons := trimReasons[fmt.Sprintf("%v", row["table_name"])]; len(reasons) > 0 {
+			result.WriteString("- Trimmed rowgroups by reason: " + strings.Join(reasons, ", ") + "\n")
+		}
+
+		var advice []string
+		if total > 0 && deleted*10 > total {
+			advice = append(advice, "over 10% of rows are deleted but still scanned; ALTER INDEX ... REORGANIZE removes them")
+		}
+		if open, _ := row["open_groups"].(int64); open > 0 {
+			advice = append(advice, "open (delta store) rowgroups are read row by row without compression")
+		}
+		if closed, _ := row["closed"].(int64); closed > 0 {
+			advice = append(advice, "closed rowgroups are waiting for the tuple mover; REORGANIZE compresses them now")
+		}
+		if len(advice) > 0 {
+			result.WriteString("- Attention: " + strings.Join(advice, "; ") + "\n")
+		}
+		result.WriteString("\n")
+	}
+
+	if table != "" {
+		elimination, err := describeSegmentElimination(schema, table)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(elimination)
+	}
+	return result.String(), nil
+}
+
+// columnSegment is the value range of one column in one rowgroup.
+type columnSegment struct {
+	min, max int64
+}
+
+// describeSegmentElimination estimates, per column, what fraction of
+// segments a filter on a single value must read. Segments whose ranges do not
+// overlap can be skipped, so a low fraction means good elimination; data
+// loaded in the order of the column typically achieves it.
+func describeSegmentElimination(schema, table string) (string, error) {
+	// String columns use dictionary ids that say nothing about value order
+	data, err := executeQuery(`SELECT c.name AS column_name, s.min_data_id, s.max_data_id
+		FROM sys.column_store_segments s
+		JOIN sys.partitions p ON p.hobt_id = s.hobt_id
+		JOIN sys.columns c ON c.object_id = p.object_id AND c.column_id = s.column_id
+		WHERE p.object_id = OBJECT_ID(@p1)
+			AND TYPE_NAME(c.system_type_id) NOT IN ('char', 'varchar', 'nchar', 'nvarchar', 'binary', 'varbinary', 'uniqueidentifier')
+		ORDER BY c.column_id`, true, quoteIdentifier(schema)+"."+quoteIdentifier(table))
+	if err != nil {
+		return "", err
+	}
+
+	var columns []string
+	segments := make(map[string][]columnSegment)
+	for _, row := range data["rows"].([]map[string]interface{}) {
+		column := fmt.Sprintf("%v", row["column_name"])
+		if _, ok := segments[column]; !ok {
+			columns = append(columns, column)
+		}
+		low, _ := row["min_data_id"].(int64)
+		high, _ := row["max_data_id"].(int64)
+		segments[column] = append(segments[column], columnSegment{low, high})
+	}
+
+	var result strings.Builder
+	result.WriteString("# Segment elimination\n\n")
+	if len(columns) == 0 {
+		result.WriteString("No numeric or date columns to analyze\n")
+		return result.String(), nil
+	}
+	result.WriteString("Share of segments a filter on one value has to read (lower is better):\n\n")
+	for _, column := range columns {
+		fraction := overlapFraction(segments[column])
+		verdict := "good"
+		switch {
+		case fraction > 0.5:
+			verdict = "poor: values are spread across rowgroups"
+		case fraction > 0.1:
+			verdict = "partial"
+		}
+		result.WriteString(fmt.Sprintf("- %s: %.0f%% of %d segments (%s)\n", column, fraction*100, len(segments[column]), verdict))
+	}
+	return result.String(), nil
+}
+
+// overlapFraction returns the average share of segments whose range contains
+// the minimum of a segment.
+func overlapFraction(segments []columnSegment) float64 {
+	if len(segments) <= 1 {
+		return 0
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].min < segments[j].min })
+	total := 0
+	for _, probe := range segments {
+		for _, segment := range segments {
+			if segment.min > probe.min {
+				break
+			}
+			if segment.max >= probe.min {
+				total++
+			}
+		}
+	}
+	return float64(total) / float64(len(segments)*len(segments))
+}
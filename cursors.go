@@ -0,0 +1,620 @@
+package mssqlmcp
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Maximum number of result sets held open for fetch_more at once; the least
+// recently used one is closed to make room
+const MAX_OPEN_CURSORS = 5
+
+// heldCursor is a partially read result set kept open on its own connection
+// so the rest can be fetched by later tool calls.
+type heldCursor struct {
+	mu        sync.Mutex
+	token     string
+	sessionID string
+	db        *sql.DB
+	rows      *sql.Rows
+	cancel    context.CancelFunc
+	columns   []string
+	types     []columnInfo
+	pending   map[string]interface{} // row read ahead to detect the end
+	last      map[string]interface{} // last row returned, unmasked
+	masked    []int                  // positions of masked columns
+	query     string
+	args      []interface{}
+	fetched   int64
+	estimated int64
+	lastUsed  time.Time
+	timer     *time.Timer
+	closed    bool
+}
+
+var (
+	cursorsMu sync.Mutex
+	cursors   = make(map[string]*heldCursor)
+)
+
+// runPagedQuery executes a query on its own connection and returns its first
+// maxRows rows. When more remain, the result set is held open and the data
+// carries a continuation token for fetch_more; otherwise the connection is
+// closed.
+func runPagedQuery(ctx context.Context, config *DbConfig, query string, maxRows int, args ...interface{}) (map[string]interface{}, error) {
+	db, err := getConnection(config)
+	if err != nil {
+		return nil, fmt.Errorf("database connection error: %v", err)
+	}
+
+	// The result set must outlive this call, so it gets its own context;
+	// the query timeout only applies while a page is being read
+	queryCtx, cancel := context.WithCancel(context.Background())
+	timer := time.AfterFunc(time.Duration(config.QueryTimeout)*time.Second, cancel)
+
+	start := time.Now()
+	sources, err := maskingSources(queryCtx, db, config, query, args...)
+	var rows *sql.Rows
+	if err == nil {
+		rows, err = db.QueryContext(queryCtx, tagQuery(queryCtx, config, query), args...)
+	}
+	if err != nil {
+		timer.Stop()
+		cancel()
+		db.Close()
+		return nil, err
+	}
+
+	cursor := &heldCursor{
+		sessionID: sessionIDFromContext(ctx),
+		db:        db,
+		rows:      rows,
+		cancel:    cancel,
+		query:     query,
+		args:      args,
+	}
+	cursor.columns, err = rows.Columns()
+	if err == nil {
+		cursor.types, err = describeColumns(rows)
+		cursor.masked = maskedColumnIndexes(config, query, cursor.columns, sources)
+	}
+	if err == nil {
+		var page []map[string]interface{}
+		page, err = cursor.readPage(config, maxRows)
+		if err == nil {
+			timer.Stop()
+			recordThroughput(len(page), time.Since(start))
+			return cursor.finishPage(config, page, query, args...)
+		}
+	}
+
+	timer.Stop()
+	cursor.close()
+	return nil, err
+}
+
+// readPage reads up to maxRows rows plus one more, which is kept back so the
+// cursor knows whether anything is left. The rows are masked by finishPage.
+// The caller must hold cursor.mu or own the cursor exclusively.
+func (cursor *heldCursor) readPage(config *DbConfig, maxRows int) ([]map[string]interface{}, error) {
+	var page []map[string]interface{}
+	pending := cursor.pending
+	if pending != nil {
+		page = append(page, pending)
+		cursor.pending = nil
+	}
+
+	_, rows, _, err := scanRows(cursor.rows, config, maxRows+1-len(page), true)
+	if err != nil {
+		// A page that failed can be read again after a reconnect
+		cursor.pending = pending
+		return nil, err
+	}
+	page = append(page, rows...)
+
+	if len(page) > maxRows {
+		cursor.pending = page[maxRows]
+		page = page[:maxRows]
+	}
+	return page, nil
+}
+
+// finishPage builds the result of a page, registering the cursor when rows
+// remain and closing it otherwise.
+func (cursor *heldCursor) finishPage(config *DbConfig, page []map[string]interface{}, query string, args ...interface{}) (map[string]interface{}, error) {
+	firstRow := cursor.fetched + 1
+	cursor.fetched += int64(len(page))
+	if len(page) > 0 {
+		// The keyset predicate resuming after the last row compares its
+		// real values, which stay on the server
+		last := page[len(page)-1]
+		cursor.last = make(map[string]interface{}, len(last))
+		for column, value := range last {
+			cursor.last[column] = value
+		}
+	}
+	maskRows(page, cursor.columns, cursor.masked)
+
+	data := map[string]interface{}{
+		"columns":     cursor.columns,
+		"columnTypes": cursor.types,
+		"rows":        page,
+		"firstRow":    firstRow,
+	}
+	if warning := duplicateRowsWarning(config, cursor.columns, page); warning != "" {
+		data["warnings"] = []string{warning}
+	}
+
+	if cursor.pending == nil {
+		cursor.close()
+		return data, nil
+	}
+
+	cursor.lastUsed = time.Now()
+
+	// The first page estimates the size of the whole result
+	if cursor.token == "" {
+		if estimate, err := estimateQuery(query, args...); err == nil && int64(estimate.Rows) > cursor.fetched {
+			cursor.estimated = int64(estimate.Rows)
+		}
+		if err := registerCursor(cursor, config); err != nil {
+			cursor.close()
+			return nil, err
+		}
+	}
+
+	data["truncated"] = true
+	data["continuationToken"] = cursor.token
+	if cursor.estimated > cursor.fetched {
+		data["estimatedRows"] = cursor.estimated
+	}
+	return data, nil
+}
+
+// registerCursor assigns the cursor a token and arms its idle expiry,
+// closing the least recently used cursor when too many are open.
+func registerCursor(cursor *heldCursor, config *DbConfig) error {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	cursor.token = hex.EncodeToString(token)
+
+	timeout := time.Duration(config.SessionIdleTimeout) * time.Second
+	cursor.timer = time.AfterFunc(timeout, func() { expireCursor(cursor, timeout) })
+
+	cursorsMu.Lock()
+	var oldest *heldCursor
+	if len(cursors) >= MAX_OPEN_CURSORS {
+		for _, held := range cursors {
+			if oldest == nil || held.lastUsed.Before(oldest.lastUsed) {
+				oldest = held
+			}
+		}
+	}
+	cursors[cursor.token] = cursor
+	cursorsMu.Unlock()
+
+	if oldest != nil {
+		log.Printf("Closing cursor %s to stay within %d open cursors", oldest.token, MAX_OPEN_CURSORS)
+		releaseCursor(oldest)
+	}
+	return nil
+}
+
+// expireCursor closes a cursor that has not been fetched from for the timeout.
+func expireCursor(cursor *heldCursor, timeout time.Duration) {
+	cursor.mu.Lock()
+	idle := time.Since(cursor.lastUsed) >= timeout
+	cursor.mu.Unlock()
+
+	if idle {
+		releaseCursor(cursor)
+	}
+}
+
+// releaseCursor unregisters a cursor and closes it.
+func releaseCursor(cursor *heldCursor) {
+	cursorsMu.Lock()
+	if cursors[cursor.token] == cursor {
+		delete(cursors, cursor.token)
+	}
+	cursorsMu.Unlock()
+
+	cursor.mu.Lock()
+	defer cursor.mu.Unlock()
+	cursor.close()
+}
+
+// close stops the query and releases its connection. The caller must hold
+// cursor.mu or own the cursor exclusively.
+func (cursor *heldCursor) close() {
+	if cursor.closed {
+		return
+	}
+	cursor.closed = true
+	if cursor.timer != nil {
+		cursor.timer.Stop()
+	}
+
+	// Cancelling first keeps Close from reading the unread rows
+	cursor.cancel()
+	cursor.rows.Close()
+	cursor.db.Close()
+}
+
+// fetchMore reads the next page of a held cursor.
+func fetchMore(ctx context.Context, token string, maxRows int) (map[string]interface{}, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cursorsMu.Lock()
+	cursor, ok := cursors[token]
+	cursorsMu.Unlock()
+	if !ok || cursor.sessionID != sessionIDFromContext(ctx) {
+		return nil, errors.New("unknown or expired continuation token; run the query again")
+	}
+
+	cursor.mu.Lock()
+	if cursor.closed {
+		cursor.mu.Unlock()
+		return nil, errors.New("unknown or expired continuation token; run the query again")
+	}
+	cursor.lastUsed = time.Now()
+	cursor.timer.Reset(time.Duration(config.SessionIdleTimeout) * time.Second)
+
+	timer := time.AfterFunc(time.Duration(config.QueryTimeout)*time.Second, func() { cursor.cancel() })
+	page, err := cursor.readPage(config, maxRows)
+	var resumeNote string
+	if err != nil && isConnectionLost(err) && cursor.resumable() {
+		log.Printf("Cursor %s lost its connection, resuming after row %d: %v", cursor.token, cursor.fetched, err)
+		if err = cursor.reopen(config); err == nil {
+			page, err = cursor.readPage(config, maxRows)
+			resumeNote = fmt.Sprintf("The connection dropped between pages; the query was run again and resumed after row %d.", cursor.fetched)
+		}
+	}
+	timer.Stop()
+	if err != nil {
+		cursor.mu.Unlock()
+		releaseCursor(cursor)
+		return nil, err
+	}
+
+	data, err := cursor.finishPage(config, page, "")
+	if err == nil && resumeNote != "" {
+		warnings, _ := data["warnings"].([]string)
+		data["warnings"] = append([]string{resumeNote}, warnings...)
+	}
+	done := cursor.closed
+	cursor.mu.Unlock()
+
+	if done {
+		cursorsMu.Lock()
+		delete(cursors, token)
+		cursorsMu.Unlock()
+	}
+	return data, err
+}
+
+// isConnectionLost reports whether an error means the connection broke, as
+// opposed to the server rejecting the query or the read timing out.
+func isConnectionLost(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// orderKey is a result column the query is ordered by.
+type orderKey struct {
+	column     int
+	descending bool
+	qualified  string // column name the ORDER BY item qualified, if any
+}
+
+// Types whose values come back from convertValue exactly as the server
+// compares them, so they can be bound again in a keyset predicate
+var keysetTypes = map[string]bool{
+	"tinyint": true, "smallint": true, "int": true, "bigint": true, "decimal": true, "numeric": true,
+	"char": true, "varchar": true, "nchar": true, "nvarchar": true, "uniqueidentifier": true, "date": true,
+}
+
+// orderKeys reads the ORDER BY of a single SELECT whose items are all plain
+// result columns that are never NULL and of a type in
+// keysetTypes, as a keyset resume needs. It reports false for anything
+// else, including TOP, OFFSET, FOR and OPTION clauses, whose results change
+// when the query is wrapped.
+func (cursor *heldCursor) orderKeys() ([]orderKey, int, bool) {
+	tokens := significantTokens(tokenizeSQL(cursor.query))
+	for len(tokens) > 0 && tokens[len(tokens)-1].Text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 || !tokens[0].isKeyword("SELECT") ||
+		findTopLevelKeyword(tokens, 0, "TOP", "OFFSET", "FOR", "OPTION", "INTO") >= 0 {
+		return nil, 0, false
+	}
+	for _, t := range tokens {
+		if t.Text == ";" && t.Depth == 0 {
+			return nil, 0, false
+		}
+	}
+	order := findTopLevelKeyword(tokens, 0, "ORDER")
+	if order < 0 || order+1 >= len(tokens) || !tokens[order+1].isKeyword("BY") {
+		return nil, 0, false
+	}
+
+	var keys []orderKey
+	for i := order + 2; i < len(tokens); i++ {
+		var parts []string
+		for i < len(tokens) && isNameToken(tokens[i]) {
+			parts = append(parts, unquoteIdentifier(tokens[i].Text))
+			if i+1 < len(tokens) && tokens[i+1].Text == "." {
+				i += 2
+				continue
+			}
+			i++
+			break
+		}
+		if len(parts) == 0 {
+			return nil, 0, false
+		}
+		key := orderKey{column: -1}
+		if i < len(tokens) && (tokens[i].isKeyword("ASC") || tokens[i].isKeyword("DESC")) {
+			key.descending = tokens[i].isKeyword("DESC")
+			i++
+		}
+		if i < len(tokens) && tokens[i].Text != "," {
+			return nil, 0, false
+		}
+
+		name := parts[len(parts)-1]
+		if len(parts) > 1 {
+			key.qualified = name
+		}
+		for j, column := range cursor.columns {
+			if strings.EqualFold(column, name) {
+				if key.column >= 0 {
+					return nil, 0, false
+				}
+				key.column = j
+			}
+		}
+		if key.column < 0 || cursor.types[key.column].Nullable == nil || *cursor.types[key.column].Nullable {
+			return nil, 0, false
+		}
+		typeName, _, _ := strings.Cut(cursor.types[key.column].Type, "(")
+		if !keysetTypes[typeName] || strings.HasSuffix(cursor.types[key.column].Type, "(max)") {
+			return nil, 0, false
+		}
+		keys = append(keys, key)
+	}
+	return keys, tokens[order].Pos, true
+}
+
+// resumable reports whether the cursor's query could resume after its last
+// row with a keyset predicate on its ORDER BY columns. Whether that
+// ordering is unique is only known once the server is asked, in reopen.
+func (cursor *heldCursor) resumable() bool {
+	_, _, ok := cursor.orderKeys()
+	return ok && cursor.last != nil
+}
+
+// uniqueOrdering asks the server whether the ORDER BY columns cover the
+// unique keys of every table the query reads, which makes each row's
+// position in the order unique. Browse information lists those keys, as
+// hidden columns when the query does not select them.
+func uniqueOrdering(ctx context.Context, db queryer, query string, args []interface{}, keys []orderKey) (bool, error) {
+	declarations, err := argumentDeclarations(args)
+	if err != nil {
+		return false, err
+	}
+	var params interface{}
+	if declarations != "" {
+		params = declarations
+	}
+	rows, err := db.QueryContext(ctx, `SELECT column_ordinal, is_hidden, ISNULL(is_part_of_unique_key, 0), ISNULL(source_column, N'')
+		FROM sys.dm_exec_describe_first_result_set(@p1, @p2, 1)`, query, params)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	ordered := make(map[int]orderKey, len(keys))
+	for _, key := range keys {
+		ordered[key.column+1] = key
+	}
+	keyColumns := 0
+	for rows.Next() {
+		var ordinal int
+		var hidden, unique bool
+		var source string
+		if err := rows.Scan(&ordinal, &hidden, &unique, &source); err != nil {
+			return false, err
+		}
+		key, isOrdered := ordered[ordinal]
+		// t.column must name the column itself, not a result alias
+		if isOrdered && !hidden && key.qualified != "" && !strings.EqualFold(key.qualified, source) {
+			return false, rows.Err()
+		}
+		if !unique {
+			continue
+		}
+		if hidden || !isOrdered {
+			return false, rows.Err()
+		}
+		keyColumns++
+	}
+	return keyColumns > 0, rows.Err()
+}
+
+// reopen runs the cursor's query again on a new connection, limited to the
+// rows after the last row returned by a keyset predicate on its ORDER BY
+// columns, so the result continues where the lost connection left off even
+// if rows were added or removed before that point. It refuses orderings
+// the server does not confirm to be unique, as rows sharing the last row's
+// keys would be skipped or repeated. The caller must hold cursor.mu.
+func (cursor *heldCursor) reopen(config *DbConfig) error {
+	cursor.cancel()
+	cursor.rows.Close()
+	cursor.db.Close()
+
+	keys, orderPos, ok := cursor.orderKeys()
+	if !ok || cursor.last == nil {
+		return errors.New("the query cannot be resumed; run the query again")
+	}
+
+	db, err := getConnection(config)
+	if err != nil {
+		return fmt.Errorf("database connection error: %v", err)
+	}
+	queryCtx, cancel := context.WithCancel(context.Background())
+	unique, err := uniqueOrdering(queryCtx, db, cursor.query, cursor.args, keys)
+	if err == nil && !unique {
+		err = errors.New("its ORDER BY does not identify rows uniquely, so the rows already read cannot be told apart; run the query again, ordered by a unique key to make it resumable")
+	}
+	if err != nil {
+		cancel()
+		db.Close()
+		return fmt.Errorf("resuming the query: %v", err)
+	}
+
+	// (k1 > @v1) OR (k1 = @v1 AND k2 > @v2) ..., with < for descending keys
+	args := append([]interface{}{}, cursor.args...)
+	var alternatives, ordering []string
+	for i, key := range keys {
+		name := quoteIdentifier(cursor.columns[key.column])
+		value := cursor.last[cursor.columns[key.column]]
+		if value == nil {
+			cancel()
+			db.Close()
+			return errors.New("the last row read has no value for the ORDER BY column " + cursor.columns[key.column] + "; run the query again")
+		}
+		if typeName, _, _ := strings.Cut(cursor.types[key.column].Type, "("); typeName == "char" || typeName == "varchar" {
+			value = mssql.VarChar(fmt.Sprint(value))
+		}
+		parameter := fmt.Sprintf("_resume_%d", i+1)
+		args = append(args, sql.Named(parameter, value))
+
+		var terms []string
+		for j, previous := range keys[:i] {
+			terms = append(terms, fmt.Sprintf("%s = @_resume_%d", quoteIdentifier(cursor.columns[previous.column]), j+1))
+		}
+		comparison, direction := ">", "ASC"
+		if key.descending {
+			comparison, direction = "<", "DESC"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s @%s", name, comparison, parameter))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+		ordering = append(ordering, name+" "+direction)
+	}
+	resumed := fmt.Sprintf("SELECT * FROM (%s) AS resumed WHERE %s ORDER BY %s",
+		strings.TrimSpace(cursor.query[:orderPos]), strings.Join(alternatives, " OR "), strings.Join(ordering, ", "))
+
+	rows, err := db.QueryContext(queryCtx, tagQuery(queryCtx, config, resumed), args...)
+	if err != nil {
+		cancel()
+		db.Close()
+		return err
+	}
+	cursor.db, cursor.rows, cursor.cancel = db, rows, cancel
+	// The row read ahead comes again after the last row returned
+	cursor.pending = nil
+	return nil
+}
+
+// registerCursorTools adds the tools paging through held result sets.
+func registerCursorTools(s *server.MCPServer) {
+	fetchTool := mcp.NewTool("fetch_more",
+		mcp.WithDescription("Fetch the next rows of a truncated execute_sql result using its continuation token. The result stays open on the server until all rows are read, close is set, or it has been idle for a while. If the connection drops between pages of a query ordered by a unique key (such as the primary key), the query is run again from after the last row returned."),
+		mcp.WithString("continuation_token",
+			mcp.Required(),
+			mcp.Description("Token returned with the truncated result"),
+		),
+		mcp.WithNumber("max_rows",
+			mcp.Description("Number of rows to fetch (default from MSSQL_MAX_ROWS, 1000)"),
+		),
+		mcp.WithBoolean("close",
+			mcp.Description("Discard the remaining rows instead of fetching them"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: text (default), tsv, vertical, markdown or json"),
+			mcp.Enum(outputFormats()...),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent xml values and values holding JSON objects or arrays (default from MSSQL_PRETTY_PRINT)"),
+		),
+	)
+
+	s.AddTool(fetchTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		token, ok := request.Params.Arguments["continuation_token"].(string)
+		if !ok || token == "" {
+			return mcp.NewToolResultError("Continuation token is required"), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+
+		if closeCursor, _ := request.Params.Arguments["close"].(bool); closeCursor {
+			cursorsMu.Lock()
+			cursor, ok := cursors[token]
+			cursorsMu.Unlock()
+			if ok && cursor.sessionID == sessionIDFromContext(ctx) {
+				releaseCursor(cursor)
+			}
+			return mcp.NewToolResultText("Result closed"), nil
+		}
+
+		format, _ := request.Params.Arguments["format"].(string)
+		if format == "" {
+			format = config.OutputFormat
+		}
+		if !isOutputFormat(format) {
+			return mcp.NewToolResultError(fmt.Sprintf("Unknown output format: %s", format)), nil
+		}
+
+		maxRows := config.MaxRows
+		if value, ok := request.Params.Arguments["max_rows"].(float64); ok && value > 0 {
+			maxRows = int(value)
+		}
+		if maxRows <= 0 {
+			maxRows = DEFAULT_MAX_ROWS
+		}
+
+		start := time.Now()
+		data, err := fetchMore(ctx, token, maxRows)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error fetching rows: %v", err)), nil
+		}
+		addExecutionSummary(config, data, time.Since(start))
+		if prettyPrintRequested(config, request.Params.Arguments) {
+			data = prettyPrintValues(data)
+		}
+
+		result, err := formatResultsAs(data, format)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error formatting results: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+}
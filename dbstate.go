@@ -0,0 +1,86 @@
+package mssqlmcp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+// databaseStateMessages explain the database states in which it cannot be
+// opened.
+var databaseStateMessages = map[string]string{
+	"RESTORING":         "is being restored and cannot be queried until the restore completes",
+	"RECOVERING":        "is running crash recovery and will be available when recovery completes",
+	"RECOVERY_PENDING":  "could not start recovery, usually because a data or log file is missing or inaccessible; an administrator must intervene",
+	"SUSPECT":           "is marked SUSPECT because recovery failed, possibly due to corruption; an administrator must intervene",
+	"EMERGENCY":         "is in EMERGENCY mode for repair and is only open to administrators",
+	"OFFLINE":           "has been taken OFFLINE",
+	"OFFLINE_SECONDARY": "is an availability group secondary that is not readable",
+}
+
+// explainConnectionError turns a server's refusal to open the database into
+// a description of why, when the database is not ONLINE. The state is read
+// from master, which stays reachable while a user database is unavailable.
+// Other errors are returned unchanged.
+func explainConnectionError(config *DbConfig, database string, cause error) error {
+	var sqlErr mssql.Error
+	if !errors.As(cause, &sqlErr) || strings.EqualFold(database, "master") {
+		return cause
+	}
+
+	master, err := openDatabase(config, "master")
+	if err != nil {
+		return cause
+	}
+	defer master.Close()
+
+	data, err := runQuery(master, config, `SELECT state_desc, user_access_desc
+		FROM sys.databases
+		WHERE name = @p1`, true, database)
+	if err != nil {
+		return cause
+	}
+	rows := data["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		return fmt.Errorf("database %s does not exist on %s or is not visible to this login (%v)", database, config.Server, cause)
+	}
+
+	state := fmt.Sprintf("%v", rows[0]["state_desc"])
+	if state == "ONLINE" {
+		if rows[0]["user_access_desc"] == "SINGLE_USER" {
+			return fmt.Errorf("database %s is in SINGLE_USER mode and another connection holds it (%v)", database, cause)
+		}
+		return cause
+	}
+
+	message, ok := databaseStateMessages[state]
+	if !ok {
+		message = "is not online"
+	}
+	status := fmt.Sprintf("database %s is %s: it %s", database, state, message)
+
+	switch state {
+	case "RESTORING":
+		progress, err := runQuery(master, config, `SELECT TOP (1) CAST(percent_complete AS decimal(5,1)) AS percent_complete,
+				estimated_completion_time / 1000 AS seconds_remaining
+			FROM sys.dm_exec_requests
+			WHERE command LIKE 'RESTORE%' AND database_id = DB_ID(@p1)`, true, database)
+		if err == nil {
+			if rows := progress["rows"].([]map[string]interface{}); len(rows) > 0 {
+				status += fmt.Sprintf(". The restore is %v%% complete, about %v seconds remain", rows[0]["percent_complete"], rows[0]["seconds_remaining"])
+			}
+		}
+	case "RECOVERING":
+		// Recovery reports its progress to the error log, e.g. "Recovery of
+		// database 'Sales' (5) is 43% complete (approximately 120 seconds remain)"
+		log, err := runQuery(master, config, `EXEC sys.xp_readerrorlog 0, 1, N'Recovery of database', @p1`, true, "'"+database+"'")
+		if err == nil {
+			if rows := log["rows"].([]map[string]interface{}); len(rows) > 0 {
+				status += fmt.Sprintf(". Latest progress: %v", rows[len(rows)-1]["Text"])
+			}
+		}
+	}
+	return errors.New(status)
+}
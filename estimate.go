@@ -0,0 +1,211 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Number of recent queries the throughput average is computed over
+const throughputWindow = 20
+
+// queryEstimate is the optimizer's view of a query before it runs.
+type queryEstimate struct {
+	Rows     float64
+	Bytes    float64
+	Cost     float64
+	Duration time.Duration // zero when no throughput has been observed yet
+}
+
+type throughputSample struct {
+	rows    int
+	elapsed time.Duration
+}
+
+var (
+	throughputMu      sync.Mutex
+	throughputSamples []throughputSample
+)
+
+// recordThroughput remembers how fast rows were fetched so that durations of
+// future exports can be projected.
+func recordThroughput(rows int, elapsed time.Duration) {
+	// Tiny results are dominated by latency and say little about throughput
+	if rows < 100 || elapsed <= 0 {
+		return
+	}
+
+	throughputMu.Lock()
+	defer throughputMu.Unlock()
+
+	throughputSamples = append(throughputSamples, throughputSample{rows, elapsed})
+	if len(throughputSamples) > throughputWindow {
+		throughputSamples = throughputSamples[len(throughputSamples)-throughputWindow:]
+	}
+}
+
+// rowsPerSecond is the fetch rate over recent queries, or 0 if unknown.
+func rowsPerSecond() float64 {
+	throughputMu.Lock()
+	defer throughputMu.Unlock()
+
+	var rows int
+	var elapsed time.Duration
+	for _, sample := range throughputSamples {
+		rows += sample.rows
+		elapsed += sample.elapsed
+	}
+	if elapsed == 0 {
+		return 0
+	}
+	return float64(rows) / elapsed.Seconds()
+}
+
+var (
+	statementEstimatePattern = regexp.MustCompile(`<StmtSimple [^>]*StatementEstRows="([^"]+)"[^>]*StatementSubTreeCost="([^"]+)"`)
+	rootOperatorPattern      = regexp.MustCompile(`<RelOp [^>]*AvgRowSize="([^"]+)"`)
+)
+
+// estimateQuery asks the optimizer for the estimated plan of a query without
+// running it, and projects its duration from recent throughput.
+func estimateQuery(query string, args ...interface{}) (*queryEstimate, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := getConnection(config)
+	if err != nil {
+		return nil, fmt.Errorf("database connection error: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.QueryTimeout)*time.Second)
+	defer cancel()
+
+	// SHOWPLAN is a session setting, so all three steps need the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SET SHOWPLAN_XML ON"); err != nil {
+		return nil, err
+	}
+	defer conn.ExecContext(context.Background(), "SET SHOWPLAN_XML OFF")
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plans []string
+	for rows.Next() {
+		var plan string
+		if err := rows.Scan(&plan); err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	estimate := &queryEstimate{}
+	for _, plan := range plans {
+		statement := statementEstimatePattern.FindStringSubmatch(plan)
+		if statement == nil {
+			continue
+		}
+		estimatedRows, _ := strconv.ParseFloat(statement[1], 64)
+		cost, _ := strconv.ParseFloat(statement[2], 64)
+		estimate.Rows += estimatedRows
+		estimate.Cost += cost
+
+		if operator := rootOperatorPattern.FindStringSubmatch(plan); operator != nil {
+			rowSize, _ := strconv.ParseFloat(operator[1], 64)
+			estimate.Bytes += estimatedRows * rowSize
+		}
+	}
+
+	if rate := rowsPerSecond(); rate > 0 {
+		estimate.Duration = time.Duration(estimate.Rows / rate * float64(time.Second))
+	}
+	return estimate, nil
+}
+
+// String renders the estimate in natural units.
+func (e *queryEstimate) String() string {
+	duration := "unknown (no throughput observed yet)"
+	if e.Duration > 0 {
+		duration = "~" + e.Duration.Round(time.Second).String()
+		if e.Duration < time.Second {
+			duration = "under a second"
+		}
+	}
+	return fmt.Sprintf("Estimated rows: ~%.0f\nEstimated size: ~%s\nProjected duration: %s\nOptimizer cost: %.2f",
+		e.Rows, formatBytes(e.Bytes), duration, e.Cost)
+}
+
+// requireExportConfirmation refuses exports estimated above the configured
+// thresholds unless the caller explicitly confirmed them.
+func requireExportConfirmation(config *DbConfig, estimate *queryEstimate, confirmed bool) error {
+	if confirmed {
+		return nil
+	}
+	if estimate.Rows > float64(config.ExportConfirmRows) || estimate.Bytes > float64(config.ExportConfirmBytes) {
+		return fmt.Errorf("this export is large and needs confirmation; repeat the call with confirm=true to proceed.\n%s", estimate)
+	}
+	return nil
+}
+
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
+
+// registerEstimateTool adds a tool reporting the expected size and duration
+// of a query without running it.
+func registerEstimateTool(s *server.MCPServer) {
+	estimateTool := mcp.NewTool("estimate_query",
+		mcp.WithDescription("Estimate the rows, size and duration of a query from its estimated execution plan, without running it. Use before exporting or fetching large results."),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("The SQL query to estimate"),
+		),
+	)
+
+	s.AddTool(estimateTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query, ok := request.Params.Arguments["query"].(string)
+		if !ok || query == "" {
+			return mcp.NewToolResultError("Query is required"), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		if err := checkPolicies(config, readAccess, query); err != nil {
+			return notPermitted("Query", err), nil
+		}
+
+		estimate, err := estimateQuery(query)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error estimating query: %v", err)), nil
+		}
+		return mcp.NewToolResultText(estimate.String()), nil
+	})
+}
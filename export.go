@@ -0,0 +1,229 @@
+package mssqlmcp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// resolveExportPath maps a requested file path to one inside
+// MSSQL_EXPORT_ROOT. Relative paths are taken from that root; the directory
+// must exist and existing files are only replaced when overwrite is set.
+func resolveExportPath(config *DbConfig, requested, extension string, overwrite bool) (string, error) {
+	if config.ExportRoot == "" {
+		return "", errors.New("exporting to files is disabled (set MSSQL_EXPORT_ROOT to enable it)")
+	}
+	if !strings.EqualFold(filepath.Ext(requested), extension) {
+		return "", fmt.Errorf("%s does not end in %s", requested, extension)
+	}
+
+	root, err := filepath.EvalSymlinks(config.ExportRoot)
+	if err != nil {
+		return "", err
+	}
+	path := requested
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	// The file itself may not exist yet, so only its directory is resolved
+	directory, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	path = filepath.Join(directory, filepath.Base(path))
+
+	relative, err := filepath.Rel(root, path)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the export root", requested)
+	}
+
+	info, err := os.Lstat(path)
+	switch {
+	case err == nil && !info.Mode().IsRegular():
+		return "", fmt.Errorf("%s exists and is not a regular file", requested)
+	case err == nil && !overwrite:
+		return "", fmt.Errorf("%s already exists; repeat the call with overwrite=true to replace it", requested)
+	case err != nil && !os.IsNotExist(err):
+		return "", err
+	}
+	return path, nil
+}
+
+// registerExportTools adds tools saving query results as files under
+// MSSQL_EXPORT_ROOT.
+func registerExportTools(s *server.MCPServer) {
+	xlsxTool := mcp.NewTool("export_query_to_xlsx",
+		append([]mcp.ToolOption{
+			mcp.WithDescription("Run a read-only query and save all of its rows as an .xlsx spreadsheet with a header row. Numbers, booleans and dates are stored as typed cells. The file must be inside the directory configured by MSSQL_EXPORT_ROOT; large exports need confirm=true."),
+		}, exportToolOptions(".xlsx")...)...,
+	)
+	s.AddTool(xlsxTool, exportQueryHandler(".xlsx", streamXLSX))
+
+	parquetTool := mcp.NewTool("export_query_to_parquet",
+		append([]mcp.ToolOption{
+			mcp.WithDescription("Run a read-only query and save all of its rows as a Parquet file for data-science tools such as pandas, Spark or DuckDB. Columns keep their SQL Server types: integers, exact decimals, dates, times and timestamps are typed, binary data is stored whole as bytes, and other values are stored as strings. Rows are written as they arrive, a row group at a time. The file must be inside the directory configured by MSSQL_EXPORT_ROOT; large exports need confirm=true."),
+		}, exportToolOptions(".parquet")...)...,
+	)
+	s.AddTool(parquetTool, exportQueryHandler(".parquet", streamParquet))
+
+	ndjsonTool := mcp.NewTool("export_query_to_ndjson",
+		append([]mcp.ToolOption{
+			mcp.WithDescription("Run a read-only query and stream its rows to a JSON Lines file, one JSON object per row, as they arrive from the server. The result is never held in memory, so this suits extracts of millions of rows. The file must be inside the directory configured by MSSQL_EXPORT_ROOT; large exports need confirm=true."),
+		}, exportToolOptions(".ndjson")...)...,
+	)
+	s.AddTool(ndjsonTool, exportQueryHandler(".ndjson", streamNDJSON))
+}
+
+// exportFunc runs an export query and writes its result to path, returning
+// the number of rows and columns written.
+type exportFunc func(config *DbConfig, path, query string) (int64, int, error)
+
+// exportRows runs an export query and hands each row to write as it is read,
+// so memory use does not grow with the number of rows. begin receives the
+// columns before the first row. Values are as scanned, for the writer to
+// convert (see exportValue), except that masked columns, flagged for begin,
+// hold maskedValue.
+// The query may run for MSSQL_EXPORT_TIMEOUT seconds rather than the shorter
+// query timeout.
+func exportRows(config *DbConfig, query string, begin func(columns []string, columnTypes []*sql.ColumnType, masked []bool) error, write func(values []interface{}) error) (int64, error) {
+	db, err := getConnection(config)
+	if err != nil {
+		return 0, fmt.Errorf("database connection error: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ExportTimeout)*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	sources, err := maskingSources(ctx, db, config, query)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := db.QueryContext(ctx, tagQuery(ctx, config, query))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	masked := make([]bool, len(columns))
+	for _, i := range maskedColumnIndexes(config, query, columns, sources) {
+		masked[i] = true
+	}
+	if err := begin(columns, columnTypes, masked); err != nil {
+		return 0, err
+	}
+
+	values := make([]interface{}, len(columns))
+	scanArgs := make([]interface{}, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	var count int64
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			return count, err
+		}
+		for i := range values {
+			if masked[i] && values[i] != nil {
+				values[i] = maskedValue
+			}
+		}
+		if err := write(values); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	recordThroughput(int(count), time.Since(start))
+	return count, nil
+}
+
+// exportToolOptions are the arguments shared by the export tools.
+func exportToolOptions(extension string) []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("The SQL query whose results are exported (read-only operations only)"),
+		),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("Path of the %s file to write, relative to MSSQL_EXPORT_ROOT or absolute inside it", extension)),
+		),
+		mcp.WithBoolean("overwrite",
+			mcp.Description("Replace the file if it already exists (default false)"),
+		),
+		mcp.WithBoolean("confirm",
+			mcp.Description("Proceed with an export estimated above MSSQL_EXPORT_CONFIRM_ROWS or MSSQL_EXPORT_CONFIRM_BYTES"),
+		),
+		mcp.WithString("tenant",
+			mcp.Description("Tenant to query on a multi-tenant database (MSSQL_TENANCY_MODEL), unless the server is pinned to one with MSSQL_TENANT"),
+		),
+	}
+}
+
+// exportQueryHandler runs the query of an export tool under the same
+// policies as execute_sql and writes all of its rows with export.
+func exportQueryHandler(extension string, export exportFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query, ok := request.Params.Arguments["query"].(string)
+		if !ok || strings.TrimSpace(query) == "" {
+			return mcp.NewToolResultError("Query is required"), nil
+		}
+		requestedPath, ok := request.Params.Arguments["path"].(string)
+		if !ok || requestedPath == "" {
+			return mcp.NewToolResultError("Path is required"), nil
+		}
+		overwrite, _ := request.Params.Arguments["overwrite"].(bool)
+		confirmed, _ := request.Params.Arguments["confirm"].(bool)
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		requestedTenant, _ := request.Params.Arguments["tenant"].(string)
+		scoped, err := checkStatement(config, readAccess, requestedTenant, query)
+		if err != nil {
+			return notPermitted("Query", err), nil
+		}
+		path, err := resolveExportPath(config, requestedPath, extension, overwrite)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error preparing export file: %v", err)), nil
+		}
+
+		estimate, err := estimateQuery(scoped)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error estimating query: %v", err)), nil
+		}
+		if err := requireExportConfirmation(config, estimate, confirmed); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		log.Printf("Exporting query to %s: %s", path, truncateString(query, 100))
+		rows, columns, err := export(config, path, scoped)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error exporting query: %v", err)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Exported %d rows and %d columns to %s", rows, columns, path)), nil
+	}
+}
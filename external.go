@@ -0,0 +1,166 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// External data policies accepted by MSSQL_EXTERNAL_DATA_POLICY
+const (
+	externalDataNone   = "none"   // neither external tables nor ad hoc access
+	externalDataTables = "tables" // external tables, but no OPENROWSET and friends
+	externalDataAll    = "all"    // external tables and ad hoc access whose pass-through queries read
+)
+
+// adHocAccessFunctions read remote or file data without a declared external table.
+var adHocAccessFunctions = []string{"OPENROWSET", "OPENDATASOURCE", "OPENQUERY"}
+
+// passThroughWrites reports whether the OPENQUERY or OPENROWSET call opening
+// at tokens[open] hands the remote server a query that may write. The
+// pass-through text runs there unchecked, so it counts as a read only when it
+// starts with SELECT or WITH and isWriteOperation finds no write in it. Calls
+// naming a remote object, or OPENROWSET(BULK ...), pass no query.
+func passThroughWrites(tokens []sqlToken, open int) bool {
+	end := skipParenthesized(tokens, open)
+	if open+1 < end && tokens[open+1].isKeyword("BULK") {
+		return false
+	}
+	// The query, if any, is the last argument
+	depth := tokens[open].Depth + 1
+	last := open + 1
+	for k := open + 1; k < end; k++ {
+		if tokens[k].Text == "," && tokens[k].Depth == depth {
+			last = k + 1
+		}
+	}
+	if last+2 != end || tokens[last].Kind != tokenString {
+		return false
+	}
+	text := unquoteString(tokens[last].Text)
+	remote := significantTokens(tokenizeSQL(text))
+	if len(remote) == 0 || !(remote[0].isKeyword("SELECT") || remote[0].isKeyword("WITH")) {
+		return true
+	}
+	return isWriteOperation(text)
+}
+
+// checkExternalDataPolicy rejects queries reading external data in ways the
+// configured policy does not allow.
+func checkExternalDataPolicy(config *DbConfig, query string) error {
+	policy := strings.ToLower(config.ExternalDataPolicy)
+	switch policy {
+	case externalDataAll:
+		return nil
+	case externalDataNone, externalDataTables:
+	default:
+		return fmt.Errorf("invalid MSSQL_EXTERNAL_DATA_POLICY %q (expected none, tables or all)", config.ExternalDataPolicy)
+	}
+
+	tokens := significantTokens(tokenizeSQL(query))
+	for i := 0; i+1 < len(tokens); i++ {
+		for _, function := range adHocAccessFunctions {
+			if tokens[i].isKeyword(function) && tokens[i+1].Text == "(" {
+				return fmt.Errorf("%s is not permitted by the external data policy (%s)", function, policy)
+			}
+		}
+	}
+
+	if policy == externalDataTables {
+		return nil
+	}
+
+	for _, reference := range findObjectReferences(query) {
+		if reference.IsTemporary() || len(reference.Parts) > 2 {
+			continue
+		}
+		quoted := make([]string, len(reference.Parts))
+		for i, part := range reference.Parts {
+			quoted[i] = quoteIdentifier(part)
+		}
+		data, err := executeQuery("SELECT COUNT(*) AS external_tables FROM sys.external_tables WHERE object_id = OBJECT_ID(@p1)", true, strings.Join(quoted, "."))
+		if err != nil {
+			return err
+		}
+		if count, _ := data["rows"].([]map[string]interface{})[0]["external_tables"].(int64); count > 0 {
+			return fmt.Errorf("%s is an external table, which the external data policy (%s) does not permit", reference.Name(), policy)
+		}
+	}
+	return nil
+}
+
+// registerExternalDataTools adds a tool listing PolyBase external objects.
+func registerExternalDataTools(s *server.MCPServer) {
+	externalTool := mcp.NewTool("list_external_objects", append([]mcp.ToolOption{
+		mcp.WithDescription("List external data sources, external file formats and external tables (PolyBase, Azure Synapse, SQL Server 2019+), showing where each external table's data lives. The schema filter and paging apply to the external tables."),
+	}, listFilterOptions(true)...)...)
+
+	s.AddTool(externalTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := describeExternalObjects(listFilterFromArguments(request.Params.Arguments))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error listing external objects: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+}
+
+// describeExternalObjects renders the external data sources, file formats
+// and tables of the current database matching the filter.
+func describeExternalObjects(filter listFilter) (string, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return "", err
+	}
+
+	nameFilter := listFilter{Name: filter.Name}
+	conditions, args := nameFilter.conditions("", "name", nil)
+	sources, err := executeQuery(`SELECT name, type_desc, location FROM sys.external_data_sources WHERE 1 = 1`+conditions+` ORDER BY name`, true, args...)
+	if err != nil {
+		return "", err
+	}
+	formats, err := executeQuery(`SELECT name, format_type, field_terminator, data_compression FROM sys.external_file_formats WHERE 1 = 1`+conditions+` ORDER BY name`, true, args...)
+	if err != nil {
+		return "", err
+	}
+	conditions, args = filter.conditions("SCHEMA_NAME(t.schema_id)", "t.name", nil)
+	tables, err := executeQuery(`SELECT SCHEMA_NAME(t.schema_id) + '.' + t.name AS table_name, ds.name AS data_source, t.location, ff.name AS file_format
+		FROM sys.external_tables t
+		LEFT JOIN sys.external_data_sources ds ON ds.data_source_id = t.data_source_id
+		LEFT JOIN sys.external_file_formats ff ON ff.file_format_id = t.file_format_id
+		WHERE 1 = 1`+conditions+`
+		ORDER BY table_name`+filter.paging(), true, args...)
+	if err != nil {
+		return "", err
+	}
+	note := filter.page(tables)
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# External data\n\nQuery policy (MSSQL_EXTERNAL_DATA_POLICY): %s\n", config.ExternalDataPolicy))
+	sections := []struct {
+		title string
+		data  map[string]interface{}
+	}{
+		{"Data sources", sources},
+		{"File formats", formats},
+		{"External tables", tables},
+	}
+	for _, section := range sections {
+		result.WriteString(fmt.Sprintf("\n## %s\n\n", section.title))
+		if len(section.data["rows"].([]map[string]interface{})) == 0 {
+			result.WriteString("None\n")
+			continue
+		}
+		table, err := formatResults(section.data)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(table)
+	}
+	if note != "" {
+		result.WriteString("\n\n" + note)
+	}
+	return result.String(), nil
+}
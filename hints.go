@@ -0,0 +1,126 @@
+package mssqlmcp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Query hint kinds operators can allow through MSSQL_ALLOWED_QUERY_HINTS
+var defaultQueryHints = []string{"recompile", "maxdop", "optimize_for_unknown", "max_grant_percent", "use_hint"}
+
+// USE HINT names allowed by default; MSSQL_ALLOWED_USE_HINTS replaces the list
+var defaultUseHints = []string{
+	"DISABLE_OPTIMIZER_ROWGOAL",
+	"DISABLE_PARAMETER_SNIFFING",
+	"ENABLE_QUERY_OPTIMIZER_HOTFIXES",
+	"FORCE_DEFAULT_CARDINALITY_ESTIMATION",
+	"FORCE_LEGACY_CARDINALITY_ESTIMATION",
+	"DISABLE_BATCH_MODE_ADAPTIVE_JOINS",
+	"DISABLE_BATCH_MODE_MEMORY_GRANT_FEEDBACK",
+	"DISABLE_INTERLEAVED_EXECUTION_TVF",
+	"DISALLOW_BATCH_MODE",
+	"ASSUME_JOIN_PREDICATE_DEPENDS_ON_FILTERS",
+	"ASSUME_MIN_SELECTIVITY_FOR_FILTER_ESTIMATES",
+}
+
+// queryHintOptions turns the structured hints argument of execute_sql into
+// OPTION clause entries. Only the hint kinds and USE HINT names allowed by
+// configuration are accepted, so no free-form hint text reaches the query.
+func queryHintOptions(config *DbConfig, hints map[string]interface{}) ([]string, error) {
+	allowed := make(map[string]bool)
+	for _, kind := range config.AllowedQueryHints {
+		allowed[strings.ToLower(kind)] = true
+	}
+	check := func(kind string) error {
+		if !allowed[kind] {
+			return fmt.Errorf("the %s hint is not allowed (MSSQL_ALLOWED_QUERY_HINTS)", kind)
+		}
+		return nil
+	}
+
+	// Sorted keys keep the generated clause stable
+	keys := make([]string, 0, len(hints))
+	for key := range hints {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var options []string
+	for _, key := range keys {
+		value := hints[key]
+		switch key {
+		case "recompile", "optimize_for_unknown":
+			enabled, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s must be true or false", key)
+			}
+			if !enabled {
+				continue
+			}
+			if err := check(key); err != nil {
+				return nil, err
+			}
+			if key == "recompile" {
+				options = append(options, "RECOMPILE")
+			} else {
+				options = append(options, "OPTIMIZE FOR UNKNOWN")
+			}
+
+		case "maxdop":
+			dop, ok := value.(float64)
+			if !ok || dop < 0 || dop > 64 || dop != float64(int(dop)) {
+				return nil, fmt.Errorf("maxdop must be a whole number from 0 to 64")
+			}
+			if err := check(key); err != nil {
+				return nil, err
+			}
+			options = append(options, fmt.Sprintf("MAXDOP %d", int(dop)))
+
+		case "max_grant_percent":
+			percent, ok := value.(float64)
+			if !ok || percent <= 0 || percent > 100 {
+				return nil, fmt.Errorf("max_grant_percent must be a number above 0 and at most 100")
+			}
+			if err := check(key); err != nil {
+				return nil, err
+			}
+			options = append(options, fmt.Sprintf("MAX_GRANT_PERCENT = %g", percent))
+
+		case "use_hint":
+			names, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("use_hint must be a list of hint names")
+			}
+			if len(names) == 0 {
+				continue
+			}
+			if err := check(key); err != nil {
+				return nil, err
+			}
+
+			quoted := make([]string, len(names))
+			for i, name := range names {
+				hint, _ := name.(string)
+				if !isAllowedUseHint(config, hint) {
+					return nil, fmt.Errorf("USE HINT %q is not allowed (MSSQL_ALLOWED_USE_HINTS)", hint)
+				}
+				quoted[i] = "'" + strings.ToUpper(hint) + "'"
+			}
+			options = append(options, "USE HINT ("+strings.Join(quoted, ", ")+")")
+
+		default:
+			return nil, fmt.Errorf("unknown hint %s", key)
+		}
+	}
+	return options, nil
+}
+
+func isAllowedUseHint(config *DbConfig, hint string) bool {
+	for _, allowed := range config.AllowedUseHints {
+		if strings.EqualFold(hint, allowed) {
+			return true
+		}
+	}
+	return false
+}
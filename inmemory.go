@@ -0,0 +1,145 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// memoryOptimizedDurability returns the durability of a memory-optimized table
+// (SCHEMA_AND_DATA or SCHEMA_ONLY), or "" for a disk-based table.
+func memoryOptimizedDurability(schema, table string) (string, error) {
+	data, err := executeQuery(`SELECT durability_desc FROM sys.tables
+		WHERE object_id = OBJECT_ID(@p1) AND is_memory_optimized = 1`, true, quoteIdentifier(schema)+"."+quoteIdentifier(table))
+	if err != nil {
+		return "", err
+	}
+
+	rows := data["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%v", rows[0]["durability_desc"]), nil
+}
+
+// memoryOptimizedNote explains how a memory-optimized table differs when queried.
+func memoryOptimizedNote(durability string) string {
+	note := "This is a memory-optimized (In-Memory OLTP) table: TABLESAMPLE is not supported and interop queries cannot use parallelism."
+	if durability == "SCHEMA_ONLY" {
+		note += " Its durability is SCHEMA_ONLY, so its rows are lost when the server restarts."
+	}
+	return note
+}
+
+// registerInMemoryTools adds a tool reporting on In-Memory OLTP objects.
+func registerInMemoryTools(s *server.MCPServer) {
+	inMemoryTool := mcp.NewTool("in_memory_oltp_status",
+		mcp.WithDescription("Report In-Memory OLTP usage: memory-optimized tables with their durability and memory consumption, hash index bucket health, and natively compiled modules"),
+	)
+
+	s.AddTool(inMemoryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := describeInMemoryObjects()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading In-Memory OLTP status: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+}
+
+// describeInMemoryObjects renders memory-optimized tables, their hash
+// indexes and natively compiled modules of the current database.
+func describeInMemoryObjects() (string, error) {
+	tables, err := executeQuery(`SELECT SCHEMA_NAME(t.schema_id) + '.' + t.name AS table_name, t.durability_desc,
+			ms.memory_allocated_for_table_kb, ms.memory_used_by_table_kb,
+			ms.memory_allocated_for_indexes_kb, ms.memory_used_by_indexes_kb
+		FROM sys.tables t
+		LEFT JOIN sys.dm_db_xtp_table_memory_stats ms ON ms.object_id = t.object_id
+		WHERE t.is_memory_optimized = 1
+		ORDER BY ms.memory_allocated_for_table_kb DESC`, true)
+	if err != nil {
+		return "", err
+	}
+
+	modules, err := executeQuery(`SELECT SCHEMA_NAME(o.schema_id) + '.' + o.name AS module, o.type_desc
+		FROM sys.sql_modules m
+		JOIN sys.objects o ON o.object_id = m.object_id
+		WHERE m.uses_native_compilation = 1
+		ORDER BY module`, true)
+	if err != nil {
+		return "", err
+	}
+
+	tableRows := tables["rows"].([]map[string]interface{})
+	moduleRows := modules["rows"].([]map[string]interface{})
+	if len(tableRows) == 0 && len(moduleRows) == 0 {
+		return "No memory-optimized tables or natively compiled modules exist in this database.", nil
+	}
+
+	var result strings.Builder
+	result.WriteString("# In-Memory OLTP\n\n## Memory-optimized tables\n\n")
+	if len(tableRows) == 0 {
+		result.WriteString("None\n")
+	} else {
+		result.WriteString("| Table | Durability | Table KB used/allocated | Indexes KB used/allocated |\n|---|---|---|---|\n")
+		for _, row := range tableRows {
+			result.WriteString(fmt.Sprintf("| %v | %v | %v / %v | %v / %v |\n", row["table_name"], row["durability_desc"],
+				row["memory_used_by_table_kb"], row["memory_allocated_for_table_kb"],
+				row["memory_used_by_indexes_kb"], row["memory_allocated_for_indexes_kb"]))
+		}
+	}
+
+	if len(tableRows) > 0 {
+		// Reading hash index stats scans the indexes, but these tables are in memory
+		hash, err := executeQuery(`SELECT OBJECT_SCHEMA_NAME(hs.object_id) + '.' + OBJECT_NAME(hs.object_id) AS table_name, i.name AS index_name,
+				hs.total_bucket_count, hs.empty_bucket_count, hs.avg_chain_length, hs.max_chain_length
+			FROM sys.dm_db_xtp_hash_index_stats hs
+			JOIN sys.indexes i ON i.object_id = hs.object_id AND i.index_id = hs.index_id
+			ORDER BY table_name, index_name`, true)
+		if err != nil {
+			return "", err
+		}
+
+		result.WriteString("\n## Hash indexes\n\n")
+		rows := hash["rows"].([]map[string]interface{})
+		if len(rows) == 0 {
+			result.WriteString("None\n")
+		}
+		for _, row := range rows {
+			result.WriteString(fmt.Sprintf("- %v.%v: %v buckets, %v empty, average chain %v, longest chain %v%s\n",
+				row["table_name"], row["index_name"], row["total_bucket_count"], row["empty_bucket_count"],
+				row["avg_chain_length"], row["max_chain_length"], hashIndexAdvice(row)))
+		}
+	}
+
+	result.WriteString("\n## Natively compiled modules\n\n")
+	if len(moduleRows) == 0 {
+		result.WriteString("None\n")
+	}
+	for _, row := range moduleRows {
+		result.WriteString(fmt.Sprintf("- %v (%v)\n", row["module"], row["type_desc"]))
+	}
+	return result.String(), nil
+}
+
+// hashIndexAdvice flags hash indexes with too few buckets (few empty buckets,
+// long chains) or many duplicate keys (long chains despite empty buckets).
+func hashIndexAdvice(row map[string]interface{}) string {
+	total, _ := row["total_bucket_count"].(int64)
+	empty, _ := row["empty_bucket_count"].(int64)
+	chain, _ := row["avg_chain_length"].(int64)
+	if total == 0 {
+		return ""
+	}
+
+	emptyPercent := empty * 100 / total
+	switch {
+	case emptyPercent < 33 && chain > 5:
+		return " (too few buckets: increase BUCKET_COUNT)"
+	case emptyPercent >= 33 && chain > 10:
+		return " (many duplicate keys: consider a nonclustered index instead)"
+	}
+	return ""
+}
@@ -0,0 +1,547 @@
+//go:build integration
+
+// Integration tests run the server's query pipeline against SQL Server in a
+// container. They need Docker and are excluded from plain go test:
+//
+//	go test -tags integration ./...
+package mssqlmcp
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/testcontainers/testcontainers-go"
+	tcmssql "github.com/testcontainers/testcontainers-go/modules/mssql"
+)
+
+const (
+	integrationImage    = "mcr.microsoft.com/mssql/server:2022-latest"
+	integrationPassword = "Fixture!Passw0rd"
+	integrationDatabase = "mcp_fixture"
+)
+
+// integrationFixture is created once in a fresh database. Orders carries a
+// tenant column, a soft-delete flag, exact decimals and NULLs so the
+// policies and formatters have something to work on.
+const integrationFixture = `
+CREATE TABLE dbo.Customers (
+	CustomerID int NOT NULL PRIMARY KEY,
+	Name nvarchar(100) NOT NULL,
+	Email nvarchar(200) NULL
+);
+CREATE TABLE dbo.Orders (
+	OrderID int NOT NULL PRIMARY KEY,
+	CustomerID int NOT NULL REFERENCES dbo.Customers (CustomerID),
+	TenantID int NOT NULL,
+	Total decimal(10,2) NOT NULL,
+	Note nvarchar(max) NULL,
+	is_deleted bit NOT NULL DEFAULT 0
+);
+INSERT INTO dbo.Customers VALUES (1, N'Ada', N'ada@example.com'), (2, N'Grace', NULL);
+INSERT INTO dbo.Orders (OrderID, CustomerID, TenantID, Total, Note, is_deleted) VALUES
+	(1, 1, 10, 19.90, NULL, 0),
+	(2, 1, 10, 5.00, N'gift', 0),
+	(3, 2, 20, 120.50, NULL, 0),
+	(4, 2, 20, 7.25, NULL, 1),
+	(5, 1, 10, 42.00, NULL, 0);`
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	container, err := tcmssql.Run(ctx, integrationImage,
+		tcmssql.WithAcceptEULA(),
+		tcmssql.WithPassword(integrationPassword),
+	)
+	if err != nil {
+		log.Fatalf("starting SQL Server container: %v", err)
+	}
+
+	code, err := runIntegrationTests(ctx, container, m)
+	if terminateErr := testcontainers.TerminateContainer(container); terminateErr != nil {
+		log.Printf("stopping SQL Server container: %v", terminateErr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(code)
+}
+
+// runIntegrationTests points the server configuration at the container,
+// provisions the fixture database and runs the tests.
+func runIntegrationTests(ctx context.Context, container *tcmssql.MSSQLServerContainer, m *testing.M) (int, error) {
+	host, err := container.Host(ctx)
+	if err != nil {
+		return 0, err
+	}
+	port, err := container.MappedPort(ctx, "1433/tcp")
+	if err != nil {
+		return 0, err
+	}
+
+	os.Setenv("MSSQL_HOST", fmt.Sprintf("%s,%s", host, port.Port()))
+	os.Setenv("MSSQL_USER", "sa")
+	os.Setenv("MSSQL_PASSWORD", integrationPassword)
+	os.Setenv("MSSQL_DATABASE", integrationDatabase)
+
+	config, err := getDbConfig()
+	if err != nil {
+		return 0, err
+	}
+	master, err := openDatabase(config, "master")
+	if err != nil {
+		return 0, fmt.Errorf("connecting to master: %v", err)
+	}
+	_, err = master.ExecContext(ctx, "CREATE DATABASE "+quoteIdentifier(integrationDatabase))
+	master.Close()
+	if err != nil {
+		return 0, fmt.Errorf("creating fixture database: %v", err)
+	}
+	if _, err := executeQuery(integrationFixture, false); err != nil {
+		return 0, fmt.Errorf("creating fixture schema: %v", err)
+	}
+
+	return m.Run(), nil
+}
+
+func TestQueryResultValues(t *testing.T) {
+	data, err := executeQuery("SELECT OrderID, Total, Note FROM dbo.Orders WHERE OrderID = 1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := data["rows"].([]map[string]interface{})
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(rows))
+	}
+	if total := rows[0]["Total"]; total != "19.90" {
+		t.Errorf("Total = %#v, want exact decimal \"19.90\"", total)
+	}
+	if note := rows[0]["Note"]; note != nil {
+		t.Errorf("Note = %#v, want nil", note)
+	}
+
+	columnTypes := data["columnTypes"].([]columnInfo)
+	if got := columnTypes[1].Type; got != "decimal(10,2)" {
+		t.Errorf("Total type = %s, want decimal(10,2)", got)
+	}
+	if got := columnTypes[2].Type; got != "nvarchar(max)" {
+		t.Errorf("Note type = %s, want nvarchar(max)", got)
+	}
+}
+
+func TestUnicodeValues(t *testing.T) {
+	// nvarchar travels as UTF-16 and must keep characters outside the BMP;
+	// varchar is decoded from its collation's code page
+	data, err := executeQuery(`SELECT
+		N'Grüße, 日本語, 한국어 😀👍🏽' AS national,
+		CAST('Crème brûlée' COLLATE Latin1_General_CI_AS AS varchar(20)) AS latin,
+		CAST(N'Ελληνικά' COLLATE Greek_CI_AS AS varchar(20)) AS greek,
+		CAST('12345678-1234-1234-1234-123456789ABC' AS uniqueidentifier) AS id`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := data["rows"].([]map[string]interface{})[0]
+	want := map[string]string{
+		"national": "Grüße, 日本語, 한국어 😀👍🏽",
+		"latin":    "Crème brûlée",
+		"greek":    "Ελληνικά",
+		"id":       "12345678-1234-1234-1234-123456789ABC",
+	}
+	for column, value := range want {
+		if row[column] != value {
+			t.Errorf("%s = %#v, want %q", column, row[column], value)
+		}
+	}
+}
+
+func TestTruncationAndFetchMore(t *testing.T) {
+	ctx := withMaxRows(context.Background(), 2)
+	data, err := executeSessionQuery(ctx, "SELECT OrderID FROM dbo.Orders ORDER BY OrderID", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["truncated"] != true {
+		t.Fatalf("result not marked truncated: %v", data)
+	}
+	token, ok := data["continuationToken"].(string)
+	if !ok {
+		t.Fatal("truncated result has no continuation token")
+	}
+
+	seen := len(data["rows"].([]map[string]interface{}))
+	for token != "" {
+		page, err := fetchMore(context.Background(), token, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen += len(page["rows"].([]map[string]interface{}))
+		token, _ = page["continuationToken"].(string)
+	}
+	if seen != 5 {
+		t.Errorf("fetched %d rows in total, want 5", seen)
+	}
+}
+
+func TestMaskedColumns(t *testing.T) {
+	t.Setenv("MSSQL_MASKED_COLUMNS", "dbo.Customers.Email")
+
+	// Parameterized queries are described with their parameters declared
+	data, err := executeQuery("SELECT Email AS contact FROM dbo.Customers WHERE CustomerID = @id", true, sql.Named("id", int64(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contact := data["rows"].([]map[string]interface{})[0]["contact"]; contact != maskedValue {
+		t.Errorf("contact = %#v, want %q", contact, maskedValue)
+	}
+
+	// Computed columns of a query reading a masked column are masked
+	data, err = executeQuery(`SELECT CONCAT(Email, '') AS s, LEFT(Email, 3) AS p,
+		(SELECT TOP 1 Email FROM dbo.Customers) AS q, CustomerID FROM dbo.Customers WHERE CustomerID = 1`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := data["rows"].([]map[string]interface{})[0]
+	for _, column := range []string{"s", "p", "q"} {
+		if row[column] != maskedValue {
+			t.Errorf("%s = %#v, want %q", column, row[column], maskedValue)
+		}
+	}
+	if row["CustomerID"] != int64(1) {
+		t.Errorf("CustomerID = %#v, want 1", row["CustomerID"])
+	}
+
+	// Columns that cannot be traced refuse the query rather than pass
+	if _, err := executeQuery("SELECT * INTO #c FROM dbo.Customers; SELECT Email AS contact FROM #c", true); err == nil {
+		t.Error("query over an untraceable result ran with masked columns configured")
+	}
+
+	profile, err := profileColumn("dbo", "Customers", "Email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(profile, "ada@example.com") {
+		t.Errorf("profile of a masked column shows its values:\n%s", profile)
+	}
+}
+
+func TestSoftDeleteFilter(t *testing.T) {
+	t.Setenv("MSSQL_SOFT_DELETE_COLUMNS", "is_deleted")
+	t.Setenv("MSSQL_SOFT_DELETE_FILTER", "true")
+
+	config, err := getDbConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := rowFilterClause(config, "dbo", "Orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := executeQuery("SELECT COUNT(*) AS live FROM dbo.Orders"+filter, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live := data["rows"].([]map[string]interface{})[0]["live"]; live != int64(4) {
+		t.Errorf("live rows = %v, want 4", live)
+	}
+}
+
+func TestTenantScoping(t *testing.T) {
+	t.Setenv("MSSQL_TENANCY_MODEL", "column")
+	t.Setenv("MSSQL_TENANT", "10")
+
+	config, err := getDbConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scoped, err := scopeQuery(config, config.Tenant, "SELECT o.OrderID, c.Name FROM dbo.Orders o JOIN dbo.Customers c ON c.CustomerID = o.CustomerID")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := executeQuery(scoped, true)
+	if err != nil {
+		t.Fatalf("running %s: %v", scoped, err)
+	}
+	if rows := data["rows"].([]map[string]interface{}); len(rows) != 3 {
+		t.Errorf("got %d rows of tenant 10, want 3", len(rows))
+	}
+
+	if _, err := scopeQuery(config, config.Tenant, "SELECT * FROM otherdb.dbo.Orders"); err == nil {
+		t.Error("cross-database reference allowed on a multi-tenant database")
+	}
+
+	db, err := getConnection(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Writes run in a transaction that is rolled back; rows counts the rows
+	// of tenant 10 a statement changes, or -1 when it fails
+	for statement, rows := range map[string]int64{
+		"SELECT o.OrderID FROM (dbo.Orders o JOIN dbo.Customers c ON c.CustomerID = o.CustomerID)":                                 3,
+		"DELETE dbo.Orders WHERE OrderID = 3":                                                                                      0,
+		"UPDATE dbo.Orders SET Note = 'x'":                                                                                         3,
+		"UPDATE o SET Note = 'x' FROM dbo.Orders o JOIN dbo.Customers c ON c.CustomerID = o.CustomerID":                            3,
+		"INSERT dbo.Orders (OrderID, CustomerID, TenantID, Total) VALUES (9, 1, 10, 1)":                                            1,
+		"INSERT dbo.Orders (OrderID, CustomerID, TenantID, Total) VALUES (9, 1, 20, 1)":                                            -1,
+		"INSERT INTO dbo.Orders (OrderID, CustomerID, TenantID, Total) SELECT 9, 1, TenantID, 1 FROM dbo.Orders WHERE OrderID = 3": 0,
+	} {
+		scoped, err := scopeQuery(config, config.Tenant, statement)
+		if err != nil {
+			t.Errorf("scopeQuery(%q): %v", statement, err)
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got int64 = -1
+		if strings.HasPrefix(statement, "SELECT") {
+			if data, err := runQuery(tx, config, scoped, true); err == nil {
+				got = int64(len(data["rows"].([]map[string]interface{})))
+			}
+		} else if result, err := tx.Exec(scoped); err == nil {
+			got, _ = result.RowsAffected()
+		}
+		tx.Rollback()
+		if got != rows {
+			t.Errorf("%s\nran as %s\nchanged %d rows, want %d", statement, scoped, got, rows)
+		}
+	}
+
+	for _, statement := range []string{
+		"UPDATE dbo.Orders SET TenantID = 20 WHERE OrderID = 1",
+		"MERGE dbo.Orders AS t USING dbo.Customers AS s ON 1 = 0 WHEN NOT MATCHED THEN INSERT (OrderID) VALUES (1);",
+		"TRUNCATE TABLE dbo.Orders",
+		"EXEC dbo.ArchiveOrders",
+	} {
+		if scoped, err := scopeQuery(config, config.Tenant, statement); err == nil {
+			t.Errorf("%s allowed as %s", statement, scoped)
+		}
+	}
+}
+
+func TestDescribeTable(t *testing.T) {
+	description, err := describeTable("dbo", "Orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"TenantID", "Total", "Customers"} {
+		if !strings.Contains(description, want) {
+			t.Errorf("description lacks %s:\n%s", want, description)
+		}
+	}
+}
+
+func TestCallTool(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := CallTool(context.Background(), s, "execute_sql", map[string]interface{}{"query": "SELECT COUNT(*) AS orders FROM dbo.Orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := result.Content[0].(mcp.TextContent).Text; result.IsError || !strings.Contains(text, "5") {
+		t.Errorf("execute_sql = %q, want the 5 orders", text)
+	}
+
+	result, err = CallTool(context.Background(), s, "execute_sql", map[string]interface{}{"query": "DELETE FROM dbo.Orders WHERE OrderID = 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Error("execute_sql ran a DELETE")
+	}
+}
+
+func TestListTables(t *testing.T) {
+	tables, err := ListTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[Table]bool{{Schema: "dbo", Name: "Customers"}: true, {Schema: "dbo", Name: "Orders"}: true}
+	for _, table := range tables {
+		delete(want, table)
+	}
+	if len(want) > 0 {
+		t.Errorf("ListTables = %v, missing %v", tables, want)
+	}
+}
+
+func TestExportTimeout(t *testing.T) {
+	t.Setenv("MSSQL_QUERY_TIMEOUT", "1")
+	t.Setenv("MSSQL_EXPORT_TIMEOUT", "30")
+
+	config, err := getDbConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The query outlasts the query timeout but not the export timeout
+	query := "WAITFOR DELAY '00:00:02'; SELECT CustomerID FROM dbo.Customers"
+	exports := map[string]exportFunc{"xlsx": streamXLSX, "parquet": streamParquet, "ndjson": streamNDJSON}
+	for format, export := range exports {
+		path := filepath.Join(t.TempDir(), "export."+format)
+		if _, _, err := export(config, path, query); err != nil {
+			t.Errorf("%s export: %v", format, err)
+		}
+	}
+
+	config.ExportTimeout = 1
+	if _, _, err := streamXLSX(config, filepath.Join(t.TempDir(), "slow.xlsx"), query); err == nil {
+		t.Error("xlsx export outlasted MSSQL_EXPORT_TIMEOUT")
+	}
+}
+
+func TestNDJSONBinary(t *testing.T) {
+	t.Setenv("MSSQL_BINARY_MAX_BYTES", "16")
+
+	config, err := getDbConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "export.ndjson")
+	query := "SELECT CONVERT(varbinary(max), REPLICATE('A', 200)) AS payload"
+	if _, _, err := streamNDJSON(config, path, query); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var row struct{ Payload []byte }
+	if err := json.Unmarshal(content, &row); err != nil {
+		t.Fatalf("%s: %v", content, err)
+	}
+	if len(row.Payload) != 200 || row.Payload[199] != 'A' {
+		t.Errorf("payload = %d bytes, want 200 bytes of 0x41", len(row.Payload))
+	}
+}
+
+func TestXLSXExportValues(t *testing.T) {
+	t.Setenv("MSSQL_BINARY_MAX_BYTES", "16")
+	t.Setenv("MSSQL_DATETIME_FORMAT", "02.01.2006 15:04")
+
+	config, err := getDbConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "export.xlsx")
+	query := `SELECT CONVERT(varbinary(max), REPLICATE('A', 200)) AS payload,
+		CAST('2024-03-01T18:00:00' AS datetime2) AS created,
+		CAST(12345678901234.5678 AS decimal(18,4)) AS amount`
+	if _, _, err := streamXLSX(config, path, query); err != nil {
+		t.Fatal(err)
+	}
+	workbook, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := readXLSXSheet(t, workbook)
+	for _, cell := range []string{
+		"0x" + strings.Repeat("41", 200) + "</t>",
+		`<c r="B2" s="2"><v>45352.75</v></c>`,
+		`<c r="C2"><v>12345678901234.5678</v></c>`,
+	} {
+		if !strings.Contains(content, cell) {
+			t.Errorf("sheet lacks %s:\n%s", cell, content)
+		}
+	}
+}
+
+func TestParquetExportValues(t *testing.T) {
+	t.Setenv("MSSQL_BINARY_MAX_BYTES", "16")
+	t.Setenv("MSSQL_MASKED_COLUMNS", "dbo.Customers.Email")
+
+	config, err := getDbConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "export.parquet")
+	query := `SELECT c.CustomerID, c.Email, o.Total, CONVERT(varbinary(max), REPLICATE('A', 200)) AS payload
+		FROM dbo.Customers c JOIN dbo.Orders o ON o.CustomerID = c.CustomerID WHERE o.OrderID = 1`
+	if _, _, err := streamParquet(config, path, query); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := readParquet(t, content)
+	if got := record.Column(1).(*array.String).Value(0); got != maskedValue {
+		t.Errorf("Email = %q, want %q", got, maskedValue)
+	}
+	if got := record.Column(2).(*array.Decimal128).Value(0).ToString(2); got != "19.90" {
+		t.Errorf("Total = %s, want 19.90", got)
+	}
+	if got := record.Column(3).(*array.Binary).Value(0); len(got) != 200 {
+		t.Errorf("payload = %d bytes, want 200", len(got))
+	}
+}
+
+func TestResumableOrdering(t *testing.T) {
+	config, err := getDbConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := getConnection(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	notNull := false
+	for query, unique := range map[string]bool{
+		"SELECT OrderID, CustomerID FROM dbo.Orders ORDER BY OrderID":                                                                           true,
+		"SELECT OrderID, CustomerID FROM dbo.Orders ORDER BY CustomerID":                                                                        false,
+		"SELECT o.OrderID, c.CustomerID FROM dbo.Orders o JOIN dbo.Customers c ON c.CustomerID = o.CustomerID ORDER BY o.OrderID, c.CustomerID": true,
+		"SELECT o.OrderID, c.CustomerID FROM dbo.Orders o JOIN dbo.Customers c ON c.CustomerID = o.CustomerID ORDER BY o.OrderID":               false,
+	} {
+		cursor := &heldCursor{
+			query:   query,
+			columns: []string{"OrderID", "CustomerID"},
+			types:   []columnInfo{{Name: "OrderID", Type: "int", Nullable: &notNull}, {Name: "CustomerID", Type: "int", Nullable: &notNull}},
+		}
+		keys, _, ok := cursor.orderKeys()
+		if !ok {
+			t.Errorf("ORDER BY of %q not recognized", query)
+			continue
+		}
+		got, err := uniqueOrdering(context.Background(), db, query, nil, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != unique {
+			t.Errorf("uniqueOrdering(%q) = %v, want %v", query, got, unique)
+		}
+	}
+
+	for _, query := range []string{
+		"SELECT TOP 10 OrderID, CustomerID FROM dbo.Orders ORDER BY OrderID",
+		"SELECT OrderID, CustomerID FROM dbo.Orders ORDER BY OrderID + 1",
+		"SELECT OrderID, CustomerID FROM dbo.Orders ORDER BY OrderID OFFSET 5 ROWS",
+		"SELECT OrderID, CustomerID FROM dbo.Orders",
+	} {
+		cursor := &heldCursor{
+			query:   query,
+			columns: []string{"OrderID", "CustomerID"},
+			types:   []columnInfo{{Name: "OrderID", Type: "int", Nullable: &notNull}, {Name: "CustomerID", Type: "int", Nullable: &notNull}},
+		}
+		if _, _, ok := cursor.orderKeys(); ok {
+			t.Errorf("%q taken as resumable", query)
+		}
+	}
+}
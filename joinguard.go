@@ -0,0 +1,152 @@
+package mssqlmcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// guardedTable is a large table taking part in a join.
+type guardedTable struct {
+	schema string
+	table  string
+	rows   int64
+	comma  bool // listed as "FROM a, b" rather than with JOIN
+}
+
+func (t guardedTable) name() string {
+	return t.schema + "." + t.table
+}
+
+// joinExplosionWarning looks for queries that join two or more large tables
+// with no WHERE clause at all, where either the tables are combined as a
+// cartesian product (comma lists, CROSS JOIN) or no foreign key relates them.
+// Such joins can produce the product of the row counts. It returns a
+// description of the risk, or "" when the query looks safe.
+func joinExplosionWarning(config *DbConfig, query string) (string, error) {
+	if config.JoinGuardRows <= 0 {
+		return "", nil
+	}
+
+	tokens := significantTokens(tokenizeSQL(query))
+	cross := false
+	for i, t := range tokens {
+		if t.isKeyword("WHERE") {
+			return "", nil
+		}
+		if t.isKeyword("CROSS") && i+1 < len(tokens) && tokens[i+1].isKeyword("JOIN") {
+			cross = true
+		}
+	}
+
+	// Only tables read in the statement count; the cheap checks above avoid
+	// catalog lookups for the common single-table query
+	var tables []guardedTable
+	seen := make(map[string]bool)
+	for _, reference := range findObjectReferences(query) {
+		if reference.Function || reference.IsTemporary() || len(reference.Parts) > 2 {
+			continue
+		}
+		schema, table := "dbo", reference.Parts[len(reference.Parts)-1]
+		if len(reference.Parts) == 2 && reference.Parts[0] != "" {
+			schema = reference.Parts[0]
+		}
+		name := schema + "." + table
+		if seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		tables = append(tables, guardedTable{schema: schema, table: table, comma: followsComma(tokens, reference.Pos)})
+	}
+	if len(tables) < 2 {
+		return "", nil
+	}
+
+	var large []guardedTable
+	for _, table := range tables {
+		rows, err := estimateRowCount(table.schema, table.table)
+		if err != nil {
+			return "", err
+		}
+		if rows >= int64(config.JoinGuardRows) {
+			table.rows = rows
+			large = append(large, table)
+		}
+	}
+	if len(large) < 2 {
+		return "", nil
+	}
+
+	related, err := foreignKeyPairs(large)
+	if err != nil {
+		return "", err
+	}
+
+	var risks []string
+	for i := 0; i < len(large); i++ {
+		for j := i + 1; j < len(large); j++ {
+			a, b := large[i], large[j]
+			reason := ""
+			switch {
+			case cross || a.comma || b.comma:
+				reason = "combined as a cross product"
+			case !related[pairKey(a.name(), b.name())]:
+				reason = "no foreign key relates them"
+			default:
+				continue
+			}
+			risks = append(risks, fmt.Sprintf("%s (~%d rows) and %s (~%d rows): %s", a.name(), a.rows, b.name(), b.rows, reason))
+		}
+	}
+	if len(risks) == 0 {
+		return "", nil
+	}
+	return "Possible join explosion: the query joins large tables without any WHERE filter; " + strings.Join(risks, "; ") +
+		". Check the join conditions and add a filter or TOP before running it.", nil
+}
+
+// followsComma reports whether the object reference at pos is an entry after
+// the first in a comma separated FROM list.
+func followsComma(tokens []sqlToken, pos int) bool {
+	for i, t := range tokens {
+		if t.Pos == pos {
+			return i > 0 && tokens[i-1].Text == ","
+		}
+	}
+	return false
+}
+
+// foreignKeyPairs returns the pairs of tables related by a foreign key in
+// either direction, keyed by pairKey.
+func foreignKeyPairs(tables []guardedTable) (map[string]bool, error) {
+	placeholders := make([]string, len(tables))
+	args := make([]interface{}, len(tables))
+	for i, table := range tables {
+		placeholders[i] = fmt.Sprintf("OBJECT_ID(@p%d)", i+1)
+		args[i] = quoteIdentifier(table.schema) + "." + quoteIdentifier(table.table)
+	}
+	in := strings.Join(placeholders, ", ")
+
+	data, err := executeQuery(fmt.Sprintf(`SELECT DISTINCT
+			OBJECT_SCHEMA_NAME(parent_object_id) + '.' + OBJECT_NAME(parent_object_id) AS parent_name,
+			OBJECT_SCHEMA_NAME(referenced_object_id) + '.' + OBJECT_NAME(referenced_object_id) AS referenced_name
+		FROM sys.foreign_keys
+		WHERE parent_object_id IN (%s) AND referenced_object_id IN (%s)`, in, in), true, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	related := make(map[string]bool)
+	for _, row := range data["rows"].([]map[string]interface{}) {
+		related[pairKey(fmt.Sprintf("%v", row["parent_name"]), fmt.Sprintf("%v", row["referenced_name"]))] = true
+	}
+	return related, nil
+}
+
+// pairKey identifies an unordered pair of table names case-insensitively.
+func pairKey(a, b string) string {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a > b {
+		a, b = b, a
+	}
+	return a + "|" + b
+}
@@ -0,0 +1,508 @@
+package mssqlmcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Deepest chain of views followed when tracing a column
+const MAX_LINEAGE_DEPTH = 8
+
+// columnLineage traces one view column back to the table columns it is
+// computed from.
+type columnLineage struct {
+	Column     string
+	Expression string   // the defining expression unless it is a plain column
+	Sources    []string // schema.table.column of base table columns
+	Via        []string // view columns passed through on the way
+	Note       string   // why the column could not be traced
+}
+
+// selectItem is one entry of a SELECT list.
+type selectItem struct {
+	Name       string
+	Expression string
+	Star       bool   // * or qualifier.*
+	Qualifier  string // of a qualified star
+	References [][]string
+	Plain      bool // the expression is a single column reference
+}
+
+// lineageSource is an object a view selects from, with its columns in
+// order. Object is empty for derived tables, CTEs and remote objects, whose
+// columns cannot be looked up.
+type lineageSource struct {
+	reference objectReference
+	schema    string
+	object    string
+	isView    bool
+	columns   []string
+}
+
+// registerLineageTool adds the column_lineage tool.
+func registerLineageTool(s *server.MCPServer) {
+	lineageTool := mcp.NewTool("column_lineage",
+		mcp.WithDescription("Trace the columns of a view back to the table columns they come from, following nested views. Lineage is read from the view definitions and is best-effort: computed columns list every column their expression uses, and UNION views follow their first SELECT."),
+		mcp.WithString("view",
+			mcp.Required(),
+			mcp.Description("View name, optionally schema-qualified (e.g. dbo.vw_Sales)"),
+		),
+		mcp.WithString("column",
+			mcp.Description("Trace only this column of the view"),
+		),
+	)
+
+	s.AddTool(lineageTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, ok := request.Params.Arguments["view"].(string)
+		if !ok || name == "" {
+			return mcp.NewToolResultError("View is required"), nil
+		}
+		column, _ := request.Params.Arguments["column"].(string)
+
+		schema, view, err := resolveObjectName(name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		lineage, err := viewLineage(schema, view, 0, make(map[string][]columnLineage))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error tracing lineage: %v", err)), nil
+		}
+		if column != "" {
+			var selected []columnLineage
+			for _, entry := range lineage {
+				if strings.EqualFold(entry.Column, column) {
+					selected = append(selected, entry)
+				}
+			}
+			if len(selected) == 0 {
+				return mcp.NewToolResultError(fmt.Sprintf("View %s.%s has no column %s", schema, view, column)), nil
+			}
+			lineage = selected
+		}
+		return mcp.NewToolResultText(formatLineage(schema, view, lineage)), nil
+	})
+}
+
+// viewLineage traces every column of a view. Traced views are remembered in
+// traced, which also breaks cycles.
+func viewLineage(schema, view string, depth int, traced map[string][]columnLineage) ([]columnLineage, error) {
+	key := strings.ToLower(schema + "." + view)
+	if lineage, ok := traced[key]; ok {
+		return lineage, nil
+	}
+	if depth > MAX_LINEAGE_DEPTH {
+		return nil, fmt.Errorf("views nested deeper than %d levels", MAX_LINEAGE_DEPTH)
+	}
+	traced[key] = nil
+
+	qualified := quoteIdentifier(schema) + "." + quoteIdentifier(view)
+	data, err := executeQuery(`SELECT o.type, OBJECT_DEFINITION(o.object_id) AS definition
+		FROM sys.objects o WHERE o.object_id = OBJECT_ID(@p1)`, true, qualified)
+	if err != nil {
+		return nil, err
+	}
+	rows := data["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("view %s.%s not found", schema, view)
+	}
+	if objectType := strings.TrimSpace(fmt.Sprintf("%v", rows[0]["type"])); objectType != "V" {
+		return nil, fmt.Errorf("%s.%s is not a view", schema, view)
+	}
+	definition, _ := rows[0]["definition"].(string)
+	if definition == "" {
+		return nil, fmt.Errorf("the definition of %s.%s is encrypted or not visible", schema, view)
+	}
+
+	viewColumns, err := objectColumns(qualified)
+	if err != nil {
+		return nil, err
+	}
+
+	items, references, err := parseViewSelect(definition)
+	if err != nil {
+		lineage := make([]columnLineage, len(viewColumns))
+		for i, column := range viewColumns {
+			lineage[i] = columnLineage{Column: column, Note: err.Error()}
+		}
+		traced[key] = lineage
+		return lineage, nil
+	}
+
+	sources := make([]lineageSource, len(references))
+	for i, reference := range references {
+		sources[i], err = resolveLineageSource(schema, reference)
+		if err != nil {
+			return nil, err
+		}
+	}
+	items = expandStars(items, sources)
+
+	lineage := make([]columnLineage, len(viewColumns))
+	for i, column := range viewColumns {
+		entry := columnLineage{Column: column}
+		// A column list on the view renames the items, so match by position
+		// when the counts agree
+		var item *selectItem
+		if len(items) == len(viewColumns) {
+			item = &items[i]
+		} else {
+			for j := range items {
+				if strings.EqualFold(items[j].Name, column) {
+					item = &items[j]
+					break
+				}
+			}
+		}
+		if item == nil {
+			entry.Note = "not found in the view's SELECT list"
+			lineage[i] = entry
+			continue
+		}
+
+		if !item.Plain {
+			entry.Expression = item.Expression
+		}
+		for _, reference := range item.References {
+			if err := traceReference(&entry, reference, sources, depth, traced); err != nil {
+				return nil, err
+			}
+		}
+		if len(entry.Sources) == 0 && entry.Note == "" {
+			if item.Plain {
+				entry.Note = "source column not found"
+			} else {
+				entry.Note = "computed without table columns"
+			}
+		}
+		lineage[i] = entry
+	}
+	traced[key] = lineage
+	return lineage, nil
+}
+
+// traceReference adds the base columns behind a column reference of a view
+// to its lineage, following the reference into nested views.
+func traceReference(entry *columnLineage, reference []string, sources []lineageSource, depth int, traced map[string][]columnLineage) error {
+	column := reference[len(reference)-1]
+	source, ok := findReferenceSource(reference, sources)
+	if !ok {
+		return nil
+	}
+	if source.object == "" {
+		entry.Sources = appendUnique(entry.Sources, source.reference.Name()+"."+column)
+		if entry.Note == "" {
+			entry.Note = fmt.Sprintf("%s is not a table or view in this database", source.reference.Name())
+		}
+		return nil
+	}
+
+	name := source.schema + "." + source.object
+	if !source.isView {
+		entry.Sources = appendUnique(entry.Sources, name+"."+column)
+		return nil
+	}
+
+	nested, err := viewLineage(source.schema, source.object, depth+1, traced)
+	if err != nil {
+		return err
+	}
+	entry.Via = appendUnique(entry.Via, name+"."+column)
+	for _, inner := range nested {
+		if strings.EqualFold(inner.Column, column) {
+			for _, via := range inner.Via {
+				entry.Via = appendUnique(entry.Via, via)
+			}
+			for _, base := range inner.Sources {
+				entry.Sources = appendUnique(entry.Sources, base)
+			}
+			if inner.Note != "" && entry.Note == "" {
+				entry.Note = fmt.Sprintf("%s: %s", name+"."+column, inner.Note)
+			}
+		}
+	}
+	return nil
+}
+
+// findReferenceSource finds the source a column reference belongs to: by its
+// qualifier (an alias or the object's name) when it has one, or else the
+// only source with a column of that name.
+func findReferenceSource(reference []string, sources []lineageSource) (lineageSource, bool) {
+	column := reference[len(reference)-1]
+	if len(reference) > 1 {
+		qualifier := reference[len(reference)-2]
+		for _, source := range sources {
+			parts := source.reference.Parts
+			if strings.EqualFold(source.reference.Alias, qualifier) ||
+				(source.reference.Alias == "" && strings.EqualFold(parts[len(parts)-1], qualifier)) {
+				return source, true
+			}
+		}
+		return lineageSource{}, false
+	}
+
+	var found []lineageSource
+	for _, source := range sources {
+		for _, name := range source.columns {
+			if strings.EqualFold(name, column) {
+				found = append(found, source)
+				break
+			}
+		}
+	}
+	if len(found) != 1 {
+		return lineageSource{}, false
+	}
+	return found[0], true
+}
+
+// resolveLineageSource looks up the table or view a view selects from. As in
+// the view itself, an unqualified name is taken from the view's schema first
+// and then from dbo.
+func resolveLineageSource(viewSchema string, reference objectReference) (lineageSource, error) {
+	source := lineageSource{reference: reference}
+	if reference.Function || reference.IsTemporary() || len(reference.Parts) > 2 {
+		return source, nil
+	}
+
+	candidates := [][2]string{{viewSchema, reference.Parts[0]}, {"dbo", reference.Parts[0]}}
+	if len(reference.Parts) == 2 {
+		candidates = [][2]string{{reference.Parts[0], reference.Parts[1]}}
+	}
+	for _, candidate := range candidates {
+		qualified := quoteIdentifier(candidate[0]) + "." + quoteIdentifier(candidate[1])
+		data, err := executeQuery(`SELECT OBJECT_SCHEMA_NAME(object_id) AS schema_name, name, type
+			FROM sys.objects WHERE object_id = OBJECT_ID(@p1) AND type IN ('U', 'V')`, true, qualified)
+		if err != nil {
+			return source, err
+		}
+		rows := data["rows"].([]map[string]interface{})
+		if len(rows) == 0 {
+			continue
+		}
+		source.schema = fmt.Sprintf("%v", rows[0]["schema_name"])
+		source.object = fmt.Sprintf("%v", rows[0]["name"])
+		source.isView = strings.TrimSpace(fmt.Sprintf("%v", rows[0]["type"])) == "V"
+		source.columns, err = objectColumns(qualified)
+		return source, err
+	}
+	// CTEs and derived tables are not in the catalog
+	return source, nil
+}
+
+// objectColumns lists the columns of a table or view in order.
+func objectColumns(qualified string) ([]string, error) {
+	data, err := executeQuery("SELECT name FROM sys.columns WHERE object_id = OBJECT_ID(@p1) ORDER BY column_id", true, qualified)
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	for _, row := range data["rows"].([]map[string]interface{}) {
+		columns = append(columns, fmt.Sprintf("%v", row["name"]))
+	}
+	return columns, nil
+}
+
+// parseViewSelect reads the SELECT list and the sources of a view's
+// definition. With UNION and the like only the first SELECT is read, as it
+// names the view's columns.
+func parseViewSelect(definition string) ([]selectItem, []objectReference, error) {
+	tokens := significantTokens(tokenizeSQL(definition))
+	start := findTopLevelKeyword(tokens, 0, "SELECT")
+	if start < 0 {
+		return nil, nil, errors.New("no SELECT found in the view definition")
+	}
+	end := findTopLevelKeyword(tokens, start+1, "FROM", "UNION", "EXCEPT", "INTERSECT")
+	if end < 0 {
+		end = len(tokens)
+	}
+
+	i := start + 1
+	for i < end && (tokens[i].isKeyword("DISTINCT") || tokens[i].isKeyword("ALL")) {
+		i++
+	}
+	if i < end && tokens[i].isKeyword("TOP") {
+		i++
+		if i < end && tokens[i].Text == "(" {
+			i = skipParenthesized(tokens, i)
+		} else {
+			i++
+		}
+		for i < end && (tokens[i].isKeyword("PERCENT") || tokens[i].isKeyword("WITH") || tokens[i].isKeyword("TIES")) {
+			i++
+		}
+	}
+
+	var items []selectItem
+	for i < end {
+		next := i
+		for next < end && !(tokens[next].Text == "," && tokens[next].Depth == 0) {
+			next++
+		}
+		if next > i {
+			items = append(items, parseSelectItem(definition, tokens[i:next]))
+		}
+		i = next + 1
+	}
+
+	// Sources of the first SELECT only, up to where the next one starts
+	body := definition
+	if setOperator := findTopLevelKeyword(tokens, start+1, "UNION", "EXCEPT", "INTERSECT"); setOperator >= 0 {
+		body = definition[:tokens[setOperator].Pos]
+	}
+	return items, findObjectReferences(body[tokens[start].Pos:]), nil
+}
+
+// parseSelectItem reads one entry of a SELECT list: "expression [AS] alias",
+// "alias = expression", "*" or "qualifier.*".
+func parseSelectItem(definition string, tokens []sqlToken) selectItem {
+	var item selectItem
+	last := len(tokens) - 1
+
+	switch {
+	case len(tokens) == 1 && tokens[0].Text == "*":
+		item.Star = true
+		return item
+	case len(tokens) >= 3 && tokens[last].Text == "*" && tokens[last-1].Text == ".":
+		item.Star = true
+		item.Qualifier = unquoteIdentifier(tokens[last-2].Text)
+		return item
+	}
+
+	expression := tokens
+	switch {
+	case len(tokens) > 2 && isNameToken(tokens[0]) && tokens[1].Text == "=":
+		item.Name = unquoteIdentifier(tokens[0].Text)
+		expression = tokens[2:]
+	case len(tokens) > 2 && tokens[last-1].isKeyword("AS"):
+		item.Name = unquoteIdentifier(tokens[last].Text)
+		expression = tokens[:last-1]
+	case len(tokens) > 1 && (isNameToken(tokens[last]) || tokens[last].Kind == tokenString) && endsOperand(tokens[last-1]):
+		item.Name = unquoteIdentifier(strings.Trim(tokens[last].Text, "'"))
+		expression = tokens[:last]
+	}
+	if len(expression) == 0 {
+		return item
+	}
+
+	first, final := expression[0], expression[len(expression)-1]
+	item.Expression = definition[first.Pos : final.Pos+len(final.Text)]
+	item.References = columnReferences(expression)
+	item.Plain = len(item.References) == 1 && len(expression) == 2*len(item.References[0])-1
+	if item.Name == "" && item.Plain {
+		item.Name = item.References[0][len(item.References[0])-1]
+	}
+	return item
+}
+
+// endsOperand reports whether a token can end an expression, so a name after
+// it is an alias rather than part of the expression.
+func endsOperand(t sqlToken) bool {
+	return isNameToken(t) || t.Kind == tokenNumber || t.Kind == tokenString || t.Text == ")" || t.isKeyword("END") || t.isKeyword("NULL")
+}
+
+// columnReferences lists the possibly qualified column names an expression
+// uses, skipping function names, the types of CAST(... AS type) and the date
+// parts of DATEADD and its relatives.
+func columnReferences(tokens []sqlToken) [][]string {
+	var references [][]string
+	for i := 0; i < len(tokens); i++ {
+		if !isNameToken(tokens[i]) || (i > 0 && (tokens[i-1].Text == "." || tokens[i-1].isKeyword("AS"))) {
+			continue
+		}
+		if i > 1 && tokens[i-1].Text == "(" && isDatePartFunction(tokens[i-2]) {
+			continue
+		}
+		parts := []string{unquoteIdentifier(tokens[i].Text)}
+		j := i + 1
+		for j+1 < len(tokens) && tokens[j].Text == "." && isNameToken(tokens[j+1]) {
+			parts = append(parts, unquoteIdentifier(tokens[j+1].Text))
+			j += 2
+		}
+		if j < len(tokens) && (tokens[j].Text == "(" || tokens[j].Text == ".") {
+			i = j - 1
+			continue
+		}
+		references = append(references, parts)
+		i = j - 1
+	}
+	return references
+}
+
+func isDatePartFunction(t sqlToken) bool {
+	for _, function := range []string{"DATEADD", "DATEDIFF", "DATEDIFF_BIG", "DATENAME", "DATEPART", "DATETRUNC", "DATE_BUCKET"} {
+		if t.isKeyword(function) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandStars replaces * and qualifier.* with the columns of the sources
+// they stand for, as far as those are known.
+func expandStars(items []selectItem, sources []lineageSource) []selectItem {
+	var expanded []selectItem
+	for _, item := range items {
+		if !item.Star {
+			expanded = append(expanded, item)
+			continue
+		}
+		for _, source := range sources {
+			parts := source.reference.Parts
+			if item.Qualifier != "" && !strings.EqualFold(source.reference.Alias, item.Qualifier) &&
+				!(source.reference.Alias == "" && strings.EqualFold(parts[len(parts)-1], item.Qualifier)) {
+				continue
+			}
+			qualifier := source.reference.Alias
+			if qualifier == "" {
+				qualifier = parts[len(parts)-1]
+			}
+			for _, column := range source.columns {
+				expanded = append(expanded, selectItem{
+					Name:       column,
+					References: [][]string{{qualifier, column}},
+					Plain:      true,
+				})
+			}
+		}
+	}
+	return expanded
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if strings.EqualFold(existing, value) {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// formatLineage renders the lineage of a view's columns as a list.
+func formatLineage(schema, view string, lineage []columnLineage) string {
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# Column lineage of %s.%s\n\n", schema, view))
+	for _, entry := range lineage {
+		result.WriteString("- " + entry.Column)
+		if len(entry.Sources) > 0 {
+			result.WriteString(" ← " + strings.Join(entry.Sources, ", "))
+		}
+		result.WriteString("\n")
+		if entry.Expression != "" {
+			result.WriteString(fmt.Sprintf("  - computed as: %s\n", strings.Join(strings.Fields(entry.Expression), " ")))
+		}
+		if len(entry.Via) > 0 {
+			result.WriteString(fmt.Sprintf("  - via: %s\n", strings.Join(entry.Via, ", ")))
+		}
+		if entry.Note != "" {
+			result.WriteString(fmt.Sprintf("  - unresolved: %s\n", entry.Note))
+		}
+	}
+	result.WriteString("\nLineage is read from the view definitions and is best-effort.\n")
+	return result.String()
+}
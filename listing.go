@@ -0,0 +1,115 @@
+package mssqlmcp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Number of objects a listing tool returns unless asked for more
+const DEFAULT_LIST_LIMIT = 200
+
+// listFilter narrows the objects a listing tool returns and pages through
+// them.
+type listFilter struct {
+	Schema string // schema name pattern
+	Name   string // object name pattern
+	Limit  int
+	Offset int
+}
+
+// listFilterOptions are the tool arguments of a listFilter; withSchema adds
+// the schema pattern for listings of schema-scoped objects.
+func listFilterOptions(withSchema bool) []mcp.ToolOption {
+	var options []mcp.ToolOption
+	if withSchema {
+		options = append(options, mcp.WithString("schema",
+			mcp.Description("Only objects in schemas matching this pattern; * and % match any text, ? one character, case is ignored"),
+		))
+	}
+	return append(options,
+		mcp.WithString("name",
+			mcp.Description("Only objects whose name matches this pattern, e.g. Order* or *audit*; * and % match any text, ? one character, case is ignored"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Number of objects to return (default %d)", DEFAULT_LIST_LIMIT)),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Number of matching objects to skip, to read the next page (default 0)"),
+		),
+	)
+}
+
+// listFilterFromArguments reads the listFilter arguments of a tool call.
+func listFilterFromArguments(arguments map[string]interface{}) listFilter {
+	filter := listFilter{Limit: DEFAULT_LIST_LIMIT}
+	filter.Schema, _ = arguments["schema"].(string)
+	filter.Name, _ = arguments["name"].(string)
+	if value, ok := arguments["limit"].(float64); ok && value >= 1 {
+		filter.Limit = int(value)
+	}
+	if value, ok := arguments["offset"].(float64); ok && value > 0 {
+		filter.Offset = int(value)
+	}
+	return filter
+}
+
+// likePattern turns a name pattern into a LIKE pattern escaped with \. Only
+// *, % and ? are wildcards, so names with underscores match literally.
+func likePattern(pattern string) string {
+	var like strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*', '%':
+			like.WriteRune('%')
+		case '?':
+			like.WriteRune('_')
+		case '_', '[', '\\':
+			like.WriteRune('\\')
+			like.WriteRune(r)
+		default:
+			like.WriteRune(r)
+		}
+	}
+	return like.String()
+}
+
+// conditions returns the SQL conditions matching the schema and name
+// expressions against the patterns, each prefixed with AND, binding the
+// patterns after the existing args.
+func (f listFilter) conditions(schemaExpression, nameExpression string, args []interface{}) (string, []interface{}) {
+	var conditions strings.Builder
+	for _, match := range [][2]string{{schemaExpression, f.Schema}, {nameExpression, f.Name}} {
+		if match[0] == "" || match[1] == "" {
+			continue
+		}
+		args = append(args, likePattern(match[1]))
+		conditions.WriteString(fmt.Sprintf(" AND UPPER(%s) LIKE UPPER(@p%d) ESCAPE '\\'", match[0], len(args)))
+	}
+	return conditions.String(), args
+}
+
+// paging returns the clause following ORDER BY that reads the page, with
+// one row more than the limit to tell whether another page follows.
+func (f listFilter) paging() string {
+	return fmt.Sprintf(" OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", f.Offset, f.Limit+1)
+}
+
+// page cuts the extra row read by paging from the results and returns a note
+// on where the page lies, or "" when everything matching fits on it.
+func (f listFilter) page(data map[string]interface{}) string {
+	rows, _ := data["rows"].([]map[string]interface{})
+	if len(rows) <= f.Limit {
+		switch {
+		case f.Offset == 0:
+			return ""
+		case len(rows) == 0:
+			return fmt.Sprintf("No more objects match past offset %d.", f.Offset)
+		}
+		return fmt.Sprintf("Objects %d to %d; this is the last page.", f.Offset+1, f.Offset+len(rows))
+	}
+	data["rows"] = rows[:f.Limit]
+	return fmt.Sprintf("Objects %d to %d; more match, so call again with offset=%d for the next page or narrow the listing with schema or name.",
+		f.Offset+1, f.Offset+f.Limit, f.Offset+f.Limit)
+}
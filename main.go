@@ -1,17 +1,28 @@
-package main
+// Package mssqlmcp is an MCP server for Microsoft SQL Server, configured
+// through MSSQL_* environment variables. The mssql_mcp_server_go command under
+// cmd serves it over stdio; the client package calls its tools from Go code.
+package mssqlmcp
 
 import (
 	"context"
 	"database/sql"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	_ "github.com/denisenkom/go-mssqldb"
+	mssql "github.com/denisenkom/go-mssqldb"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
@@ -19,28 +30,315 @@ import (
 // Constants for timeout handling
 const DEFAULT_QUERY_TIMEOUT = 120 // seconds
 
+// Number of sample rows included in table resources
+const DEFAULT_RESOURCE_SAMPLE_ROWS = 5
+
+// Maximum number of rows returned by OUTPUT clause capture
+const DEFAULT_CAPTURE_OUTPUT_ROWS = 20
+
+// Maximum number of rows read when profiling a column
+const DEFAULT_PROFILE_SAMPLE_ROWS = 100000
+
+// Largest SQL file execute_sql reads through query_file
+const MAX_QUERY_FILE_SIZE = 1 << 20 // bytes
+
+// Seconds allowed to open a TCP connection; endpoints across regions or
+// behind a VPC peering (e.g. RDS) can need more than the default
+const DEFAULT_DIAL_TIMEOUT = 15
+
+// Seconds allowed for connecting and logging in, 0 leaving it to the query timeout
+const DEFAULT_LOGIN_TIMEOUT = 0
+
+// Seconds an export to a file may run, longer than interactive queries
+const DEFAULT_EXPORT_TIMEOUT = 3600
+
+// Export size above which an explicit confirmation is required
+const DEFAULT_EXPORT_CONFIRM_ROWS = 100000
+const DEFAULT_EXPORT_CONFIRM_BYTES = 100 << 20
+
+// Share of fully duplicate rows in a result above which a warning is added
+const DEFAULT_DUPLICATE_WARN_PERCENT = 30
+
+// Results smaller than this are never checked for duplicates
+const MIN_DUPLICATE_CHECK_ROWS = 10
+
+// Row count from which a table counts as large for the join-explosion guard
+const DEFAULT_JOIN_GUARD_ROWS = 1000000
+
+// Time window covered by azure_resource_stats by default
+const DEFAULT_AZURE_STATS_MINUTES = 60 // minutes
+
+// Maximum number of rows execute_sql returns unless max_rows says otherwise
+const DEFAULT_MAX_ROWS = 1000
+
+// Bytes of a binary value shown before it is cut short
+const DEFAULT_BINARY_MAX_BYTES = 64
+
+// Characters of a text value shown in query results before it is cut short
+const DEFAULT_MAX_CELL_LENGTH = 4000
+
+// Approximate size, in LLM tokens, that formatted query results are shaped to fit
+const DEFAULT_MAX_OUTPUT_TOKENS = 20000
+
+// Query results kept per session for follow-up tools such as diff_results
+const DEFAULT_RESULT_HISTORY = 10
+
+// Text shown for NULL values in text output
+const DEFAULT_NULL_TOKEN = "NULL"
+
+// Idle time after which a sticky session is released and its open transaction rolled back
+const DEFAULT_SESSION_IDLE_TIMEOUT = 300 // seconds
+
 // Database connection configuration
 type DbConfig struct {
-	Driver       string
-	Server       string
-	User         string
-	Password     string
-	Database     string
-	QueryTimeout int
+	Driver             string
+	Server             string
+	User               string
+	Password           string
+	Database           string
+	QueryTimeout       int
+	ResourceSampleRows int
+	CaptureWriteOutput bool
+	CaptureOutputRows  int
+	StickySessions     bool
+	SessionIdleTimeout int
+	SoftDeleteColumns  []string
+	SoftDeleteFilter   bool
+	DatetimeStorage    string
+	ProfileSampleRows  int
+	QueryFileRoot      string
+	ExportConfirmRows  int64
+	ExportConfirmBytes int64
+	DuplicateWarnPct   int
+	JoinGuardRows      int
+	JoinGuardStrict    bool
+	SnapshotDatabase   string
+	SnapshotPattern    string
+	OutputFormat       string
+	DescribeFormat     string
+	ExternalDataPolicy string
+	QueryPolicyFile    string
+	SessionOptions     []string
+	SessionInitSQL     string
+	EnglishErrors      bool
+	SessionTagging     bool
+	QueryComments      bool
+	ResultDigest       bool
+	ResultHMACKey      string
+	RedactErrors       string
+	MaskedColumns      []string
+	MaxRows            int
+	AllowedQueryHints  []string
+	AllowedUseHints    []string
+	DatetimeFormat     string
+	Timezone           string
+	DisplayLocation    *time.Location
+	StorageLocation    *time.Location
+	SubscriptionsFile  string
+	BinaryFormat       string
+	BinaryMaxBytes     int
+	SummaryTables      []string
+	SummaryInterval    int
+	SummaryFile        string
+	TenancyModel       string
+	Tenant             string
+	TenantColumn       string
+	SharedSchemas      []string
+	NullToken          string
+	AnnotateLag        bool
+	AnnotateSources    bool
+	MaxCellLength      int
+	ResultHistory      int
+	MaxOutputTokens    int
+	OutputDelimiter    rune
+	CassetteFile       string
+	CassetteMode       string
+	ExportRoot         string
+	ImportRoot         string
+	SecretProvider     string
+	Port               int
+	Encrypt            string
+	TrustServerCert    bool
+	CACertificate      string
+	HostInCertificate  string
+	DialTimeout        int
+	LoginTimeout       int
+	ExportTimeout      int
+	CloudSQLInstance   string
+	CloudSQLIPType     string
+	AboutFile          string
+	PrettyPrint        bool
+	AllowWrite         bool
+	AllowedProcedures  []string
+	WritableTables     []string
+	AllowedObjects     []string
+	DeniedObjects      []string
+	UnfilteredWrites   bool
+	MaxAffectedRows    int
+	SessionTimeBudget  int
+	ReadOnlyUser       string
+	VerifyReadOnly     bool
+	SCDTables          []string
+	SCDColumns         []string
+	SCDEndInclusive    bool
 }
 
 func getDbConfig() (*DbConfig, error) {
 	config := &DbConfig{
-		Driver:       getEnvOrDefault("MSSQL_DRIVER", "sqlserver"),
-		Server:       getEnvOrDefault("MSSQL_HOST", "localhost"),
-		User:         getEnvOrDefault("MSSQL_USER", ""),
-		Password:     getEnvOrDefault("MSSQL_PASSWORD", ""),
-		Database:     getEnvOrDefault("MSSQL_DATABASE", ""),
-		QueryTimeout: getEnvIntOrDefault("MSSQL_QUERY_TIMEOUT", DEFAULT_QUERY_TIMEOUT),
+		Driver:             getEnvOrDefault("MSSQL_DRIVER", "sqlserver"),
+		Server:             getEnvOrDefault("MSSQL_HOST", "localhost"),
+		User:               getEnvOrDefault("MSSQL_USER", ""),
+		Database:           getEnvOrDefault("MSSQL_DATABASE", ""),
+		QueryTimeout:       getEnvIntOrDefault("MSSQL_QUERY_TIMEOUT", DEFAULT_QUERY_TIMEOUT),
+		ResourceSampleRows: getEnvIntOrDefault("MSSQL_RESOURCE_SAMPLE_ROWS", DEFAULT_RESOURCE_SAMPLE_ROWS),
+		CaptureWriteOutput: getEnvBoolOrDefault("MSSQL_CAPTURE_WRITE_OUTPUT", false),
+		CaptureOutputRows:  getEnvIntOrDefault("MSSQL_CAPTURE_OUTPUT_ROWS", DEFAULT_CAPTURE_OUTPUT_ROWS),
+		StickySessions:     getEnvBoolOrDefault("MSSQL_STICKY_SESSIONS", false),
+		SessionIdleTimeout: getEnvIntOrDefault("MSSQL_SESSION_IDLE_TIMEOUT", DEFAULT_SESSION_IDLE_TIMEOUT),
+		SoftDeleteColumns:  getEnvListOrDefault("MSSQL_SOFT_DELETE_COLUMNS", nil),
+		SoftDeleteFilter:   getEnvBoolOrDefault("MSSQL_SOFT_DELETE_FILTER", false),
+		DatetimeStorage:    getEnvOrDefault("MSSQL_DATETIME_STORAGE", ""),
+		ProfileSampleRows:  getEnvIntOrDefault("MSSQL_PROFILE_SAMPLE_ROWS", DEFAULT_PROFILE_SAMPLE_ROWS),
+		QueryFileRoot:      getEnvOrDefault("MSSQL_QUERY_FILE_ROOT", ""),
+		ExportConfirmRows:  int64(getEnvIntOrDefault("MSSQL_EXPORT_CONFIRM_ROWS", DEFAULT_EXPORT_CONFIRM_ROWS)),
+		ExportConfirmBytes: int64(getEnvIntOrDefault("MSSQL_EXPORT_CONFIRM_BYTES", DEFAULT_EXPORT_CONFIRM_BYTES)),
+		ExportRoot:         getEnvOrDefault("MSSQL_EXPORT_ROOT", ""),
+		ImportRoot:         getEnvOrDefault("MSSQL_IMPORT_ROOT", ""),
+		DuplicateWarnPct:   getEnvIntOrDefault("MSSQL_DUPLICATE_WARN_PERCENT", DEFAULT_DUPLICATE_WARN_PERCENT),
+		JoinGuardRows:      getEnvIntOrDefault("MSSQL_JOIN_GUARD_ROWS", DEFAULT_JOIN_GUARD_ROWS),
+		JoinGuardStrict:    getEnvBoolOrDefault("MSSQL_JOIN_GUARD_STRICT", false),
+		SnapshotDatabase:   getEnvOrDefault("MSSQL_SNAPSHOT_DATABASE", ""),
+		SnapshotPattern:    getEnvOrDefault("MSSQL_SNAPSHOT_PATTERN", ""),
+		OutputFormat:       getEnvOrDefault("MSSQL_OUTPUT_FORMAT", "text"),
+		DescribeFormat:     getEnvOrDefault("MSSQL_DESCRIBE_FORMAT", describeFull),
+		ExternalDataPolicy: getEnvOrDefault("MSSQL_EXTERNAL_DATA_POLICY", externalDataTables),
+		QueryPolicyFile:    getEnvOrDefault("MSSQL_QUERY_POLICY_FILE", ""),
+		SessionOptions:     getEnvListOrDefault("MSSQL_SESSION_OPTIONS", nil),
+		EnglishErrors:      getEnvBoolOrDefault("MSSQL_ENGLISH_ERRORS", false),
+		SessionTagging:     getEnvBoolOrDefault("MSSQL_SESSION_TAGGING", true),
+		QueryComments:      getEnvBoolOrDefault("MSSQL_QUERY_COMMENTS", true),
+		ResultDigest:       getEnvBoolOrDefault("MSSQL_RESULT_DIGEST", false),
+		ResultHMACKey:      getEnvOrDefault("MSSQL_RESULT_HMAC_KEY", ""),
+		RedactErrors:       strings.ToLower(getEnvOrDefault("MSSQL_REDACT_ERRORS", redactAuto)),
+		MaskedColumns:      getEnvListOrDefault("MSSQL_MASKED_COLUMNS", nil),
+		MaxRows:            getEnvIntOrDefault("MSSQL_MAX_ROWS", DEFAULT_MAX_ROWS),
+		AllowedQueryHints:  getEnvListOrDefault("MSSQL_ALLOWED_QUERY_HINTS", defaultQueryHints),
+		AllowedUseHints:    getEnvListOrDefault("MSSQL_ALLOWED_USE_HINTS", defaultUseHints),
+		DatetimeFormat:     getEnvOrDefault("MSSQL_DATETIME_FORMAT", "iso8601"),
+		Timezone:           getEnvOrDefault("MSSQL_TIMEZONE", ""),
+		SubscriptionsFile:  getEnvOrDefault("MSSQL_SUBSCRIPTIONS_FILE", ""),
+		BinaryFormat:       getEnvOrDefault("MSSQL_BINARY_FORMAT", "hex"),
+		BinaryMaxBytes:     getEnvIntOrDefault("MSSQL_BINARY_MAX_BYTES", DEFAULT_BINARY_MAX_BYTES),
+		SummaryTables:      getEnvListOrDefault("MSSQL_SUMMARY_TABLES", nil),
+		SummaryInterval:    getEnvIntOrDefault("MSSQL_SUMMARY_INTERVAL", DEFAULT_SUMMARY_INTERVAL),
+		SummaryFile:        getEnvOrDefault("MSSQL_SUMMARY_FILE", ""),
+		TenancyModel:       strings.ToLower(getEnvOrDefault("MSSQL_TENANCY_MODEL", "")),
+		Tenant:             getEnvOrDefault("MSSQL_TENANT", ""),
+		TenantColumn:       getEnvOrDefault("MSSQL_TENANT_COLUMN", "TenantID"),
+		SharedSchemas:      getEnvListOrDefault("MSSQL_SHARED_SCHEMAS", nil),
+		NullToken:          getEnvOrDefault("MSSQL_NULL_TOKEN", DEFAULT_NULL_TOKEN),
+		AnnotateLag:        getEnvBoolOrDefault("MSSQL_ANNOTATE_REPLICA_LAG", false),
+		AnnotateSources:    getEnvBoolOrDefault("MSSQL_ANNOTATE_SOURCES", false),
+		MaxCellLength:      getEnvIntOrDefault("MSSQL_MAX_CELL_LENGTH", DEFAULT_MAX_CELL_LENGTH),
+		ResultHistory:      getEnvIntOrDefault("MSSQL_RESULT_HISTORY", DEFAULT_RESULT_HISTORY),
+		MaxOutputTokens:    getEnvIntOrDefault("MSSQL_MAX_OUTPUT_TOKENS", DEFAULT_MAX_OUTPUT_TOKENS),
+		CassetteFile:       getEnvOrDefault("MSSQL_CASSETTE", ""),
+		CassetteMode:       strings.ToLower(getEnvOrDefault("MSSQL_CASSETTE_MODE", "")),
+		SecretProvider:     getEnvOrDefault("MSSQL_SECRET_PROVIDER", "env"),
+		Port:               getEnvIntOrDefault("MSSQL_PORT", 0),
+		CACertificate:      getEnvOrDefault("MSSQL_CA_CERTIFICATE", ""),
+		HostInCertificate:  getEnvOrDefault("MSSQL_HOSTNAME_IN_CERTIFICATE", ""),
+		DialTimeout:        getEnvIntOrDefault("MSSQL_DIAL_TIMEOUT", DEFAULT_DIAL_TIMEOUT),
+		LoginTimeout:       getEnvIntOrDefault("MSSQL_LOGIN_TIMEOUT", DEFAULT_LOGIN_TIMEOUT),
+		ExportTimeout:      getEnvIntOrDefault("MSSQL_EXPORT_TIMEOUT", DEFAULT_EXPORT_TIMEOUT),
+		CloudSQLInstance:   getEnvOrDefault("MSSQL_CLOUDSQL_INSTANCE", ""),
+		CloudSQLIPType:     strings.ToLower(getEnvOrDefault("MSSQL_CLOUDSQL_IP_TYPE", cloudSQLPublicIP)),
+		AboutFile:          getEnvOrDefault("MSSQL_ABOUT_FILE", ""),
+		PrettyPrint:        getEnvBoolOrDefault("MSSQL_PRETTY_PRINT", false),
+		AllowWrite:         getEnvBoolOrDefault("MSSQL_ALLOW_WRITE", false),
+		AllowedProcedures:  getEnvListOrDefault("MSSQL_ALLOWED_PROCEDURES", nil),
+		WritableTables:     getEnvListOrDefault("MSSQL_WRITABLE_TABLES", nil),
+		AllowedObjects:     getEnvListOrDefault("MSSQL_ALLOWED_OBJECTS", nil),
+		DeniedObjects:      getEnvListOrDefault("MSSQL_DENIED_OBJECTS", nil),
+		UnfilteredWrites:   getEnvBoolOrDefault("MSSQL_ALLOW_UNFILTERED_WRITES", false),
+		MaxAffectedRows:    getEnvIntOrDefault("MSSQL_MAX_AFFECTED_ROWS", 0),
+		SessionTimeBudget:  getEnvIntOrDefault("MSSQL_SESSION_TIME_BUDGET", 0),
+		ReadOnlyUser:       getEnvOrDefault("MSSQL_READ_ONLY_USER", ""),
+		VerifyReadOnly:     getEnvBoolOrDefault("MSSQL_VERIFY_READ_ONLY", false),
+		SCDTables:          getEnvListOrDefault("MSSQL_SCD_TABLES", nil),
+		SCDColumns:         getEnvListOrDefault("MSSQL_SCD_COLUMNS", defaultSCDColumns),
+		SCDEndInclusive:    getEnvBoolOrDefault("MSSQL_SCD_END_INCLUSIVE", false),
+	}
+	// The Cloud SQL connector already wraps connections in TLS, so only the
+	// login is encrypted again unless asked otherwise
+	defaultEncrypt := "true"
+	if config.CloudSQLInstance != "" {
+		defaultEncrypt = "false"
+	}
+	config.Encrypt = strings.ToLower(getEnvOrDefault("MSSQL_ENCRYPT", defaultEncrypt))
+	// The certificate is only skipped when no CA to check it against is given
+	config.TrustServerCert = getEnvBoolOrDefault("MSSQL_TRUST_SERVER_CERTIFICATE", config.CACertificate == "")
+
+	if config.Encrypt != "true" && config.Encrypt != "false" && config.Encrypt != "disable" {
+		return nil, fmt.Errorf("invalid MSSQL_ENCRYPT %q (expected true, false or disable)", config.Encrypt)
+	}
+	if err := validateCloudSQLConfig(config); err != nil {
+		return nil, err
+	}
+
+	if config.CassetteMode != "" && config.CassetteFile == "" {
+		return nil, errors.New("MSSQL_CASSETTE_MODE needs a cassette file in MSSQL_CASSETTE")
+	}
+
+	// Replay answers every query from the cassette, so no database is needed
+	if config.CassetteMode != cassetteReplay {
+		credentials, err := loadCredentials(config.SecretProvider)
+		if err != nil {
+			return nil, fmt.Errorf("reading credentials (MSSQL_SECRET_PROVIDER=%s): %v", config.SecretProvider, err)
+		}
+		if credentials.User != "" {
+			config.User = credentials.User
+		}
+		config.Password = credentials.Password
+
+		if config.User == "" || config.Password == "" || config.Database == "" {
+			return nil, errors.New("missing required database configuration (MSSQL_USER, MSSQL_PASSWORD or MSSQL_SECRET_PROVIDER, MSSQL_DATABASE)")
+		}
+	}
+
+	// Localized messages are harder to recognize than the English ones
+	if config.EnglishErrors {
+		config.SessionOptions = withEnglishMessages(config.SessionOptions)
+	}
+	initSQL, err := sessionInitSQL(config.SessionOptions)
+	if err != nil {
+		return nil, fmt.Errorf("MSSQL_SESSION_OPTIONS: %v", err)
+	}
+	config.SessionInitSQL = initSQL
+
+	config.DisplayLocation, config.StorageLocation, err = datetimeLocations(config)
+	if err != nil {
+		return nil, err
+	}
+
+	config.OutputDelimiter, err = parseDelimiter(getEnvOrDefault("MSSQL_OUTPUT_DELIMITER", ","))
+	if err != nil {
+		return nil, fmt.Errorf("MSSQL_OUTPUT_DELIMITER: %v", err)
+	}
+
+	if config.DescribeFormat != describeFull && config.DescribeFormat != describeCard {
+		return nil, fmt.Errorf("invalid MSSQL_DESCRIBE_FORMAT %q (expected full or card)", config.DescribeFormat)
+	}
+	if config.RedactErrors != redactAuto && config.RedactErrors != redactOn && config.RedactErrors != redactOff {
+		return nil, fmt.Errorf("invalid MSSQL_REDACT_ERRORS %q (expected auto, on or off)", config.RedactErrors)
+	}
+	if config.ReadOnlyUser != "" && config.AllowWrite {
+		return nil, errors.New("MSSQL_READ_ONLY_USER cannot be combined with MSSQL_ALLOW_WRITE")
 	}
 
-	if config.User == "" || config.Password == "" || config.Database == "" {
-		return nil, errors.New("missing required database configuration (MSSQL_USER, MSSQL_PASSWORD, MSSQL_DATABASE)")
+	// An unknown tenancy model must not silently disable tenant scoping
+	if config.TenancyModel != "" && config.TenancyModel != tenancySchema && config.TenancyModel != tenancyColumn {
+		return nil, fmt.Errorf("invalid MSSQL_TENANCY_MODEL %q (expected schema or column)", config.TenancyModel)
 	}
 
 	return config, nil
@@ -64,38 +362,185 @@ func getEnvIntOrDefault(key string, defaultValue int) int {
 	return defaultValue
 }
 
-func isWriteOperation(query string) bool {
-	normalizedQuery := strings.TrimSpace(strings.ToUpper(query))
+func getEnvBoolOrDefault(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		result, err := strconv.ParseBool(value)
+		if err == nil {
+			return result
+		}
+	}
+	return defaultValue
+}
 
-	// List of SQL commands that modify data or structure
-	writeOperations := []string{
-		"CREATE", "ALTER", "DROP", "INSERT", "UPDATE", "DELETE",
-		"TRUNCATE", "MERGE", "UPSERT", "GRANT", "REVOKE", "EXEC", "EXECUTE",
+// parseDelimiter reads a field delimiter: one character, or "tab" / "\t".
+func parseDelimiter(value string) (rune, error) {
+	switch strings.ToLower(value) {
+	case "tab", `\t`, "\t":
+		return '\t', nil
+	}
+	runes := []rune(value)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' {
+		return 0, fmt.Errorf("invalid delimiter %q (expected one character other than a quote or line break)", value)
 	}
+	return runes[0], nil
+}
 
-	for _, operation := range writeOperations {
-		if strings.HasPrefix(normalizedQuery, operation) || strings.Contains(normalizedQuery, " "+operation+" ") {
-			return true
+// getEnvListOrDefault reads a comma separated list, dropping empty entries.
+func getEnvListOrDefault(key string, defaultValue []string) []string {
+	if value, exists := os.LookupEnv(key); exists {
+		var result []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
 		}
+		return result
 	}
+	return defaultValue
+}
+
+// isWriteOperation reports whether a query may change the database or the
+// server, classifying its tokens so that keywords inside strings, comments
+// and bracketed identifiers are ignored. Besides data and schema changes it
+// counts procedure calls, EXEC of dynamic SQL, SELECT ... INTO, permission
+// and maintenance statements, USE and Service Broker SEND and RECEIVE, and
+// OPENQUERY or OPENROWSET pass-through queries that may write remotely.
+func isWriteOperation(query string) bool {
+	tokens := significantTokens(tokenizeSQL(query))
+	for i, t := range tokens {
+		if t.Kind != tokenWord {
+			continue
+		}
+		// A batch starting with a name calls that procedure, as if with EXEC
+		statementStart := i == 0 || tokens[i-1].Text == ";"
+		if i == 0 && isNameToken(t) && !t.isKeyword("RECEIVE") {
+			return true
+		}
+		next := func(word string) bool {
+			return i+1 < len(tokens) && tokens[i+1].isKeyword(word)
+		}
 
+		switch strings.ToUpper(t.Text) {
+		case "INSERT", "UPDATE", "DELETE", "MERGE", "TRUNCATE", "CREATE", "ALTER", "DROP",
+			"GRANT", "REVOKE", "DENY", "EXEC", "EXECUTE", "BULK", "BACKUP", "RESTORE", "DBCC", "KILL",
+			"SHUTDOWN", "RECONFIGURE", "CHECKPOINT", "WRITETEXT", "UPDATETEXT", "SETUSER", "USE":
+			return true
+		case "INTO":
+			// FETCH ... INTO @variable only assigns variables
+			if i+1 < len(tokens) && tokens[i+1].Kind == tokenVariable {
+				continue
+			}
+			return true
+		case "ENABLE", "DISABLE":
+			if next("TRIGGER") {
+				return true
+			}
+		case "SEND":
+			if next("ON") {
+				return true
+			}
+		case "RECEIVE":
+			if statementStart {
+				return true
+			}
+		case "OPENQUERY", "OPENROWSET":
+			if i+1 < len(tokens) && tokens[i+1].Text == "(" && passThroughWrites(tokens, i+1) {
+				return true
+			}
+		}
+	}
 	return false
 }
 
 func getConnection(config *DbConfig) (*sql.DB, error) {
-	// Build connection string
-	connString := fmt.Sprintf("server=%s;user id=%s;password=%s;database=%s;encrypt=true;trustservercertificate=true",
-		config.Server, config.User, config.Password, config.Database)
+	// Exploration may be redirected to a read-only database snapshot
+	database := config.Database
+	if config.SnapshotDatabase != "" || config.SnapshotPattern != "" {
+		var err error
+		database, err = resolveSnapshotDatabase(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return openDatabase(config, database)
+}
+
+// connectionURL builds the driver's connection string for a database. The
+// URL form keeps passwords from secret stores intact whatever punctuation
+// they contain. MSSQL_HOST may carry the port ("host,1433") or a named
+// instance ("host\instance") as in ADO connection strings.
+func connectionURL(config *DbConfig, database string) string {
+	host := strings.TrimPrefix(config.Server, "tcp:")
+	port := config.Port
+	if name, portText, ok := strings.Cut(host, ","); ok {
+		host = name
+		if port == 0 {
+			port, _ = strconv.Atoi(strings.TrimSpace(portText))
+		}
+	}
+	instance := ""
+	if name, instanceName, ok := strings.Cut(host, `\`); ok {
+		host, instance = name, "/"+instanceName
+	}
+	if port > 0 {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+
+	query := url.Values{}
+	query.Set("database", database)
+	query.Set("encrypt", config.Encrypt)
+	query.Set("trustservercertificate", strconv.FormatBool(config.TrustServerCert))
+	if config.CACertificate != "" {
+		query.Set("certificate", config.CACertificate)
+	}
+	if config.HostInCertificate != "" {
+		query.Set("hostnameincertificate", config.HostInCertificate)
+	}
+	query.Set("dial timeout", strconv.Itoa(config.DialTimeout))
+	if config.LoginTimeout > 0 {
+		query.Set("connection timeout", strconv.Itoa(config.LoginTimeout))
+	}
+
+	connection := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(config.User, config.Password),
+		Host:     host,
+		Path:     instance,
+		RawQuery: query.Encode(),
+	}
+	return connection.String()
+}
 
-	// Create connection
-	db, err := sql.Open("sqlserver", connString)
+// openDatabase connects to the named database of the configured server.
+func openDatabase(config *DbConfig, database string) (*sql.DB, error) {
+	// Create connection; the connector re-applies the session options
+	// whenever the pool resets a connection
+	connector, err := mssql.NewConnector(connectionURL(config, database))
 	if err != nil {
 		return nil, err
 	}
+	connector.SessionInitSQL = config.SessionInitSQL
+	if config.SessionTagging {
+		connector.SessionInitSQL = strings.TrimSpace(config.SessionInitSQL + " " + sessionContextSQL(activeQueryTag()))
+	}
+	if config.ReadOnlyUser != "" {
+		connector.SessionInitSQL = strings.TrimSpace(connector.SessionInitSQL + " " + impersonationSQL(config.ReadOnlyUser))
+	}
+	if config.CloudSQLInstance != "" {
+		connector.Dialer, err = newCloudSQLDialer(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	db := sql.OpenDB(connector)
 
 	// Set connection properties
 	db.SetMaxOpenConns(10)
 	db.SetMaxIdleConns(5)
+	if config.ReadOnlyUser != "" {
+		// An impersonation that cannot be reverted survives no reset
+		db.SetMaxIdleConns(0)
+	}
 	db.SetConnMaxLifetime(time.Minute * 3)
 	db.SetConnMaxIdleTime(time.Minute * 1)
 
@@ -103,94 +548,127 @@ func getConnection(config *DbConfig) (*sql.DB, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.QueryTimeout)*time.Second)
 	defer cancel()
 
-	// Test connection
+	// Test connection; a database that is not ONLINE is reported as such
+	// rather than as a login failure
 	err = db.PingContext(ctx)
 	if err != nil {
 		db.Close()
-		return nil, err
+		// A rejected login may mean the secret was rotated
+		var sqlErr mssql.Error
+		if errors.As(err, &sqlErr) && sqlErr.Number == 18456 {
+			forgetCredentials()
+		}
+		return nil, explainConnectionError(config, database, err)
 	}
 
 	return db, nil
 }
 
-func executeQuery(query string, fetchResults bool) (map[string]interface{}, error) {
+func executeQuery(query string, fetchResults bool, args ...interface{}) (map[string]interface{}, error) {
 	config, err := getDbConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	db, err := getConnection(config)
-	if err != nil {
-		return nil, fmt.Errorf("database connection error: %v", err)
-	}
-	defer db.Close()
+	return withCassette(config, query, 0, args, func() (map[string]interface{}, error) {
+		db, err := getConnection(config)
+		if err != nil {
+			return nil, fmt.Errorf("database connection error: %v", err)
+		}
+		defer db.Close()
+
+		return runQuery(db, config, query, fetchResults, args...)
+	})
+}
+
+// queryer is implemented by *sql.DB, *sql.Conn and *sql.Tx, so the same
+// execution path serves pooled, pinned and transactional queries.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
 
+func runQuery(db queryer, config *DbConfig, query string, fetchResults bool, args ...interface{}) (map[string]interface{}, error) {
+	return runQueryLimited(db, config, query, fetchResults, 0, args...)
+}
+
+// runQueryLimited is runQuery with a cap on the rows fetched: when maxRows is
+// positive, reading stops after that many rows and the result is marked as
+// truncated, with the optimizer's estimate of the full row count if known.
+func runQueryLimited(db queryer, config *DbConfig, query string, fetchResults bool, maxRows int, args ...interface{}) (map[string]interface{}, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.QueryTimeout)*time.Second)
 	defer cancel()
 
 	if fetchResults {
 		// Execute query and fetch results
-		rows, err := db.QueryContext(ctx, query)
+		start := time.Now()
+		sources, err := maskingSources(ctx, db, config, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := db.QueryContext(ctx, tagQuery(ctx, config, query), args...)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
 
-		// Get column names
-		columns, err := rows.Columns()
+		columnTypes, err := describeColumns(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		result := make([]map[string]interface{}, 0)
-
-		for rows.Next() {
-			// Create a slice of interface{} to hold the values
-			values := make([]interface{}, len(columns))
-			scanArgs := make([]interface{}, len(columns))
+		// One row beyond the limit tells whether the result was cut short
+		limit := -1
+		if maxRows > 0 {
+			limit = maxRows + 1
+		}
+		columns, result, total, err := scanRows(rows, config, limit, true)
+		if err != nil {
+			return nil, err
+		}
+		recordThroughput(total, time.Since(start))
+		maskRows(result, columns, maskedColumnIndexes(config, query, columns, sources))
 
-			for i := range values {
-				scanArgs[i] = &values[i]
-			}
+		truncated := maxRows > 0 && len(result) > maxRows
+		if truncated {
+			// Cancelling stops the server from sending the remaining rows,
+			// which closing the result set would otherwise read and discard
+			cancel()
+			result = result[:maxRows]
+		}
 
-			// Scan the result into the values slice
-			if err := rows.Scan(scanArgs...); err != nil {
-				return nil, err
+		data := map[string]interface{}{
+			"columns":     columns,
+			"columnTypes": columnTypes,
+			"rows":        result,
+		}
+		if truncated {
+			data["truncated"] = true
+			if estimate, err := estimateQuery(query, args...); err == nil && estimate.Rows > float64(maxRows) {
+				data["estimatedRows"] = int64(estimate.Rows)
 			}
-
-			// Create a map for this row's data
-			rowData := make(map[string]interface{})
-			for i, colName := range columns {
-				val := values[i]
-
-				// Convert to appropriate Go type
-				if val == nil {
-					rowData[colName] = nil
-				} else {
-					// Handle different types
-					switch v := val.(type) {
-					case []byte:
-						rowData[colName] = string(v)
-					default:
-						rowData[colName] = v
-					}
+		}
+		if warning := duplicateRowsWarning(config, columns, result); warning != "" {
+			data["warnings"] = []string{warning}
+		}
+		return data, nil
+	} else {
+		// Capture the touched rows through an OUTPUT clause when requested
+		if config.CaptureWriteOutput {
+			if outputQuery, ok := injectOutputClause(query); ok {
+				data, err := executeWithOutput(ctx, db, config, guardAffectedRows(config, outputQuery), args...)
+				if err == nil {
+					return data, nil
+				}
+				if !isOutputClauseRejected(err) {
+					return nil, err
 				}
+				log.Printf("OUTPUT clause rejected, executing without capture: %v", err)
 			}
-
-			result = append(result, rowData)
-		}
-
-		if err = rows.Err(); err != nil {
-			return nil, err
 		}
 
-		return map[string]interface{}{
-			"columns": columns,
-			"rows":    result,
-		}, nil
-	} else {
-		// Execute non-select query
-		res, err := db.ExecContext(ctx, query)
+		// Execute non-select query, rolled back if it changes too many rows
+		res, err := db.ExecContext(ctx, tagQuery(ctx, config, guardAffectedRows(config, query)), args...)
 		if err != nil {
 			return nil, err
 		}
@@ -202,12 +680,173 @@ func executeQuery(query string, fetchResults bool) (map[string]interface{}, erro
 	}
 }
 
+// executeWithOutput runs a write statement carrying an OUTPUT clause and keeps
+// at most CaptureOutputRows of the returned rows.
+func executeWithOutput(ctx context.Context, db queryer, config *DbConfig, query string, args ...interface{}) (map[string]interface{}, error) {
+	sources, err := maskingSources(ctx, db, config, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, tagQuery(ctx, config, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, result, total, err := scanRows(rows, config, config.CaptureOutputRows, false)
+	if err != nil {
+		return nil, err
+	}
+	maskRows(result, columns, maskedColumnIndexes(config, query, columns, sources))
+
+	return map[string]interface{}{
+		"rowCount":      int64(total),
+		"outputColumns": columns,
+		"outputRows":    result,
+	}, nil
+}
+
+// isOutputClauseRejected reports whether the server refused an OUTPUT clause
+// without INTO, which happens on tables with enabled triggers (error 334).
+func isOutputClauseRejected(err error) bool {
+	var sqlErr mssql.Error
+	return errors.As(err, &sqlErr) && sqlErr.Number == 334
+}
+
+// scanRows reads the rows of a result set, keeping at most limit of them (all
+// when limit is negative) and returning the total number of rows seen. With
+// stopAtLimit it stops reading once limit rows are kept, otherwise it counts
+// the rest.
+func scanRows(rows *sql.Rows, config *DbConfig, limit int, stopAtLimit bool) ([]string, []map[string]interface{}, int, error) {
+	// Get column names
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	result := make([]map[string]interface{}, 0)
+	total := 0
+
+	for rows.Next() {
+		if limit >= 0 && len(result) >= limit {
+			if stopAtLimit {
+				break
+			}
+			total++
+			continue
+		}
+		total++
+
+		// Create a slice of interface{} to hold the values
+		values := make([]interface{}, len(columns))
+		scanArgs := make([]interface{}, len(columns))
+
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+
+		// Scan the result into the values slice
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, nil, 0, err
+		}
+
+		// Create a map for this row's data
+		rowData := make(map[string]interface{})
+		for i, colName := range columns {
+			val := values[i]
+
+			// Convert to appropriate Go type
+			if val == nil {
+				rowData[colName] = nil
+			} else {
+				rowData[colName] = convertValue(config, columnTypes[i], val)
+			}
+		}
+
+		result = append(result, rowData)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, 0, err
+	}
+
+	return columns, result, total, nil
+}
+
+// duplicateRowsWarning checks a result for fully duplicate rows, the usual
+// sign of a join fanning out on a non-unique key, and describes the
+// duplication when it exceeds the configured share of rows.
+func duplicateRowsWarning(config *DbConfig, columns []string, rows []map[string]interface{}) string {
+	if config.DuplicateWarnPct <= 0 || len(rows) < MIN_DUPLICATE_CHECK_ROWS {
+		return ""
+	}
+
+	// Rows are compared by a hash of their values to keep memory flat
+	seen := make(map[uint64]struct{}, len(rows))
+	for _, row := range rows {
+		seen[hashRow(columns, row)] = struct{}{}
+	}
+
+	duplicates := len(rows) - len(seen)
+	if duplicates*100 < len(rows)*config.DuplicateWarnPct {
+		return ""
+	}
+	return fmt.Sprintf("%d of %d rows are exact duplicates (each distinct row appears %.1f times on average). "+
+		"This usually means a join matched more rows than intended: check the join keys, or use DISTINCT if duplicates are expected.",
+		duplicates, len(rows), float64(len(rows))/float64(len(seen)))
+}
+
+// hashRow hashes the values of a row, distinguishing NULL from empty values.
+func hashRow(columns []string, row map[string]interface{}) uint64 {
+	h := fnv.New64a()
+	for _, column := range columns {
+		if row[column] == nil {
+			h.Write([]byte{0})
+		} else {
+			fmt.Fprintf(h, "\x01%v", row[column])
+		}
+		h.Write([]byte{0xff})
+	}
+	return h.Sum64()
+}
+
 func formatResults(data map[string]interface{}) (string, error) {
+	return formatTextResults(data, delimitedLayout(','), configuredNullToken())
+}
+
+// tableLayout lays out result rows as text.
+type tableLayout func(columns []string, rows []map[string]interface{}, null string) string
+
+// delimitedLayout lays rows out as delimited text, one line per row.
+func delimitedLayout(delimiter rune) tableLayout {
+	return func(columns []string, rows []map[string]interface{}, null string) string {
+		return formatDelimitedTable(columns, rows, null, delimiter)
+	}
+}
+
+// formatTextResults is formatResults with the given layout of the rows and
+// text for NULL.
+func formatTextResults(data map[string]interface{}, layout tableLayout, null string) (string, error) {
 	columns, hasColumns := data["columns"].([]string)
 	if !hasColumns {
 		rowCount, hasRowCount := data["rowCount"].(int64)
 		if hasRowCount {
-			return fmt.Sprintf("Query executed successfully. Rows affected: %d", rowCount), nil
+			message := fmt.Sprintf("Query executed successfully. Rows affected: %d", rowCount)
+
+			// Append rows captured through an OUTPUT clause
+			outputColumns, hasOutput := data["outputColumns"].([]string)
+			outputRows, _ := data["outputRows"].([]map[string]interface{})
+			if hasOutput && len(outputRows) > 0 {
+				message += fmt.Sprintf("\nAffected rows (showing %d of %d):\n%s", len(outputRows), rowCount, layout(outputColumns, outputRows, null))
+			}
+			if summary, ok := data["execution"].(executionSummary); ok {
+				message += "\n" + summary.String()
+			}
+			return message, nil
 		}
 		return "", errors.New("unknown result format")
 	}
@@ -218,63 +857,296 @@ func formatResults(data map[string]interface{}) (string, error) {
 	}
 
 	if len(rows) == 0 {
+		if summary, ok := data["execution"].(executionSummary); ok {
+			return "No results found\n" + summary.String(), nil
+		}
 		return "No results found", nil
 	}
 
-	// Format the results in a tabular format
+	result := layout(columns, rows, null)
+	firstRow, paged := data["firstRow"].(int64)
+	if paged && firstRow > 1 {
+		result = fmt.Sprintf("Rows %d to %d:\n%s", firstRow, firstRow+int64(len(rows))-1, result)
+	}
+	if data["truncated"] == true {
+		shown := int64(len(rows))
+		if paged {
+			shown += firstRow - 1
+		}
+		if estimated, ok := data["estimatedRows"].(int64); ok {
+			result += fmt.Sprintf("…truncated, %d of ~%d rows shown\n", shown, estimated)
+		} else {
+			result += fmt.Sprintf("…truncated, %d rows shown; more are available\n", shown)
+		}
+		if token, ok := data["continuationToken"].(string); ok {
+			result += fmt.Sprintf("Call fetch_more with continuation_token %s for the next rows.\n", token)
+		}
+		if offset, ok := data["nextOffset"].(int); ok {
+			result += fmt.Sprintf("Call get_result with offset %d for the next rows.\n", offset)
+		}
+	}
+	if id, ok := data["resultId"].(int); ok {
+		result += fmt.Sprintf("Result #%d\n", id)
+	}
+	if summary, ok := data["execution"].(executionSummary); ok {
+		result += summary.String() + "\n"
+	}
+	if note, ok := data["dataAsOf"].(string); ok {
+		result += "\nRead from a replica: " + note
+	}
+	if warnings, ok := data["warnings"].([]string); ok {
+		for _, warning := range warnings {
+			result += "\nWarning: " + warning
+		}
+	}
+	return result, nil
+}
+
+// formatResultsAs renders query results with the renderer registered for the
+// requested output format (see renderers.go). Long text values are cut to
+// MSSQL_MAX_CELL_LENGTH characters in any format, and the whole output is
+// shaped to fit MSSQL_MAX_OUTPUT_TOKENS.
+func formatResultsAs(data map[string]interface{}, format string) (string, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return renderResults(data, format, ',')
+	}
+	if config.MaxCellLength > 0 {
+		data = truncateCells(data, config.MaxCellLength)
+	}
+	return renderWithinBudget(data, format, config.OutputDelimiter, config.MaxOutputTokens)
+}
+
+// formatJSON renders results as JSON, keeping column order by emitting each
+// row as an array. NULL stays a JSON null whatever the configured token.
+func formatJSON(data map[string]interface{}) (string, error) {
+	document := make(map[string]interface{})
+	if columns, ok := data["columns"].([]string); ok {
+		document["columns"] = columns
+		if columnTypes, ok := data["columnTypes"].([]columnInfo); ok {
+			document["columnTypes"] = columnTypes
+		}
+		document["rows"] = rowArrays(columns, data["rows"].([]map[string]interface{}))
+	} else if rowCount, ok := data["rowCount"].(int64); ok {
+		document["rowsAffected"] = rowCount
+		if outputColumns, ok := data["outputColumns"].([]string); ok {
+			document["outputColumns"] = outputColumns
+			document["outputRows"] = rowArrays(outputColumns, data["outputRows"].([]map[string]interface{}))
+		}
+	} else {
+		return "", errors.New("unknown result format")
+	}
+	if firstRow, ok := data["firstRow"].(int64); ok {
+		document["firstRow"] = firstRow
+	}
+	if token, ok := data["continuationToken"].(string); ok {
+		document["continuationToken"] = token
+	}
+	if data["truncated"] == true {
+		document["truncated"] = true
+		if estimated, ok := data["estimatedRows"].(int64); ok {
+			document["estimatedRows"] = estimated
+		}
+	}
+	if note, ok := data["dataAsOf"].(string); ok {
+		document["dataAsOf"] = note
+	}
+	if summary, ok := data["execution"].(executionSummary); ok {
+		document["execution"] = summary
+	}
+	if id, ok := data["resultId"].(int); ok {
+		document["resultId"] = id
+	}
+	if offset, ok := data["nextOffset"].(int); ok {
+		document["nextOffset"] = offset
+	}
+	if warnings, ok := data["warnings"].([]string); ok {
+		document["warnings"] = warnings
+	}
+
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// rowArrays converts rows keyed by column name to value arrays in column order.
+func rowArrays(columns []string, rows []map[string]interface{}) [][]interface{} {
+	result := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		values := make([]interface{}, len(columns))
+		for j, column := range columns {
+			values[j] = row[column]
+		}
+		result[i] = values
+	}
+	return result
+}
+
+// displayValue renders a result value as text, showing NULL as the token.
+func displayValue(value interface{}, null string) string {
+	if value == nil {
+		return null
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// configuredNullToken returns the text NULL values are shown as, falling back
+// to the default when the configuration is incomplete.
+func configuredNullToken() string {
+	config, err := getDbConfig()
+	if err != nil {
+		return DEFAULT_NULL_TOKEN
+	}
+	return config.NullToken
+}
+
+// formatVerticalTable prints each row as a block with one "column: value"
+// line per column, names right-aligned, like mysql's \G.
+func formatVerticalTable(columns []string, rows []map[string]interface{}, null string) string {
+	width := 0
+	for _, column := range columns {
+		if length := utf8.RuneCountInString(column); length > width {
+			width = length
+		}
+	}
+
 	var result strings.Builder
-	result.WriteString(strings.Join(columns, ","))
-	result.WriteString("\n")
+	for i, row := range rows {
+		result.WriteString(fmt.Sprintf("*************************** %d. row ***************************\n", i+1))
+		for _, column := range columns {
+			padding := strings.Repeat(" ", width-utf8.RuneCountInString(column))
+			result.WriteString(fmt.Sprintf("%s%s: %s\n", padding, column, displayValue(row[column], null)))
+		}
+	}
+	return result.String()
+}
+
+// formatTable renders rows as CSV (RFC 4180): values containing commas,
+// quotes or line breaks are quoted, and NULL is written as the null token.
+func formatTable(columns []string, rows []map[string]interface{}, null string) string {
+	return formatDelimitedTable(columns, rows, null, ',')
+}
+
+// formatDelimitedTable is formatTable with another field delimiter, such as
+// a tab; values containing it are quoted.
+func formatDelimitedTable(columns []string, rows []map[string]interface{}, null string, delimiter rune) string {
+	var result strings.Builder
+	writer := csv.NewWriter(&result)
+	writer.Comma = delimiter
+	writer.Write(columns)
 
 	for _, row := range rows {
 		values := make([]string, len(columns))
 		for i, col := range columns {
-			val := row[col]
-			if val == nil {
-				values[i] = ""
-			} else {
-				values[i] = fmt.Sprintf("%v", val)
-			}
+			values[i] = displayValue(row[col], null)
 		}
-		result.WriteString(strings.Join(values, ","))
-		result.WriteString("\n")
+		writer.Write(values)
 	}
 
-	return result.String(), nil
+	// Writing to a strings.Builder cannot fail
+	writer.Flush()
+	return result.String()
 }
 
-func main() {
-	// Create MCP server
+// NewServer creates the MCP server with the tools, resources and prompts the
+// configuration enables, or fails when the configuration is invalid.
+func NewServer() (*server.MCPServer, error) {
+	// Create MCP server; an operator's description of the database is
+	// handed to clients as instructions so sessions start with it
+	options := []server.ServerOption{
+		server.WithLogging(),
+		server.WithRecovery(),
+		server.WithToolHandlerMiddleware(tagToolCalls),
+		server.WithToolHandlerMiddleware(enforceTimeBudget),
+		server.WithToolHandlerMiddleware(redactToolErrors),
+	}
+	if instructions := aboutInstructions(); instructions != "" {
+		options = append(options, server.WithInstructions(instructions))
+	}
 	s := server.NewMCPServer(
 		"MSSQL MCP Server", // Server name
 		"1.0.0",            // Version
-		server.WithLogging(),
-		server.WithRecovery(),
+		options...,
 	)
 
 	// Add execute_sql tool
 	sqlTool := mcp.NewTool("execute_sql",
-		mcp.WithDescription("Execute a read-only SQL query on the MSSQL server. Write operations (CREATE, ALTER, DROP, INSERT, UPDATE, DELETE, etc.) are not permitted."),
+		mcp.WithDescription("Execute a read-only SQL query on the MSSQL server. Write operations (CREATE, ALTER, DROP, INSERT, UPDATE, DELETE, etc.) are not permitted, except on table variables and, when sticky sessions are enabled, local #temp tables: these last for the session, so intermediate results can be built up over several calls. A query may DECLARE and SET variables before its final SELECT, or hold several SELECT statements separated by semicolons, which run in order and are returned as separately labeled results (a JSON array with the json format)."),
 		mcp.WithString("query",
-			mcp.Required(),
 			mcp.Description("The SQL query to execute (read-only operations only)"),
 		),
+		mcp.WithString("query_file",
+			mcp.Description("Path or file:// URI of a file containing the query, as an alternative to query for very long statements. Must be inside the directory configured by MSSQL_QUERY_FILE_ROOT."),
+		),
+		mcp.WithObject("params",
+			mcp.Description("Named parameters referenced in the query as @name, e.g. {\"customer\": 42, \"since\": {\"value\": \"2024-01-31\", \"type\": \"date\"}}. Values are bound, never spliced into the SQL; give a {value, type} object to bind a specific SQL Server type such as date, datetime, datetime2, datetimeoffset, decimal, varchar or uniqueidentifier. A list of rows with a user-defined table type, e.g. {\"value\": [1, 2, 3], \"type\": \"dbo.IdList\"}, is bound as a table-valued parameter for lookups like WHERE id IN (SELECT Id FROM @ids)."),
+		),
+		mcp.WithNumber("max_rows",
+			mcp.Description("Stop reading after this many rows (default from MSSQL_MAX_ROWS, 1000); a notice tells when the result was truncated, and without sticky sessions the rest can be read with fetch_more"),
+		),
+		mcp.WithObject("hints",
+			mcp.Description("Query hints appended as OPTION (...), subject to the server's hint policy"),
+			mcp.Properties(map[string]interface{}{
+				"recompile":            map[string]interface{}{"type": "boolean", "description": "OPTION (RECOMPILE)"},
+				"optimize_for_unknown": map[string]interface{}{"type": "boolean", "description": "OPTION (OPTIMIZE FOR UNKNOWN)"},
+				"maxdop":               map[string]interface{}{"type": "number", "description": "Maximum degree of parallelism, 0 to 64"},
+				"max_grant_percent":    map[string]interface{}{"type": "number", "description": "Memory grant cap as a percentage"},
+				"use_hint": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "USE HINT names, e.g. DISABLE_PARAMETER_SNIFFING",
+				},
+			}),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: text (default, comma separated unless MSSQL_OUTPUT_DELIMITER says otherwise), csv (comma separated with no type comment, for other tools), tsv (tab separated, for pasting into spreadsheets), vertical (one line per column, readable for wide tables), markdown (a table for chat and documents) or json, whose rows are arrays aligned with the columns list"),
+			mcp.Enum(outputFormats()...),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent xml values and values holding JSON objects or arrays (default from MSSQL_PRETTY_PRINT)"),
+		),
+		mcp.WithString("transaction",
+			mcp.Description("Handle from begin_transaction to read inside that transaction, seeing its uncommitted changes"),
+		),
+		mcp.WithString("tenant",
+			mcp.Description("Tenant to query on a multi-tenant database (MSSQL_TENANCY_MODEL), unless the server is pinned to one with MSSQL_TENANT"),
+		),
+		mcp.WithBoolean("annotate_sources",
+			mcp.Description("Add to the column metadata the table each column is read from, by its alias in the query, e.g. order_id [o], name [c], to tell the sides of a join apart (default from MSSQL_ANNOTATE_SOURCES)"),
+		),
 	)
 
 	// Add tool handler
-	s.AddTool(sqlTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		query, ok := request.Params.Arguments["query"].(string)
-		if !ok || query == "" {
+	var handleSQL server.ToolHandlerFunc
+	handleSQL = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query, _ := request.Params.Arguments["query"].(string)
+		if queryFile, _ := request.Params.Arguments["query_file"].(string); queryFile != "" {
+			if query != "" {
+				return mcp.NewToolResultError("Provide either query or query_file, not both"), nil
+			}
+
+			var err error
+			query, err = readQueryFile(queryFile)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Error reading query file: %v", err)), nil
+			}
+		}
+		if strings.TrimSpace(query) == "" {
 			return mcp.NewToolResultError("Query is required"), nil
 		}
 
 		log.Printf("Executing SQL query: %s", query)
 
-		// Check if the query is a write operation
-		if isWriteOperation(query) {
-			errorMessage := "Write operations (CREATE, ALTER, DROP, INSERT, UPDATE, DELETE, etc.) are not permitted for security reasons."
-			log.Printf("Attempted write operation denied: %s", truncateString(query, 100))
-			return mcp.NewToolResultError(errorMessage), nil
+		// Scripts are split into batches only by execute_write
+		if batches, err := splitBatches(query); err == nil && len(batches) > 1 {
+			return mcp.NewToolResultError("The query holds several batches separated by GO; run each batch as its own query"), nil
+		}
+
+		// Several SELECTs separated by semicolons each get a result of their own
+		if statements := selectStatements(query); len(statements) > 1 {
+			return runStatements(ctx, request, statements, handleSQL)
 		}
 
 		// Special handling for "SHOW TABLES" query
@@ -284,31 +1156,130 @@ func main() {
 				return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
 			}
 
-			showTablesQuery := "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE';"
-			data, err := executeQuery(showTablesQuery, true)
+			// Tables the object access policy refuses are not listed
+			tables, err := listBaseTables()
 			if err != nil {
 				return mcp.NewToolResultError(fmt.Sprintf("Error executing query: %v", err)), nil
 			}
 
-			rows := data["rows"].([]map[string]interface{})
 			var result strings.Builder
 			result.WriteString(fmt.Sprintf("Tables_in_%s\n", config.Database))
-			for _, row := range rows {
-				tableName := row["TABLE_NAME"]
-				result.WriteString(fmt.Sprintf("%v\n", tableName))
+			for _, table := range tables {
+				result.WriteString(table[1] + "\n")
 			}
 			return mcp.NewToolResultText(result.String()), nil
 		}
 
 		// For all other queries
 		try := func() (*mcp.CallToolResult, error) {
-			data, err := executeQuery(query, true)
+			config, err := getDbConfig()
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+			}
+
+			format, _ := request.Params.Arguments["format"].(string)
+			if format == "" {
+				format = config.OutputFormat
+			}
+			if !isOutputFormat(format) {
+				return mcp.NewToolResultError(fmt.Sprintf("Unknown output format: %s", format)), nil
+			}
+
+			if hints, ok := request.Params.Arguments["hints"].(map[string]interface{}); ok && len(hints) > 0 {
+				options, err := queryHintOptions(config, hints)
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("Invalid hints: %v", err)), nil
+				}
+				if len(options) > 0 {
+					query, err = appendOptionClause(query, options)
+					if err != nil {
+						return mcp.NewToolResultError(fmt.Sprintf("Invalid hints: %v", err)), nil
+					}
+				}
+			}
+
+			params, _ := request.Params.Arguments["params"].(map[string]interface{})
+			args, err := queryParameters(params)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Invalid params: %v", err)), nil
+			}
+
+			// Writes to table variables and #temp tables leave the database
+			// untouched; #temp tables only outlive the call on a sticky session.
+			requestedTenant, _ := request.Params.Arguments["tenant"].(string)
+			scoped, err := checkStatement(config, localWriteAccess, requestedTenant, query)
+			if err != nil {
+				return notPermitted("Query", err), nil
+			}
+			if _, temp := localWrites(query); temp && !config.StickySessions {
+				return mcp.NewToolResultError("#temp tables are dropped when the call's connection closes; enable sticky sessions (MSSQL_STICKY_SESSIONS) to keep them across calls, or use a table variable within one query"), nil
+			}
+
+			// Look for joins of large tables that could multiply out before
+			// spending server time on them
+			joinWarning, err := joinExplosionWarning(config, query)
+			if err != nil {
+				log.Printf("Join explosion check failed: %v", err)
+			}
+			if joinWarning != "" && config.JoinGuardStrict {
+				log.Printf("Query blocked by join explosion guard: %s", truncateString(query, 100))
+				return mcp.NewToolResultError(joinWarning + " The query was not executed."), nil
+			}
+
+			maxRows := config.MaxRows
+			if value, ok := request.Params.Arguments["max_rows"].(float64); ok && value > 0 {
+				maxRows = int(value)
+			}
+
+			start := time.Now()
+			transaction, _ := request.Params.Arguments["transaction"].(string)
+			queryCtx := withTransactionHandle(withMaxRows(ctx, maxRows), transaction)
+			data, err := executeSessionQuery(queryCtx, scoped, true, args...)
+			// Sums over large fact tables outgrow int; widen and try again
+			var overflowNote string
+			if err != nil {
+				data, overflowNote, err = retryWithWiderAggregates(queryCtx, scoped, err, args...)
+			}
 			if err != nil {
 				log.Printf("Error executing SQL '%s': %v", query, err)
 				return mcp.NewToolResultError(fmt.Sprintf("Error executing query: %v", err)), nil
 			}
+			addExecutionSummary(config, data, time.Since(start))
+			if joinWarning != "" {
+				warnings, _ := data["warnings"].([]string)
+				data["warnings"] = append([]string{joinWarning}, warnings...)
+			}
+			if overflowNote != "" {
+				warnings, _ := data["warnings"].([]string)
+				data["warnings"] = append([]string{overflowNote}, warnings...)
+			}
+			annotateSources := config.AnnotateSources
+			if value, ok := request.Params.Arguments["annotate_sources"].(bool); ok {
+				annotateSources = value
+			}
+			if annotateSources {
+				if err := annotateColumnSources(config, scoped, params, data); err != nil {
+					log.Printf("Describing column sources failed: %v", err)
+					warnings, _ := data["warnings"].([]string)
+					data["warnings"] = append(warnings, fmt.Sprintf("Column sources are unavailable: %v", err))
+				}
+			}
+			if config.AnnotateLag {
+				lag, err := currentReplicaLag()
+				if err != nil {
+					log.Printf("Reading replica lag failed: %v", err)
+				} else if lag != nil {
+					data["dataAsOf"] = dataAsOfNote(config, lag)
+				}
+			}
+			if id := rememberResult(ctx, config, query, data); id > 0 {
+				data["resultId"] = id
+			}
 
-			formattedResult, err := formatResults(data)
+			if prettyPrintRequested(config, request.Params.Arguments) {
+				data = prettyPrintValues(data)
+			}
+			formattedResult, err := formatResultsAs(data, format)
 			if err != nil {
 				return mcp.NewToolResultError(fmt.Sprintf("Error formatting results: %v", err)), nil
 			}
@@ -322,14 +1293,105 @@ func main() {
 			return mcp.NewToolResultError(fmt.Sprintf("Unexpected error: %v", err)), nil
 		}
 		return result, nil
-	})
+	}
+	s.AddTool(sqlTool, handleSQL)
 
 	// Initialize and log configuration
 	config, err := getDbConfig()
 	if err != nil {
-		log.Fatalf("Configuration error: %v", err)
+		return nil, fmt.Errorf("configuration error: %v", err)
 	}
 	log.Printf("Database config: %s/%s as %s", config.Server, config.Database, config.User)
+	if config.SessionInitSQL != "" {
+		log.Printf("Session options: %s", config.SessionInitSQL)
+	}
+	if _, err := loadQueryPolicy(config); err != nil {
+		return nil, fmt.Errorf("query policy error (MSSQL_QUERY_POLICY_FILE): %v", err)
+	}
+	if config.ReadOnlyUser != "" {
+		log.Printf("Sessions run as read-only database user %s", config.ReadOnlyUser)
+	}
+	if config.VerifyReadOnly && !config.AllowWrite {
+		if err := verifyReadOnlySession(); err != nil {
+			return nil, fmt.Errorf("read-only verification failed: %v", err)
+		}
+		log.Printf("Verified that the database session cannot write")
+	}
+	if config.SnapshotDatabase != "" {
+		log.Printf("Queries run against snapshot %s", config.SnapshotDatabase)
+	} else if config.SnapshotPattern != "" {
+		log.Printf("Queries run against the latest snapshot matching %s", config.SnapshotPattern)
+	}
+
+	// Expose tables and the overall schema as browsable resources
+	registerTableResources(s)
+	registerSchemaResource(s)
+	registerAboutResource(s)
+	registerReportResources(s)
+
+	// Prompt templates for common database tasks
+	registerPrompts(s)
+
+	// Schema exploration and data profiling tools
+	registerSchemaTools(s)
+	registerLineageTool(s)
+	registerProfileTools(s)
+	startSummaryJob(config)
+	registerEstimateTool(s)
+	registerValidateTool(s)
+	registerExportTools(s)
+	registerSnapshotTools(s)
+	registerTemporalTools(s)
+	registerSCDTools(s)
+	registerMonitoringTools(s)
+	registerReplicaTools(s)
+	registerResultTools(s)
+	registerInMemoryTools(s)
+	registerColumnstoreTools(s)
+	registerExternalDataTools(s)
+	registerSecurityTools(s)
+	registerTimeBudgetTools(s)
+
+	// Writes are a separate tool that only exists when enabled
+	if config.AllowWrite {
+		registerWriteTool(s)
+		registerBulkInsertTool(s)
+		registerUpsertTool(s)
+		log.Printf("Write operations are allowed through execute_write (MSSQL_ALLOW_WRITE)")
+	}
+	if config.AllowWrite || len(config.AllowedProcedures) > 0 {
+		registerProcedureTools(s)
+	}
+
+	// Transactions need a connection that outlives a single tool call, and
+	// only make sense where writes are allowed; without sticky sessions,
+	// truncated results can be paged instead
+	if config.StickySessions {
+		if config.AllowWrite {
+			registerTransactionTools(s)
+		}
+	} else {
+		registerCursorTools(s)
+		// Multi-step writes keep their transaction by handle instead
+		if config.AllowWrite {
+			registerTransactionHandleTools(s)
+		}
+	}
+
+	return s, nil
+}
+
+// Main runs the server over stdio, as the mssql_mcp_server_go command does.
+func Main() {
+	s, err := NewServer()
+	if err != nil {
+		log.Fatalf("Error starting server: %v", err)
+	}
+
+	// "query SQL" runs one query through the tools and exits
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		os.Exit(runQueryCommand(s, os.Args[2:], os.Stdout, os.Stderr))
+	}
 
 	// Start the server
 	log.Printf("Starting MSSQL MCP server...")
@@ -342,5 +1404,62 @@ func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
 	}
-	return s[:maxLen] + "..."
+	// Cut before a whole character so multi-byte text stays valid UTF-8
+	cut := maxLen
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
+
+// readQueryFile loads SQL from a path or file:// URI, which must resolve to a
+// file inside MSSQL_QUERY_FILE_ROOT. Relative paths are taken from that root.
+func readQueryFile(reference string) (string, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return "", err
+	}
+	if config.QueryFileRoot == "" {
+		return "", errors.New("reading queries from files is disabled (set MSSQL_QUERY_FILE_ROOT to enable it)")
+	}
+
+	path := reference
+	if strings.HasPrefix(reference, "file://") {
+		parsed, err := url.Parse(reference)
+		if err != nil {
+			return "", err
+		}
+		path = parsed.Path
+	}
+
+	root, err := filepath.EvalSymlinks(config.QueryFileRoot)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+
+	relative, err := filepath.Rel(root, path)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the query file root", reference)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > MAX_QUERY_FILE_SIZE {
+		return "", fmt.Errorf("query file is larger than %d bytes", MAX_QUERY_FILE_SIZE)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
 }
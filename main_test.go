@@ -0,0 +1,65 @@
+package mssqlmcp
+
+import "testing"
+
+// testConfig reads the configuration with the required settings filled in
+// when the environment lacks them. Tests here never connect, so the values
+// only need to pass validation; credentials read along the way are
+// forgotten afterwards so they do not outlive the test.
+func testConfig(t *testing.T) *DbConfig {
+	t.Helper()
+	for name, value := range map[string]string{
+		"MSSQL_USER":     "reader",
+		"MSSQL_PASSWORD": "secret",
+		"MSSQL_DATABASE": "Sales",
+	} {
+		if getEnvOrDefault(name, "") == "" {
+			t.Setenv(name, value)
+		}
+	}
+	t.Cleanup(forgetCredentials)
+
+	config, err := getDbConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestIsWriteOperation(t *testing.T) {
+	for query, write := range map[string]bool{
+		"DELETE FROM dbo.Orders":                                                                      true,
+		"SELECT * FROM OPENQUERY(linked, 'DELETE FROM dbo.Orders')":                                   true,
+		"SELECT * FROM OPENQUERY(linked, N'UPDATE dbo.Orders SET status = ''x''')":                    true,
+		"SELECT * FROM OPENQUERY(linked, 'SELECT * FROM dbo.Orders WHERE status = ''DELETE''')":       false,
+		"SELECT * FROM OPENQUERY(linked, 'SELECT 1; DROP TABLE dbo.Orders')":                          true,
+		"SELECT * FROM OPENROWSET('MSOLEDBSQL', 'Server=remote;', 'EXEC dbo.Purge')":                  true,
+		"SELECT * FROM OPENROWSET('MSOLEDBSQL', 'Server=remote;', 'SELECT name FROM sys.tables')":     false,
+		"SELECT * FROM OPENROWSET('MSOLEDBSQL', 'Server=remote;', remote.dbo.Orders)":                 false,
+		"SELECT * FROM dbo.Orders":                                                                    false,
+		"SELECT * FROM dbo.Orders WHERE status = 'DELETE '":                                           false,
+		"SELECT * FROM dbo.Orders -- then DROP TABLE dbo.Orders":                                      false,
+		"SELECT * FROM dbo.Orders /* UPDATE dbo.Orders SET x = 1 */":                                  false,
+		"SELECT [Update], [Delete] FROM dbo.AuditActions":                                             false,
+		"SELECT * FROM CreatedOrders":                                                                 false,
+		"WITH recent AS (SELECT * FROM dbo.Orders) SELECT * FROM recent":                              false,
+		";WITH recent AS (SELECT * FROM dbo.Orders) DELETE FROM recent":                               true,
+		"SELECT * INTO dbo.OrdersCopy FROM dbo.Orders":                                                true,
+		"DECLARE @sql nvarchar(max) = N'DEL' + N'ETE FROM dbo.Orders'; EXEC (@sql)":                   true,
+		"sp_executesql N'DELETE FROM dbo.Orders'":                                                     true,
+		"SELECT 1; UPDATE dbo.Orders SET status = 'x' WHERE id = 1":                                   true,
+		"IF 1 = 1 BEGIN SELECT 1 END ELSE BEGIN TRUNCATE TABLE dbo.Orders END":                        true,
+		"DECLARE @id int; DECLARE c CURSOR FOR SELECT id FROM dbo.Orders; FETCH NEXT FROM c INTO @id": false,
+	} {
+		if got := isWriteOperation(query); got != write {
+			t.Errorf("isWriteOperation(%q) = %v, want %v", query, got, write)
+		}
+	}
+}
+
+func TestExternalDataPolicy(t *testing.T) {
+	config := testConfig(t)
+	if err := checkExternalDataPolicy(config, "SELECT * FROM OPENROWSET('SQLNCLI', 'Server=x;', 'SELECT 1')"); err == nil {
+		t.Error("OPENROWSET allowed by the default external data policy")
+	}
+}
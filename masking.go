@@ -0,0 +1,239 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+)
+
+// Value returned in place of the values of masked columns
+const maskedValue = "****"
+
+// columnMask is one MSSQL_MASKED_COLUMNS pattern, such as *.email,
+// dbo.Customers.SSN or Customers.SSN (a table in dbo), split into
+// lower-case schema, table and column patterns.
+type columnMask struct {
+	schema, table, column string
+}
+
+func parseColumnMasks(patterns []string) []columnMask {
+	var masks []columnMask
+	for _, pattern := range patterns {
+		parts := strings.Split(strings.ToLower(strings.NewReplacer("[", "", "]", "").Replace(pattern)), ".")
+		switch len(parts) {
+		case 1:
+			masks = append(masks, columnMask{"*", "*", parts[0]})
+		case 2:
+			schema := "dbo"
+			if parts[0] == "*" {
+				schema = "*"
+			}
+			masks = append(masks, columnMask{schema, parts[0], parts[1]})
+		default:
+			n := len(parts)
+			masks = append(masks, columnMask{parts[n-3], parts[n-2], parts[n-1]})
+		}
+	}
+	return masks
+}
+
+func (m columnMask) matchesTable(schema, table string) bool {
+	schemaMatched, _ := path.Match(m.schema, strings.ToLower(schema))
+	tableMatched, _ := path.Match(m.table, strings.ToLower(table))
+	return schemaMatched && tableMatched
+}
+
+func (m columnMask) matchesColumn(column string) bool {
+	matched, _ := path.Match(m.column, strings.ToLower(column))
+	return matched
+}
+
+// columnMasked reports whether MSSQL_MASKED_COLUMNS masks a table column.
+func columnMasked(config *DbConfig, schema, table, column string) bool {
+	for _, mask := range parseColumnMasks(config.MaskedColumns) {
+		if mask.matchesTable(schema, table) && mask.matchesColumn(column) {
+			return true
+		}
+	}
+	return false
+}
+
+// columnSource is the table column a result column is read from, empty for
+// computed columns. Masked marks a computed column of a query reading a
+// masked column, which may be computed from it.
+type columnSource struct {
+	Schema, Table, Column string
+	Masked                bool
+}
+
+// describeColumnSources asks the server which table columns the result
+// columns of a query come from; declarations declares the parameters the
+// query uses, as for sp_describe_first_result_set. It must run before the
+// query itself on the same connection, as a connection can only serve one
+// request at a time.
+func describeColumnSources(ctx context.Context, db queryer, query, declarations string) ([]columnSource, error) {
+	var params interface{}
+	if declarations != "" {
+		params = declarations
+	}
+	rows, err := db.QueryContext(ctx, `SELECT ISNULL(source_schema, N'dbo'), ISNULL(source_table, N''), ISNULL(source_column, N'')
+		FROM sys.dm_exec_describe_first_result_set(@p1, @p2, 1)
+		WHERE is_hidden = 0
+		ORDER BY column_ordinal`, query, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []columnSource
+	for rows.Next() {
+		var source columnSource
+		if err := rows.Scan(&source.Schema, &source.Table, &source.Column); err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, rows.Err()
+}
+
+// maskingSources describes the column sources of a query when columns are
+// masked, so a masked column stays masked under an alias. It returns nil
+// when nothing is masked. When the server cannot tell, the query must not
+// run: its columns could be masked ones under any name.
+func maskingSources(ctx context.Context, db queryer, config *DbConfig, query string, args ...interface{}) ([]columnSource, error) {
+	if len(config.MaskedColumns) == 0 {
+		return nil, nil
+	}
+	declarations, err := argumentDeclarations(args)
+	if err == nil {
+		var sources []columnSource
+		if sources, err = describeColumnSources(ctx, db, query, declarations); err == nil {
+			if err = markComputedSources(ctx, db, config, query, sources); err == nil {
+				return sources, nil
+			}
+		}
+	}
+	log.Printf("Describing result columns for masking failed: %v", err)
+	return nil, fmt.Errorf("the result columns could not be traced to their tables to apply MSSQL_MASKED_COLUMNS, so the query was not run: %v", err)
+}
+
+// markComputedSources marks the computed columns among sources as masked
+// when the query reads a masked column. What a column is computed from is
+// not known, so LEFT(SSN, 3) AS prefix, CONCAT(SSN, ”) and a scalar
+// subquery reading SSN are all masked, as is any other computed column of
+// such a query.
+func markComputedSources(ctx context.Context, db queryer, config *DbConfig, query string, sources []columnSource) error {
+	computed := false
+	for _, source := range sources {
+		computed = computed || source.Column == ""
+	}
+	if !computed {
+		return nil
+	}
+	masked, err := readsMaskedColumns(ctx, db, config, query)
+	if err != nil || !masked {
+		return err
+	}
+	for i := range sources {
+		sources[i].Masked = sources[i].Column == ""
+	}
+	return nil
+}
+
+// readsMaskedColumns reports whether a query references a table, view or
+// function with a column MSSQL_MASKED_COLUMNS masks. Temporary tables, table
+// variables and objects of other databases may hold copies of masked values
+// that cannot be traced, so they count as masked, and a query whose objects
+// cannot all be found fails.
+func readsMaskedColumns(ctx context.Context, db queryer, config *DbConfig, query string) (bool, error) {
+	references, err := resolveObjectReferences(query)
+	if err != nil {
+		return false, err
+	}
+	for _, reference := range references {
+		if reference.IsBuiltin() {
+			continue
+		}
+		if reference.IsTemporary() || strings.HasPrefix(reference.Name(), "@") || len(reference.Parts) > 2 {
+			return true, nil
+		}
+		quoted := make([]string, len(reference.Parts))
+		for i, part := range reference.Parts {
+			quoted[i] = quoteIdentifier(part)
+		}
+		rows, err := db.QueryContext(ctx, `SELECT OBJECT_SCHEMA_NAME(object_id), OBJECT_NAME(object_id), name
+			FROM sys.columns WHERE object_id = OBJECT_ID(@p1)`, strings.Join(quoted, "."))
+		if err != nil {
+			return false, err
+		}
+		masked := false
+		for rows.Next() {
+			var schema, table, column string
+			if err := rows.Scan(&schema, &table, &column); err != nil {
+				rows.Close()
+				return false, err
+			}
+			masked = masked || columnMasked(config, schema, table, column)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil || masked {
+			return masked, err
+		}
+	}
+	return false, nil
+}
+
+// maskedColumnIndexes returns the positions of the result columns that
+// MSSQL_MASKED_COLUMNS masks: those read from a masked table column,
+// computed columns of a query reading one, and those named like a masked
+// column when the query references its table, or with no sources, such as
+// for procedure results, of any table.
+func maskedColumnIndexes(config *DbConfig, query string, columns []string, sources []columnSource) []int {
+	masks := parseColumnMasks(config.MaskedColumns)
+	if len(masks) == 0 {
+		return nil
+	}
+	references := findObjectReferences(query)
+
+	var indexes []int
+	for i, column := range columns {
+		masked := false
+		for _, mask := range masks {
+			if i < len(sources) && sources[i].Column != "" {
+				source := sources[i]
+				masked = mask.matchesTable(source.Schema, source.Table) && mask.matchesColumn(source.Column)
+			}
+			masked = masked || i < len(sources) && sources[i].Masked
+			if !masked && mask.matchesColumn(column) {
+				masked = mask.table == "*" || sources == nil
+				for _, reference := range references {
+					parts := reference.Parts
+					schema := "dbo"
+					if len(parts) >= 2 && parts[len(parts)-2] != "" {
+						schema = parts[len(parts)-2]
+					}
+					masked = masked || mask.matchesTable(schema, parts[len(parts)-1])
+				}
+			}
+			if masked {
+				indexes = append(indexes, i)
+				break
+			}
+		}
+	}
+	return indexes
+}
+
+// maskRows replaces the values of the masked columns in place; NULL stays
+// NULL.
+func maskRows(rows []map[string]interface{}, columns []string, indexes []int) {
+	for _, row := range rows {
+		for _, i := range indexes {
+			if row[columns[i]] != nil {
+				row[columns[i]] = maskedValue
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package mssqlmcp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaskedColumnIndexes(t *testing.T) {
+	t.Setenv("MSSQL_MASKED_COLUMNS", "dbo.Customers.SSN,*.email")
+
+	config := testConfig(t)
+	columns := []string{"id", "s", "p", "contact", "email"}
+	sources := []columnSource{
+		{Schema: "dbo", Table: "Customers", Column: "CustomerID"},
+		{Masked: true},
+		{Masked: true},
+		{Schema: "dbo", Table: "Customers", Column: "Email"},
+		{Schema: "dbo", Table: "Customers", Column: "Name"},
+	}
+	query := "SELECT CustomerID AS id, CONCAT(SSN, '') AS s, LEFT(SSN, 3) AS p, Email AS contact, Name AS email FROM dbo.Customers"
+	if got, want := maskedColumnIndexes(config, query, columns, sources), []int{1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("maskedColumnIndexes = %v, want %v", got, want)
+	}
+
+	// Procedure results have no sources; columns are masked by name
+	if got, want := maskedColumnIndexes(config, "EXEC dbo.Report", columns, nil), []int{4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("maskedColumnIndexes without sources = %v, want %v", got, want)
+	}
+}
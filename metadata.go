@@ -0,0 +1,132 @@
+package mssqlmcp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// How long the server and database names queries run against are reused
+const EXECUTION_SOURCE_TTL = time.Minute
+
+// executionSummary describes how a result was produced, so its freshness
+// and cost can be judged at a glance.
+type executionSummary struct {
+	RowsReturned *int   `json:"rowsReturned,omitempty"`
+	RowsAffected *int64 `json:"rowsAffected,omitempty"`
+	ElapsedMs    int64  `json:"elapsedMs"`
+	Server       string `json:"server"`
+	Database     string `json:"database"`
+	// Digests of the result as read, before display limits, when enabled
+	SHA256     string `json:"sha256,omitempty"`
+	HMACSHA256 string `json:"hmacSha256,omitempty"`
+}
+
+var (
+	executionSourceMu     sync.Mutex
+	executionServer       string
+	executionDatabase     string
+	executionSourceReadAt time.Time
+)
+
+// addExecutionSummary attaches an executionSummary to a result under
+// "execution".
+func addExecutionSummary(config *DbConfig, data map[string]interface{}, elapsed time.Duration) {
+	summary := executionSummary{ElapsedMs: elapsed.Milliseconds()}
+	if rows, ok := data["rows"].([]map[string]interface{}); ok {
+		count := len(rows)
+		summary.RowsReturned = &count
+	}
+	if rowCount, ok := data["rowCount"].(int64); ok {
+		summary.RowsAffected = &rowCount
+	}
+	summary.Server, summary.Database = executionSource(config)
+	if config.ResultDigest || config.ResultHMACKey != "" {
+		if canonical, err := canonicalResult(data); err != nil {
+			log.Printf("Digesting result failed: %v", err)
+		} else {
+			digest := sha256.Sum256(canonical)
+			summary.SHA256 = hex.EncodeToString(digest[:])
+			if config.ResultHMACKey != "" {
+				mac := hmac.New(sha256.New, []byte(config.ResultHMACKey))
+				mac.Write(canonical)
+				summary.HMACSHA256 = hex.EncodeToString(mac.Sum(nil))
+			}
+		}
+	}
+	data["execution"] = summary
+}
+
+// canonicalResult is the form of a result its digests are computed over:
+// compact JSON of {"columns": [...], "rows": [[...], ...]} for result sets,
+// with rows as arrays aligned with the columns, or {"rowsAffected": n} for
+// writes. It matches the columns and rows of the json output format, so a
+// consumer can recompute the digest from a result that was not truncated.
+func canonicalResult(data map[string]interface{}) ([]byte, error) {
+	if columns, ok := data["columns"].([]string); ok {
+		rows, _ := data["rows"].([]map[string]interface{})
+		return json.Marshal(struct {
+			Columns []string        `json:"columns"`
+			Rows    [][]interface{} `json:"rows"`
+		}{columns, rowArrays(columns, rows)})
+	}
+	rowCount, _ := data["rowCount"].(int64)
+	return json.Marshal(struct {
+		RowsAffected int64 `json:"rowsAffected"`
+	}{rowCount})
+}
+
+// executionSource returns the name the server reports for itself and the
+// database queries run in, which differ from MSSQL_HOST and MSSQL_DATABASE
+// behind a listener or with snapshots. The configured names stand in when
+// they cannot be read, e.g. when replaying a cassette.
+func executionSource(config *DbConfig) (string, string) {
+	if config.CassetteMode == cassetteReplay {
+		return config.Server, config.Database
+	}
+
+	executionSourceMu.Lock()
+	defer executionSourceMu.Unlock()
+
+	if executionServer != "" && time.Since(executionSourceReadAt) < EXECUTION_SOURCE_TTL {
+		return executionServer, executionDatabase
+	}
+
+	data, err := executeQuery("SELECT @@SERVERNAME AS server_name, DB_NAME() AS database_name", true)
+	if err != nil {
+		log.Printf("Reading server name failed: %v", err)
+		return config.Server, config.Database
+	}
+	rows := data["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		return config.Server, config.Database
+	}
+	executionServer = displayValue(rows[0]["server_name"], config.Server)
+	executionDatabase = displayValue(rows[0]["database_name"], config.Database)
+	executionSourceReadAt = time.Now()
+	return executionServer, executionDatabase
+}
+
+// String renders the summary as one line of text.
+func (summary executionSummary) String() string {
+	text := "Executed"
+	switch {
+	case summary.RowsAffected != nil:
+		text = fmt.Sprintf("%d rows affected", *summary.RowsAffected)
+	case summary.RowsReturned != nil:
+		text = fmt.Sprintf("%d rows returned", *summary.RowsReturned)
+	}
+	text = fmt.Sprintf("%s in %d ms on %s, database %s", text, summary.ElapsedMs, summary.Server, summary.Database)
+	if summary.SHA256 != "" {
+		text += ", sha256 " + summary.SHA256
+	}
+	if summary.HMACSHA256 != "" {
+		text += ", hmac-sha256 " + summary.HMACSHA256
+	}
+	return text
+}
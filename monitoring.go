@@ -0,0 +1,356 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// registerMonitoringTools adds tools reporting the operational state of
+// database features.
+func registerMonitoringTools(s *server.MCPServer) {
+	brokerTool := mcp.NewTool("service_broker_status",
+		mcp.WithDescription("Report Service Broker health: whether it is enabled, queue depths, queues disabled by poison messages, conversations by state and messages stuck in the transmission queue"),
+	)
+
+	s.AddTool(brokerTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := describeServiceBroker()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading Service Broker status: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+
+	infoTool := mcp.NewTool("server_info",
+		mcp.WithDescription("Report the server version and edition, when it last restarted and its uptime, recent availability group failovers, the current database and its isolation settings: whether read committed snapshot (RCSI) and snapshot isolation are on, and so whether reads block behind writers. Use it to answer whether the database restarted or failed over."),
+	)
+
+	s.AddTool(infoTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := describeServerInfo()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading server info: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+
+	azureTool := mcp.NewTool("azure_resource_stats",
+		mcp.WithDescription("For Azure SQL Database, show resource utilization against the service tier limits (CPU/DTU, data IO, log IO, memory, workers, sessions) in 5-minute buckets, plus elastic pool utilization when the database is in a pool"),
+		mcp.WithNumber("minutes",
+			mcp.Description("How far back to look, in minutes (default 60). Windows over 60 minutes use the 5-minute history in master, kept for 14 days."),
+		),
+	)
+
+	s.AddTool(azureTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		minutes := DEFAULT_AZURE_STATS_MINUTES
+		if value, ok := request.Params.Arguments["minutes"].(float64); ok && value > 0 {
+			minutes = int(value)
+		}
+
+		result, err := describeAzureResourceStats(minutes)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading resource stats: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+}
+
+// describeAzureResourceStats renders resource utilization of an Azure SQL
+// database over the last minutes, and of its elastic pool if it has one.
+func describeAzureResourceStats(minutes int) (string, error) {
+	info, err := executeQuery(`SELECT CAST(SERVERPROPERTY('EngineEdition') AS int) AS engine_edition,
+			DB_NAME() AS database_name, so.edition, so.service_objective, so.elastic_pool_name
+		FROM (SELECT 1 AS one) x
+		LEFT JOIN sys.database_service_objectives so ON so.database_id = DB_ID()`, true)
+	if err != nil {
+		// sys.database_service_objectives only exists on Azure
+		return "", fmt.Errorf("not an Azure SQL Database (%v)", err)
+	}
+	row := info["rows"].([]map[string]interface{})[0]
+	if edition, _ := row["engine_edition"].(int64); edition != 5 {
+		return "", fmt.Errorf("resource stats are only available on Azure SQL Database (engine edition %v)", row["engine_edition"])
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# Resource utilization of %v (%v %v), last %d minutes, times in UTC\n\n", row["database_name"], row["edition"], row["service_objective"], minutes))
+	result.WriteString("Percentages are of the service tier limit; sustained values near 100 mean the database is being throttled.\n\n")
+
+	columns := `DATEADD(minute, DATEDIFF(minute, 0, end_time) / 5 * 5, 0) AS window_start,
+			CAST(AVG(avg_cpu_percent) AS decimal(5,1)) AS avg_cpu,
+			CAST(MAX(avg_cpu_percent) AS decimal(5,1)) AS max_cpu,
+			CAST(AVG(avg_data_io_percent) AS decimal(5,1)) AS avg_data_io,
+			CAST(MAX(avg_data_io_percent) AS decimal(5,1)) AS max_data_io,
+			CAST(AVG(avg_log_write_percent) AS decimal(5,1)) AS avg_log_io,
+			CAST(MAX(avg_log_write_percent) AS decimal(5,1)) AS max_log_io,
+			CAST(MAX(max_worker_percent) AS decimal(5,1)) AS max_workers,
+			CAST(MAX(max_session_percent) AS decimal(5,1)) AS max_sessions`
+
+	var stats map[string]interface{}
+	if minutes <= 60 {
+		// 15-second samples of the last hour, readable from the database itself
+		stats, err = executeQuery(fmt.Sprintf(`SELECT %s,
+				CAST(MAX(avg_memory_usage_percent) AS decimal(5,1)) AS max_memory
+			FROM sys.dm_db_resource_stats
+			WHERE end_time >= DATEADD(minute, -@p1, GETUTCDATE())
+			GROUP BY DATEADD(minute, DATEDIFF(minute, 0, end_time) / 5 * 5, 0)
+			ORDER BY window_start`, columns), true, minutes)
+	} else {
+		stats, err = queryMaster(fmt.Sprintf(`SELECT %s
+			FROM sys.resource_stats
+			WHERE database_name = @p2 AND end_time >= DATEADD(minute, -@p1, GETUTCDATE())
+			GROUP BY DATEADD(minute, DATEDIFF(minute, 0, end_time) / 5 * 5, 0)
+			ORDER BY window_start`, columns), minutes, row["database_name"])
+	}
+	if err != nil {
+		return "", err
+	}
+	table, err := formatResults(stats)
+	if err != nil {
+		return "", err
+	}
+	result.WriteString("## Database\n\n" + table)
+
+	if row["elastic_pool_name"] != nil {
+		result.WriteString(fmt.Sprintf("\n## Elastic pool %v\n\n", row["elastic_pool_name"]))
+		pool, err := queryMaster(`SELECT DATEADD(minute, DATEDIFF(minute, 0, end_time) / 5 * 5, 0) AS window_start,
+				CAST(MAX(avg_cpu_percent) AS decimal(5,1)) AS max_cpu,
+				CAST(MAX(avg_data_io_percent) AS decimal(5,1)) AS max_data_io,
+				CAST(MAX(avg_log_write_percent) AS decimal(5,1)) AS max_log_io,
+				CAST(MAX(max_worker_percent) AS decimal(5,1)) AS max_workers,
+				CAST(MAX(max_session_percent) AS decimal(5,1)) AS max_sessions,
+				CAST(MAX(avg_storage_percent) AS decimal(5,1)) AS storage
+			FROM sys.elastic_pool_resource_stats
+			WHERE elastic_pool_name = @p2 AND end_time >= DATEADD(minute, -@p1, GETUTCDATE())
+			GROUP BY DATEADD(minute, DATEDIFF(minute, 0, end_time) / 5 * 5, 0)
+			ORDER BY window_start`, minutes, row["elastic_pool_name"])
+		if err != nil {
+			// Pool statistics live in master, which the login may not reach
+			result.WriteString(fmt.Sprintf("Pool statistics are unavailable: %v\n", err))
+		} else {
+			table, err := formatResults(pool)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(table)
+		}
+	}
+	return result.String(), nil
+}
+
+// queryMaster runs a read query against the master database of the server,
+// where Azure keeps server-wide history views.
+func queryMaster(query string, args ...interface{}) (map[string]interface{}, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return withCassette(config, "-- master\n"+query, 0, args, func() (map[string]interface{}, error) {
+		db, err := openDatabase(config, "master")
+		if err != nil {
+			return nil, fmt.Errorf("database connection error: %v", err)
+		}
+		defer db.Close()
+
+		return runQuery(db, config, query, true, args...)
+	})
+}
+
+// describeServerInfo renders the version of the server and the isolation
+// settings of the current database, warning when reads take shared locks.
+func describeServerInfo() (string, error) {
+	info, err := executeQuery(`SELECT @@SERVERNAME AS server_name,
+			CAST(SERVERPROPERTY('ProductVersion') AS nvarchar(128)) AS product_version,
+			CAST(SERVERPROPERTY('ProductLevel') AS nvarchar(128)) AS product_level,
+			CAST(SERVERPROPERTY('Edition') AS nvarchar(128)) AS edition,
+			CAST(SERVERPROPERTY('IsHadrEnabled') AS int) AS hadr_enabled,
+			d.name AS database_name, d.compatibility_level,
+			d.is_read_committed_snapshot_on, d.snapshot_isolation_state_desc
+		FROM sys.databases d
+		WHERE d.database_id = DB_ID()`, true)
+	if err != nil {
+		return "", err
+	}
+	row := info["rows"].([]map[string]interface{})[0]
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# %v\n\n", row["server_name"]))
+	result.WriteString(fmt.Sprintf("- Version: %v %v, %v\n", row["product_version"], row["product_level"], row["edition"]))
+	result.WriteString(fmt.Sprintf("- Database: %v (compatibility level %v)\n", row["database_name"], row["compatibility_level"]))
+	result.WriteString(fmt.Sprintf("- Read committed snapshot (RCSI): %s\n", onOff(row["is_read_committed_snapshot_on"])))
+	result.WriteString(fmt.Sprintf("- Snapshot isolation: %v\n", row["snapshot_isolation_state_desc"]))
+
+	var warnings []string
+
+	// The start time needs VIEW SERVER STATE and is not exposed on Azure SQL Database
+	uptime, err := executeQuery(`SELECT sqlserver_start_time,
+			DATEDIFF_BIG(SECOND, sqlserver_start_time, SYSDATETIME()) AS uptime_seconds
+		FROM sys.dm_os_sys_info`, true)
+	if err != nil {
+		result.WriteString(fmt.Sprintf("- Last restart: unavailable (%v)\n", err))
+	} else {
+		started := uptime["rows"].([]map[string]interface{})[0]
+		seconds, _ := started["uptime_seconds"].(int64)
+		result.WriteString(fmt.Sprintf("- Last restart: %v (up %s)\n", started["sqlserver_start_time"], formatUptime(seconds)))
+		if seconds < 24*60*60 {
+			warnings = append(warnings, fmt.Sprintf("The server restarted %s ago: plan cache, query statistics, wait statistics and missing index suggestions only cover the time since.", formatUptime(seconds)))
+		}
+	}
+
+	if hadr, _ := row["hadr_enabled"].(int64); hadr == 1 {
+		failovers, err := executeQuery(`SELECT TOP (10) event_time, availability_group, previous_state, current_state
+			FROM (
+				SELECT x.value('(event/@timestamp)[1]', 'datetime2') AS event_time,
+					x.value('(event/data[@name="availability_group_name"]/value)[1]', 'nvarchar(128)') AS availability_group,
+					x.value('(event/data[@name="previous_state"]/text)[1]', 'nvarchar(60)') AS previous_state,
+					x.value('(event/data[@name="current_state"]/text)[1]', 'nvarchar(60)') AS current_state
+				FROM (
+					SELECT CAST(event_data AS xml) AS x
+					FROM sys.fn_xe_file_target_read_file('AlwaysOn_health*.xel', NULL, NULL, NULL)
+					WHERE object_name = 'availability_replica_state_change'
+				) AS events
+			) AS changes
+			ORDER BY event_time DESC`, true)
+		switch {
+		case err != nil:
+			result.WriteString(fmt.Sprintf("\nFailover history is unavailable: %v\n", err))
+		case len(failovers["rows"].([]map[string]interface{})) == 0:
+			result.WriteString("\nNo availability replica role changes are recorded in the AlwaysOn_health session.\n")
+		default:
+			table, err := formatResults(failovers)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString("\n## Recent availability replica role changes (UTC)\n\n" + table)
+		}
+	}
+	if row["is_read_committed_snapshot_on"] != true {
+		warnings = append(warnings, "RCSI is off: queries under the default READ COMMITTED isolation take shared locks, so they wait behind open write transactions and can block writers in turn. Reads here are not non-blocking; keep them short and selective, or use a SNAPSHOT transaction if snapshot isolation is on.")
+	}
+	if state := fmt.Sprintf("%v", row["snapshot_isolation_state_desc"]); state != "ON" {
+		warnings = append(warnings, fmt.Sprintf("Snapshot isolation is %s: begin_transaction with isolation_level SNAPSHOT fails on this database.", state))
+	}
+	if len(warnings) > 0 {
+		result.WriteString("\n## Warnings\n\n")
+		for _, warning := range warnings {
+			result.WriteString("- " + warning + "\n")
+		}
+	}
+	return result.String(), nil
+}
+
+// describeServiceBroker renders the state of the user queues, conversations
+// and transmission queue of the current database.
+func describeServiceBroker() (string, error) {
+	database, err := executeQuery("SELECT name, is_broker_enabled FROM sys.databases WHERE database_id = DB_ID()", true)
+	if err != nil {
+		return "", err
+	}
+	info := database["rows"].([]map[string]interface{})[0]
+
+	// Queue depth is the row count of the internal table backing each queue
+	queues, err := executeQuery(`SELECT SCHEMA_NAME(q.schema_id) + '.' + q.name AS queue,
+			ISNULL(SUM(p.rows), 0) AS messages,
+			q.is_receive_enabled, q.is_enqueue_enabled, q.is_activation_enabled,
+			q.is_poison_message_handling_enabled,
+			q.activation_procedure, q.max_readers
+		FROM sys.service_queues q
+		LEFT JOIN sys.internal_tables it ON it.parent_object_id = q.object_id AND it.internal_type_desc = 'QUEUE_MESSAGES'
+		LEFT JOIN sys.partitions p ON p.object_id = it.object_id AND p.index_id = 1
+		WHERE q.is_ms_shipped = 0
+		GROUP BY q.schema_id, q.name, q.is_receive_enabled, q.is_enqueue_enabled, q.is_activation_enabled,
+			q.is_poison_message_handling_enabled, q.activation_procedure, q.max_readers
+		ORDER BY queue`, true)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# Service Broker in %v\n\n", info["name"]))
+	if info["is_broker_enabled"] != true {
+		result.WriteString("Service Broker is DISABLED for this database: messages are not delivered until it is enabled (ALTER DATABASE ... SET ENABLE_BROKER).\n\n")
+	}
+
+	rows := queues["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		result.WriteString("No user queues exist; Service Broker is not in use.\n")
+		return result.String(), nil
+	}
+
+	result.WriteString("## Queues\n\n| Queue | Messages | Receive | Enqueue | Activation | Notes |\n|---|---|---|---|---|---|\n")
+	for _, row := range rows {
+		var notes []string
+		if row["is_receive_enabled"] != true {
+			notes = append(notes, "RECEIVE DISABLED (likely poison message: five rollbacks in a row)")
+		}
+		if row["is_poison_message_handling_enabled"] == false {
+			notes = append(notes, "poison message handling off")
+		}
+		activation := "off"
+		if row["is_activation_enabled"] == true {
+			activation = fmt.Sprintf("%v (max %v readers)", row["activation_procedure"], row["max_readers"])
+		}
+		result.WriteString(fmt.Sprintf("| %v | %v | %s | %s | %s | %s |\n",
+			row["queue"], row["messages"], onOff(row["is_receive_enabled"]), onOff(row["is_enqueue_enabled"]), activation, strings.Join(notes, "; ")))
+	}
+
+	conversations, err := executeQuery(`SELECT state_desc, COUNT_BIG(*) AS conversations
+		FROM sys.conversation_endpoints
+		GROUP BY state_desc
+		ORDER BY conversations DESC`, true)
+	if err != nil {
+		return "", err
+	}
+	result.WriteString("\n## Conversations by state\n\n")
+	rows = conversations["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		result.WriteString("None\n")
+	}
+	for _, row := range rows {
+		result.WriteString(fmt.Sprintf("- %v: %v\n", row["state_desc"], row["conversations"]))
+	}
+
+	// Messages wait in the transmission queue when they cannot be delivered;
+	// transmission_status explains why
+	transmission, err := executeQuery(`SELECT TOP (10) transmission_status, COUNT_BIG(*) AS messages, MIN(enqueue_time) AS oldest
+		FROM sys.transmission_queue
+		GROUP BY transmission_status
+		ORDER BY messages DESC`, true)
+	if err != nil {
+		return "", err
+	}
+	result.WriteString("\n## Transmission queue\n\n")
+	rows = transmission["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		result.WriteString("Empty\n")
+	}
+	for _, row := range rows {
+		status := fmt.Sprintf("%v", row["transmission_status"])
+		if status == "" {
+			status = "pending, no error"
+		}
+		result.WriteString(fmt.Sprintf("- %v messages since %v: %s\n", row["messages"], row["oldest"], status))
+	}
+	return result.String(), nil
+}
+
+// formatUptime renders a number of seconds as days, hours and minutes.
+func formatUptime(seconds int64) string {
+	days, hours, minutes := seconds/86400, seconds%86400/3600, seconds%3600/60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%d days %d hours", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%d hours %d minutes", hours, minutes)
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+func onOff(value interface{}) string {
+	if value == true {
+		return "on"
+	}
+	return "off"
+}
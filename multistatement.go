@@ -0,0 +1,116 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// queryStatement is one statement of a query holding several, with the line
+// it starts on.
+type queryStatement struct {
+	Text string
+	Line int
+}
+
+// selectStatements splits a query into its statements when it holds several
+// separated by semicolons and every one of them is a SELECT. Anything else,
+// such as variables declared for a final SELECT, returns nil and runs as
+// one statement.
+func selectStatements(query string) []queryStatement {
+	var statements []queryStatement
+	start := 0
+	add := func(end int) bool {
+		text := query[start:end]
+		tokens := significantTokens(tokenizeSQL(text))
+		if len(tokens) == 0 {
+			return true
+		}
+		if statementVerb(text) != "SELECT" {
+			return false
+		}
+		// Comments before a statement are left out
+		statements = append(statements, queryStatement{
+			Text: strings.TrimSpace(text[tokens[0].Pos:]),
+			Line: strings.Count(query[:start+tokens[0].Pos], "\n") + 1,
+		})
+		return true
+	}
+
+	for _, t := range significantTokens(tokenizeSQL(query)) {
+		if t.Text != ";" || t.Depth != 0 {
+			continue
+		}
+		if !add(t.Pos) {
+			return nil
+		}
+		start = t.Pos + 1
+	}
+	if !add(len(query)) || len(statements) < 2 {
+		return nil
+	}
+	return statements
+}
+
+// runStatements runs the statements of a query one after another through the
+// execute_sql handler, so each passes the same checks as a query of its own,
+// and labels each result. Execution stops at the first failing statement.
+// JSON results are returned as an array with one document per statement.
+func runStatements(ctx context.Context, request mcp.CallToolRequest, statements []queryStatement, handler server.ToolHandlerFunc) (*mcp.CallToolResult, error) {
+	format, _ := request.Params.Arguments["format"].(string)
+	if format == "" {
+		if config, err := getDbConfig(); err == nil {
+			format = config.OutputFormat
+		}
+	}
+
+	var report strings.Builder
+	var documents []string
+	for i, statement := range statements {
+		label := fmt.Sprintf("Statement %d of %d (line %d): %s", i+1, len(statements), statement.Line,
+			truncateString(strings.Join(strings.Fields(statement.Text), " "), 80))
+
+		arguments := make(map[string]interface{}, len(request.Params.Arguments))
+		for name, value := range request.Params.Arguments {
+			arguments[name] = value
+		}
+		delete(arguments, "query_file")
+		arguments["query"] = statement.Text
+		statementRequest := request
+		statementRequest.Params.Arguments = arguments
+
+		result, err := handler(ctx, statementRequest)
+		if err != nil {
+			return nil, err
+		}
+		text := resultText(result)
+		if result.IsError {
+			report.WriteString(fmt.Sprintf("-- %s\nFailed: %s\n", label, text))
+			if remaining := len(statements) - i - 1; remaining > 0 {
+				report.WriteString(fmt.Sprintf("Stopped; the remaining %d statements did not run.\n", remaining))
+			}
+			return mcp.NewToolResultError(report.String()), nil
+		}
+		documents = append(documents, text)
+		report.WriteString(fmt.Sprintf("-- %s\n%s\n\n", label, strings.TrimRight(text, "\n")))
+	}
+
+	if format == "json" {
+		return mcp.NewToolResultText("[" + strings.Join(documents, ",\n") + "]"), nil
+	}
+	return mcp.NewToolResultText(strings.TrimRight(report.String(), "\n")), nil
+}
+
+// resultText joins the text content of a tool result.
+func resultText(result *mcp.CallToolResult) string {
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
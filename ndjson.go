@@ -0,0 +1,80 @@
+package mssqlmcp
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"os"
+)
+
+// streamNDJSON runs a query and writes each row to path as a JSON object on
+// its own line while the result is read (see exportRows). Keys keep the
+// column order, and binary values are base64 strings that
+// MSSQL_BINARY_MAX_BYTES does not cut.
+func streamNDJSON(config *DbConfig, path, query string) (int64, int, error) {
+	var (
+		file        *os.File
+		writer      *bufio.Writer
+		keys        [][]byte
+		columnTypes []*sql.ColumnType
+	)
+	begin := func(columns []string, types []*sql.ColumnType, masked []bool) error {
+		keys = make([][]byte, len(columns))
+		for i, column := range columns {
+			var err error
+			if keys[i], err = json.Marshal(column); err != nil {
+				return err
+			}
+		}
+		columnTypes = types
+
+		var err error
+		if file, err = os.Create(path); err != nil {
+			return err
+		}
+		writer = bufio.NewWriterSize(file, 1<<16)
+		return nil
+	}
+	write := func(values []interface{}) error {
+		writer.WriteByte('{')
+		for i, value := range values {
+			if i > 0 {
+				writer.WriteByte(',')
+			}
+			writer.Write(keys[i])
+			writer.WriteByte(':')
+			if value != nil {
+				// Binary values are written whole, which json encodes as base64
+				if binary, ok := binaryValue(columnTypes[i], value); ok {
+					value = binary
+				} else {
+					value = convertValue(config, columnTypes[i], value)
+				}
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			writer.Write(encoded)
+		}
+		_, err := writer.WriteString("}\n")
+		return err
+	}
+
+	count, err := exportRows(config, query, begin, write)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, len(keys), nil
+}
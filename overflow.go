@@ -0,0 +1,130 @@
+package mssqlmcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+// overflowTypePattern finds the type named by error 8115, e.g. "Arithmetic
+// overflow error converting expression to data type int."
+var overflowTypePattern = regexp.MustCompile(`(?i)arithmetic overflow error converting expression to data type (\w+)`)
+
+// arithmeticOverflowType returns the type an aggregate overflowed, when err
+// is SQL Server's arithmetic overflow error (8115).
+func arithmeticOverflowType(err error) (string, bool) {
+	var sqlErr mssql.Error
+	if errors.As(err, &sqlErr) && sqlErr.Number != 8115 {
+		return "", false
+	}
+	// Errors from paged reads arrive wrapped as text
+	match := overflowTypePattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", false
+	}
+	return strings.ToLower(match[1]), true
+}
+
+// widenedAggregateType is the type aggregates are widened to after one over
+// the given type overflowed, or "" when there is nothing wider to try.
+func widenedAggregateType(overflowed string) string {
+	switch overflowed {
+	case "tinyint", "smallint", "int":
+		return "bigint"
+	case "bigint":
+		return "decimal(38, 0)"
+	}
+	return ""
+}
+
+// widenAggregates rewrites SUM and AVG so they accumulate in the given type,
+// and COUNT into COUNT_BIG, reporting whether anything changed. Arguments are
+// multiplied by a 1 of that type rather than cast, so integers widen while
+// decimal, money and float values keep their own type and fractions.
+func widenAggregates(query, widerType string) (string, bool) {
+	tokens := significantTokens(tokenizeSQL(query))
+
+	type edit struct {
+		pos, end int
+		text     string
+	}
+	var edits []edit
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i+1].Text != "(" || (i > 0 && tokens[i-1].Text == ".") {
+			continue
+		}
+		switch {
+		case tokens[i].isKeyword("COUNT"):
+			edits = append(edits, edit{tokens[i].Pos, tokens[i].Pos + len(tokens[i].Text), "COUNT_BIG"})
+		case tokens[i].isKeyword("SUM") || tokens[i].isKeyword("AVG"):
+			open := i + 1
+			closing := skipParenthesized(tokens, open) - 1
+			if closing >= len(tokens) || closing <= open+1 {
+				continue
+			}
+			first := open + 1
+			if tokens[first].isKeyword("DISTINCT") || tokens[first].isKeyword("ALL") {
+				first++
+			}
+			if first >= closing {
+				continue
+			}
+			argument := query[tokens[first].Pos:tokens[closing].Pos]
+			edits = append(edits, edit{tokens[first].Pos, tokens[closing].Pos,
+				fmt.Sprintf("CAST(1 AS %s) * (%s)", widerType, strings.TrimSpace(argument))})
+		}
+	}
+	if len(edits) == 0 {
+		return query, false
+	}
+
+	// Nested aggregates are not valid T-SQL, so edits never overlap
+	var rewritten strings.Builder
+	last := 0
+	for _, e := range edits {
+		if e.pos < last {
+			continue
+		}
+		rewritten.WriteString(query[last:e.pos])
+		rewritten.WriteString(e.text)
+		last = e.end
+	}
+	rewritten.WriteString(query[last:])
+	return rewritten.String(), true
+}
+
+// retryWithWiderAggregates reruns a query that failed with an arithmetic
+// overflow with its aggregates widened, first to bigint and then to
+// decimal(38, 0), returning a note on the rewrite that succeeded. The error
+// of the last attempt is returned when widening does not help.
+func retryWithWiderAggregates(ctx context.Context, query string, err error, args ...interface{}) (map[string]interface{}, string, error) {
+	attempted := query
+	for {
+		overflowed, ok := arithmeticOverflowType(err)
+		if !ok {
+			return nil, "", err
+		}
+		wider := widenedAggregateType(overflowed)
+		if wider == "" {
+			return nil, "", err
+		}
+		rewritten, changed := widenAggregates(query, wider)
+		if !changed || rewritten == attempted {
+			return nil, "", err
+		}
+		attempted = rewritten
+
+		log.Printf("Arithmetic overflow to %s, retrying with aggregates widened to %s", overflowed, wider)
+		data, retryErr := executeSessionQuery(ctx, rewritten, true, args...)
+		if retryErr == nil {
+			return data, fmt.Sprintf("An aggregate overflowed %s, so the query was rerun with SUM and AVG accumulating in %s and COUNT as COUNT_BIG: %s",
+				overflowed, wider, strings.Join(strings.Fields(rewritten), " ")), nil
+		}
+		err = retryErr
+	}
+}
@@ -0,0 +1,280 @@
+package mssqlmcp
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/golang-sql/civil"
+)
+
+var (
+	parameterNamePattern = regexp.MustCompile(`^@?[A-Za-z_][A-Za-z0-9_]*$`)
+	typeNamePattern      = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+)
+
+// Largest integer a JSON number holds exactly
+const maxExactJSONInteger = 1 << 53
+
+// queryParameters binds the params argument of a tool call as named
+// parameters, referenced in the query as @name. A value is bound as given,
+// or as the SQL Server type named in a {"value": ..., "type": ...} object;
+// a list of rows with a user-defined table type as its type is bound as a
+// table-valued parameter.
+// Parameters are sorted by name so recorded cassettes match on replay.
+func queryParameters(params map[string]interface{}) ([]interface{}, error) {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if !parameterNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid parameter name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]interface{}, 0, len(names))
+	bound := make(map[string]bool, len(names))
+	for _, name := range names {
+		bare := strings.TrimPrefix(name, "@")
+		if bound[strings.ToLower(bare)] {
+			return nil, fmt.Errorf("parameter %s is given twice", bare)
+		}
+		bound[strings.ToLower(bare)] = true
+
+		value, err := parameterValue(params[name])
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %v", name, err)
+		}
+		args = append(args, sql.Named(bare, value))
+	}
+	return args, nil
+}
+
+// parameterValue converts a JSON parameter value to the value bound for it.
+// Whole numbers are bound as bigint rather than float.
+func parameterValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, string, bool:
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= maxExactJSONInteger {
+			return int64(v), nil
+		}
+		return v, nil
+	case map[string]interface{}:
+		typeName, _ := v["type"].(string)
+		if typeName == "" {
+			return nil, errors.New("a typed value needs a type")
+		}
+		if rows, ok := v["value"].([]interface{}); ok {
+			return tableValuedParameter(typeName, rows)
+		}
+		if v["value"] == nil {
+			return nil, nil
+		}
+		return typedParameterValue(strings.ToLower(typeName), v["value"])
+	case []interface{}:
+		return nil, errors.New("a list of rows is bound as a table-valued parameter and needs its table type, e.g. {\"value\": [1, 2, 3], \"type\": \"dbo.IdList\"}")
+	}
+	return nil, fmt.Errorf("unsupported value %v; use a string, number, boolean, null or {\"value\": ..., \"type\": ...}", value)
+}
+
+// typedParameterValue binds a value as the given SQL Server type. Dates and
+// times are written in ISO 8601, e.g. 2024-01-31 or 2024-01-31T13:45:00.
+func typedParameterValue(typeName string, value interface{}) (interface{}, error) {
+	text := fmt.Sprintf("%v", value)
+	if number, ok := value.(float64); ok {
+		text = fmt.Sprintf("%.15g", number)
+	}
+	naive := strings.Replace(strings.TrimSpace(text), " ", "T", 1)
+
+	switch typeName {
+	case "nvarchar", "nchar", "ntext":
+		return text, nil
+	case "varchar", "char", "text":
+		return mssql.VarChar(text), nil
+	case "bit":
+		switch strings.ToLower(text) {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid bit %q", text)
+	case "tinyint", "smallint", "int", "bigint":
+		var n int64
+		if _, err := fmt.Sscan(text, &n); err != nil {
+			return nil, fmt.Errorf("invalid %s %q", typeName, text)
+		}
+		return n, nil
+	case "float", "real":
+		var f float64
+		if _, err := fmt.Sscan(text, &f); err != nil {
+			return nil, fmt.Errorf("invalid %s %q", typeName, text)
+		}
+		return f, nil
+	case "decimal", "numeric", "money", "smallmoney":
+		// Sent as text so the server converts it without rounding through float
+		return text, nil
+	case "date":
+		return civil.ParseDate(naive)
+	case "time":
+		return civil.ParseTime(naive)
+	case "datetime2":
+		return parseNaiveDatetime(naive)
+	case "datetime", "smalldatetime":
+		t, err := parseNaiveDatetime(naive)
+		if err != nil {
+			return nil, err
+		}
+		return mssql.DateTime1(t.In(time.UTC)), nil
+	case "datetimeoffset":
+		t, err := time.Parse(time.RFC3339Nano, naive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid datetimeoffset %q (expected e.g. 2024-01-31T13:45:00+01:00)", text)
+		}
+		return mssql.DateTimeOffset(t), nil
+	case "uniqueidentifier":
+		var id mssql.UniqueIdentifier
+		if err := id.Scan(text); err != nil {
+			return nil, fmt.Errorf("invalid uniqueidentifier %q", text)
+		}
+		return id, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", typeName)
+}
+
+// parseNaiveDatetime reads a date and time without an offset, accepting a
+// bare date as midnight and a time without seconds.
+func parseNaiveDatetime(text string) (civil.DateTime, error) {
+	for _, layout := range []string{isoDateLayout, "2006-01-02T15:04", "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return civil.DateTimeOf(t), nil
+		}
+	}
+	return civil.DateTime{}, fmt.Errorf("invalid date and time %q (expected e.g. 2024-01-31T13:45:00)", text)
+}
+
+// parameterDeclarations declares the parameters of the params argument as
+// T-SQL does for sp_executesql, e.g. "@customer bigint, @since date", for
+// catalog functions that compile a query without binding values.
+func parameterDeclarations(params map[string]interface{}) (string, error) {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if !parameterNamePattern.MatchString(name) {
+			return "", fmt.Errorf("invalid parameter name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	declarations := make([]string, 0, len(names))
+	for _, name := range names {
+		typeName := "sql_variant"
+		switch v := params[name].(type) {
+		case string:
+			typeName = "nvarchar(max)"
+		case bool:
+			typeName = "bit"
+		case float64:
+			typeName = "float"
+			if v == math.Trunc(v) && math.Abs(v) <= maxExactJSONInteger {
+				typeName = "bigint"
+			}
+		case map[string]interface{}:
+			declared, _ := v["type"].(string)
+			if _, isTable := v["value"].([]interface{}); isTable {
+				schema, tableType, err := parseObjectName(declared)
+				if err != nil {
+					return "", fmt.Errorf("parameter %s: %v", name, err)
+				}
+				typeName = formatObjectName(schema, tableType) + " READONLY"
+				break
+			}
+			if !typeNamePattern.MatchString(declared) {
+				return "", fmt.Errorf("parameter %s: invalid type %q", name, declared)
+			}
+			typeName = declaredParameterType(strings.ToLower(declared))
+		}
+		declarations = append(declarations, "@"+strings.TrimPrefix(name, "@")+" "+typeName)
+	}
+	return strings.Join(declarations, ", "), nil
+}
+
+// declaredParameterType gives the types of typedParameterValue the length or
+// precision their declaration needs.
+func declaredParameterType(typeName string) string {
+	switch typeName {
+	case "nvarchar", "nchar", "ntext":
+		return "nvarchar(max)"
+	case "varchar", "char", "text":
+		return "varchar(max)"
+	case "decimal", "numeric":
+		return "decimal(38,10)"
+	}
+	return typeName
+}
+
+// argumentDeclarations declares bound parameters, as queryParameters makes
+// them, for catalog functions that compile a query without running it. It
+// fails for values whose type it cannot name, so callers that depend on the
+// description do not silently get none.
+func argumentDeclarations(args []interface{}) (string, error) {
+	var declarations []string
+	for _, arg := range args {
+		named, ok := arg.(sql.NamedArg)
+		if !ok || named.Name == "" {
+			return "", fmt.Errorf("cannot declare the unnamed parameter %v", arg)
+		}
+		value, output := named.Value, ""
+		if out, ok := value.(sql.Out); ok {
+			if _, ok := out.Dest.(*string); !ok {
+				return "", fmt.Errorf("cannot declare output parameter %s of type %T", named.Name, out.Dest)
+			}
+			value, output = "", " OUTPUT"
+		}
+		var typeName string
+		switch v := value.(type) {
+		case nil:
+			typeName = "sql_variant"
+		case string:
+			typeName = "nvarchar(max)"
+		case mssql.VarChar:
+			typeName = "varchar(max)"
+		case bool:
+			typeName = "bit"
+		case int64:
+			typeName = "bigint"
+		case float64:
+			typeName = "float"
+		case civil.Date:
+			typeName = "date"
+		case civil.Time:
+			typeName = "time"
+		case civil.DateTime:
+			typeName = "datetime2"
+		case mssql.DateTime1:
+			typeName = "datetime"
+		case mssql.DateTimeOffset:
+			typeName = "datetimeoffset"
+		case mssql.UniqueIdentifier:
+			typeName = "uniqueidentifier"
+		case mssql.TVP:
+			schema, tableType, err := parseObjectName(v.TypeName)
+			if err != nil {
+				return "", fmt.Errorf("parameter %s: %v", named.Name, err)
+			}
+			typeName = formatObjectName(schema, tableType) + " READONLY"
+		default:
+			return "", fmt.Errorf("cannot declare parameter %s of type %T", named.Name, value)
+		}
+		declarations = append(declarations, "@"+named.Name+" "+typeName+output)
+	}
+	return strings.Join(declarations, ", "), nil
+}
@@ -0,0 +1,274 @@
+package mssqlmcp
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// Rows per row group of Parquet exports, and so the most rows held in memory
+const PARQUET_ROW_GROUP_ROWS = 65536
+
+// streamParquet exports a query as a Parquet file, writing a row group each
+// PARQUET_ROW_GROUP_ROWS rows as they are read (see exportRows). Columns
+// keep their SQL Server types as far as Parquet has them (see
+// parquetColumnOf); binary values are written whole.
+func streamParquet(config *DbConfig, path, query string) (int64, int, error) {
+	var (
+		file    *os.File
+		writer  *parquetWriter
+		columns []parquetColumn
+	)
+	begin := func(names []string, columnTypes []*sql.ColumnType, masked []bool) error {
+		columns = make([]parquetColumn, len(names))
+		for i, columnType := range columnTypes {
+			databaseType := columnType.DatabaseTypeName()
+			if masked[i] {
+				// Masked values are text whatever the column holds
+				databaseType = "NVARCHAR"
+			}
+			precision, scale, _ := columnType.DecimalSize()
+			columns[i] = parquetColumnOf(config, names[i], databaseType, precision, scale)
+		}
+
+		var err error
+		if file, err = os.Create(path); err != nil {
+			return err
+		}
+		// The file is closed here, not by the Parquet writer
+		writer, err = newParquetWriter(struct{ io.Writer }{file}, columns)
+		return err
+	}
+	write := func(values []interface{}) error {
+		return writer.WriteRow(values)
+	}
+
+	count, err := exportRows(config, query, begin, write)
+	if writer != nil {
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, len(columns), nil
+}
+
+// parquetColumn stores one result column: its Arrow field, which the Parquet
+// writer maps to a Parquet type, and how a scanned value is appended.
+type parquetColumn struct {
+	field  arrow.Field
+	append func(builder array.Builder, value interface{}) error
+}
+
+// parquetColumnOf chooses how a column of an SQL Server type is stored.
+// Integers, floats, bits, exact decimals (precision and scale as given),
+// dates, times and timestamps are typed; binary data is a byte array and
+// everything else a string. Naive datetimes are timestamps without a zone,
+// unless converted to MSSQL_TIMEZONE from a known MSSQL_DATETIME_STORAGE.
+func parquetColumnOf(config *DbConfig, name, databaseType string, precision, scale int64) parquetColumn {
+	column := parquetColumn{field: arrow.Field{Name: name, Nullable: true}}
+	switch databaseType {
+	case "BIT":
+		column.field.Type = arrow.FixedWidthTypes.Boolean
+		column.append = appendParquet(func(b *array.BooleanBuilder, v bool) { b.Append(v) })
+	case "TINYINT":
+		column.field.Type = arrow.PrimitiveTypes.Uint8
+		column.append = appendParquet(func(b *array.Uint8Builder, v int64) { b.Append(uint8(v)) })
+	case "SMALLINT":
+		column.field.Type = arrow.PrimitiveTypes.Int16
+		column.append = appendParquet(func(b *array.Int16Builder, v int64) { b.Append(int16(v)) })
+	case "INT":
+		column.field.Type = arrow.PrimitiveTypes.Int32
+		column.append = appendParquet(func(b *array.Int32Builder, v int64) { b.Append(int32(v)) })
+	case "BIGINT":
+		column.field.Type = arrow.PrimitiveTypes.Int64
+		column.append = appendParquet(func(b *array.Int64Builder, v int64) { b.Append(v) })
+	case "REAL":
+		column.field.Type = arrow.PrimitiveTypes.Float32
+		column.append = appendParquet(func(b *array.Float32Builder, v float64) { b.Append(float32(v)) })
+	case "FLOAT":
+		column.field.Type = arrow.PrimitiveTypes.Float64
+		column.append = appendParquet(func(b *array.Float64Builder, v float64) { b.Append(v) })
+	case "DECIMAL", "NUMERIC", "MONEY", "SMALLMONEY":
+		switch databaseType {
+		case "MONEY":
+			precision, scale = 19, 4
+		case "SMALLMONEY":
+			precision, scale = 10, 4
+		}
+		decimalType := &arrow.Decimal128Type{Precision: int32(precision), Scale: int32(scale)}
+		column.field.Type = decimalType
+		column.append = func(builder array.Builder, value interface{}) error {
+			// The driver reads these as exact decimal text
+			var text string
+			switch v := value.(type) {
+			case []byte:
+				text = string(v)
+			case string:
+				text = v
+			case float64:
+				text = fmt.Sprintf("%.*f", scale, v)
+			default:
+				return fmt.Errorf("unexpected %T value", value)
+			}
+			number, err := decimal128.FromString(text, decimalType.Precision, decimalType.Scale)
+			if err != nil {
+				return err
+			}
+			builder.(*array.Decimal128Builder).Append(number)
+			return nil
+		}
+	case "DATE":
+		column.field.Type = arrow.FixedWidthTypes.Date32
+		column.append = appendParquet(func(b *array.Date32Builder, v time.Time) { b.Append(arrow.Date32FromTime(v)) })
+	case "TIME":
+		column.field.Type = arrow.FixedWidthTypes.Time64us
+		column.append = appendParquet(func(b *array.Time64Builder, v time.Time) {
+			midnight := time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, v.Location())
+			b.Append(arrow.Time64(v.Sub(midnight).Microseconds()))
+		})
+	case "DATETIME", "DATETIME2", "SMALLDATETIME":
+		// Naive values arrive as UTC wall clock, which is what a timestamp
+		// without a zone stores; converted ones are instants
+		timestampType := &arrow.TimestampType{Unit: arrow.Microsecond}
+		if config.DisplayLocation != nil && config.StorageLocation != nil {
+			timestampType.TimeZone = "UTC"
+		}
+		column.field.Type = timestampType
+		column.append = appendParquet(func(b *array.TimestampBuilder, v time.Time) {
+			b.Append(arrow.Timestamp(displayDatetime(config, v).UnixMicro()))
+		})
+	case "DATETIMEOFFSET":
+		column.field.Type = &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+		column.append = appendParquet(func(b *array.TimestampBuilder, v time.Time) { b.Append(arrow.Timestamp(v.UnixMicro())) })
+	case "BINARY", "VARBINARY", "IMAGE", "TIMESTAMP":
+		column.field.Type = arrow.BinaryTypes.Binary
+		column.append = appendParquet(func(b *array.BinaryBuilder, v []byte) { b.Append(v) })
+	case "UNIQUEIDENTIFIER":
+		column.field.Type = arrow.BinaryTypes.String
+		column.append = appendParquet(func(b *array.StringBuilder, v []byte) { b.Append(formatUniqueIdentifier(v)) })
+	default:
+		column.field.Type = arrow.BinaryTypes.String
+		column.append = func(builder array.Builder, value interface{}) error {
+			builder.(*array.StringBuilder).Append(parquetText(value))
+			return nil
+		}
+	}
+	return column
+}
+
+// appendParquet makes the append function of a column whose scanned values
+// have one Go type.
+func appendParquet[B array.Builder, V any](add func(builder B, value V)) func(array.Builder, interface{}) error {
+	return func(builder array.Builder, value interface{}) error {
+		v, ok := value.(V)
+		if !ok {
+			return fmt.Errorf("unexpected %T value", value)
+		}
+		add(builder.(B), v)
+		return nil
+	}
+}
+
+// parquetText renders a value of a string column. Bytes that are not UTF-8,
+// e.g. of CLR types such as geography, are written whole as hex.
+func parquetText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.ToValidUTF8(v, "\uFFFD")
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v)
+		}
+		return formatBinary(&DbConfig{}, v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// parquetWriter writes rows to a Parquet file, one row group per
+// PARQUET_ROW_GROUP_ROWS rows.
+type parquetWriter struct {
+	columns []parquetColumn
+	file    *pqarrow.FileWriter
+	builder *array.RecordBuilder
+	rows    int
+}
+
+// newParquetWriter starts a Parquet file with gzip-compressed pages. The
+// writer closes w when it is closed if w is an io.Closer.
+func newParquetWriter(w io.Writer, columns []parquetColumn) (*parquetWriter, error) {
+	fields := make([]arrow.Field, len(columns))
+	for i, column := range columns {
+		fields[i] = column.field
+	}
+	schema := arrow.NewSchema(fields, nil)
+	properties := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Gzip))
+	file, err := pqarrow.NewFileWriter(schema, w, properties, pqarrow.DefaultWriterProps())
+	if err != nil {
+		return nil, err
+	}
+	return &parquetWriter{columns: columns, file: file, builder: array.NewRecordBuilder(memory.DefaultAllocator, schema)}, nil
+}
+
+// WriteRow adds a row of values, in column order.
+func (p *parquetWriter) WriteRow(values []interface{}) error {
+	for i, value := range values {
+		builder := p.builder.Field(i)
+		if value == nil {
+			builder.AppendNull()
+			continue
+		}
+		if err := p.columns[i].append(builder, value); err != nil {
+			return fmt.Errorf("column %s: %v", p.columns[i].field.Name, err)
+		}
+	}
+	p.rows++
+	if p.rows == PARQUET_ROW_GROUP_ROWS {
+		return p.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group.
+func (p *parquetWriter) flush() error {
+	record := p.builder.NewRecordBatch()
+	defer record.Release()
+	p.rows = 0
+	return p.file.Write(record)
+}
+
+// Close writes the remaining rows and the file footer.
+func (p *parquetWriter) Close() error {
+	defer p.builder.Release()
+	if p.rows > 0 {
+		if err := p.flush(); err != nil {
+			p.file.Close()
+			return err
+		}
+	}
+	return p.file.Close()
+}
@@ -0,0 +1,137 @@
+package mssqlmcp
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// readParquet reads a file written by parquetWriter back as one record.
+func readParquet(t *testing.T, content []byte) arrow.RecordBatch {
+	t.Helper()
+	table, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(content),
+		parquet.NewReaderProperties(memory.DefaultAllocator), pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(table.Release)
+	reader := array.NewTableReader(table, table.NumRows())
+	t.Cleanup(reader.Release)
+	if !reader.Next() {
+		t.Fatal("the file has no rows")
+	}
+	return reader.RecordBatch()
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	config := &DbConfig{}
+	created := time.Date(2024, 3, 1, 18, 30, 0, 123456000, time.UTC)
+	payload := bytes.Repeat([]byte{0xAB}, 1000)
+	columns := []parquetColumn{
+		parquetColumnOf(config, "id", "INT", 0, 0),
+		parquetColumnOf(config, "flag", "BIT", 0, 0),
+		parquetColumnOf(config, "amount", "DECIMAL", 18, 4),
+		parquetColumnOf(config, "day", "DATE", 0, 0),
+		parquetColumnOf(config, "created", "DATETIME2", 0, 0),
+		parquetColumnOf(config, "payload", "VARBINARY", 0, 0),
+		parquetColumnOf(config, "note", "NVARCHAR", 0, 0),
+		// Result sets may repeat a name; the columns keep their order
+		parquetColumnOf(config, "id", "BIGINT", 0, 0),
+	}
+	rows := [][]interface{}{
+		{int64(1), true, []byte("12345678901234.5678"), created, created, payload, "Grüße", int64(1 << 40)},
+		{int64(2), nil, nil, nil, nil, nil, nil, nil},
+	}
+
+	var content bytes.Buffer
+	writer, err := newParquetWriter(&content, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	record := readParquet(t, content.Bytes())
+	if record.NumRows() != 2 {
+		t.Fatalf("read %d rows, want 2", record.NumRows())
+	}
+	for i, column := range columns {
+		field := record.Schema().Field(i)
+		if field.Name != column.field.Name || !arrow.TypeEqual(field.Type, column.field.Type) {
+			t.Errorf("column %d = %s %s, want %s %s", i, field.Name, field.Type, column.field.Name, column.field.Type)
+		}
+	}
+
+	if got := record.Column(0).(*array.Int32).Value(0); got != 1 {
+		t.Errorf("id = %d, want 1", got)
+	}
+	if got := record.Column(1).(*array.Boolean).Value(0); !got {
+		t.Error("flag = false, want true")
+	}
+	if got := record.Column(2).(*array.Decimal128).Value(0).ToString(4); got != "12345678901234.5678" {
+		t.Errorf("amount = %s, want 12345678901234.5678", got)
+	}
+	if got := record.Column(3).(*array.Date32).Value(0).ToTime(); !got.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("day = %v, want 2024-03-01", got)
+	}
+	if got := record.Column(4).(*array.Timestamp).Value(0).ToTime(arrow.Microsecond); !got.Equal(created) {
+		t.Errorf("created = %v, want %v", got, created)
+	}
+	if got := record.Column(5).(*array.Binary).Value(0); !bytes.Equal(got, payload) {
+		t.Errorf("payload = %d bytes, want all %d", len(got), len(payload))
+	}
+	if got := record.Column(6).(*array.String).Value(0); got != "Grüße" {
+		t.Errorf("note = %q, want %q", got, "Grüße")
+	}
+	if got := record.Column(7).(*array.Int64).Value(0); got != 1<<40 {
+		t.Errorf("second id = %d, want %d", got, int64(1<<40))
+	}
+	for i := 1; i < len(columns); i++ {
+		if !record.Column(i).IsNull(1) {
+			t.Errorf("column %d of the second row is not NULL", i)
+		}
+	}
+}
+
+func TestParquetRowGroups(t *testing.T) {
+	var content bytes.Buffer
+	writer, err := newParquetWriter(&content, []parquetColumn{parquetColumnOf(&DbConfig{}, "n", "BIGINT", 0, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := 2*PARQUET_ROW_GROUP_ROWS + 1
+	for i := 0; i < rows; i++ {
+		if err := writer.WriteRow([]interface{}{int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := file.NewParquetReader(bytes.NewReader(content.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if got := reader.NumRowGroups(); got != 3 {
+		t.Errorf("%d row groups, want 3", got)
+	}
+	if got := reader.NumRows(); got != int64(rows) {
+		t.Errorf("%d rows, want %d", got, rows)
+	}
+}
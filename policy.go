@@ -0,0 +1,118 @@
+package mssqlmcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// queryPolicy holds the regular expressions of the MSSQL_QUERY_POLICY_FILE
+// JSON object, e.g. {"deny": ["(?i)\\bdbo\\.Salaries\\b"]}. A query matching
+// any deny pattern is refused, and when allow patterns are given a query
+// must match one of them.
+type queryPolicy struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+var (
+	queryPolicyOnce   sync.Once
+	loadedQueryPolicy *queryPolicy
+	queryPolicyErr    error
+)
+
+// loadQueryPolicy reads and compiles MSSQL_QUERY_POLICY_FILE once; edits
+// apply after a restart. It returns nil when no policy file is configured.
+func loadQueryPolicy(config *DbConfig) (*queryPolicy, error) {
+	if config.QueryPolicyFile == "" {
+		return nil, nil
+	}
+	queryPolicyOnce.Do(func() {
+		loadedQueryPolicy, queryPolicyErr = readQueryPolicy(config.QueryPolicyFile)
+	})
+	return loadedQueryPolicy, queryPolicyErr
+}
+
+func readQueryPolicy(path string) (*queryPolicy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &queryPolicy{}
+	if err := json.Unmarshal(content, policy); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		var compiled []*regexp.Regexp
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("pattern %q in %s: %v", pattern, path, err)
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled, nil
+	}
+	if policy.allow, err = compile(policy.Allow); err != nil {
+		return nil, err
+	}
+	if policy.deny, err = compile(policy.Deny); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// policyText is the form of a query the policy patterns are matched
+// against: comments are removed, identifiers unquoted and tokens separated
+// by single spaces, with none around the dots of qualified names, so
+// [dbo].[Salaries] and dbo . Salaries both read dbo.Salaries.
+func policyText(query string) string {
+	var text strings.Builder
+	previous := ""
+	for _, t := range significantTokens(tokenizeSQL(query)) {
+		token := t.Text
+		if t.Kind == tokenQuotedIdentifier {
+			token = unquoteIdentifier(token)
+		}
+		if text.Len() > 0 && token != "." && previous != "." {
+			text.WriteByte(' ')
+		}
+		text.WriteString(token)
+		previous = token
+	}
+	return text.String()
+}
+
+// checkQueryPolicy refuses a query the MSSQL_QUERY_POLICY_FILE patterns do
+// not permit. A policy file that cannot be loaded refuses every query.
+func checkQueryPolicy(config *DbConfig, query string) error {
+	policy, err := loadQueryPolicy(config)
+	if err != nil {
+		return fmt.Errorf("policy violation: the query policy could not be loaded: %v", err)
+	}
+	if policy == nil {
+		return nil
+	}
+
+	text := policyText(query)
+	for _, re := range policy.deny {
+		if re.MatchString(text) {
+			return fmt.Errorf("policy violation: the query matches the denied pattern %q", re.String())
+		}
+	}
+	if len(policy.allow) == 0 {
+		return nil
+	}
+	for _, re := range policy.allow {
+		if re.MatchString(text) {
+			return nil
+		}
+	}
+	return fmt.Errorf("policy violation: the query matches none of the allowed patterns (%d configured in MSSQL_QUERY_POLICY_FILE)", len(policy.allow))
+}
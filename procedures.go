@@ -0,0 +1,373 @@
+package mssqlmcp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// procedureParameter is a parameter of a stored procedure as described by
+// INFORMATION_SCHEMA.PARAMETERS.
+type procedureParameter struct {
+	Name     string
+	DataType string
+	// T-SQL type to declare a variable receiving the parameter as, e.g. nvarchar(50)
+	Declared string
+	Output   bool
+	// Schema-qualified user-defined type of a table-valued parameter
+	TableType string
+}
+
+// procedureResult holds what a procedure call produced: its result sets, its
+// output parameters and its return code.
+type procedureResult struct {
+	Sets []map[string]interface{}
+	// Rows in each result set, of which at most MSSQL_MAX_ROWS are kept
+	Totals     []int
+	Outputs    []string
+	Values     map[string]interface{}
+	ReturnCode interface{}
+}
+
+// registerProcedureTools adds call_procedure when writes are enabled or some
+// procedures are allowed by MSSQL_ALLOWED_PROCEDURES.
+func registerProcedureTools(s *server.MCPServer) {
+	procedureTool := mcp.NewTool("call_procedure",
+		mcp.WithDescription("Call a stored procedure with typed input and OUTPUT parameters, returning every result set it produces, the values of its output parameters and its return code. Procedures may change data; only those allowed by the server's configuration can be called."),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Procedure name, optionally schema-qualified (e.g. dbo.usp_GetOrders)"),
+		),
+		mcp.WithObject("params",
+			mcp.Description("Parameter values by name, without or with the @. Values are bound as the procedure's declared parameter types; a table-valued parameter takes a list of rows, each an object keyed by column or, for a one-column table type, the bare value. OUTPUT parameters may be given an initial value or left out."),
+		),
+		mcp.WithString("transaction",
+			mcp.Description("Handle from begin_transaction to call the procedure inside that transaction"),
+		),
+	)
+
+	s.AddTool(procedureTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, _ := request.Params.Arguments["name"].(string)
+		if strings.TrimSpace(name) == "" {
+			return mcp.NewToolResultError("Procedure name is required"), nil
+		}
+		params, _ := request.Params.Arguments["params"].(map[string]interface{})
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		schema, procedure, err := resolveObjectName(name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if !procedureAllowed(config, schema, procedure) {
+			log.Printf("Procedure call denied: %s.%s", schema, procedure)
+			return mcp.NewToolResultError(fmt.Sprintf("Calling %s.%s is not permitted; allow it in MSSQL_ALLOWED_PROCEDURES", schema, procedure)), nil
+		}
+
+		// The procedure is checked before its parameters are read to build the
+		// call, and the call as it will run
+		if err := checkPolicies(config, procedureAccess, "EXEC "+formatObjectName(schema, procedure)); err != nil {
+			return notPermitted("Query", err), nil
+		}
+		parameters, err := getProcedureParameters(schema, procedure)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading procedure: %v", err)), nil
+		}
+		query, args, outputs, err := procedureCall(schema, procedure, parameters, params)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if err := checkPolicies(config, procedureAccess, query); err != nil {
+			return notPermitted("Query", err), nil
+		}
+
+		log.Printf("Calling procedure %s.%s", schema, procedure)
+		start := time.Now()
+		transaction, _ := request.Params.Arguments["transaction"].(string)
+		result, err := runProcedure(withTransactionHandle(ctx, transaction), config, query, outputs, args...)
+		if err != nil {
+			log.Printf("Error calling procedure %s.%s: %v", schema, procedure, err)
+			return mcp.NewToolResultError(fmt.Sprintf("Error calling procedure: %v", err)), nil
+		}
+
+		formatted, err := formatProcedureResult(result)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error formatting results: %v", err)), nil
+		}
+		summary := executionSummary{ElapsedMs: time.Since(start).Milliseconds()}
+		summary.Server, summary.Database = executionSource(config)
+		formatted += "\n" + summary.String()
+		return mcp.NewToolResultText(formatted), nil
+	})
+}
+
+// procedureAllowed reports whether a procedure may be called: any when writes
+// are allowed, otherwise those matching an MSSQL_ALLOWED_PROCEDURES pattern
+// such as dbo.usp_Report or reporting.*. A procedure can write to any table,
+// so with MSSQL_WRITABLE_TABLES set only the listed procedures stay callable.
+func procedureAllowed(config *DbConfig, schema, procedure string) bool {
+	if config.AllowWrite && len(config.WritableTables) == 0 {
+		return true
+	}
+	name := strings.ToLower(schema + "." + procedure)
+	for _, pattern := range config.AllowedProcedures {
+		pattern = strings.ToLower(strings.NewReplacer("[", "", "]", "").Replace(pattern))
+		if !strings.Contains(pattern, ".") {
+			pattern = "dbo." + pattern
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// getProcedureParameters reads the parameters of a stored procedure in
+// declaration order.
+func getProcedureParameters(schema, procedure string) ([]procedureParameter, error) {
+	found, err := executeQuery(`SELECT 1 AS found FROM INFORMATION_SCHEMA.ROUTINES
+		WHERE ROUTINE_SCHEMA = @p1 AND ROUTINE_NAME = @p2 AND ROUTINE_TYPE = 'PROCEDURE'`, true, schema, procedure)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := found["rows"].([]map[string]interface{}); len(rows) == 0 {
+		return nil, fmt.Errorf("procedure %s.%s not found", schema, procedure)
+	}
+
+	data, err := executeQuery(`SELECT PARAMETER_NAME, PARAMETER_MODE, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE,
+			USER_DEFINED_TYPE_SCHEMA, USER_DEFINED_TYPE_NAME
+		FROM INFORMATION_SCHEMA.PARAMETERS
+		WHERE SPECIFIC_SCHEMA = @p1 AND SPECIFIC_NAME = @p2 AND IS_RESULT = 'NO'
+		ORDER BY ORDINAL_POSITION`, true, schema, procedure)
+	if err != nil {
+		return nil, err
+	}
+	rows, _ := data["rows"].([]map[string]interface{})
+	parameters := make([]procedureParameter, 0, len(rows))
+	for _, row := range rows {
+		parameter := procedureParameter{
+			Name:     strings.TrimPrefix(fmt.Sprintf("%v", row["PARAMETER_NAME"]), "@"),
+			DataType: strings.ToLower(fmt.Sprintf("%v", row["DATA_TYPE"])),
+			Declared: formatColumnType(row),
+			Output:   fmt.Sprintf("%v", row["PARAMETER_MODE"]) != "IN",
+		}
+		if parameter.DataType == "table type" {
+			parameter.TableType = fmt.Sprintf("%v.%v", row["USER_DEFINED_TYPE_SCHEMA"], row["USER_DEFINED_TYPE_NAME"])
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters, nil
+}
+
+// procedureCall builds the batch calling a procedure. Inputs are bound under
+// the parameters' own names; OUTPUT parameters are received into variables
+// of their declared types, which a final result set returns together with the
+// return code; the driver's own OUTPUT parameters need a Go type per SQL type
+// and cannot receive NULL into most of them.
+func procedureCall(schema, procedure string, parameters []procedureParameter, params map[string]interface{}) (string, []interface{}, []string, error) {
+	given := make(map[string]interface{}, len(params))
+	for name, value := range params {
+		given[strings.ToLower(strings.TrimPrefix(name, "@"))] = value
+	}
+
+	declarations := []string{"@return_code int"}
+	var assignments, arguments, selected, outputs []string
+	var bound []interface{}
+	for _, parameter := range parameters {
+		value, isGiven := given[strings.ToLower(parameter.Name)]
+		delete(given, strings.ToLower(parameter.Name))
+		if parameter.DataType == "table type" {
+			if isGiven {
+				if typed, ok := value.(map[string]interface{}); ok {
+					value = typed["value"]
+				}
+				rows, ok := value.([]interface{})
+				if !ok {
+					return "", nil, nil, fmt.Errorf("parameter @%s takes a list of rows of %s", parameter.Name, parameter.TableType)
+				}
+				table, err := tableValuedParameter(parameter.TableType, rows)
+				if err != nil {
+					return "", nil, nil, fmt.Errorf("parameter @%s: %v", parameter.Name, err)
+				}
+				bound = append(bound, sql.Named(parameter.Name, table))
+				arguments = append(arguments, fmt.Sprintf("@%s = @%s", parameter.Name, parameter.Name))
+			}
+			continue
+		}
+		if isGiven {
+			converted, err := procedureParameterValue(parameter, value)
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("parameter @%s: %v", parameter.Name, err)
+			}
+			bound = append(bound, sql.Named(parameter.Name, converted))
+		}
+
+		if !parameter.Output {
+			if isGiven {
+				arguments = append(arguments, fmt.Sprintf("@%s = @%s", parameter.Name, parameter.Name))
+			}
+			continue
+		}
+		variable := "@out_" + parameter.Name
+		declarations = append(declarations, fmt.Sprintf("%s %s", variable, parameter.Declared))
+		if isGiven {
+			assignments = append(assignments, fmt.Sprintf("SET %s = @%s;", variable, parameter.Name))
+		}
+		arguments = append(arguments, fmt.Sprintf("@%s = %s OUTPUT", parameter.Name, variable))
+		selected = append(selected, fmt.Sprintf("%s AS %s", variable, quoteIdentifier(parameter.Name)))
+		outputs = append(outputs, parameter.Name)
+	}
+	for name := range given {
+		return "", nil, nil, fmt.Errorf("procedure %s.%s has no parameter @%s", schema, procedure, name)
+	}
+
+	var batch strings.Builder
+	batch.WriteString("DECLARE " + strings.Join(declarations, ", ") + ";\n")
+	for _, assignment := range assignments {
+		batch.WriteString(assignment + "\n")
+	}
+	batch.WriteString("EXEC @return_code = " + formatObjectName(schema, procedure))
+	if len(arguments) > 0 {
+		batch.WriteString(" " + strings.Join(arguments, ", "))
+	}
+	batch.WriteString(";\n")
+	batch.WriteString("SELECT " + strings.Join(append([]string{"@return_code AS return_code"}, selected...), ", ") + ";")
+	return batch.String(), bound, outputs, nil
+}
+
+// procedureParameterValue binds a value as the parameter's declared type,
+// unless it comes as a {"value": ..., "type": ...} object naming another.
+func procedureParameterValue(parameter procedureParameter, value interface{}) (interface{}, error) {
+	if _, typed := value.(map[string]interface{}); typed || value == nil {
+		return parameterValue(value)
+	}
+	converted, err := typedParameterValue(parameter.DataType, value)
+	if err != nil && strings.HasPrefix(err.Error(), "unsupported type") {
+		return parameterValue(value)
+	}
+	return converted, err
+}
+
+// runProcedure executes a procedure call on the caller's sticky session, or a
+// fresh connection without sticky sessions, and reads every result set. The
+// last set holds the return code and output parameters.
+func runProcedure(ctx context.Context, config *DbConfig, query string, outputs []string, args ...interface{}) (*procedureResult, error) {
+	var sets []map[string]interface{}
+	var totals []int
+	limit := -1
+	if config.MaxRows > 0 {
+		limit = config.MaxRows
+	}
+	read := func(db queryer) error {
+		queryCtx, cancel := context.WithTimeout(ctx, time.Duration(config.QueryTimeout)*time.Second)
+		defer cancel()
+
+		rows, err := db.QueryContext(queryCtx, tagQuery(queryCtx, config, query), args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for {
+			columns, result, total, err := scanRows(rows, config, limit, false)
+			if err != nil {
+				return err
+			}
+			maskRows(result, columns, maskedColumnIndexes(config, query, columns, nil))
+			if len(columns) > 0 {
+				sets = append(sets, map[string]interface{}{"columns": columns, "rows": result})
+				totals = append(totals, total)
+			}
+			if !rows.NextResultSet() {
+				break
+			}
+		}
+		return rows.Err()
+	}
+
+	if handle := transactionHandleFromContext(ctx); handle != "" {
+		err := withHeldTransaction(ctx, handle, func(tx *sql.Tx, config *DbConfig) error {
+			return read(tx)
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if config.StickySessions {
+		err := withSession(ctx, func(sess *stickySession, config *DbConfig) error {
+			if sess.tx != nil {
+				return read(sess.tx)
+			}
+			return read(sess.conn)
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		db, err := getConnection(config)
+		if err != nil {
+			return nil, fmt.Errorf("database connection error: %v", err)
+		}
+		defer db.Close()
+		if err := read(db); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(sets) == 0 {
+		return nil, errors.New("the procedure call returned no status")
+	}
+	status := sets[len(sets)-1]
+	rows, _ := status["rows"].([]map[string]interface{})
+	if len(rows) != 1 {
+		return nil, errors.New("the procedure call returned no status")
+	}
+	return &procedureResult{
+		Sets:       sets[:len(sets)-1],
+		Totals:     totals[:len(totals)-1],
+		Outputs:    outputs,
+		Values:     rows[0],
+		ReturnCode: rows[0]["return_code"],
+	}, nil
+}
+
+func formatProcedureResult(result *procedureResult) (string, error) {
+	var text strings.Builder
+	if len(result.Sets) == 0 {
+		text.WriteString("The procedure returned no result sets.\n")
+	}
+	for i, set := range result.Sets {
+		rows, _ := set["rows"].([]map[string]interface{})
+		if total := result.Totals[i]; total > len(rows) {
+			text.WriteString(fmt.Sprintf("Result set %d (showing %d of %d rows):\n", i+1, len(rows), total))
+		} else {
+			text.WriteString(fmt.Sprintf("Result set %d (%d rows):\n", i+1, len(rows)))
+		}
+		formatted, err := formatResults(set)
+		if err != nil {
+			return "", err
+		}
+		text.WriteString(formatted + "\n\n")
+	}
+
+	if len(result.Outputs) > 0 {
+		text.WriteString("Output parameters:\n")
+		for _, name := range result.Outputs {
+			value := result.Values[name]
+			if value == nil {
+				value = configuredNullToken()
+			}
+			text.WriteString(fmt.Sprintf("@%s = %v\n", name, value))
+		}
+	}
+	text.WriteString(fmt.Sprintf("Return code: %v", result.ReturnCode))
+	return text.String(), nil
+}
@@ -0,0 +1,217 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Number of most frequent values reported by profile_column
+const profileTopValues = 10
+
+// registerProfileTools adds tools computing statistics over table data.
+func registerProfileTools(s *server.MCPServer) {
+	profileTool := mcp.NewTool("profile_column",
+		mcp.WithDescription("Profile a column: null count, distinct count, min/max, most frequent values and average length. Large tables are sampled, so figures are estimates there."),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Table name, optionally schema-qualified (e.g. dbo.Orders)"),
+		),
+		mcp.WithString("column",
+			mcp.Required(),
+			mcp.Description("Column to profile"),
+		),
+		mcp.WithBoolean("refresh",
+			mcp.Description("Query the table even if a local summary of it exists"),
+		),
+	)
+
+	s.AddTool(profileTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, _ := request.Params.Arguments["table"].(string)
+		column, _ := request.Params.Arguments["column"].(string)
+		if name == "" || column == "" {
+			return mcp.NewToolResultError("Table and column are required"), nil
+		}
+
+		schema, table, err := resolveObjectName(name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		if err := checkPolicies(config, readAccess, fmt.Sprintf("SELECT %s FROM %s", formatIdentifier(column), formatObjectName(schema, table))); err != nil {
+			return notPermitted("Query", err), nil
+		}
+
+		// Huge tables may be summarized in the background; answer from that
+		if refresh, _ := request.Params.Arguments["refresh"].(bool); !refresh {
+			if profile, ok := cachedProfile(config, schema, table, column); ok {
+				return mcp.NewToolResultText(profile), nil
+			}
+		}
+
+		result, err := profileColumn(schema, table, column)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error profiling column: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+}
+
+// profileColumn computes column statistics over at most ProfileSampleRows
+// rows, using TABLESAMPLE on large tables so the cost stays bounded.
+func profileColumn(schema, table, column string) (string, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return "", err
+	}
+
+	columns, err := getTableColumns(schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	var dataType string
+	for _, c := range columns {
+		if strings.EqualFold(fmt.Sprintf("%v", c["COLUMN_NAME"]), column) {
+			column = fmt.Sprintf("%v", c["COLUMN_NAME"])
+			dataType = fmt.Sprintf("%v", c["DATA_TYPE"])
+		}
+	}
+	if dataType == "" {
+		return "", fmt.Errorf("column %s not found in %s.%s", column, schema, table)
+	}
+
+	rowCount, err := estimateRowCount(schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	filter, err := rowFilterClause(config, schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	// Memory-optimized tables have no pages to sample; TOP alone bounds them
+	durability, err := memoryOptimizedDurability(schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	// Sample a proportion of pages large enough to yield the row budget
+	sample := ""
+	sampled := rowCount > int64(config.ProfileSampleRows)
+	if sampled && durability == "" {
+		percent := float64(config.ProfileSampleRows) * 100 / float64(rowCount) * 1.5
+		if percent < 100 {
+			sample = fmt.Sprintf(" TABLESAMPLE (%.4f PERCENT)", percent)
+		}
+	}
+
+	value, lengthFunction := profileExpression(quoteIdentifier(column), dataType)
+	source := fmt.Sprintf("(SELECT TOP (%d) %s AS v FROM %s.%s%s%s) AS s",
+		config.ProfileSampleRows, value, quoteIdentifier(schema), quoteIdentifier(table), sample, filter)
+
+	aggregates := "COUNT_BIG(*) AS total, COUNT_BIG(*) - COUNT_BIG(v) AS nulls, COUNT_BIG(DISTINCT v) AS distinct_values, " +
+		fmt.Sprintf("AVG(CAST(%s(v) AS float)) AS avg_length", lengthFunction)
+	if supportsMinMax(dataType) {
+		aggregates += ", MIN(v) AS min_value, MAX(v) AS max_value"
+	}
+
+	statsQuery := fmt.Sprintf("SELECT %s FROM %s", aggregates, source)
+	topQuery := fmt.Sprintf("SELECT TOP (%d) v AS value, COUNT_BIG(*) AS frequency FROM %s GROUP BY v ORDER BY COUNT_BIG(*) DESC", profileTopValues, source)
+	for _, query := range []string{statsQuery, topQuery} {
+		if err := checkPolicies(config, readAccess, query); err != nil {
+			return "", fmt.Errorf("query not permitted: %v", err)
+		}
+	}
+
+	stats, err := executeQuery(statsQuery, true)
+	if err != nil {
+		return "", err
+	}
+	row := stats["rows"].([]map[string]interface{})[0]
+
+	top, err := executeQuery(topQuery, true)
+	if err != nil {
+		return "", err
+	}
+
+	// Counts of a masked column may be shown, its values may not
+	if columnMasked(config, schema, table, column) {
+		maskRows([]map[string]interface{}{row}, []string{"min_value", "max_value"}, []int{0, 1})
+		maskRows(top["rows"].([]map[string]interface{}), []string{"value"}, []int{0})
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# Profile of %s.%s.%s (%s)\n\n", schema, table, column, dataType))
+	total, _ := row["total"].(int64)
+	if durability != "" && total >= int64(config.ProfileSampleRows) {
+		result.WriteString(fmt.Sprintf("Profiled the first %d rows of this memory-optimized table, which cannot be sampled randomly; counts are estimates.\n\n", total))
+	} else if sampled {
+		result.WriteString(fmt.Sprintf("Sampled %v of ~%d rows; counts are estimates.\n\n", row["total"], rowCount))
+	} else {
+		result.WriteString(fmt.Sprintf("Rows: %v\n\n", row["total"]))
+	}
+	result.WriteString(fmt.Sprintf("- Nulls: %v\n- Distinct values: %v\n", row["nulls"], row["distinct_values"]))
+	if supportsMinMax(dataType) {
+		result.WriteString(fmt.Sprintf("- Min: %s\n- Max: %s\n", displayValue(row["min_value"], config.NullToken), displayValue(row["max_value"], config.NullToken)))
+	}
+	if lengthFunction == "LEN" {
+		result.WriteString(fmt.Sprintf("- Average length: %v characters\n", row["avg_length"]))
+	} else {
+		result.WriteString(fmt.Sprintf("- Average size: %v bytes\n", row["avg_length"]))
+	}
+
+	result.WriteString(fmt.Sprintf("\n## Top %d values\n\n", profileTopValues))
+	result.WriteString(formatTable([]string{"value", "frequency"}, top["rows"].([]map[string]interface{}), config.NullToken))
+	return result.String(), nil
+}
+
+// profileExpression adapts a column so it can be grouped and counted: types
+// that do not support comparison are converted first. It also returns the
+// function measuring value length.
+func profileExpression(column, dataType string) (string, string) {
+	switch dataType {
+	case "char", "varchar", "nchar", "nvarchar":
+		return column, "LEN"
+	case "text", "ntext", "xml":
+		return fmt.Sprintf("CAST(%s AS nvarchar(4000))", column), "LEN"
+	case "bit":
+		return fmt.Sprintf("CAST(%s AS int)", column), "DATALENGTH"
+	case "image":
+		return fmt.Sprintf("CAST(%s AS varbinary(8000))", column), "DATALENGTH"
+	case "geography", "geometry", "hierarchyid":
+		return fmt.Sprintf("%s.ToString()", column), "LEN"
+	}
+	return column, "DATALENGTH"
+}
+
+// supportsMinMax reports whether MIN/MAX are meaningful for a type.
+func supportsMinMax(dataType string) bool {
+	switch dataType {
+	case "bit", "text", "ntext", "xml", "image", "geography", "geometry", "hierarchyid", "binary", "varbinary", "uniqueidentifier", "sql_variant":
+		return false
+	}
+	return true
+}
+
+// estimateRowCount reads a table's row count from partition metadata, which
+// is instant compared to COUNT(*).
+func estimateRowCount(schema, table string) (int64, error) {
+	data, err := executeQuery(`SELECT ISNULL(SUM(rows), 0) AS row_count
+		FROM sys.partitions
+		WHERE object_id = OBJECT_ID(@p1) AND index_id IN (0, 1)`, true, quoteIdentifier(schema)+"."+quoteIdentifier(table))
+	if err != nil {
+		return 0, err
+	}
+
+	count, _ := data["rows"].([]map[string]interface{})[0]["row_count"].(int64)
+	return count, nil
+}
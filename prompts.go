@@ -0,0 +1,148 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// registerPrompts adds prompt templates for common database tasks. Each one
+// pre-fills the schema context and the tool calls needed for the task.
+func registerPrompts(s *server.MCPServer) {
+	s.AddPrompt(
+		mcp.NewPrompt("analyze_table",
+			mcp.WithPromptDescription("Profile a table: size, column contents, data quality and notable patterns"),
+			mcp.WithArgument("table",
+				mcp.ArgumentDescription("Table name, optionally schema-qualified (e.g. dbo.Orders)"),
+				mcp.RequiredArgument(),
+			),
+		),
+		handleAnalyzeTablePrompt,
+	)
+
+	s.AddPrompt(
+		mcp.NewPrompt("find_slow_queries",
+			mcp.WithPromptDescription("Find the most expensive queries in the plan cache and suggest improvements"),
+			mcp.WithArgument("top",
+				mcp.ArgumentDescription("Number of queries to inspect (default 10)"),
+			),
+		),
+		handleFindSlowQueriesPrompt,
+	)
+
+	s.AddPrompt(
+		mcp.NewPrompt("explain_schema",
+			mcp.WithPromptDescription("Explain what the database models: main entities, relationships and how to query them"),
+		),
+		handleExplainSchemaPrompt,
+	)
+}
+
+func handleAnalyzeTablePrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	schema, table, err := resolveObjectName(request.Params.Arguments["table"])
+	if err != nil {
+		return nil, err
+	}
+
+	description, err := describeTable(schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getDbConfig()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := rowFilterClause(config, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	qualified := formatObjectName(schema, table) + filter
+	instructions := fmt.Sprintf(`Analyze the table %s.%s. Its columns are attached.
+
+Use the execute_sql tool to gather facts before drawing conclusions:
+1. Row count: SELECT COUNT_BIG(*) AS row_count FROM %s
+2. A sample of rows: SELECT TOP (20) * FROM %s
+3. For interesting columns, null and distinct counts, e.g.
+   SELECT COUNT_BIG(*) - COUNT_BIG(col) AS nulls, COUNT_BIG(DISTINCT col) AS distinct_values FROM %s
+
+Then summarize what the table contains, its likely purpose, data quality issues (nulls, suspicious values, duplicates) and anything notable.`,
+		schema, table, qualified, qualified, qualified)
+
+	return mcp.NewGetPromptResult(
+		fmt.Sprintf("Analyze table %s.%s", schema, table),
+		[]mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(instructions)),
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewEmbeddedResource(mcp.TextResourceContents{
+				URI:      tableResourceURI(schema, table),
+				MIMEType: "text/markdown",
+				Text:     description,
+			})),
+		},
+	), nil
+}
+
+func handleFindSlowQueriesPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	top := 10
+	if value := request.Params.Arguments["top"]; value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("top must be a positive integer")
+		}
+		top = parsed
+	}
+
+	instructions := fmt.Sprintf(`Find the slowest queries on this server using the plan cache.
+
+Run this with the execute_sql tool:
+
+SELECT TOP (%d)
+    qs.total_elapsed_time / qs.execution_count / 1000 AS avg_elapsed_ms,
+    qs.total_worker_time / qs.execution_count / 1000 AS avg_cpu_ms,
+    qs.total_logical_reads / qs.execution_count AS avg_logical_reads,
+    qs.execution_count,
+    qs.last_execution_time,
+    SUBSTRING(st.text, (qs.statement_start_offset / 2) + 1,
+        ((CASE qs.statement_end_offset WHEN -1 THEN DATALENGTH(st.text) ELSE qs.statement_end_offset END - qs.statement_start_offset) / 2) + 1) AS statement_text
+FROM sys.dm_exec_query_stats qs
+CROSS APPLY sys.dm_exec_sql_text(qs.sql_handle) st
+ORDER BY avg_elapsed_ms DESC
+
+For each expensive statement, explain why it is likely slow (scans, missing predicates, high reads) and suggest concrete improvements such as indexes or rewrites. Reading the plan cache requires VIEW SERVER STATE; if the query is denied, say so.`, top)
+
+	return mcp.NewGetPromptResult(
+		"Find slow queries",
+		[]mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(instructions)),
+		},
+	), nil
+}
+
+func handleExplainSchemaPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	schema, err := renderSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	instructions := `Explain this database schema, which is attached. Describe:
+- the business domain it appears to model,
+- the main entities and how they relate (follow the foreign keys),
+- lookup/reference tables versus transactional tables,
+- how to answer typical questions, with example queries for the execute_sql tool.`
+
+	return mcp.NewGetPromptResult(
+		"Explain the database schema",
+		[]mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(instructions)),
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewEmbeddedResource(mcp.TextResourceContents{
+				URI:      schemaResourceURI,
+				MIMEType: "text/markdown",
+				Text:     schema,
+			})),
+		},
+	), nil
+}
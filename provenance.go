@@ -0,0 +1,69 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// annotateColumnSources records in each result column's metadata the table
+// it is read from, as the alias the query gives the table when there is
+// one, so the two sides of a join can be told apart: order_id [o], name [c].
+// The sources come from sys.dm_exec_describe_first_result_set, the function
+// behind sp_describe_first_result_set; computed columns have none.
+func annotateColumnSources(config *DbConfig, query string, params map[string]interface{}, data map[string]interface{}) error {
+	columnTypes, ok := data["columnTypes"].([]columnInfo)
+	if !ok || len(columnTypes) == 0 {
+		return nil
+	}
+	declarations, err := parameterDeclarations(params)
+	if err != nil {
+		return err
+	}
+
+	db, err := getConnection(config)
+	if err != nil {
+		return fmt.Errorf("database connection error: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.QueryTimeout)*time.Second)
+	defer cancel()
+	sources, err := describeColumnSources(ctx, db, query, declarations)
+	if err != nil {
+		return err
+	}
+
+	references := findObjectReferences(query)
+	for i := range columnTypes {
+		if i < len(sources) && sources[i].Table != "" {
+			columnTypes[i].Source = sourceLabel(sources[i], references)
+		}
+	}
+	return nil
+}
+
+// sourceLabel names the table a column comes from as the query refers to
+// it: by its alias, or its name as written. A table the query references
+// more than once, or only through a view, is named schema.table.
+func sourceLabel(source columnSource, references []objectReference) string {
+	var matches []objectReference
+	for _, reference := range references {
+		parts := reference.Parts
+		if !strings.EqualFold(parts[len(parts)-1], source.Table) {
+			continue
+		}
+		if len(parts) >= 2 && parts[len(parts)-2] != "" && !strings.EqualFold(parts[len(parts)-2], source.Schema) {
+			continue
+		}
+		matches = append(matches, reference)
+	}
+	if len(matches) != 1 {
+		return source.Schema + "." + source.Table
+	}
+	if matches[0].Alias != "" {
+		return matches[0].Alias
+	}
+	return matches[0].Name()
+}
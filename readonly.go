@@ -0,0 +1,53 @@
+package mssqlmcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// writePermissionsQuery lists what lets the session's principal change the
+// database: membership of a role that can write, database-wide permissions
+// to change data, schema or code, and grants on individual tables. A login
+// limited to db_datareader returns no rows.
+const writePermissionsQuery = `SELECT N'server role sysadmin' AS permission WHERE IS_SRVROLEMEMBER('sysadmin') = 1
+UNION ALL
+SELECT N'database role ' + r.name FROM (VALUES (N'db_owner'), (N'db_datawriter'), (N'db_ddladmin')) AS r(name)
+WHERE IS_ROLEMEMBER(r.name) = 1
+UNION ALL
+SELECT N'database permission ' + permission_name FROM fn_my_permissions(NULL, 'DATABASE')
+WHERE permission_name IN (N'CONTROL', N'ALTER', N'INSERT', N'UPDATE', N'DELETE', N'EXECUTE', N'TAKE OWNERSHIP',
+	N'CREATE TABLE', N'CREATE VIEW', N'CREATE PROCEDURE', N'CREATE FUNCTION', N'CREATE SCHEMA', N'ALTER ANY SCHEMA')
+UNION ALL
+SELECT TOP (20) p.name + N' on ' + QUOTENAME(s.name) + N'.' + QUOTENAME(t.name)
+FROM sys.tables t
+JOIN sys.schemas s ON s.schema_id = t.schema_id
+CROSS JOIN (VALUES (N'INSERT'), (N'UPDATE'), (N'DELETE'), (N'ALTER')) AS p(name)
+WHERE HAS_PERMS_BY_NAME(QUOTENAME(s.name) + N'.' + QUOTENAME(t.name), 'OBJECT', p.name) = 1`
+
+// impersonationSQL switches a new session to the MSSQL_READ_ONLY_USER
+// database user for good, so a statement slipping past the client-side
+// checks still runs without write permissions. The impersonation cannot be
+// reverted, so the pool keeps no idle connections to reset.
+func impersonationSQL(user string) string {
+	return fmt.Sprintf("EXECUTE AS USER = %s WITH NO REVERT;", quoteString(user))
+}
+
+// verifyReadOnlySession checks, for MSSQL_VERIFY_READ_ONLY, that the
+// principal queries run as, the login or MSSQL_READ_ONLY_USER, has no way
+// to write, and lists what would let it otherwise.
+func verifyReadOnlySession() error {
+	data, err := executeQuery(writePermissionsQuery, true)
+	if err != nil {
+		return fmt.Errorf("reading the session's permissions: %v", err)
+	}
+	rows, _ := data["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		return nil
+	}
+	var permissions []string
+	for _, row := range rows {
+		permissions = append(permissions, fmt.Sprint(row["permission"]))
+	}
+	return fmt.Errorf("the session can write through %s; grant only db_datareader, or set MSSQL_READ_ONLY_USER to a user that has nothing more",
+		strings.Join(permissions, ", "))
+}
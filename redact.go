@@ -0,0 +1,88 @@
+package mssqlmcp
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MSSQL_REDACT_ERRORS settings
+const (
+	redactAuto = "auto" // redact while the database masks any column
+	redactOn   = "on"
+	redactOff  = "off"
+)
+
+// Text replacing a data value quoted in an error message
+const redactedValue = "<redacted>"
+
+// errorValuePattern matches the data values SQL Server quotes in its error
+// messages after the word "value": "converting the varchar value 'x' to data
+// type int", "Truncated value: 'x'" and "The duplicate key value is (x, y)".
+// Object and constraint names, quoted elsewhere, are left as they are.
+var errorValuePattern = regexp.MustCompile(`(?i)(\bvalue(?:\s+is)?:?\s*)('(?:[^']|'')*'|\((?:[^()]|\([^()]*\))*\))`)
+
+var (
+	maskedColumnsOnce sync.Once
+	maskedColumns     bool
+)
+
+// redactErrorValues replaces the data values quoted in an error message.
+func redactErrorValues(message string) string {
+	return errorValuePattern.ReplaceAllString(message, "${1}"+redactedValue)
+}
+
+// errorRedactionActive reports whether errors are redacted: always or never
+// when MSSQL_REDACT_ERRORS says so, otherwise when MSSQL_MASKED_COLUMNS or
+// dynamic data masking protects a column of the database, as an error could
+// show the unmasked value a query stumbled on. Whether columns are masked in
+// the database is read once.
+func errorRedactionActive(config *DbConfig) bool {
+	switch config.RedactErrors {
+	case redactOn:
+		return true
+	case redactOff:
+		return false
+	}
+	if len(config.MaskedColumns) > 0 {
+		return true
+	}
+	maskedColumnsOnce.Do(func() {
+		data, err := executeQuery("SELECT TOP (1) 1 AS masked FROM sys.masked_columns", true)
+		if err != nil {
+			// Redact rather than risk a leak when it cannot be told
+			log.Printf("Reading masked columns failed, redacting errors: %v", err)
+			maskedColumns = true
+			return
+		}
+		rows, _ := data["rows"].([]map[string]interface{})
+		maskedColumns = len(rows) > 0
+	})
+	return maskedColumns
+}
+
+// redactToolErrors is middleware removing data values from the error results
+// of tool calls while error redaction is active.
+func redactToolErrors(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, request)
+		if err != nil || result == nil || !result.IsError {
+			return result, err
+		}
+		config, configErr := getDbConfig()
+		if configErr != nil || !errorRedactionActive(config) {
+			return result, err
+		}
+		for i, content := range result.Content {
+			if text, ok := content.(mcp.TextContent); ok {
+				text.Text = redactErrorValues(text.Text)
+				result.Content[i] = text
+			}
+		}
+		return result, err
+	}
+}
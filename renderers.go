@@ -0,0 +1,178 @@
+package mssqlmcp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Renderer writes query results in one output format. data is a result as
+// returned by executeQuery: "columns", "columnTypes" and "rows" for result
+// sets, "rowCount" and the captured "outputColumns"/"outputRows" for writes,
+// plus notes such as "truncated", "resultId" and "warnings".
+type Renderer interface {
+	Render(w io.Writer, data map[string]interface{}, options RenderOptions) error
+	// MediaType tells what the renderer produces. Only text formats
+	// (text/* and application/json) can be returned from tools.
+	MediaType() string
+}
+
+// RenderOptions are the configured settings renderers may honour.
+type RenderOptions struct {
+	Delimiter rune   // field separator of delimited text
+	Null      string // text shown for NULL
+}
+
+var (
+	renderersMu   sync.RWMutex
+	renderers     = make(map[string]Renderer)
+	rendererNames []string
+)
+
+// RegisterRenderer makes a renderer available under a format name, replacing
+// any renderer registered with that name. Call it from an init function so
+// the format is known when the tools are created.
+func RegisterRenderer(name string, renderer Renderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+
+	name = strings.ToLower(name)
+	if _, exists := renderers[name]; !exists {
+		rendererNames = append(rendererNames, name)
+	}
+	renderers[name] = renderer
+}
+
+// lookupRenderer returns the renderer registered for a format name.
+func lookupRenderer(format string) (Renderer, bool) {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+
+	renderer, ok := renderers[strings.ToLower(format)]
+	return renderer, ok
+}
+
+// isTextMediaType tells whether output of a media type can be shown as text.
+func isTextMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json"
+}
+
+// outputFormats lists the formats tools can return, in registration order.
+func outputFormats() []string {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+
+	var formats []string
+	for _, name := range rendererNames {
+		if isTextMediaType(renderers[name].MediaType()) {
+			formats = append(formats, name)
+		}
+	}
+	return formats
+}
+
+func isOutputFormat(format string) bool {
+	renderer, ok := lookupRenderer(format)
+	return ok && isTextMediaType(renderer.MediaType())
+}
+
+// renderResults formats results without any shaping. The delimiter separates
+// fields in the text format; tsv always uses tabs.
+func renderResults(data map[string]interface{}, format string, delimiter rune) (string, error) {
+	if !isOutputFormat(format) {
+		return "", fmt.Errorf("unknown output format %q", format)
+	}
+	renderer, _ := lookupRenderer(format)
+
+	var result strings.Builder
+	options := RenderOptions{Delimiter: delimiter, Null: configuredNullToken()}
+	if err := renderer.Render(&result, data, options); err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+func init() {
+	RegisterRenderer("text", textRenderer{layout: func(options RenderOptions) tableLayout {
+		return delimitedLayout(options.Delimiter)
+	}, typesComment: true})
+	RegisterRenderer("csv", textRenderer{layout: func(RenderOptions) tableLayout {
+		return delimitedLayout(',')
+	}})
+	RegisterRenderer("tsv", textRenderer{layout: func(RenderOptions) tableLayout {
+		return delimitedLayout('\t')
+	}, typesComment: true})
+	RegisterRenderer("vertical", textRenderer{layout: func(RenderOptions) tableLayout {
+		return formatVerticalTable
+	}, typesComment: true})
+	RegisterRenderer("json", jsonRenderer{})
+	RegisterRenderer("markdown", textRenderer{layout: func(RenderOptions) tableLayout {
+		return formatMarkdownTable
+	}})
+}
+
+// textRenderer lays out rows as text followed by the truncation, paging and
+// warning notes, optionally headed by a comment giving the column types.
+type textRenderer struct {
+	layout       func(options RenderOptions) tableLayout
+	typesComment bool
+}
+
+func (r textRenderer) Render(w io.Writer, data map[string]interface{}, options RenderOptions) error {
+	result, err := formatTextResults(data, r.layout(options), options.Null)
+	if err != nil {
+		return err
+	}
+	if columnTypes, ok := data["columnTypes"].([]columnInfo); ok && len(columnTypes) > 0 && r.typesComment {
+		result = columnTypesComment(columnTypes) + result
+	}
+	_, err = io.WriteString(w, result)
+	return err
+}
+
+func (r textRenderer) MediaType() string {
+	return "text/plain"
+}
+
+// jsonRenderer renders results as a JSON document (see formatJSON).
+type jsonRenderer struct{}
+
+func (jsonRenderer) Render(w io.Writer, data map[string]interface{}, options RenderOptions) error {
+	result, err := formatJSON(data)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, result)
+	return err
+}
+
+func (jsonRenderer) MediaType() string {
+	return "application/json"
+}
+
+// formatMarkdownTable renders rows as a GitHub-flavored Markdown table. Pipes
+// are escaped and line breaks become <br> so each row stays on one line.
+func formatMarkdownTable(columns []string, rows []map[string]interface{}, null string) string {
+	escape := strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+	var result strings.Builder
+	result.WriteString("|")
+	for _, column := range columns {
+		result.WriteString(" " + escape.Replace(column) + " |")
+	}
+	result.WriteString("\n|")
+	for range columns {
+		result.WriteString(" --- |")
+	}
+	result.WriteString("\n")
+
+	for _, row := range rows {
+		result.WriteString("|")
+		for _, column := range columns {
+			result.WriteString(" " + escape.Replace(displayValue(row[column], null)) + " |")
+		}
+		result.WriteString("\n")
+	}
+	return result.String()
+}
@@ -0,0 +1,88 @@
+package mssqlmcp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// testResults is a result set as runQuery returns it, with a NULL, text
+// needing quoting and characters outside the Basic Multilingual Plane.
+func testResults() map[string]interface{} {
+	return map[string]interface{}{
+		"columns": []string{"CustomerID", "Name", "Email"},
+		"rows": []map[string]interface{}{
+			{"CustomerID": int64(1), "Name": "Grüße, 日本語 😀👍🏽", "Email": "ada@example.com"},
+			{"CustomerID": int64(2), "Name": "Tab\there", "Email": nil},
+		},
+	}
+}
+
+func TestUnicodeRendering(t *testing.T) {
+	testConfig(t)
+
+	for _, format := range outputFormats() {
+		output, err := formatResultsAs(testResults(), format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !utf8.ValidString(output) || !strings.Contains(output, "日本語 😀👍🏽") {
+			t.Errorf("%s output lost characters:\n%s", format, output)
+		}
+	}
+
+	if cut := truncateString("Grüße 😀", 9); !utf8.ValidString(cut) || cut != "Grüße ..." {
+		t.Errorf("truncateString cut inside a character: %q", cut)
+	}
+
+	// The first three groups of a uniqueidentifier are stored little-endian
+	id := []byte{0x78, 0x56, 0x34, 0x12, 0x34, 0x12, 0x34, 0x12, 0x12, 0x34, 0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC}
+	if got := formatUniqueIdentifier(id); got != "12345678-1234-1234-1234-123456789ABC" {
+		t.Errorf("formatUniqueIdentifier = %s", got)
+	}
+}
+
+func TestDelimitedRendering(t *testing.T) {
+	testConfig(t)
+
+	text, err := formatResultsAs(testResults(), "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "1,\"Grüße, 日本語 😀👍🏽\",ada@example.com\n") || !strings.Contains(text, "2,Tab\there,NULL\n") {
+		t.Errorf("text output does not quote commas or show NULL:\n%s", text)
+	}
+
+	tsv, err := formatResultsAs(testResults(), "tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(tsv, "1\tGrüße, 日本語 😀👍🏽\tada@example.com\n") || !strings.Contains(tsv, "2\t\"Tab\there\"\tNULL\n") {
+		t.Errorf("tsv output does not quote tabs:\n%s", tsv)
+	}
+
+	t.Setenv("MSSQL_OUTPUT_DELIMITER", ";")
+	text, err = formatResultsAs(testResults(), "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "1;Grüße, 日本語 😀👍🏽;ada@example.com\n") {
+		t.Errorf("text output ignores MSSQL_OUTPUT_DELIMITER:\n%s", text)
+	}
+
+	encoded, err := formatResultsAs(testResults(), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document struct {
+		Columns []string        `json:"columns"`
+		Rows    [][]interface{} `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(encoded), &document); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if len(document.Rows) != 2 || document.Rows[1][2] != nil {
+		t.Errorf("unexpected JSON rows: %v", document.Rows)
+	}
+}
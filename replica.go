@@ -0,0 +1,159 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// How long a measured replica lag is reused to annotate results before it is
+// read again
+const REPLICA_LAG_CACHE_INTERVAL = 5 * time.Second
+
+var (
+	replicaLagMu     sync.Mutex
+	cachedLag        *replicaLag
+	replicaLagReadAt time.Time
+)
+
+// replicaLag is the staleness of a readable secondary.
+type replicaLag struct {
+	Seconds int64
+	AsOf    time.Time
+}
+
+// readReplicaLag measures how far the configured database trails its primary,
+// or returns nil when it is not a readable secondary. On an availability
+// group secondary the lag is the time since the last commit redone locally,
+// which overstates it while the primary is idle.
+func readReplicaLag() (*replicaLag, error) {
+	data, err := executeQuery(`SELECT CAST(DATABASEPROPERTYEX(DB_NAME(), 'Updateability') AS nvarchar(20)) AS updateability,
+			rs.is_primary_replica,
+			DATEDIFF(second, rs.last_commit_time, GETDATE()) AS lag_seconds
+		FROM (SELECT 1 AS one) x
+		LEFT JOIN sys.dm_hadr_database_replica_states rs ON rs.database_id = DB_ID() AND rs.is_local = 1`, true)
+	if err != nil {
+		return nil, err
+	}
+	row := data["rows"].([]map[string]interface{})[0]
+	if row["updateability"] != "READ_ONLY" || row["is_primary_replica"] != false {
+		return nil, nil
+	}
+
+	seconds, _ := row["lag_seconds"].(int64)
+	if seconds < 0 {
+		seconds = 0
+	}
+	return &replicaLag{Seconds: seconds, AsOf: time.Now().Add(-time.Duration(seconds) * time.Second)}, nil
+}
+
+// currentReplicaLag returns the replica lag, measured at most every
+// REPLICA_LAG_CACHE_INTERVAL so annotating results stays cheap.
+func currentReplicaLag() (*replicaLag, error) {
+	replicaLagMu.Lock()
+	defer replicaLagMu.Unlock()
+
+	if !replicaLagReadAt.IsZero() && time.Since(replicaLagReadAt) < REPLICA_LAG_CACHE_INTERVAL {
+		return cachedLag, nil
+	}
+	lag, err := readReplicaLag()
+	if err != nil {
+		return nil, err
+	}
+	cachedLag, replicaLagReadAt = lag, time.Now()
+	return lag, nil
+}
+
+// dataAsOfNote describes the freshness of reads from a secondary, e.g.
+// "data as of ~14:32:05 UTC (lag 7s)".
+func dataAsOfNote(config *DbConfig, lag *replicaLag) string {
+	location := time.UTC
+	if config.DisplayLocation != nil {
+		location = config.DisplayLocation
+	}
+	return fmt.Sprintf("data as of ~%s (lag %ds)", lag.AsOf.In(location).Format("15:04:05 MST"), lag.Seconds)
+}
+
+// registerReplicaTools adds a tool reporting replication lag.
+func registerReplicaTools(s *server.MCPServer) {
+	lagTool := mcp.NewTool("replica_lag",
+		mcp.WithDescription("Show whether the database is a readable secondary (availability group replica or Azure geo-replica) and how far it trails the primary, so stale reads are not mistaken for missing data"),
+	)
+
+	s.AddTool(lagTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := describeReplication()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading replication state: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+}
+
+// describeReplication renders the replica role of the configured database,
+// its availability group synchronization state and any geo-replication links.
+func describeReplication() (string, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return "", err
+	}
+
+	info, err := executeQuery(`SELECT DB_NAME() AS database_name,
+			CAST(DATABASEPROPERTYEX(DB_NAME(), 'Updateability') AS nvarchar(20)) AS updateability,
+			CAST(SERVERPROPERTY('EngineEdition') AS int) AS engine_edition`, true)
+	if err != nil {
+		return "", err
+	}
+	row := info["rows"].([]map[string]interface{})[0]
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# Replication of %v\n\nUpdateability: %v\n", row["database_name"], row["updateability"]))
+
+	lag, err := readReplicaLag()
+	if err != nil {
+		// The DMVs need VIEW SERVER STATE (VIEW DATABASE STATE on Azure)
+		result.WriteString(fmt.Sprintf("\nReplica state is unavailable: %v\n", err))
+	} else if lag != nil {
+		result.WriteString(fmt.Sprintf("\nThis is a readable secondary: %s.\n", dataAsOfNote(config, lag)))
+	}
+
+	states, err := executeQuery(`SELECT ar.replica_server_name, rs.is_local, rs.is_primary_replica,
+			rs.synchronization_state_desc, rs.synchronization_health_desc,
+			rs.log_send_queue_size AS log_send_queue_kb, rs.redo_queue_size AS redo_queue_kb,
+			rs.last_commit_time
+		FROM sys.dm_hadr_database_replica_states rs
+		JOIN sys.availability_replicas ar ON ar.replica_id = rs.replica_id
+		WHERE rs.database_id = DB_ID()
+		ORDER BY rs.is_primary_replica DESC, ar.replica_server_name`, true)
+	if err == nil && len(states["rows"].([]map[string]interface{})) > 0 {
+		table, err := formatResults(states)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString("\n## Availability group replicas\n\n" + table)
+	} else if err == nil {
+		result.WriteString("\nThe database is not in an availability group.\n")
+	}
+
+	if edition, _ := row["engine_edition"].(int64); edition == 5 {
+		links, err := executeQuery(`SELECT partner_server, partner_database, role_desc, replication_state_desc,
+				replication_lag_sec, last_replication
+			FROM sys.dm_geo_replication_link_status`, true)
+		if err != nil {
+			result.WriteString(fmt.Sprintf("\nGeo-replication state is unavailable: %v\n", err))
+		} else if len(links["rows"].([]map[string]interface{})) == 0 {
+			result.WriteString("\nNo geo-replication links.\n")
+		} else {
+			table, err := formatResults(links)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString("\n## Geo-replication links\n\n" + table)
+		}
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,322 @@
+package mssqlmcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const reportResourcePrefix = "mssql://reports/"
+
+// subscription is a recurring read-only query whose latest result is served
+// as a resource, as declared in the MSSQL_SUBSCRIPTIONS_FILE JSON array.
+type subscription struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Query       string `json:"query"`
+	Schedule    string `json:"schedule"` // @every 15m, @hourly, @daily, @weekly or a 5-field cron expression
+
+	schedule reportSchedule
+
+	mu          sync.Mutex
+	result      string
+	err         error
+	refreshedAt time.Time
+	nextRun     time.Time
+}
+
+// reportSchedule computes the next run after a given time.
+type reportSchedule interface {
+	next(after time.Time) time.Time
+}
+
+type intervalSchedule time.Duration
+
+func (interval intervalSchedule) next(after time.Time) time.Time {
+	return after.Add(time.Duration(interval))
+}
+
+// cronSchedule holds the allowed values of each cron field.
+type cronSchedule struct {
+	minute, hour, day, month, weekday map[int]bool
+	anyDay, anyWeekday                bool
+}
+
+func (c *cronSchedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// Every schedule fires within five years (29 February on a Monday at worst)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); t = t.Add(time.Minute) {
+		if !c.month[int(t.Month())] || !c.hour[t.Hour()] || !c.minute[t.Minute()] {
+			continue
+		}
+		// As in cron, a restricted day of month and day of week match either
+		dayMatch, weekdayMatch := c.day[t.Day()], c.weekday[int(t.Weekday())]
+		switch {
+		case c.anyDay && c.anyWeekday, !c.anyDay && !c.anyWeekday && (dayMatch || weekdayMatch),
+			c.anyDay && !c.anyWeekday && weekdayMatch, !c.anyDay && c.anyWeekday && dayMatch:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseSchedule parses @every <duration>, @hourly, @daily, @weekly or a
+// standard five-field cron expression (minute hour day month weekday).
+func parseSchedule(spec string) (reportSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, err
+		}
+		if interval < time.Minute {
+			return nil, errors.New("interval must be at least one minute")
+		}
+		return intervalSchedule(interval), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q", spec)
+	}
+
+	// Weekdays run from 0 to 6, with Sunday also accepted as 7
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := make([]map[int]bool, 5)
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+		sets[i] = set
+	}
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return &cronSchedule{
+		minute: sets[0], hour: sets[1], day: sets[2], month: sets[3], weekday: sets[4],
+		anyDay: fields[2] == "*", anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField expands a cron field of comma separated values, ranges
+// (a-b) and steps (*/n, a-b/n) into the set of matching values.
+func parseCronField(field string, low, high int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if slash := strings.Index(part, "/"); slash >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[slash+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:slash]
+		}
+
+		from, to := low, high
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			}
+		}
+		if from < low || to > high || from > to {
+			return nil, fmt.Errorf("value out of range in %q", part)
+		}
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// loadSubscriptions reads and validates the subscriptions file. Queries are
+// checked against the policies execute_sql applies.
+func loadSubscriptions(config *DbConfig, path string) ([]*subscription, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscriptions []*subscription
+	if err := json.Unmarshal(content, &subscriptions); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for _, sub := range subscriptions {
+		if sub.Name == "" || strings.ContainsAny(sub.Name, "/?#") {
+			return nil, fmt.Errorf("invalid subscription name %q", sub.Name)
+		}
+		if names[sub.Name] {
+			return nil, fmt.Errorf("duplicate subscription %s", sub.Name)
+		}
+		names[sub.Name] = true
+
+		if strings.TrimSpace(sub.Query) == "" {
+			return nil, fmt.Errorf("subscription %s has no query", sub.Name)
+		}
+		if err := checkPolicies(config, readAccess, sub.Query); err != nil {
+			return nil, fmt.Errorf("subscription %s: %v", sub.Name, err)
+		}
+		if sub.schedule, err = parseSchedule(sub.Schedule); err != nil {
+			return nil, fmt.Errorf("subscription %s: %v", sub.Name, err)
+		}
+	}
+	return subscriptions, nil
+}
+
+// refresh runs the subscription's query and caches the formatted result,
+// keeping the previous result if the query fails.
+func (sub *subscription) refresh() {
+	result, err := func() (string, error) {
+		config, err := getDbConfig()
+		if err != nil {
+			return "", err
+		}
+		db, err := getConnection(config)
+		if err != nil {
+			return "", fmt.Errorf("database connection error: %v", err)
+		}
+		defer db.Close()
+
+		// Policies may have changed since the file was loaded, and a pinned
+		// tenant scopes the query
+		query, err := checkStatement(config, readAccess, "", sub.Query)
+		if err != nil {
+			return "", fmt.Errorf("query not permitted: %v", err)
+		}
+		data, err := runQueryLimited(db, config, query, true, config.MaxRows)
+		if err != nil {
+			return "", err
+		}
+		return formatResults(data)
+	}()
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.err = err
+	if err != nil {
+		log.Printf("Error refreshing report %s: %v", sub.Name, err)
+		return
+	}
+	sub.result = result
+	sub.refreshedAt = time.Now()
+}
+
+// run refreshes the subscription now and then on its schedule.
+func (sub *subscription) run() {
+	for {
+		sub.refresh()
+
+		next := sub.schedule.next(time.Now())
+		if next.IsZero() {
+			log.Printf("Report %s has no future run time; it will not be refreshed again", sub.Name)
+			return
+		}
+		sub.mu.Lock()
+		sub.nextRun = next
+		sub.mu.Unlock()
+		time.Sleep(time.Until(next))
+	}
+}
+
+// registerReportResources serves the subscriptions declared in
+// MSSQL_SUBSCRIPTIONS_FILE as mssql://reports/{name} resources and starts
+// refreshing them.
+func registerReportResources(s *server.MCPServer) {
+	config, err := getDbConfig()
+	if err != nil || config.SubscriptionsFile == "" {
+		return
+	}
+
+	subscriptions, err := loadSubscriptions(config, config.SubscriptionsFile)
+	if err != nil {
+		log.Printf("Could not load subscriptions from %s: %v", config.SubscriptionsFile, err)
+		return
+	}
+
+	for _, sub := range subscriptions {
+		sub := sub
+		description := sub.Description
+		if description == "" {
+			description = fmt.Sprintf("Latest result of a query refreshed on schedule %s", sub.Schedule)
+		}
+
+		s.AddResource(
+			mcp.NewResource(reportResourcePrefix+sub.Name, sub.Name,
+				mcp.WithResourceDescription(description),
+				mcp.WithMIMEType("text/markdown"),
+			),
+			func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+				return []mcp.ResourceContents{
+					mcp.TextResourceContents{
+						URI:      request.Params.URI,
+						MIMEType: "text/markdown",
+						Text:     sub.render(),
+					},
+				}, nil
+			},
+		)
+		go sub.run()
+	}
+	log.Printf("Registered %d report subscriptions", len(subscriptions))
+}
+
+// render presents the cached result with its age.
+func (sub *subscription) render() string {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# Report %s\n\n", sub.Name))
+	if sub.Description != "" {
+		result.WriteString(sub.Description + "\n\n")
+	}
+	if sub.refreshedAt.IsZero() {
+		if sub.err != nil {
+			result.WriteString(fmt.Sprintf("The report could not be produced: %v\n", sub.err))
+		} else {
+			result.WriteString("The report is being produced for the first time; read it again shortly.\n")
+		}
+		return result.String()
+	}
+
+	result.WriteString(fmt.Sprintf("Refreshed %s", sub.refreshedAt.Format(time.RFC3339)))
+	if !sub.nextRun.IsZero() {
+		result.WriteString(fmt.Sprintf(", next refresh %s", sub.nextRun.Format(time.RFC3339)))
+	}
+	result.WriteString(".\n")
+	if sub.err != nil {
+		result.WriteString(fmt.Sprintf("The latest refresh failed (%v); this is the previous result.\n", sub.err))
+	}
+	result.WriteString("\n```csv\n" + sub.result + "```\n")
+	return result.String()
+}
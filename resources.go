@@ -0,0 +1,414 @@
+package mssqlmcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const tableResourcePrefix = "mssql://"
+
+// registerTableResources exposes every base table as an MCP resource. The URI
+// template makes any table readable on demand; tables present at startup are
+// additionally registered individually so clients can browse them.
+func registerTableResources(s *server.MCPServer) {
+	s.AddResourceTemplate(
+		mcp.NewResourceTemplate(tableResourcePrefix+"{schema}/{table}", "Table",
+			mcp.WithTemplateDescription("Column description and a small sample of rows for a table"),
+			mcp.WithTemplateMIMEType("text/markdown"),
+		),
+		handleTableResource,
+	)
+
+	tables, err := listBaseTables()
+	if err != nil {
+		log.Printf("Could not enumerate tables for resources: %v", err)
+		return
+	}
+
+	for _, t := range tables {
+		s.AddResource(
+			mcp.NewResource(tableResourceURI(t[0], t[1]), t[0]+"."+t[1],
+				mcp.WithResourceDescription(fmt.Sprintf("Columns and sample rows of table %s.%s", t[0], t[1])),
+				mcp.WithMIMEType("text/markdown"),
+			),
+			handleTableResource,
+		)
+	}
+	log.Printf("Registered %d table resources", len(tables))
+}
+
+func handleTableResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	schema, table, err := parseTableResourceURI(request.Params.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getDbConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResolvedAccess([][2]string{{schema, table}}); err != nil {
+		return nil, err
+	}
+
+	description, err := describeTable(schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var content strings.Builder
+	content.WriteString(description)
+
+	if config.ResourceSampleRows > 0 {
+		filter, err := rowFilterClause(config, schema, table)
+		if err != nil {
+			return nil, err
+		}
+
+		sampleQuery := fmt.Sprintf("SELECT TOP (%d) * FROM %s.%s%s", config.ResourceSampleRows, quoteIdentifier(schema), quoteIdentifier(table), filter)
+		if err := checkPolicies(config, readAccess, sampleQuery); err != nil {
+			return nil, fmt.Errorf("sampling table not permitted: %v", err)
+		}
+		data, err := executeQuery(sampleQuery, true)
+		if err != nil {
+			return nil, fmt.Errorf("error sampling table: %v", err)
+		}
+
+		sample, err := formatResults(data)
+		if err != nil {
+			return nil, err
+		}
+
+		content.WriteString(fmt.Sprintf("\n## Sample rows (up to %d)\n\n```csv\n%s```\n", config.ResourceSampleRows, sample))
+	}
+
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			URI:      request.Params.URI,
+			MIMEType: "text/markdown",
+			Text:     content.String(),
+		},
+	}, nil
+}
+
+// listBaseTables returns (schema, table) pairs for every base table the
+// object access policy permits.
+func listBaseTables() ([][2]string, error) {
+	data, err := executeQuery("SELECT TABLE_SCHEMA, TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_SCHEMA, TABLE_NAME", true)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getDbConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Tables the object access policy refuses are not listed
+	rows := data["rows"].([]map[string]interface{})
+	tables := make([][2]string, 0, len(rows))
+	for _, row := range rows {
+		schema, table := fmt.Sprintf("%v", row["TABLE_SCHEMA"]), fmt.Sprintf("%v", row["TABLE_NAME"])
+		if objectAccessible(config, schema, table) {
+			tables = append(tables, [2]string{schema, table})
+		}
+	}
+	return tables, nil
+}
+
+// getTableColumns returns the INFORMATION_SCHEMA.COLUMNS rows of a table in
+// ordinal order.
+func getTableColumns(schema, table string) ([]map[string]interface{}, error) {
+	data, err := executeQuery(`SELECT COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE, IS_NULLABLE
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = @p1 AND TABLE_NAME = @p2
+		ORDER BY ORDINAL_POSITION`, true, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := data["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("table %s.%s not found", schema, table)
+	}
+	return rows, nil
+}
+
+// describeTable renders the column list of a table as markdown.
+func describeTable(schema, table string) (string, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := getTableColumns(schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	dictionary, _, err := getDataDictionary(schema, table)
+	if err != nil {
+		return "", err
+	}
+	descriptions := dictionary[schema+"."+table]
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# %s.%s\n\n", schema, table))
+	if description, ok := descriptions[""]; ok {
+		result.WriteString(description + "\n\n")
+	}
+	result.WriteString("| Column | Type | Nullable | Description |\n|---|---|---|---|\n")
+	for _, row := range rows {
+		column := fmt.Sprintf("%v", row["COLUMN_NAME"])
+		result.WriteString(fmt.Sprintf("| %s | %s | %v | %s |\n", column, formatColumnType(row), row["IS_NULLABLE"], descriptions[column]))
+	}
+
+	if note := datetimeStorageNote(config, rows); note != "" {
+		result.WriteString("\n" + note + "\n")
+	}
+
+	temporal, err := getTemporalTable(schema, table)
+	if err != nil {
+		return "", err
+	}
+	if temporal != nil {
+		result.WriteString("\n" + temporalNote(temporal) + "\n")
+	}
+
+	if scd := getSCDTable(config, schema, table, rows); scd != nil {
+		result.WriteString("\n" + scdNote(scd) + "\n")
+	}
+
+	durability, err := memoryOptimizedDurability(schema, table)
+	if err != nil {
+		return "", err
+	}
+	if durability != "" {
+		result.WriteString("\n" + memoryOptimizedNote(durability) + "\n")
+	}
+
+	if conditions := softDeleteConditions(config, schema, table, rows); len(conditions) > 0 {
+		result.WriteString(fmt.Sprintf("\nSoft-deleted rows are kept in this table; live rows satisfy %s. Filter on this when counting or aggregating.\n", strings.Join(conditions, " AND ")))
+	}
+	return result.String(), nil
+}
+
+// datetimeStorageNote explains which time zone the table's datetime columns
+// hold according to MSSQL_DATETIME_STORAGE ("utc", "local" or an IANA zone
+// name for local time in that zone), so comparisons use the matching clock.
+func datetimeStorageNote(config *DbConfig, columns []map[string]interface{}) string {
+	var names []string
+	for _, column := range columns {
+		switch column["DATA_TYPE"] {
+		case "datetime", "datetime2", "smalldatetime":
+			names = append(names, fmt.Sprintf("%v", column["COLUMN_NAME"]))
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+
+	list := strings.Join(names, ", ")
+	switch strings.ToLower(config.DatetimeStorage) {
+	case "":
+		return fmt.Sprintf("Datetime columns (%s) carry no time zone and their convention is not declared; confirm whether they hold UTC or local time before comparing them with the current time.", list)
+	case "utc":
+		return fmt.Sprintf("Datetime columns (%s) store UTC; compare them with SYSUTCDATETIME() rather than GETDATE().", list)
+	case "local":
+		return fmt.Sprintf("Datetime columns (%s) store the server's local time; compare them with SYSDATETIME() and convert with AT TIME ZONE before comparing with UTC values.", list)
+	default:
+		return fmt.Sprintf("Datetime columns (%s) store local time in %s; use AT TIME ZONE '%s' to convert before comparing with UTC values.", list, config.DatetimeStorage, config.DatetimeStorage)
+	}
+}
+
+// formatColumnType renders an INFORMATION_SCHEMA.COLUMNS row as a T-SQL type, e.g. nvarchar(50).
+func formatColumnType(row map[string]interface{}) string {
+	dataType := fmt.Sprintf("%v", row["DATA_TYPE"])
+	switch dataType {
+	case "char", "varchar", "nchar", "nvarchar", "binary", "varbinary":
+		if length, ok := row["CHARACTER_MAXIMUM_LENGTH"].(int64); ok {
+			if length == -1 {
+				return dataType + "(max)"
+			}
+			return fmt.Sprintf("%s(%d)", dataType, length)
+		}
+	case "decimal", "numeric":
+		return fmt.Sprintf("%s(%v,%v)", dataType, row["NUMERIC_PRECISION"], row["NUMERIC_SCALE"])
+	}
+	return dataType
+}
+
+func tableResourceURI(schema, table string) string {
+	return tableResourcePrefix + url.PathEscape(schema) + "/" + url.PathEscape(table)
+}
+
+func parseTableResourceURI(uri string) (string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(uri, tableResourcePrefix), "/")
+	if !strings.HasPrefix(uri, tableResourcePrefix) || len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid table resource URI: %s", uri)
+	}
+
+	schema, err := url.PathUnescape(parts[0])
+	if err != nil {
+		return "", "", err
+	}
+	table, err := url.PathUnescape(parts[1])
+	if err != nil {
+		return "", "", err
+	}
+	if schema == "" || table == "" {
+		return "", "", errors.New("table resource URI requires both schema and table")
+	}
+	return schema, table, nil
+}
+
+// quoteIdentifier brackets an identifier so it can be safely embedded in T-SQL.
+func quoteIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+const schemaResourceURI = "mssql://schema"
+
+// registerSchemaResource exposes the whole database schema as one compact
+// document suitable for dropping into an LLM context window.
+func registerSchemaResource(s *server.MCPServer) {
+	s.AddResource(
+		mcp.NewResource(schemaResourceURI, "Database schema",
+			mcp.WithResourceDescription("All tables with their columns, primary keys and foreign key relationships"),
+			mcp.WithMIMEType("text/markdown"),
+		),
+		func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			document, err := renderSchema()
+			if err != nil {
+				return nil, err
+			}
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      request.Params.URI,
+					MIMEType: "text/markdown",
+					Text:     document,
+				},
+			}, nil
+		},
+	)
+}
+
+// renderSchema builds a markdown overview of all base tables using three
+// catalog queries: columns, primary keys and foreign keys.
+func renderSchema() (string, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return "", err
+	}
+
+	columnData, err := executeQuery(`SELECT c.TABLE_SCHEMA, c.TABLE_NAME, c.COLUMN_NAME, c.DATA_TYPE, c.CHARACTER_MAXIMUM_LENGTH, c.NUMERIC_PRECISION, c.NUMERIC_SCALE, c.IS_NULLABLE
+		FROM INFORMATION_SCHEMA.COLUMNS c
+		JOIN INFORMATION_SCHEMA.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME
+		WHERE t.TABLE_TYPE = 'BASE TABLE'
+		ORDER BY c.TABLE_SCHEMA, c.TABLE_NAME, c.ORDINAL_POSITION`, true)
+	if err != nil {
+		return "", err
+	}
+
+	keyData, err := executeQuery(`SELECT k.TABLE_SCHEMA, k.TABLE_NAME, k.COLUMN_NAME
+		FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc
+		JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE k ON k.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA AND k.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+		WHERE tc.CONSTRAINT_TYPE = 'PRIMARY KEY'`, true)
+	if err != nil {
+		return "", err
+	}
+
+	foreignKeyData, err := executeQuery(`SELECT fk.name, OBJECT_SCHEMA_NAME(fk.parent_object_id) AS from_schema, OBJECT_NAME(fk.parent_object_id) AS from_table, pc.name AS from_column,
+			OBJECT_SCHEMA_NAME(fk.referenced_object_id) AS to_schema, OBJECT_NAME(fk.referenced_object_id) AS to_table, rc.name AS to_column
+		FROM sys.foreign_keys fk
+		JOIN sys.foreign_key_columns fkc ON fkc.constraint_object_id = fk.object_id
+		JOIN sys.columns pc ON pc.object_id = fkc.parent_object_id AND pc.column_id = fkc.parent_column_id
+		JOIN sys.columns rc ON rc.object_id = fkc.referenced_object_id AND rc.column_id = fkc.referenced_column_id
+		ORDER BY from_schema, from_table, fk.name, fkc.constraint_column_id`, true)
+	if err != nil {
+		return "", err
+	}
+
+	primaryKeys := make(map[string]bool)
+	for _, row := range keyData["rows"].([]map[string]interface{}) {
+		primaryKeys[fmt.Sprintf("%v.%v.%v", row["TABLE_SCHEMA"], row["TABLE_NAME"], row["COLUMN_NAME"])] = true
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# Schema of %s\n\n", config.Database))
+	result.WriteString("Columns are listed as `name type`; `?` marks nullable columns, `PK` primary key columns and `soft-delete` columns flagging logically deleted rows.\n\n## Tables\n\n")
+
+	currentTable := ""
+	for _, row := range columnData["rows"].([]map[string]interface{}) {
+		// Objects the access lists refuse are left out of the schema
+		if !objectAccessible(config, fmt.Sprintf("%v", row["TABLE_SCHEMA"]), fmt.Sprintf("%v", row["TABLE_NAME"])) {
+			continue
+		}
+		table := fmt.Sprintf("%v.%v", row["TABLE_SCHEMA"], row["TABLE_NAME"])
+		if table != currentTable {
+			if currentTable != "" {
+				result.WriteString("\n")
+			}
+			result.WriteString(fmt.Sprintf("- %s: ", table))
+			currentTable = table
+		} else {
+			result.WriteString(", ")
+		}
+
+		column := fmt.Sprintf("%v", row["COLUMN_NAME"])
+		result.WriteString(column + " " + formatColumnType(row))
+		if row["IS_NULLABLE"] == "YES" {
+			result.WriteString("?")
+		}
+		if primaryKeys[table+"."+column] {
+			result.WriteString(" PK")
+		}
+		if isSoftDeleteColumn(config, fmt.Sprintf("%v", row["TABLE_SCHEMA"]), fmt.Sprintf("%v", row["TABLE_NAME"]), column) {
+			result.WriteString(" soft-delete")
+		}
+	}
+	if currentTable != "" {
+		result.WriteString("\n")
+	}
+
+	// Foreign key columns arrive one per row; group them per constraint
+	type relationship struct {
+		from, to               string
+		fromColumns, toColumns []string
+	}
+	var relationships []*relationship
+	currentKey := ""
+	for _, row := range foreignKeyData["rows"].([]map[string]interface{}) {
+		if !objectAccessible(config, fmt.Sprintf("%v", row["from_schema"]), fmt.Sprintf("%v", row["from_table"])) ||
+			!objectAccessible(config, fmt.Sprintf("%v", row["to_schema"]), fmt.Sprintf("%v", row["to_table"])) {
+			continue
+		}
+		key := fmt.Sprintf("%v.%v", row["from_schema"], row["name"])
+		if key != currentKey {
+			relationships = append(relationships, &relationship{
+				from: fmt.Sprintf("%v.%v", row["from_schema"], row["from_table"]),
+				to:   fmt.Sprintf("%v.%v", row["to_schema"], row["to_table"]),
+			})
+			currentKey = key
+		}
+		r := relationships[len(relationships)-1]
+		r.fromColumns = append(r.fromColumns, fmt.Sprintf("%v", row["from_column"]))
+		r.toColumns = append(r.toColumns, fmt.Sprintf("%v", row["to_column"]))
+	}
+
+	if len(relationships) > 0 {
+		result.WriteString("\n## Relationships\n\n")
+		for _, r := range relationships {
+			result.WriteString(fmt.Sprintf("- %s(%s) -> %s(%s)\n", r.from, strings.Join(r.fromColumns, ", "), r.to, strings.Join(r.toColumns, ", ")))
+		}
+	}
+
+	return result.String(), nil
+}
@@ -0,0 +1,396 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// How long the results of a session that makes no further queries are kept
+const RESULT_HISTORY_TTL = time.Hour
+
+// Rows listed per section by diff_results
+const DIFF_ROWS_SHOWN = 20
+
+// storedResult is a query result kept so later tool calls can refer to it.
+type storedResult struct {
+	id          int
+	query       string
+	columns     []string
+	columnTypes []columnInfo
+	rows        []map[string]interface{}
+	truncated   bool
+	createdAt   time.Time
+}
+
+// resultHistory holds the most recent results of one client session.
+type resultHistory struct {
+	next     int
+	results  []*storedResult
+	lastUsed time.Time
+}
+
+var (
+	resultsMu       sync.Mutex
+	resultHistories = make(map[string]*resultHistory)
+)
+
+// rememberResult keeps a query result for the calling session, dropping the
+// oldest beyond MSSQL_RESULT_HISTORY, and returns its id. It returns 0 when
+// the history is disabled or the query returned no result set.
+func rememberResult(ctx context.Context, config *DbConfig, query string, data map[string]interface{}) int {
+	columns, ok := data["columns"].([]string)
+	if !ok || config.ResultHistory <= 0 {
+		return 0
+	}
+	result := &storedResult{
+		query:     query,
+		columns:   columns,
+		truncated: data["truncated"] == true,
+		createdAt: time.Now(),
+	}
+	result.rows, _ = data["rows"].([]map[string]interface{})
+	result.columnTypes, _ = data["columnTypes"].([]columnInfo)
+
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+
+	// Sessions end without notice, so forgotten histories are pruned here
+	for id, history := range resultHistories {
+		if time.Since(history.lastUsed) > RESULT_HISTORY_TTL {
+			delete(resultHistories, id)
+		}
+	}
+
+	sessionID := sessionIDFromContext(ctx)
+	history, ok := resultHistories[sessionID]
+	if !ok {
+		history = &resultHistory{}
+		resultHistories[sessionID] = history
+	}
+	history.next++
+	history.lastUsed = time.Now()
+	result.id = history.next
+	history.results = append(history.results, result)
+	if len(history.results) > config.ResultHistory {
+		history.results = history.results[len(history.results)-config.ResultHistory:]
+	}
+	return result.id
+}
+
+// lookupResult returns a result kept for the calling session.
+func lookupResult(ctx context.Context, id int) (*storedResult, error) {
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+
+	if history, ok := resultHistories[sessionIDFromContext(ctx)]; ok {
+		history.lastUsed = time.Now()
+		for _, result := range history.results {
+			if result.id == id {
+				return result, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("result #%d is not available; only the last results of this session are kept", id)
+}
+
+// registerResultTools adds tools working on earlier query results without
+// running the queries again.
+func registerResultTools(s *server.MCPServer) {
+	listTool := mcp.NewTool("list_results",
+		mcp.WithDescription("List the recent execute_sql results of this session that can be referred to by id"),
+	)
+
+	s.AddTool(listTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		resultsMu.Lock()
+		var results []*storedResult
+		if history, ok := resultHistories[sessionIDFromContext(ctx)]; ok {
+			results = append(results, history.results...)
+		}
+		resultsMu.Unlock()
+
+		if len(results) == 0 {
+			return mcp.NewToolResultText("No results are kept for this session"), nil
+		}
+		var list strings.Builder
+		for _, result := range results {
+			rows := fmt.Sprintf("%d rows", len(result.rows))
+			if result.truncated {
+				rows += " (truncated)"
+			}
+			list.WriteString(fmt.Sprintf("#%d at %s, %s: %s\n", result.id, result.createdAt.Format("15:04:05"), rows, truncateString(result.query, 100)))
+		}
+		return mcp.NewToolResultText(list.String()), nil
+	})
+
+	getTool := mcp.NewTool("get_result",
+		mcp.WithDescription("Show rows of an earlier execute_sql result by id, e.g. to page through it or change its format, without re-executing the query"),
+		mcp.WithNumber("id",
+			mcp.Required(),
+			mcp.Description("Result id, as reported with the result"),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Number of rows to skip (default 0)"),
+		),
+		mcp.WithNumber("max_rows",
+			mcp.Description("Number of rows to show (default from MSSQL_MAX_ROWS, 1000)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: text (default), tsv, vertical, markdown or json"),
+			mcp.Enum(outputFormats()...),
+		),
+		mcp.WithBoolean("pretty",
+			mcp.Description("Indent xml values and values holding JSON objects or arrays (default from MSSQL_PRETTY_PRINT)"),
+		),
+	)
+
+	s.AddTool(getTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+
+		id, _ := request.Params.Arguments["id"].(float64)
+		result, err := lookupResult(ctx, int(id))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		format, _ := request.Params.Arguments["format"].(string)
+		if format == "" {
+			format = config.OutputFormat
+		}
+		if !isOutputFormat(format) {
+			return mcp.NewToolResultError(fmt.Sprintf("Unknown output format: %s", format)), nil
+		}
+
+		offset := 0
+		if value, ok := request.Params.Arguments["offset"].(float64); ok && value > 0 {
+			offset = int(value)
+		}
+		if offset > len(result.rows) {
+			offset = len(result.rows)
+		}
+		maxRows := config.MaxRows
+		if value, ok := request.Params.Arguments["max_rows"].(float64); ok && value > 0 {
+			maxRows = int(value)
+		}
+		end := len(result.rows)
+		if maxRows > 0 && offset+maxRows < end {
+			end = offset + maxRows
+		}
+
+		data := map[string]interface{}{
+			"columns":     result.columns,
+			"columnTypes": result.columnTypes,
+			"rows":        result.rows[offset:end],
+			"firstRow":    int64(offset + 1),
+			"resultId":    result.id,
+		}
+		if end < len(result.rows) {
+			data["truncated"] = true
+			data["nextOffset"] = end
+		}
+		if prettyPrintRequested(config, request.Params.Arguments) {
+			data = prettyPrintValues(data)
+		}
+
+		formatted, err := formatResultsAs(data, format)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error formatting results: %v", err)), nil
+		}
+		return mcp.NewToolResultText(formatted), nil
+	})
+
+	diffTool := mcp.NewTool("diff_results",
+		mcp.WithDescription("Compare two earlier execute_sql results by id: rows only in one of them and, when key columns are given, rows whose values changed"),
+		mcp.WithNumber("from",
+			mcp.Required(),
+			mcp.Description("Id of the earlier result"),
+		),
+		mcp.WithNumber("to",
+			mcp.Required(),
+			mcp.Description("Id of the later result"),
+		),
+		mcp.WithArray("key",
+			mcp.Description("Columns identifying a row in both results, e.g. [\"OrderID\"]; without them whole rows are compared"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+	)
+
+	s.AddTool(diffTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		fromID, _ := request.Params.Arguments["from"].(float64)
+		toID, _ := request.Params.Arguments["to"].(float64)
+		from, err := lookupResult(ctx, int(fromID))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		to, err := lookupResult(ctx, int(toID))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		var key []string
+		if values, ok := request.Params.Arguments["key"].([]interface{}); ok {
+			for _, value := range values {
+				if column, ok := value.(string); ok && column != "" {
+					key = append(key, column)
+				}
+			}
+		}
+
+		diff, err := diffResults(from, to, key)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error comparing results: %v", err)), nil
+		}
+		return mcp.NewToolResultText(diff), nil
+	})
+}
+
+// diffResults describes how one result differs from another over the columns
+// they share. With key columns, rows are matched on the key and changed
+// values are listed; otherwise rows are compared as a whole, counting
+// duplicates.
+func diffResults(from, to *storedResult, key []string) (string, error) {
+	null := configuredNullToken()
+	var columns []string
+	inTo := make(map[string]bool)
+	for _, column := range to.columns {
+		inTo[column] = true
+	}
+	inFrom := make(map[string]bool)
+	for _, column := range from.columns {
+		inFrom[column] = true
+		if inTo[column] {
+			columns = append(columns, column)
+		}
+	}
+	for _, column := range key {
+		if !inFrom[column] || !inTo[column] {
+			return "", fmt.Errorf("key column %s is not in both results", column)
+		}
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# Result #%d (%d rows) compared to #%d (%d rows)\n\n", from.id, len(from.rows), to.id, len(to.rows)))
+	if from.truncated || to.truncated {
+		result.WriteString("A result was truncated, so rows beyond those fetched are not compared.\n\n")
+	}
+	for _, column := range from.columns {
+		if !inTo[column] {
+			result.WriteString(fmt.Sprintf("Column %s is only in #%d.\n", column, from.id))
+		}
+	}
+	for _, column := range to.columns {
+		if !inFrom[column] {
+			result.WriteString(fmt.Sprintf("Column %s is only in #%d.\n", column, to.id))
+		}
+	}
+
+	var removed, added []map[string]interface{}
+	var changed []string
+	if len(key) == 0 {
+		// Multiset difference: each row of one result cancels one equal row
+		// of the other
+		counts := make(map[uint64]int)
+		for _, row := range from.rows {
+			counts[hashRow(columns, row)]++
+		}
+		for _, row := range to.rows {
+			h := hashRow(columns, row)
+			if counts[h] > 0 {
+				counts[h]--
+			} else {
+				added = append(added, row)
+			}
+		}
+		for _, row := range from.rows {
+			h := hashRow(columns, row)
+			if counts[h] > 0 {
+				counts[h]--
+				removed = append(removed, row)
+			}
+		}
+	} else {
+		before := make(map[uint64]map[string]interface{})
+		for _, row := range from.rows {
+			h := hashRow(key, row)
+			if _, ok := before[h]; ok {
+				return "", fmt.Errorf("key %s is not unique in #%d", strings.Join(key, ", "), from.id)
+			}
+			before[h] = row
+		}
+		seen := make(map[uint64]bool)
+		for _, row := range to.rows {
+			h := hashRow(key, row)
+			if seen[h] {
+				return "", fmt.Errorf("key %s is not unique in #%d", strings.Join(key, ", "), to.id)
+			}
+			seen[h] = true
+
+			old, ok := before[h]
+			if !ok {
+				added = append(added, row)
+				continue
+			}
+			var differences []string
+			for _, column := range columns {
+				if hashRow([]string{column}, old) != hashRow([]string{column}, row) {
+					differences = append(differences, fmt.Sprintf("%s: %s → %s", column, displayValue(old[column], null), displayValue(row[column], null)))
+				}
+			}
+			if len(differences) > 0 {
+				changed = append(changed, fmt.Sprintf("- %s: %s", keyDescription(key, row, null), strings.Join(differences, "; ")))
+			}
+		}
+		for _, row := range from.rows {
+			if !seen[hashRow(key, row)] {
+				removed = append(removed, row)
+			}
+		}
+	}
+
+	if len(added) == 0 && len(removed) == 0 && len(changed) == 0 {
+		result.WriteString("The results contain the same rows.\n")
+		return result.String(), nil
+	}
+
+	writeRows := func(title string, rows []map[string]interface{}) {
+		if len(rows) == 0 {
+			return
+		}
+		result.WriteString(fmt.Sprintf("\n## %s: %d\n\n", title, len(rows)))
+		if len(rows) > DIFF_ROWS_SHOWN {
+			result.WriteString(fmt.Sprintf("First %d:\n", DIFF_ROWS_SHOWN))
+			rows = rows[:DIFF_ROWS_SHOWN]
+		}
+		result.WriteString(formatTable(columns, rows, null))
+	}
+	writeRows(fmt.Sprintf("Only in #%d", from.id), removed)
+	writeRows(fmt.Sprintf("Only in #%d", to.id), added)
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		result.WriteString(fmt.Sprintf("\n## Changed: %d\n\n", len(changed)))
+		if len(changed) > DIFF_ROWS_SHOWN {
+			result.WriteString(fmt.Sprintf("First %d:\n", DIFF_ROWS_SHOWN))
+			changed = changed[:DIFF_ROWS_SHOWN]
+		}
+		result.WriteString(strings.Join(changed, "\n") + "\n")
+	}
+	return result.String(), nil
+}
+
+// keyDescription renders the key values of a row, e.g. "OrderID=42".
+func keyDescription(key []string, row map[string]interface{}, null string) string {
+	parts := make([]string, len(key))
+	for i, column := range key {
+		parts[i] = column + "=" + displayValue(row[column], null)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,236 @@
+package mssqlmcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Validity column pairs ("from:to") that mark a slowly changing dimension
+// unless MSSQL_SCD_COLUMNS replaces them; names match ignoring case and
+// underscores
+var defaultSCDColumns = []string{
+	"effective_from:effective_to",
+	"effective_start_date:effective_end_date",
+	"effective_date:expiration_date",
+	"valid_from:valid_to",
+	"row_effective_date:row_expiration_date",
+	"scd_start:scd_end",
+}
+
+// scdTable describes how a type 2 slowly changing dimension records the
+// period each row version is valid for.
+type scdTable struct {
+	From string
+	To   string
+	// The period ends at To inclusive rather than just before it
+	EndInclusive bool
+}
+
+// getSCDTable returns the validity columns of a table declared in
+// MSSQL_SCD_TABLES ("schema.table:from:to") or carrying one of the pairs in
+// MSSQL_SCD_COLUMNS, or nil when it has none.
+func getSCDTable(config *DbConfig, schema, table string, columns []map[string]interface{}) *scdTable {
+	names := make(map[string]string, len(columns))
+	for _, column := range columns {
+		name := fmt.Sprintf("%v", column["COLUMN_NAME"])
+		names[normalizeSCDName(name)] = name
+	}
+
+	for _, entry := range config.SCDTables {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			continue
+		}
+		entrySchema, entryTable, err := parseObjectName(parts[0])
+		if err != nil || !strings.EqualFold(entrySchema, schema) || !strings.EqualFold(entryTable, table) {
+			continue
+		}
+		from, fromOK := names[normalizeSCDName(parts[1])]
+		to, toOK := names[normalizeSCDName(parts[2])]
+		if fromOK && toOK {
+			return &scdTable{From: from, To: to, EndInclusive: config.SCDEndInclusive}
+		}
+	}
+
+	for _, pair := range config.SCDColumns {
+		fromName, toName, ok := strings.Cut(pair, ":")
+		if !ok {
+			continue
+		}
+		from, fromOK := names[normalizeSCDName(fromName)]
+		to, toOK := names[normalizeSCDName(toName)]
+		if fromOK && toOK {
+			return &scdTable{From: from, To: to, EndInclusive: config.SCDEndInclusive}
+		}
+	}
+	return nil
+}
+
+func normalizeSCDName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "_", ""))
+}
+
+// validAt is the condition selecting the version of a row valid at the
+// instant given by the expression at, for a dimension aliased as alias. An
+// open period has a NULL end or a far-future one, which compares as later.
+func (scd *scdTable) validAt(alias, at string) string {
+	from := alias + "." + quoteIdentifier(scd.From)
+	to := alias + "." + quoteIdentifier(scd.To)
+	endComparison := ">"
+	if scd.EndInclusive {
+		endComparison = ">="
+	}
+	return fmt.Sprintf("%s <= %s AND (%s %s %s OR %s IS NULL)", from, at, to, endComparison, at, to)
+}
+
+// scdNote explains how to pick the right version of a row in a slowly
+// changing dimension.
+func scdNote(scd *scdTable) string {
+	end := "before"
+	if scd.EndInclusive {
+		end = "up to and including"
+	}
+	return fmt.Sprintf("This looks like a slowly changing dimension: each row version is valid from %s %s %s, and the current version has no end. "+
+		"Join facts on the business key and the fact's date falling in that period, not on the key alone; the scd_join tool writes such joins.",
+		scd.From, end, scd.To)
+}
+
+// registerSCDTools adds a tool generating point-in-time joins against slowly
+// changing dimensions.
+func registerSCDTools(s *server.MCPServer) {
+	joinTool := mcp.NewTool("scd_join",
+		mcp.WithDescription("Write the SQL for a point-in-time join against a type 2 slowly changing dimension (rows versioned by validity columns such as effective_from/effective_to), either matching each fact to the dimension version valid on the fact's date or selecting the versions valid at one moment. The query is returned, not executed; run it with execute_sql."),
+		mcp.WithString("dimension",
+			mcp.Required(),
+			mcp.Description("Dimension table, optionally schema-qualified (e.g. dbo.DimCustomer)"),
+		),
+		mcp.WithString("fact",
+			mcp.Description("Fact table to join to the dimension (e.g. dbo.FactSales)"),
+		),
+		mcp.WithString("fact_date",
+			mcp.Description("Column of the fact table holding the date each fact happened on; required with fact"),
+		),
+		mcp.WithString("keys",
+			mcp.Description("Business key columns joining fact to dimension, as fact_column=dimension_column pairs separated by commas, or a column name shared by both; required with fact"),
+		),
+		mcp.WithString("as_of",
+			mcp.Description("Instead of a fact table, select the dimension rows valid at this time, e.g. 2024-01-31"),
+		),
+	)
+
+	s.AddTool(joinTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		dimensionName, _ := request.Params.Arguments["dimension"].(string)
+		factName, _ := request.Params.Arguments["fact"].(string)
+		factDate, _ := request.Params.Arguments["fact_date"].(string)
+		keys, _ := request.Params.Arguments["keys"].(string)
+		asOf, _ := request.Params.Arguments["as_of"].(string)
+		if dimensionName == "" {
+			return mcp.NewToolResultError("Dimension is required"), nil
+		}
+		if (factName == "") == (asOf == "") {
+			return mcp.NewToolResultError("Provide either fact (with fact_date and keys) or as_of"), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		dimensionSchema, dimension, err := resolveObjectName(dimensionName)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if err := checkPolicies(config, readAccess, "SELECT * FROM "+formatObjectName(dimensionSchema, dimension)); err != nil {
+			return notPermitted("Query", err), nil
+		}
+		dimensionColumns, err := getTableColumns(dimensionSchema, dimension)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading table: %v", err)), nil
+		}
+		if len(dimensionColumns) == 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("Table %s.%s not found", dimensionSchema, dimension)), nil
+		}
+		scd := getSCDTable(config, dimensionSchema, dimension, dimensionColumns)
+		if scd == nil {
+			return mcp.NewToolResultError(fmt.Sprintf("%s.%s has no validity columns; declare them in MSSQL_SCD_TABLES as schema.table:from_column:to_column", dimensionSchema, dimension)), nil
+		}
+
+		var query string
+		if asOf != "" {
+			query = fmt.Sprintf("DECLARE @as_of datetime2 = %s;\n\nSELECT d.*\nFROM %s AS d\nWHERE %s;",
+				quoteString(asOf), formatObjectName(dimensionSchema, dimension), scd.validAt("d", "@as_of"))
+		} else {
+			query, err = scdFactJoin(config, scd, dimensionSchema, dimension, dimensionColumns, factName, factDate, keys)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+		// The query is only written out, but must be one execute_sql runs
+		if err := checkPolicies(config, readAccess, query); err != nil {
+			return notPermitted("Query", err), nil
+		}
+		return mcp.NewToolResultText(query + "\n\n-- " + scdNote(scd)), nil
+	})
+}
+
+// scdFactJoin writes the join of a fact table to the dimension version valid
+// on each fact's date.
+func scdFactJoin(config *DbConfig, scd *scdTable, dimensionSchema, dimension string, dimensionColumns []map[string]interface{}, factName, factDate, keys string) (string, error) {
+	if factDate == "" || strings.TrimSpace(keys) == "" {
+		return "", errors.New("fact_date and keys are required with fact")
+	}
+	factSchema, fact, err := resolveObjectName(factName)
+	if err != nil {
+		return "", err
+	}
+	if err := checkPolicies(config, readAccess, "SELECT * FROM "+formatObjectName(factSchema, fact)); err != nil {
+		return "", fmt.Errorf("Query not permitted: %v", err)
+	}
+	factColumns, err := getTableColumns(factSchema, fact)
+	if err != nil {
+		return "", fmt.Errorf("error reading table: %v", err)
+	}
+	if len(factColumns) == 0 {
+		return "", fmt.Errorf("table %s.%s not found", factSchema, fact)
+	}
+
+	// Columns are checked against the catalog so only real names reach the SQL
+	lookup := func(columns []map[string]interface{}, name, table string) (string, error) {
+		name = unquoteIdentifier(strings.TrimSpace(name))
+		for _, column := range columns {
+			if actual := fmt.Sprintf("%v", column["COLUMN_NAME"]); strings.EqualFold(actual, name) {
+				return quoteIdentifier(actual), nil
+			}
+		}
+		return "", fmt.Errorf("%s has no column %s", table, name)
+	}
+
+	dateColumn, err := lookup(factColumns, factDate, factSchema+"."+fact)
+	if err != nil {
+		return "", err
+	}
+	var conditions []string
+	for _, pair := range strings.Split(keys, ",") {
+		factKey, dimensionKey, ok := strings.Cut(pair, "=")
+		if !ok {
+			dimensionKey = factKey
+		}
+		factColumn, err := lookup(factColumns, factKey, factSchema+"."+fact)
+		if err != nil {
+			return "", err
+		}
+		dimensionColumn, err := lookup(dimensionColumns, dimensionKey, dimensionSchema+"."+dimension)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, fmt.Sprintf("d.%s = f.%s", dimensionColumn, factColumn))
+	}
+	conditions = append(conditions, scd.validAt("d", "f."+dateColumn))
+
+	return fmt.Sprintf("SELECT f.*, d.*\nFROM %s AS f\nLEFT JOIN %s AS d\n    ON %s;",
+		formatObjectName(factSchema, fact), formatObjectName(dimensionSchema, dimension), strings.Join(conditions, "\n   AND ")), nil
+}
@@ -0,0 +1,1028 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Maximum number of tables describe_tables accepts in one call
+const MAX_DESCRIBE_TABLES = 50
+
+// Renderings of describe_table and describe_tables
+const (
+	describeFull = "full"
+	describeCard = "card"
+)
+
+// describeFormat returns the rendering asked for in a tool call, or the
+// configured one.
+func describeFormat(config *DbConfig, request mcp.CallToolRequest) (string, error) {
+	format, _ := request.Params.Arguments["format"].(string)
+	if format == "" {
+		format = config.DescribeFormat
+	}
+	if format != describeFull && format != describeCard {
+		return "", fmt.Errorf("unknown format %q (expected full or card)", format)
+	}
+	return format, nil
+}
+
+// registerSchemaTools adds tools for exploring the structure of the database.
+func registerSchemaTools(s *server.MCPServer) {
+	describeTool := mcp.NewTool("describe_table",
+		mcp.WithDescription("Describe a table's columns, types and nullability, including notes on soft-delete columns, system versioning and the time zone of datetime columns"),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Table name, optionally schema-qualified (e.g. dbo.Orders)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("full for the human-oriented description with documentation and notes, or card for one line per column (name type, ? if nullable, PK if in the primary key), several times shorter; defaults to MSSQL_DESCRIBE_FORMAT"),
+			mcp.Enum(describeFull, describeCard),
+		),
+	)
+
+	s.AddTool(describeTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, ok := request.Params.Arguments["table"].(string)
+		if !ok || name == "" {
+			return mcp.NewToolResultError("Table is required"), nil
+		}
+
+		schema, table, err := resolveObjectName(name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		format, err := describeFormat(config, request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if format == describeCard {
+			card, missing, err := describeTableCards([][2]string{{schema, table}})
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Error describing table: %v", err)), nil
+			}
+			if len(missing) > 0 {
+				return mcp.NewToolResultError(fmt.Sprintf("Error describing table: table %s not found", missing[0])), nil
+			}
+			return mcp.NewToolResultText(card), nil
+		}
+
+		description, err := describeTable(schema, table)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error describing table: %v", err)), nil
+		}
+		return mcp.NewToolResultText(description), nil
+	})
+
+	describeManyTool := mcp.NewTool("describe_tables",
+		mcp.WithDescription(fmt.Sprintf("Describe the columns, types, nullability, primary keys and documentation of up to %d tables or views in one catalog query, instead of calling describe_table for each. Notes on system versioning and memory-optimized tables are left to describe_table.", MAX_DESCRIBE_TABLES)),
+		mcp.WithArray("tables",
+			mcp.Required(),
+			mcp.Description("Table names, optionally schema-qualified, e.g. [\"dbo.Orders\", \"dbo.Customers\"]"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithString("format",
+			mcp.Description("full for the human-oriented description with documentation and notes, or card for one line per column (name type, ? if nullable, PK if in the primary key), several times shorter; defaults to MSSQL_DESCRIBE_FORMAT"),
+			mcp.Enum(describeFull, describeCard),
+		),
+	)
+
+	s.AddTool(describeManyTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		values, _ := request.Params.Arguments["tables"].([]interface{})
+		var requested []string
+		for _, value := range values {
+			name, ok := value.(string)
+			if !ok || strings.TrimSpace(name) == "" {
+				continue
+			}
+			requested = append(requested, name)
+		}
+		if len(requested) == 0 {
+			return mcp.NewToolResultError("At least one table is required"), nil
+		}
+		if len(requested) > MAX_DESCRIBE_TABLES {
+			return mcp.NewToolResultError(fmt.Sprintf("At most %d tables can be described at once", MAX_DESCRIBE_TABLES)), nil
+		}
+		names, err := resolveObjectNames(requested)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		format, err := describeFormat(config, request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if format == describeCard {
+			cards, missing, err := describeTableCards(names)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Error describing tables: %v", err)), nil
+			}
+			if len(missing) > 0 {
+				cards += fmt.Sprintf("Not found: %s\n", strings.Join(missing, ", "))
+			}
+			return mcp.NewToolResultText(cards), nil
+		}
+
+		description, err := describeTables(names)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error describing tables: %v", err)), nil
+		}
+		return mcp.NewToolResultText(description), nil
+	})
+
+	dictionaryTool := mcp.NewTool("get_data_dictionary",
+		mcp.WithDescription("Return the documentation stored in the database as MS_Description extended properties on tables, views and columns"),
+		mcp.WithString("table",
+			mcp.Description("Limit to one table or view, optionally schema-qualified; omit for the whole database"),
+		),
+	)
+
+	s.AddTool(dictionaryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var schema, table string
+		if name, _ := request.Params.Arguments["table"].(string); name != "" {
+			var err error
+			schema, table, err = resolveObjectName(name)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+
+		dictionary, objects, err := getDataDictionary(schema, table)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading data dictionary: %v", err)), nil
+		}
+		if len(objects) == 0 {
+			return mcp.NewToolResultText("No MS_Description extended properties found"), nil
+		}
+
+		var result strings.Builder
+		for _, object := range objects {
+			descriptions := dictionary[object]
+			result.WriteString(fmt.Sprintf("## %s\n", object))
+			if description, ok := descriptions[""]; ok {
+				result.WriteString(description + "\n")
+			}
+
+			columns := make([]string, 0, len(descriptions))
+			for column := range descriptions {
+				if column != "" {
+					columns = append(columns, column)
+				}
+			}
+			sort.Strings(columns)
+			for _, column := range columns {
+				result.WriteString(fmt.Sprintf("- %s: %s\n", column, descriptions[column]))
+			}
+			result.WriteString("\n")
+		}
+		return mcp.NewToolResultText(result.String()), nil
+	})
+
+	dependenciesTool := mcp.NewTool("get_dependencies",
+		mcp.WithDescription("List what a table, view, function or procedure depends on and which objects depend on it (from sys.sql_expression_dependencies and foreign keys)"),
+		mcp.WithString("object",
+			mcp.Required(),
+			mcp.Description("Object name, optionally schema-qualified (e.g. dbo.vw_Sales)"),
+		),
+	)
+
+	s.AddTool(dependenciesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, ok := request.Params.Arguments["object"].(string)
+		if !ok || name == "" {
+			return mcp.NewToolResultError("Object is required"), nil
+		}
+
+		schema, object, err := resolveObjectName(name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		result, err := describeDependencies(schema, object)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading dependencies: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+
+	checkTool := mcp.NewTool("check_identifiers",
+		mcp.WithDescription("Check the tables, views and functions a query references against the catalog, and flag column names that are reserved words or contain spaces and must be bracketed"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("The SQL query to check; it is not executed"),
+		),
+	)
+
+	s.AddTool(checkTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query, ok := request.Params.Arguments["query"].(string)
+		if !ok || query == "" {
+			return mcp.NewToolResultError("Query is required"), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		access := readAccess
+		if isWriteOperation(query) {
+			access = writeAccess
+		}
+		if err := checkPolicies(config, access, query); err != nil {
+			return notPermitted("Query", err), nil
+		}
+
+		result, err := checkIdentifiers(query)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error checking identifiers: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+
+	triggersTool := mcp.NewTool("list_triggers", append([]mcp.ToolOption{
+		mcp.WithDescription("List DML triggers on tables and views and database-level DDL triggers, with the events they fire on, whether they are enabled and their definitions"),
+		mcp.WithString("table",
+			mcp.Description("Limit to the triggers of one table or view, optionally schema-qualified; omit for the whole database"),
+		),
+		mcp.WithBoolean("include_definitions",
+			mcp.Description("Include the trigger source code (default true)"),
+		),
+	}, listFilterOptions(true)...)...)
+
+	s.AddTool(triggersTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var schema, table string
+		if name, _ := request.Params.Arguments["table"].(string); name != "" {
+			var err error
+			schema, table, err = resolveObjectName(name)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+		includeDefinitions := true
+		if value, ok := request.Params.Arguments["include_definitions"].(bool); ok {
+			includeDefinitions = value
+		}
+
+		result, err := describeTriggers(schema, table, includeDefinitions, listFilterFromArguments(request.Params.Arguments))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error listing triggers: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+
+	constraintsTool := mcp.NewTool("list_constraints",
+		mcp.WithDescription("List the primary key, unique constraints, check constraints (with their expressions) and column defaults of a table"),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Table name, optionally schema-qualified (e.g. dbo.Orders)"),
+		),
+	)
+
+	s.AddTool(constraintsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, ok := request.Params.Arguments["table"].(string)
+		if !ok || name == "" {
+			return mcp.NewToolResultError("Table is required"), nil
+		}
+
+		schema, table, err := resolveObjectName(name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		result, err := describeConstraints(schema, table)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error listing constraints: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+
+	synonymsTool := mcp.NewTool("list_synonyms", append([]mcp.ToolOption{
+		mcp.WithDescription("List synonyms with the object each one points to, its type and whether it resolves"),
+	}, listFilterOptions(true)...)...)
+
+	s.AddTool(synonymsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		filter := listFilterFromArguments(request.Params.Arguments)
+		conditions, args := filter.conditions("SCHEMA_NAME(sn.schema_id)", "sn.name", nil)
+
+		// OBJECT_ID only resolves local objects; synonyms for other databases
+		// or linked servers are reported as not checked
+		data, err := executeQuery(`SELECT SCHEMA_NAME(sn.schema_id) + '.' + sn.name AS synonym,
+				sn.base_object_name,
+				CASE
+					WHEN PARSENAME(sn.base_object_name, 3) IS NOT NULL OR PARSENAME(sn.base_object_name, 4) IS NOT NULL THEN 'not checked (other database)'
+					WHEN o.object_id IS NULL THEN 'MISSING'
+					ELSE o.type_desc
+				END AS base_object_type
+			FROM sys.synonyms sn
+			LEFT JOIN sys.objects o ON o.object_id = OBJECT_ID(sn.base_object_name)
+			WHERE 1 = 1`+conditions+`
+			ORDER BY synonym`+filter.paging(), true, args...)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error listing synonyms: %v", err)), nil
+		}
+
+		note := filter.page(data)
+		result, err := formatResults(data)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error formatting results: %v", err)), nil
+		}
+		if note != "" {
+			result += "\n\n" + note
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+
+	sequencesTool := mcp.NewTool("list_sequences", append([]mcp.ToolOption{
+		mcp.WithDescription("List sequence objects with their type, current value, increment, bounds and cycling behaviour"),
+	}, listFilterOptions(true)...)...)
+
+	s.AddTool(sequencesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		filter := listFilterFromArguments(request.Params.Arguments)
+		conditions, args := filter.conditions("SCHEMA_NAME(sq.schema_id)", "sq.name", nil)
+
+		data, err := executeQuery(`SELECT SCHEMA_NAME(sq.schema_id) + '.' + sq.name AS sequence,
+				TYPE_NAME(sq.user_type_id) AS type,
+				CAST(sq.current_value AS nvarchar(40)) AS current_value,
+				CAST(sq.increment AS nvarchar(40)) AS increment,
+				CAST(sq.start_value AS nvarchar(40)) AS start_value,
+				CAST(sq.minimum_value AS nvarchar(40)) AS minimum_value,
+				CAST(sq.maximum_value AS nvarchar(40)) AS maximum_value,
+				sq.is_cycling,
+				sq.is_exhausted,
+				CASE WHEN sq.is_cached = 0 THEN 'none' ELSE ISNULL(CAST(sq.cache_size AS nvarchar(20)), 'default') END AS cache
+			FROM sys.sequences sq
+			WHERE 1 = 1`+conditions+`
+			ORDER BY sequence`+filter.paging(), true, args...)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error listing sequences: %v", err)), nil
+		}
+
+		note := filter.page(data)
+		result, err := formatResults(data)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error formatting results: %v", err)), nil
+		}
+		if note != "" {
+			result += "\n\n" + note
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+}
+
+// getDataDictionary returns MS_Description extended properties keyed by
+// "schema.object" and then by column name, with "" holding the description of
+// the object itself. Schema and table may be empty to fetch everything.
+func getDataDictionary(schema, table string) (map[string]map[string]string, []string, error) {
+	query := `SELECT s.name AS schema_name, o.name AS object_name, ISNULL(c.name, '') AS column_name, CAST(ep.value AS nvarchar(4000)) AS description
+		FROM sys.extended_properties ep
+		JOIN sys.objects o ON o.object_id = ep.major_id
+		JOIN sys.schemas s ON s.schema_id = o.schema_id
+		LEFT JOIN sys.columns c ON ep.minor_id > 0 AND c.object_id = ep.major_id AND c.column_id = ep.minor_id
+		WHERE ep.class = 1 AND ep.name = 'MS_Description'`
+	var args []interface{}
+	if table != "" {
+		query += " AND s.name = @p1 AND o.name = @p2"
+		args = append(args, schema, table)
+	}
+	query += " ORDER BY s.name, o.name, ep.minor_id"
+
+	data, err := executeQuery(query, true, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dictionary := make(map[string]map[string]string)
+	var objects []string
+	for _, row := range data["rows"].([]map[string]interface{}) {
+		object := fmt.Sprintf("%v.%v", row["schema_name"], row["object_name"])
+		if dictionary[object] == nil {
+			dictionary[object] = make(map[string]string)
+			objects = append(objects, object)
+		}
+		dictionary[object][fmt.Sprintf("%v", row["column_name"])] = fmt.Sprintf("%v", row["description"])
+	}
+	return dictionary, objects, nil
+}
+
+// describeTables describes several tables with a single catalog query
+// returning their columns, primary key membership and MS_Description
+// documentation.
+func describeTables(names [][2]string) (string, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return "", err
+	}
+
+	columns, err := getDescribedColumns(names)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	var missing []string
+	for i, name := range names {
+		rows := columns[i]
+		if len(rows) == 0 {
+			missing = append(missing, name[0]+"."+name[1])
+			continue
+		}
+		schema, table := fmt.Sprintf("%v", rows[0]["TABLE_SCHEMA"]), fmt.Sprintf("%v", rows[0]["TABLE_NAME"])
+		result.WriteString(fmt.Sprintf("# %s.%s\n\n", schema, table))
+		if description, ok := rows[0]["table_description"].(string); ok {
+			result.WriteString(description + "\n\n")
+		}
+		result.WriteString("| Column | Type | Nullable | Key | Description |\n|---|---|---|---|---|\n")
+		for _, row := range rows {
+			key := ""
+			if row["is_primary_key"] == int64(1) {
+				key = "PK"
+			}
+			description, _ := row["column_description"].(string)
+			result.WriteString(fmt.Sprintf("| %v | %s | %v | %s | %s |\n", row["COLUMN_NAME"], formatColumnType(row), row["IS_NULLABLE"], key, description))
+		}
+
+		if note := datetimeStorageNote(config, rows); note != "" {
+			result.WriteString("\n" + note + "\n")
+		}
+		if scd := getSCDTable(config, schema, table, rows); scd != nil {
+			result.WriteString("\n" + scdNote(scd) + "\n")
+		}
+		if conditions := softDeleteConditions(config, schema, table, rows); len(conditions) > 0 {
+			result.WriteString(fmt.Sprintf("\nSoft-deleted rows are kept in this table; live rows satisfy %s. Filter on this when counting or aggregating.\n", strings.Join(conditions, " AND ")))
+		}
+		result.WriteString("\n")
+	}
+	if len(missing) > 0 {
+		result.WriteString(fmt.Sprintf("Not found: %s\n", strings.Join(missing, ", ")))
+	}
+	return strings.TrimRight(result.String(), "\n") + "\n", nil
+}
+
+// describeTableCards renders tables as schema cards: the table name and one
+// line per column in the notation of the schema resource, `name type` with
+// `?` for nullable, `PK` for primary key and `soft-delete` for soft-delete
+// columns. Descriptions and notes are left out, so a card takes a fraction
+// of the tokens of the full description.
+func describeTableCards(names [][2]string) (string, []string, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return "", nil, err
+	}
+
+	columns, err := getDescribedColumns(names)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var result strings.Builder
+	var missing []string
+	for i, name := range names {
+		rows := columns[i]
+		if len(rows) == 0 {
+			missing = append(missing, name[0]+"."+name[1])
+			continue
+		}
+		schema, table := fmt.Sprintf("%v", rows[0]["TABLE_SCHEMA"]), fmt.Sprintf("%v", rows[0]["TABLE_NAME"])
+		result.WriteString(schema + "." + table + "\n")
+		for _, row := range rows {
+			column := fmt.Sprintf("%v", row["COLUMN_NAME"])
+			result.WriteString("  " + column + " " + formatColumnType(row))
+			if row["IS_NULLABLE"] == "YES" {
+				result.WriteString("?")
+			}
+			if row["is_primary_key"] == int64(1) {
+				result.WriteString(" PK")
+			}
+			if isSoftDeleteColumn(config, schema, table, column) {
+				result.WriteString(" soft-delete")
+			}
+			result.WriteString("\n")
+		}
+	}
+	return result.String(), missing, nil
+}
+
+// getDescribedColumns reads the columns of the named tables in one catalog
+// query, with their primary key membership and MS_Description documentation,
+// grouped by the position of the table in names.
+func getDescribedColumns(names [][2]string) ([][]map[string]interface{}, error) {
+	var requested []string
+	var args []interface{}
+	for i, name := range names {
+		requested = append(requested, fmt.Sprintf("(%d, @p%d, @p%d)", i, 2*i+1, 2*i+2))
+		args = append(args, name[0], name[1])
+	}
+	data, err := executeQuery(fmt.Sprintf(`SELECT r.position, c.TABLE_SCHEMA, c.TABLE_NAME, c.COLUMN_NAME, c.DATA_TYPE, c.CHARACTER_MAXIMUM_LENGTH, c.NUMERIC_PRECISION, c.NUMERIC_SCALE, c.IS_NULLABLE,
+			CASE WHEN pk.COLUMN_NAME IS NULL THEN 0 ELSE 1 END AS is_primary_key,
+			CAST(td.value AS nvarchar(4000)) AS table_description, CAST(cd.value AS nvarchar(4000)) AS column_description
+		FROM (VALUES %s) AS r(position, schema_name, table_name)
+		JOIN INFORMATION_SCHEMA.COLUMNS c ON c.TABLE_SCHEMA = r.schema_name AND c.TABLE_NAME = r.table_name
+		LEFT JOIN (
+			SELECT k.TABLE_SCHEMA, k.TABLE_NAME, k.COLUMN_NAME
+			FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc
+			JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE k ON k.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA AND k.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+			WHERE tc.CONSTRAINT_TYPE = 'PRIMARY KEY'
+		) pk ON pk.TABLE_SCHEMA = c.TABLE_SCHEMA AND pk.TABLE_NAME = c.TABLE_NAME AND pk.COLUMN_NAME = c.COLUMN_NAME
+		LEFT JOIN sys.extended_properties td ON td.class = 1 AND td.name = 'MS_Description' AND td.minor_id = 0
+			AND td.major_id = OBJECT_ID(QUOTENAME(c.TABLE_SCHEMA) + '.' + QUOTENAME(c.TABLE_NAME))
+		LEFT JOIN sys.extended_properties cd ON cd.class = 1 AND cd.name = 'MS_Description'
+			AND cd.major_id = OBJECT_ID(QUOTENAME(c.TABLE_SCHEMA) + '.' + QUOTENAME(c.TABLE_NAME))
+			AND cd.minor_id = COLUMNPROPERTY(cd.major_id, c.COLUMN_NAME, 'ColumnId')
+		ORDER BY r.position, c.ORDINAL_POSITION`, strings.Join(requested, ", ")), true, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([][]map[string]interface{}, len(names))
+	for _, row := range data["rows"].([]map[string]interface{}) {
+		position, _ := row["position"].(int64)
+		columns[position] = append(columns[position], row)
+	}
+	return columns, nil
+}
+
+// describeDependencies renders the objects an object references and the
+// objects referencing it.
+func describeDependencies(schema, object string) (string, error) {
+	qualified := quoteIdentifier(schema) + "." + quoteIdentifier(object)
+
+	exists, err := executeQuery("SELECT OBJECT_ID(@p1) AS object_id", true, qualified)
+	if err != nil {
+		return "", err
+	}
+	if exists["rows"].([]map[string]interface{})[0]["object_id"] == nil {
+		return "", fmt.Errorf("object %s.%s not found", schema, object)
+	}
+
+	dependsOn, err := executeQuery(`SELECT
+			COALESCE(d.referenced_server_name + '.', '') + COALESCE(d.referenced_database_name + '.', '')
+				+ COALESCE(d.referenced_schema_name, OBJECT_SCHEMA_NAME(d.referenced_id), '') + '.' + d.referenced_entity_name AS name,
+			ISNULL(o.type_desc, CASE WHEN d.referenced_id IS NULL THEN 'UNRESOLVED' ELSE '' END) AS type,
+			d.referenced_minor_name AS column_name
+		FROM sys.sql_expression_dependencies d
+		LEFT JOIN sys.objects o ON o.object_id = d.referenced_id
+		WHERE d.referencing_id = OBJECT_ID(@p1)
+		ORDER BY name, column_name`, true, qualified)
+	if err != nil {
+		return "", err
+	}
+
+	referencedBy, err := executeQuery(`SELECT DISTINCT OBJECT_SCHEMA_NAME(d.referencing_id) + '.' + OBJECT_NAME(d.referencing_id) AS name, o.type_desc AS type
+		FROM sys.sql_expression_dependencies d
+		JOIN sys.objects o ON o.object_id = d.referencing_id
+		WHERE d.referenced_id = OBJECT_ID(@p1)
+		UNION
+		SELECT OBJECT_SCHEMA_NAME(fk.parent_object_id) + '.' + OBJECT_NAME(fk.parent_object_id), 'FOREIGN KEY ' + fk.name
+		FROM sys.foreign_keys fk
+		WHERE fk.referenced_object_id = OBJECT_ID(@p1) AND fk.parent_object_id <> fk.referenced_object_id
+		ORDER BY name`, true, qualified)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# Dependencies of %s.%s\n\n## Depends on\n\n", schema, object))
+	rows := dependsOn["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		result.WriteString("Nothing\n")
+	}
+
+	// Column-level references arrive one per row; list them under their object
+	for i := 0; i < len(rows); {
+		name := rows[i]["name"]
+		var columns []string
+		j := i
+		for ; j < len(rows) && rows[j]["name"] == name; j++ {
+			if rows[j]["column_name"] != nil {
+				columns = append(columns, fmt.Sprintf("%v", rows[j]["column_name"]))
+			}
+		}
+
+		result.WriteString(fmt.Sprintf("- %v (%v)", name, rows[i]["type"]))
+		if len(columns) > 0 {
+			result.WriteString(": " + strings.Join(columns, ", "))
+		}
+		result.WriteString("\n")
+		i = j
+	}
+
+	result.WriteString("\n## Referenced by\n\n")
+	rows = referencedBy["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		result.WriteString("Nothing\n")
+	}
+	for _, row := range rows {
+		result.WriteString(fmt.Sprintf("- %v (%v)\n", row["name"], row["type"]))
+	}
+	return result.String(), nil
+}
+
+// checkIdentifiers resolves every object a query references and reports
+// missing objects, with near-miss suggestions, and column names that need
+// brackets but are written bare.
+func checkIdentifiers(query string) (string, error) {
+	tokens := significantTokens(tokenizeSQL(query))
+
+	var objects, quoting []string
+	seen := make(map[string]bool)
+	for _, reference := range findObjectReferences(query) {
+		name := reference.Name()
+		if seen[strings.ToLower(name)] || reference.IsTemporary() {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+
+		if len(reference.Parts) > 2 {
+			objects = append(objects, fmt.Sprintf("- %s: not checked (cross-database reference)", name))
+			continue
+		}
+
+		quoted := make([]string, len(reference.Parts))
+		for i, part := range reference.Parts {
+			quoted[i] = quoteIdentifier(part)
+		}
+
+		data, err := executeQuery(`SELECT OBJECT_ID(@p1) AS object_id`, true, strings.Join(quoted, "."))
+		if err != nil {
+			return "", err
+		}
+		objectID := data["rows"].([]map[string]interface{})[0]["object_id"]
+		if objectID == nil {
+			objects = append(objects, fmt.Sprintf("- %s: NOT FOUND%s", name, suggestObjects(reference.Parts[len(reference.Parts)-1])))
+			continue
+		}
+		objects = append(objects, fmt.Sprintf("- %s: OK", name))
+
+		columns, err := executeQuery(`SELECT name FROM sys.columns WHERE object_id = @p1 ORDER BY column_id`, true, objectID)
+		if err != nil {
+			return "", err
+		}
+		for _, row := range columns["rows"].([]map[string]interface{}) {
+			column := fmt.Sprintf("%v", row["name"])
+			if !needsQuoting(column) || !isWrittenBare(tokens, column) {
+				continue
+			}
+			quoting = append(quoting, fmt.Sprintf("- column %q of %s must be written as %s", column, name, quoteIdentifier(column)))
+		}
+	}
+
+	var result strings.Builder
+	result.WriteString("Object references:\n")
+	if len(objects) == 0 {
+		result.WriteString("- none found\n")
+	}
+	result.WriteString(strings.Join(objects, "\n"))
+	if len(quoting) > 0 {
+		result.WriteString("\n\nQuoting issues:\n")
+		result.WriteString(strings.Join(quoting, "\n"))
+	}
+	return result.String(), nil
+}
+
+// isWrittenBare reports whether a column needing brackets appears unquoted in
+// the token stream: as a reserved word qualified by an alias (o.Order), or as
+// the leading words of a name containing spaces.
+func isWrittenBare(tokens []sqlToken, column string) bool {
+	words := strings.Fields(column)
+	for i := range tokens {
+		if len(words) == 1 {
+			if i > 0 && tokens[i-1].Text == "." && tokens[i].Kind == tokenWord && strings.EqualFold(tokens[i].Text, column) {
+				return true
+			}
+			continue
+		}
+
+		matched := i+len(words) <= len(tokens)
+		for j := 0; matched && j < len(words); j++ {
+			matched = tokens[i+j].Kind == tokenWord && strings.EqualFold(tokens[i+j].Text, words[j])
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestObjects lists objects whose names resemble a missing one.
+func suggestObjects(name string) string {
+	data, err := executeQuery(`SELECT TOP (5) SCHEMA_NAME(schema_id) + '.' + name AS name
+		FROM sys.objects
+		WHERE type IN ('U', 'V', 'IF', 'TF', 'SN') AND (name LIKE '%' + @p1 + '%' OR @p1 LIKE '%' + name + '%')
+		ORDER BY LEN(name)`, true, name)
+	if err != nil {
+		return ""
+	}
+
+	var names []string
+	for _, row := range data["rows"].([]map[string]interface{}) {
+		names = append(names, fmt.Sprintf("%v", row["name"]))
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return " (did you mean " + strings.Join(names, ", ") + "?)"
+}
+
+// describeTriggers renders the DML triggers of a table, or of every table and
+// view plus the database's DDL triggers when table is empty.
+func describeTriggers(schema, table string, includeDefinitions bool, filter listFilter) (string, error) {
+	query := `SELECT t.object_id,
+			CASE WHEN t.parent_class = 0 THEN 'DATABASE' ELSE OBJECT_SCHEMA_NAME(t.parent_id) + '.' + OBJECT_NAME(t.parent_id) END AS parent,
+			CASE WHEN t.parent_class = 0 THEN '' ELSE OBJECT_SCHEMA_NAME(t.object_id) + '.' END + t.name AS name,
+			t.parent_class_desc, t.is_disabled, t.is_instead_of_trigger, t.type_desc, m.definition
+		FROM sys.triggers t
+		LEFT JOIN sys.sql_modules m ON m.object_id = t.object_id
+		WHERE t.is_ms_shipped = 0`
+	var args []interface{}
+	if table != "" {
+		query += " AND t.parent_id = OBJECT_ID(@p1)"
+		args = append(args, quoteIdentifier(schema)+"."+quoteIdentifier(table))
+	}
+	// Database DDL triggers belong to no schema
+	conditions, args := filter.conditions("OBJECT_SCHEMA_NAME(t.object_id)", "t.name", args)
+	query += conditions + " ORDER BY t.parent_class DESC, parent, name" + filter.paging()
+
+	triggers, err := executeQuery(query, true, args...)
+	if err != nil {
+		return "", err
+	}
+
+	events, err := executeQuery(`SELECT te.object_id, te.type_desc
+		FROM sys.trigger_events te
+		JOIN sys.triggers t ON t.object_id = te.object_id
+		WHERE t.is_ms_shipped = 0
+		ORDER BY te.object_id, te.type`, true)
+	if err != nil {
+		return "", err
+	}
+	eventsByTrigger := make(map[string][]string)
+	for _, row := range events["rows"].([]map[string]interface{}) {
+		id := fmt.Sprintf("%v", row["object_id"])
+		eventsByTrigger[id] = append(eventsByTrigger[id], fmt.Sprintf("%v", row["type_desc"]))
+	}
+
+	note := filter.page(triggers)
+	rows := triggers["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		if note != "" {
+			return note, nil
+		}
+		if table != "" {
+			return fmt.Sprintf("No triggers on %s.%s", schema, table), nil
+		}
+		return "No triggers found", nil
+	}
+
+	var result strings.Builder
+	var parent interface{}
+	for _, row := range rows {
+		if row["parent"] != parent {
+			parent = row["parent"]
+			if parent == "DATABASE" {
+				result.WriteString("# Database DDL triggers\n\n")
+			} else {
+				result.WriteString(fmt.Sprintf("# Triggers on %v\n\n", parent))
+			}
+		}
+
+		timing := "AFTER"
+		if row["is_instead_of_trigger"] == true {
+			timing = "INSTEAD OF"
+		}
+		state := "enabled"
+		if row["is_disabled"] == true {
+			state = "DISABLED"
+		}
+		result.WriteString(fmt.Sprintf("## %v\n", row["name"]))
+		result.WriteString(fmt.Sprintf("- Fires: %s %s\n", timing, strings.Join(eventsByTrigger[fmt.Sprintf("%v", row["object_id"])], ", ")))
+		result.WriteString(fmt.Sprintf("- State: %s\n", state))
+		if row["type_desc"] == "CLR_TRIGGER" {
+			result.WriteString("- Implemented in a CLR assembly\n")
+		}
+
+		if includeDefinitions {
+			if row["definition"] == nil {
+				result.WriteString("\nDefinition not available (encrypted, CLR or no VIEW DEFINITION permission)\n")
+			} else {
+				result.WriteString(fmt.Sprintf("\n```sql\n%v\n```\n", strings.TrimSpace(fmt.Sprintf("%v", row["definition"]))))
+			}
+		}
+		result.WriteString("\n")
+	}
+	result.WriteString(note)
+	return strings.TrimRight(result.String(), "\n") + "\n", nil
+}
+
+// describeConstraints renders the key, check and default constraints of a
+// table.
+func describeConstraints(schema, table string) (string, error) {
+	qualified := quoteIdentifier(schema) + "." + quoteIdentifier(table)
+
+	exists, err := executeQuery("SELECT OBJECT_ID(@p1, 'U') AS object_id", true, qualified)
+	if err != nil {
+		return "", err
+	}
+	if exists["rows"].([]map[string]interface{})[0]["object_id"] == nil {
+		return "", fmt.Errorf("table %s.%s not found", schema, table)
+	}
+
+	keys, err := executeQuery(`SELECT kc.name, kc.type_desc, i.type_desc AS index_type, c.name AS column_name, ic.is_descending_key
+		FROM sys.key_constraints kc
+		JOIN sys.indexes i ON i.object_id = kc.parent_object_id AND i.index_id = kc.unique_index_id
+		JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id AND ic.is_included_column = 0
+		JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+		WHERE kc.parent_object_id = OBJECT_ID(@p1)
+		ORDER BY kc.type, kc.name, ic.key_ordinal`, true, qualified)
+	if err != nil {
+		return "", err
+	}
+
+	checks, err := executeQuery(`SELECT cc.name, COL_NAME(cc.parent_object_id, cc.parent_column_id) AS column_name,
+			cc.definition, cc.is_disabled, cc.is_not_trusted
+		FROM sys.check_constraints cc
+		WHERE cc.parent_object_id = OBJECT_ID(@p1)
+		ORDER BY cc.name`, true, qualified)
+	if err != nil {
+		return "", err
+	}
+
+	defaults, err := executeQuery(`SELECT dc.name, COL_NAME(dc.parent_object_id, dc.parent_column_id) AS column_name, dc.definition
+		FROM sys.default_constraints dc
+		WHERE dc.parent_object_id = OBJECT_ID(@p1)
+		ORDER BY column_name`, true, qualified)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("# Constraints of %s.%s\n\n## Primary key and unique constraints\n\n", schema, table))
+	rows := keys["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		result.WriteString("None (the table has no primary key)\n")
+	}
+
+	// Key columns arrive one per row; list them under their constraint
+	for i := 0; i < len(rows); {
+		name := rows[i]["name"]
+		var columns []string
+		j := i
+		for ; j < len(rows) && rows[j]["name"] == name; j++ {
+			column := fmt.Sprintf("%v", rows[j]["column_name"])
+			if rows[j]["is_descending_key"] == true {
+				column += " DESC"
+			}
+			columns = append(columns, column)
+		}
+
+		kind := "UNIQUE"
+		if rows[i]["type_desc"] == "PRIMARY_KEY_CONSTRAINT" {
+			kind = "PRIMARY KEY"
+		}
+		result.WriteString(fmt.Sprintf("- %v: %s %v (%s)\n", name, kind, rows[i]["index_type"], strings.Join(columns, ", ")))
+		i = j
+	}
+
+	result.WriteString("\n## Check constraints\n\n")
+	rows = checks["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		result.WriteString("None\n")
+	}
+	for _, row := range rows {
+		scope := "table"
+		if row["column_name"] != nil {
+			scope = fmt.Sprintf("column %v", row["column_name"])
+		}
+		result.WriteString(fmt.Sprintf("- %v (%s): %v", row["name"], scope, row["definition"]))
+		if row["is_disabled"] == true {
+			result.WriteString(" [DISABLED]")
+		} else if row["is_not_trusted"] == true {
+			result.WriteString(" [NOT TRUSTED: existing rows may violate it]")
+		}
+		result.WriteString("\n")
+	}
+
+	result.WriteString("\n## Defaults\n\n")
+	rows = defaults["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		result.WriteString("None\n")
+	}
+	for _, row := range rows {
+		result.WriteString(fmt.Sprintf("- %v = %v (%v)\n", row["column_name"], row["definition"], row["name"]))
+	}
+	return result.String(), nil
+}
+
+// resolveObjectName parses an object name given in a tool argument and
+// matches it against the catalog; see resolveObjectNames.
+func resolveObjectName(name string) (string, string, error) {
+	resolved, err := resolveObjectNames([]string{name})
+	if err != nil {
+		return "", "", err
+	}
+	return resolved[0][0], resolved[0][1], nil
+}
+
+// resolveObjectNames parses object names given in tool arguments, bracketed
+// or not, and matches them against the catalog with one query, so that
+// orders finds dbo.Orders even in a database with a case-sensitive
+// collation. A match equal under the database collation wins over one
+// differing only in case, and an unqualified name prefers dbo but is also
+// looked up in other schemas. Names matching several objects equally well
+// are reported as ambiguous; names matching none are returned as parsed.
+func resolveObjectNames(names []string) ([][2]string, error) {
+	resolved := make([][2]string, len(names))
+	qualified := make([]bool, len(names))
+	var requested []string
+	var args []interface{}
+	for i, name := range names {
+		schema, object, err := parseObjectName(name)
+		if err != nil {
+			return nil, err
+		}
+		resolved[i] = [2]string{schema, object}
+
+		// parseObjectName defaults the schema; an explicit one follows a dot
+		var requestedSchema interface{}
+		if isQualifiedName(name) {
+			qualified[i] = true
+			requestedSchema = schema
+		}
+		requested = append(requested, fmt.Sprintf("(%d, CAST(@p%d AS sysname), CAST(@p%d AS sysname))", i, 2*i+1, 2*i+2))
+		args = append(args, requestedSchema, object)
+	}
+
+	data, err := executeQuery(fmt.Sprintf(`SELECT r.position, s.name AS schema_name, o.name AS object_name,
+			CASE WHEN o.name = r.object_name THEN 2 ELSE 0 END
+				+ CASE WHEN s.name = ISNULL(r.schema_name, N'dbo') THEN 1 ELSE 0 END AS score
+		FROM (VALUES %s) AS r(position, schema_name, object_name)
+		JOIN sys.objects o ON UPPER(o.name) = UPPER(r.object_name) AND o.parent_object_id = 0
+		JOIN sys.schemas s ON s.schema_id = o.schema_id AND (r.schema_name IS NULL OR UPPER(s.name) = UPPER(r.schema_name))
+		ORDER BY r.position, score DESC, s.name, o.name`, strings.Join(requested, ", ")), true, args...)
+	if err != nil {
+		// Callers look the names up themselves and report what is wrong
+		log.Printf("Error resolving object names: %v", err)
+		return resolved, checkResolvedAccess(resolved)
+	}
+
+	best := make([][]string, len(names))
+	bestScore := make([]int64, len(names))
+	for _, row := range data["rows"].([]map[string]interface{}) {
+		position, _ := row["position"].(int64)
+		score, _ := row["score"].(int64)
+		match := fmt.Sprintf("%v.%v", row["schema_name"], row["object_name"])
+		switch {
+		case len(best[position]) == 0 || score > bestScore[position]:
+			best[position], bestScore[position] = []string{match}, score
+			resolved[position] = [2]string{fmt.Sprintf("%v", row["schema_name"]), fmt.Sprintf("%v", row["object_name"])}
+		case score == bestScore[position]:
+			best[position] = append(best[position], match)
+		}
+	}
+	for i, matches := range best {
+		if len(matches) > 1 {
+			hint := "qualify it with its schema"
+			if qualified[i] {
+				hint = "give it in the exact case"
+			}
+			return nil, fmt.Errorf("%q matches several objects (%s); %s", names[i], strings.Join(matches, ", "), hint)
+		}
+	}
+	return resolved, checkResolvedAccess(resolved)
+}
+
+// checkResolvedAccess refuses object names given to tools that the object
+// access policy does not permit.
+func checkResolvedAccess(resolved [][2]string) error {
+	config, err := getDbConfig()
+	if err != nil {
+		return err
+	}
+	for _, name := range resolved {
+		if !objectAccessible(config, name[0], name[1]) {
+			return fmt.Errorf("%s is not accessible under the object access policy (MSSQL_ALLOWED_OBJECTS, MSSQL_DENIED_OBJECTS)", formatObjectName(name[0], name[1]))
+		}
+	}
+	return nil
+}
+
+// isQualifiedName reports whether an object name names its schema.
+func isQualifiedName(name string) bool {
+	for _, t := range tokenizeSQL(name) {
+		if t.Text == "." {
+			return true
+		}
+	}
+	return false
+}
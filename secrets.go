@@ -0,0 +1,314 @@
+package mssqlmcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Seconds credentials from a secret provider are reused before being read again
+const DEFAULT_SECRET_CACHE_SECONDS = 300
+
+// Time allowed for a secret provider to answer
+const SECRET_PROVIDER_TIMEOUT = 10 * time.Second
+
+// Credentials are what the server logs in with. A provider may leave User
+// empty, in which case MSSQL_USER is used.
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// SecretProvider acquires database credentials, e.g. from the environment,
+// a mounted file or a secret store. Providers read their own settings from
+// the environment when created.
+type SecretProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+var (
+	secretProvidersMu sync.Mutex
+	secretProviders   = make(map[string]func() (SecretProvider, error))
+	// Credentials by provider name, with when they were read
+	cachedCredentials = make(map[string]Credentials)
+	credentialsReadAt = make(map[string]time.Time)
+	// Concurrent reads from one provider share a single request
+	credentialsReads singleflight.Group
+)
+
+// RegisterSecretProvider makes a provider selectable by name through
+// MSSQL_SECRET_PROVIDER. Call it from an init function.
+func RegisterSecretProvider(name string, create func() (SecretProvider, error)) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[strings.ToLower(name)] = create
+}
+
+func init() {
+	RegisterSecretProvider("env", func() (SecretProvider, error) { return envSecretProvider{}, nil })
+	RegisterSecretProvider("file", newFileSecretProvider)
+	RegisterSecretProvider("keyvault", newKeyVaultSecretProvider)
+	RegisterSecretProvider("vault", newVaultSecretProvider)
+	RegisterSecretProvider("aws", newAWSSecretProvider)
+}
+
+// loadCredentials returns the credentials of the named provider, reading
+// them again once they are older than MSSQL_SECRET_CACHE_SECONDS so rotated
+// secrets are picked up.
+func loadCredentials(name string) (Credentials, error) {
+	name = strings.ToLower(name)
+	ttl := time.Duration(getEnvIntOrDefault("MSSQL_SECRET_CACHE_SECONDS", DEFAULT_SECRET_CACHE_SECONDS)) * time.Second
+
+	secretProvidersMu.Lock()
+	credentials, cached := cachedCredentials[name]
+	fresh := cached && time.Since(credentialsReadAt[name]) < ttl
+	create, ok := secretProviders[name]
+	secretProvidersMu.Unlock()
+	if fresh {
+		return credentials, nil
+	}
+	if !ok {
+		return Credentials{}, fmt.Errorf("unknown secret provider %q", name)
+	}
+
+	// A provider may take SECRET_PROVIDER_TIMEOUT to answer, so it is asked
+	// without holding the lock
+	value, err, _ := credentialsReads.Do(name, func() (interface{}, error) {
+		provider, err := create()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), SECRET_PROVIDER_TIMEOUT)
+		defer cancel()
+		credentials, err := provider.Credentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		secretProvidersMu.Lock()
+		cachedCredentials[name], credentialsReadAt[name] = credentials, time.Now()
+		secretProvidersMu.Unlock()
+		return credentials, nil
+	})
+	if err != nil {
+		return Credentials{}, err
+	}
+	return value.(Credentials), nil
+}
+
+// forgetCredentials drops cached credentials, e.g. after a failed login,
+// so the next connection reads them from their provider again.
+func forgetCredentials() {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	cachedCredentials = make(map[string]Credentials)
+	credentialsReadAt = make(map[string]time.Time)
+}
+
+// parseSecretValue reads a secret holding either the password alone or a
+// JSON object with "username" and "password", as secret stores commonly
+// keep database logins.
+func parseSecretValue(value string) Credentials {
+	var login struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal([]byte(value), &login); err == nil && login.Password != "" {
+		return Credentials{User: login.Username, Password: login.Password}
+	}
+	return Credentials{Password: value}
+}
+
+// envSecretProvider reads MSSQL_USER and MSSQL_PASSWORD.
+type envSecretProvider struct{}
+
+func (envSecretProvider) Credentials(ctx context.Context) (Credentials, error) {
+	return Credentials{User: os.Getenv("MSSQL_USER"), Password: os.Getenv("MSSQL_PASSWORD")}, nil
+}
+
+// fileSecretProvider reads the password, and optionally the user, from files
+// such as Docker or Kubernetes secrets (MSSQL_PASSWORD_FILE, MSSQL_USER_FILE).
+type fileSecretProvider struct {
+	userFile     string
+	passwordFile string
+}
+
+func newFileSecretProvider() (SecretProvider, error) {
+	provider := fileSecretProvider{
+		userFile:     os.Getenv("MSSQL_USER_FILE"),
+		passwordFile: os.Getenv("MSSQL_PASSWORD_FILE"),
+	}
+	if provider.passwordFile == "" {
+		return nil, errors.New("the file secret provider needs MSSQL_PASSWORD_FILE")
+	}
+	return provider, nil
+}
+
+func (p fileSecretProvider) Credentials(ctx context.Context) (Credentials, error) {
+	var credentials Credentials
+	password, err := os.ReadFile(p.passwordFile)
+	if err != nil {
+		return credentials, err
+	}
+	// Editors and echo leave a trailing line break
+	credentials.Password = strings.TrimRight(string(password), "\r\n")
+
+	if p.userFile != "" {
+		user, err := os.ReadFile(p.userFile)
+		if err != nil {
+			return credentials, err
+		}
+		credentials.User = strings.TrimSpace(string(user))
+	}
+	return credentials, nil
+}
+
+// keyVaultSecretProvider reads a secret from Azure Key Vault
+// (MSSQL_KEYVAULT_URL, MSSQL_KEYVAULT_SECRET) with a token of the managed
+// identity the server runs under.
+type keyVaultSecretProvider struct {
+	vaultURL string
+	secret   string
+}
+
+func newKeyVaultSecretProvider() (SecretProvider, error) {
+	provider := keyVaultSecretProvider{
+		vaultURL: strings.TrimRight(os.Getenv("MSSQL_KEYVAULT_URL"), "/"),
+		secret:   os.Getenv("MSSQL_KEYVAULT_SECRET"),
+	}
+	if provider.vaultURL == "" || provider.secret == "" {
+		return nil, errors.New("the keyvault secret provider needs MSSQL_KEYVAULT_URL and MSSQL_KEYVAULT_SECRET")
+	}
+	return provider, nil
+}
+
+func (p keyVaultSecretProvider) Credentials(ctx context.Context) (Credentials, error) {
+	token, err := managedIdentityToken(ctx, "https://vault.azure.net")
+	if err != nil {
+		return Credentials{}, fmt.Errorf("getting managed identity token: %v", err)
+	}
+
+	var secret struct {
+		Value string `json:"value"`
+	}
+	secretURL := fmt.Sprintf("%s/secrets/%s?api-version=7.4", p.vaultURL, url.PathEscape(p.secret))
+	headers := map[string]string{"Authorization": "Bearer " + token}
+	if err := getSecretJSON(ctx, secretURL, headers, &secret); err != nil {
+		return Credentials{}, fmt.Errorf("reading secret %s: %v", p.secret, err)
+	}
+	return parseSecretValue(secret.Value), nil
+}
+
+// managedIdentityToken gets an access token for a resource from the App
+// Service / Container Apps identity endpoint when present, or else from the
+// Azure instance metadata service.
+func managedIdentityToken(ctx context.Context, resource string) (string, error) {
+	query := url.Values{"resource": {resource}}
+	if clientID := os.Getenv("AZURE_CLIENT_ID"); clientID != "" {
+		query.Set("client_id", clientID)
+	}
+
+	endpoint := "http://169.254.169.254/metadata/identity/oauth2/token"
+	headers := map[string]string{"Metadata": "true"}
+	query.Set("api-version", "2018-02-01")
+	if identityEndpoint := os.Getenv("IDENTITY_ENDPOINT"); identityEndpoint != "" {
+		endpoint = identityEndpoint
+		headers = map[string]string{"X-IDENTITY-HEADER": os.Getenv("IDENTITY_HEADER")}
+		query.Set("api-version", "2019-08-01")
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := getSecretJSON(ctx, endpoint+"?"+query.Encode(), headers, &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// vaultSecretProvider reads credentials from HashiCorp Vault (VAULT_ADDR,
+// VAULT_TOKEN, optionally VAULT_NAMESPACE) at MSSQL_VAULT_PATH. Both KV
+// secrets with "username" and "password" fields and the dynamic logins of
+// the database secrets engine (database/creds/<role>) work.
+type vaultSecretProvider struct {
+	address   string
+	token     string
+	namespace string
+	path      string
+}
+
+func newVaultSecretProvider() (SecretProvider, error) {
+	provider := vaultSecretProvider{
+		address:   strings.TrimRight(os.Getenv("VAULT_ADDR"), "/"),
+		token:     os.Getenv("VAULT_TOKEN"),
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		path:      strings.Trim(os.Getenv("MSSQL_VAULT_PATH"), "/"),
+	}
+	if provider.address == "" || provider.token == "" || provider.path == "" {
+		return nil, errors.New("the vault secret provider needs VAULT_ADDR, VAULT_TOKEN and MSSQL_VAULT_PATH")
+	}
+	return provider, nil
+}
+
+func (p vaultSecretProvider) Credentials(ctx context.Context) (Credentials, error) {
+	headers := map[string]string{"X-Vault-Token": p.token}
+	if p.namespace != "" {
+		headers["X-Vault-Namespace"] = p.namespace
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := getSecretJSON(ctx, p.address+"/v1/"+p.path, headers, &secret); err != nil {
+		return Credentials{}, fmt.Errorf("reading %s: %v", p.path, err)
+	}
+	// KV version 2 nests the fields in a second data object
+	fields := secret.Data
+	if nested, ok := fields["data"].(map[string]interface{}); ok {
+		fields = nested
+	}
+
+	user, _ := fields["username"].(string)
+	password, _ := fields["password"].(string)
+	if password == "" {
+		return Credentials{}, fmt.Errorf("%s has no password field", p.path)
+	}
+	return Credentials{User: user, Password: password}, nil
+}
+
+// getSecretJSON sends a GET request to a secret store or credential
+// endpoint and decodes the JSON body of a successful response.
+func getSecretJSON(ctx context.Context, target string, headers map[string]string, result interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", response.Status, truncateString(strings.TrimSpace(string(body)), 200))
+	}
+	return json.Unmarshal(body, result)
+}
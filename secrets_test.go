@@ -0,0 +1,128 @@
+package mssqlmcp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubSecretProvider answers once release is closed, counting its reads.
+type stubSecretProvider struct {
+	reads   *atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p stubSecretProvider) Credentials(ctx context.Context) (Credentials, error) {
+	p.reads.Add(1)
+	if p.started != nil {
+		p.started <- struct{}{}
+	}
+	<-p.release
+	return Credentials{User: "reader", Password: "secret"}, nil
+}
+
+func registerStubProvider(t *testing.T, name string, provider stubSecretProvider) {
+	t.Helper()
+	RegisterSecretProvider(name, func() (SecretProvider, error) { return provider, nil })
+	t.Cleanup(func() {
+		secretProvidersMu.Lock()
+		delete(secretProviders, name)
+		secretProvidersMu.Unlock()
+		forgetCredentials()
+	})
+}
+
+func TestLoadCredentialsConcurrently(t *testing.T) {
+	t.Setenv("MSSQL_SECRET_CACHE_SECONDS", "300")
+
+	var slowReads, fastReads atomic.Int32
+	slow := stubSecretProvider{reads: &slowReads, started: make(chan struct{}, 2), release: make(chan struct{})}
+	fast := stubSecretProvider{reads: &fastReads, release: make(chan struct{})}
+	close(fast.release)
+	registerStubProvider(t, "test-slow", slow)
+	registerStubProvider(t, "test-fast", fast)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := loadCredentials("test-slow"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	<-slow.started
+
+	// A slow provider holds up neither other providers nor the cache
+	done := make(chan error, 1)
+	go func() {
+		_, err := loadCredentials("test-fast")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("loadCredentials waited for another provider's read")
+	}
+
+	close(slow.release)
+	wg.Wait()
+	if n := slowReads.Load(); n != 1 {
+		t.Errorf("concurrent loads read the provider %d times, want 1", n)
+	}
+}
+
+func TestAWSSecretProvider(t *testing.T) {
+	var authorization, target string
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization, target = r.Header.Get("Authorization"), r.Header.Get("X-Amz-Target")
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		io.WriteString(w, `{"Name": "db", "SecretString": "{\"username\": \"admin\", \"password\": \"s3cret\"}"}`)
+	}))
+	defer endpoint.Close()
+
+	for name, value := range map[string]string{
+		"MSSQL_AWS_SECRET_ID":         "arn:aws:secretsmanager:eu-west-1:123456789012:secret:db",
+		"MSSQL_AWS_ENDPOINT":          endpoint.URL,
+		"AWS_ACCESS_KEY_ID":           "AKIDEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY":       "secret",
+		"AWS_REGION":                  "",
+		"AWS_DEFAULT_REGION":          "",
+		"AWS_PROFILE":                 "",
+		"AWS_CONFIG_FILE":             filepath.Join(t.TempDir(), "config"),
+		"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(t.TempDir(), "credentials"),
+	} {
+		t.Setenv(name, value)
+	}
+
+	provider, err := newAWSSecretProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials, err := provider.Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials != (Credentials{User: "admin", Password: "s3cret"}) {
+		t.Errorf("credentials = %+v, want admin/s3cret", credentials)
+	}
+	if target != "secretsmanager.GetSecretValue" {
+		t.Errorf("X-Amz-Target = %q, want secretsmanager.GetSecretValue", target)
+	}
+	// The region comes from the ARN when the environment names none
+	if !strings.Contains(authorization, "/eu-west-1/secretsmanager/aws4_request") {
+		t.Errorf("Authorization = %q, want a SigV4 signature for eu-west-1", authorization)
+	}
+}
@@ -0,0 +1,306 @@
+package mssqlmcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Roles whose membership decides what the login can do beyond the tools'
+// own restrictions
+var reportedRoles = []string{"db_owner", "db_datareader", "db_datawriter", "db_ddladmin", "db_securityadmin"}
+
+// registerSecurityTools adds a tool summarizing the server's effective
+// security configuration for review.
+func registerSecurityTools(s *server.MCPServer) {
+	reportTool := mcp.NewTool("security_report",
+		mcp.WithDescription("Compile the effective security configuration of this server into one document for auditors: transport and authentication, the login's permissions, the tools enabled, the policies applied to queries, masking and where activity is recorded. Nothing is changed."),
+	)
+
+	s.AddTool(reportTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+
+		var report strings.Builder
+		report.WriteString(fmt.Sprintf("# Security report for %s/%s\n\n", config.Server, config.Database))
+		writeTransportSection(&report, config)
+		writePermissionsSection(&report, config)
+		writeToolsSection(ctx, &report, s)
+		writePolicySection(&report, config)
+		writeMaskingSection(&report, config)
+		writeAuditSection(&report, config)
+		return mcp.NewToolResultText(report.String()), nil
+	})
+}
+
+// reportLine writes a "- **name:** value" line.
+func reportLine(report *strings.Builder, name string, value interface{}) {
+	report.WriteString(fmt.Sprintf("- **%s:** %v\n", name, value))
+}
+
+func writeTransportSection(report *strings.Builder, config *DbConfig) {
+	report.WriteString("## Transport and authentication\n\n")
+	reportLine(report, "MCP transport", "stdio; no network listener, so access is limited to whoever can start the process")
+	host := config.Server
+	if config.Port > 0 {
+		host = fmt.Sprintf("%s:%d", host, config.Port)
+	}
+	if config.CloudSQLInstance != "" {
+		host = fmt.Sprintf("Cloud SQL instance %s (%s IP, connector TLS)", config.CloudSQLInstance, config.CloudSQLIPType)
+	}
+	reportLine(report, "Database server", host)
+	reportLine(report, "Login", config.User)
+	reportLine(report, "Credentials from", config.SecretProvider)
+
+	encryption := map[string]string{
+		"true":    "TLS for the whole connection",
+		"false":   "TLS for the login only",
+		"disable": "none",
+	}[config.Encrypt]
+	reportLine(report, "Encryption (MSSQL_ENCRYPT)", encryption)
+	switch {
+	case config.Encrypt == "disable":
+	case config.TrustServerCert:
+		reportLine(report, "Server certificate", "NOT verified (MSSQL_TRUST_SERVER_CERTIFICATE)")
+	case config.CACertificate != "":
+		reportLine(report, "Server certificate", "verified against "+config.CACertificate)
+	default:
+		reportLine(report, "Server certificate", "verified against the system roots")
+	}
+	report.WriteString("\n")
+}
+
+func writePermissionsSection(report *strings.Builder, config *DbConfig) {
+	report.WriteString("## Login permissions\n\n")
+	if config.CassetteMode == cassetteReplay {
+		report.WriteString("Not available: queries are replayed from a cassette.\n\n")
+		return
+	}
+
+	var roles []string
+	for _, role := range reportedRoles {
+		roles = append(roles, fmt.Sprintf("IS_ROLEMEMBER(%s) AS %s", quoteString(role), quoteIdentifier(role)))
+	}
+	identity, err := executeQuery(fmt.Sprintf(`SELECT SUSER_SNAME() AS login_name, USER_NAME() AS user_name,
+			IS_SRVROLEMEMBER('sysadmin') AS sysadmin, %s`, strings.Join(roles, ", ")), true)
+	if err != nil {
+		report.WriteString(fmt.Sprintf("Could not be read: %v\n\n", err))
+		return
+	}
+	if rows, _ := identity["rows"].([]map[string]interface{}); len(rows) > 0 {
+		row := rows[0]
+		reportLine(report, "Server login", row["login_name"])
+		reportLine(report, "Database user", row["user_name"])
+		var memberOf []string
+		if fmt.Sprintf("%v", row["sysadmin"]) == "1" {
+			memberOf = append(memberOf, "sysadmin (unrestricted on the whole server)")
+		}
+		for _, role := range reportedRoles {
+			if fmt.Sprintf("%v", row[role]) == "1" {
+				memberOf = append(memberOf, role)
+			}
+		}
+		if len(memberOf) == 0 {
+			memberOf = append(memberOf, "none of sysadmin, "+strings.Join(reportedRoles, ", "))
+		}
+		reportLine(report, "Roles", strings.Join(memberOf, ", "))
+	}
+
+	permissions, err := executeQuery(`SELECT permission_name FROM fn_my_permissions(NULL, 'DATABASE') ORDER BY permission_name`, true)
+	if err != nil {
+		reportLine(report, "Database permissions", fmt.Sprintf("could not be read: %v", err))
+	} else {
+		rows, _ := permissions["rows"].([]map[string]interface{})
+		var names []string
+		for _, row := range rows {
+			names = append(names, fmt.Sprintf("%v", row["permission_name"]))
+		}
+		reportLine(report, "Database permissions", strings.Join(names, ", "))
+	}
+	report.WriteString("\n")
+}
+
+// writeToolsSection lists the tools clients are offered, as the server itself
+// reports them.
+func writeToolsSection(ctx context.Context, report *strings.Builder, s *server.MCPServer) {
+	report.WriteString("## Enabled tools\n\n")
+	message := s.HandleMessage(ctx, json.RawMessage(`{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`))
+	response, ok := message.(mcp.JSONRPCResponse)
+	if !ok {
+		report.WriteString("Could not be listed.\n\n")
+		return
+	}
+	var tools []mcp.Tool
+	switch result := response.Result.(type) {
+	case mcp.ListToolsResult:
+		tools = result.Tools
+	case *mcp.ListToolsResult:
+		tools = result.Tools
+	}
+	if len(tools) == 0 {
+		report.WriteString("Could not be listed.\n\n")
+		return
+	}
+	for _, tool := range tools {
+		note := ""
+		switch tool.Name {
+		case "execute_write", "bulk_insert", "upsert":
+			note = " (changes data; MSSQL_ALLOW_WRITE)"
+		}
+		report.WriteString(fmt.Sprintf("- %s%s\n", tool.Name, note))
+	}
+	report.WriteString("\n")
+}
+
+func writePolicySection(report *strings.Builder, config *DbConfig) {
+	report.WriteString("## Query policies\n\n")
+	switch {
+	case config.AllowWrite && len(config.WritableTables) > 0:
+		reportLine(report, "Writes", "allowed through execute_write on tables matching MSSQL_WRITABLE_TABLES only: "+strings.Join(config.WritableTables, ", "))
+	case config.AllowWrite:
+		reportLine(report, "Writes", "allowed through execute_write; execute_sql stays read-only")
+	default:
+		reportLine(report, "Writes", "refused; execute_sql is read-only and execute_write is not offered")
+	}
+	switch {
+	case config.AllowWrite && len(config.WritableTables) == 0:
+		reportLine(report, "Stored procedures", "any can be called through call_procedure")
+	case len(config.AllowedProcedures) > 0:
+		reportLine(report, "Stored procedures", "callable through call_procedure: "+strings.Join(config.AllowedProcedures, ", "))
+	default:
+		reportLine(report, "Stored procedures", "none can be called")
+	}
+	if config.AllowWrite {
+		if config.UnfilteredWrites {
+			reportLine(report, "UPDATE and DELETE without WHERE", "allowed (MSSQL_ALLOW_UNFILTERED_WRITES)")
+		} else {
+			reportLine(report, "UPDATE and DELETE without WHERE", "refused")
+		}
+		if config.MaxAffectedRows > 0 {
+			reportLine(report, "Rows one UPDATE or DELETE may change", fmt.Sprintf("%d; statements changing more are rolled back", config.MaxAffectedRows))
+		}
+	}
+	switch {
+	case config.ReadOnlyUser != "" && config.VerifyReadOnly:
+		reportLine(report, "Database session", fmt.Sprintf("runs as read-only user %s, verified at startup to have no write permissions", config.ReadOnlyUser))
+	case config.ReadOnlyUser != "":
+		reportLine(report, "Database session", fmt.Sprintf("runs as read-only user %s (EXECUTE AS ... WITH NO REVERT)", config.ReadOnlyUser))
+	case config.VerifyReadOnly && !config.AllowWrite:
+		reportLine(report, "Database session", "verified at startup to have no write permissions")
+	case !config.AllowWrite:
+		reportLine(report, "Database session", "not checked; only the client-side checks keep it read-only (MSSQL_VERIFY_READ_ONLY, MSSQL_READ_ONLY_USER)")
+	}
+	if len(config.AllowedObjects) > 0 {
+		reportLine(report, "Objects queries may reference (MSSQL_ALLOWED_OBJECTS)", strings.Join(config.AllowedObjects, ", ")+", and the sys and INFORMATION_SCHEMA catalog views")
+	}
+	if len(config.DeniedObjects) > 0 {
+		reportLine(report, "Objects queries may not reference (MSSQL_DENIED_OBJECTS)", strings.Join(config.DeniedObjects, ", "))
+	}
+	reportLine(report, "External data (MSSQL_EXTERNAL_DATA_POLICY)", config.ExternalDataPolicy)
+	if policy, err := loadQueryPolicy(config); err != nil {
+		reportLine(report, "Query policy (MSSQL_QUERY_POLICY_FILE)", fmt.Sprintf("could not be loaded, every query is refused: %v", err))
+	} else if policy != nil {
+		reportLine(report, "Query policy (MSSQL_QUERY_POLICY_FILE)", fmt.Sprintf("%d allow and %d deny patterns", len(policy.allow), len(policy.deny)))
+	}
+	reportLine(report, "Query hints allowed", strings.Join(config.AllowedQueryHints, ", "))
+	reportLine(report, "USE HINT names allowed", strings.Join(config.AllowedUseHints, ", "))
+	reportLine(report, "Rows returned per query", config.MaxRows)
+	reportLine(report, "Query timeout", fmt.Sprintf("%d seconds", config.QueryTimeout))
+	if config.SessionTimeBudget > 0 {
+		reportLine(report, "Database time per session", fmt.Sprintf("%d seconds, then further calls wait for the user to confirm through continue_exploration", config.SessionTimeBudget))
+	}
+	joinGuard := "warns"
+	if config.JoinGuardStrict {
+		joinGuard = "blocks"
+	}
+	reportLine(report, "Join explosion guard", fmt.Sprintf("%s above %d estimated rows", joinGuard, config.JoinGuardRows))
+	if config.TenancyModel != "" {
+		tenancy := fmt.Sprintf("%s tenancy", config.TenancyModel)
+		if config.TenancyModel == tenancyColumn {
+			tenancy += fmt.Sprintf(" on column %s", config.TenantColumn)
+		}
+		if config.Tenant != "" {
+			tenancy += fmt.Sprintf(", pinned to tenant %s", config.Tenant)
+		} else {
+			tenancy += ", tenant chosen by the caller"
+		}
+		if len(config.SharedSchemas) > 0 {
+			tenancy += fmt.Sprintf("; shared schemas %s", strings.Join(config.SharedSchemas, ", "))
+		}
+		reportLine(report, "Tenant isolation", tenancy)
+	} else {
+		reportLine(report, "Tenant isolation", "off")
+	}
+	reportLine(report, "Soft-deleted rows filtered", onOff(config.SoftDeleteFilter))
+	if config.SessionInitSQL != "" {
+		reportLine(report, "Session options", config.SessionInitSQL)
+	}
+	reportLine(report, "Sticky sessions and transactions", onOff(config.StickySessions))
+	if config.QueryFileRoot != "" {
+		reportLine(report, "Query files readable under", config.QueryFileRoot)
+	} else {
+		reportLine(report, "Query files", "refused (no MSSQL_QUERY_FILE_ROOT)")
+	}
+	if config.ExportRoot != "" {
+		reportLine(report, "Exports written under", config.ExportRoot)
+	}
+	if config.ImportRoot != "" {
+		reportLine(report, "Files loadable by bulk_insert under", config.ImportRoot)
+	}
+	reportLine(report, "Exports needing confirmation", fmt.Sprintf("over %d rows or %d bytes", config.ExportConfirmRows, config.ExportConfirmBytes))
+	report.WriteString("\n")
+}
+
+func writeMaskingSection(report *strings.Builder, config *DbConfig) {
+	report.WriteString("## Masking\n\n")
+	if len(config.MaskedColumns) > 0 {
+		report.WriteString(fmt.Sprintf("Values of columns matching MSSQL_MASKED_COLUMNS are replaced with %s before results are returned, and queries whose result columns cannot be traced to their tables are refused; values computed from them under another name are not recognized, so dynamic data masking and permissions in the database remain the stronger protection.\n", maskedValue))
+		reportLine(report, "Masked columns", strings.Join(config.MaskedColumns, ", "))
+	} else {
+		report.WriteString("The server applies no masking of its own: values are returned as the login can read them, so dynamic data masking and permissions in the database are what protect sensitive columns.\n")
+	}
+	switch config.RedactErrors {
+	case redactOn:
+		reportLine(report, "Error messages", "data values quoted in errors are redacted")
+	case redactOff:
+		reportLine(report, "Error messages", "returned as the server reports them, including any data values they quote")
+	default:
+		reportLine(report, "Error messages", "data values quoted in errors are redacted while the database or MSSQL_MASKED_COLUMNS masks any column")
+	}
+	reportLine(report, "Binary values", fmt.Sprintf("%s, cut at %d bytes", config.BinaryFormat, config.BinaryMaxBytes))
+	reportLine(report, "Cells cut at", fmt.Sprintf("%d characters", config.MaxCellLength))
+	report.WriteString("\n")
+}
+
+func writeAuditSection(report *strings.Builder, config *DbConfig) {
+	report.WriteString("## Audit\n\n")
+	reportLine(report, "Process log", "every query and denied request is logged to stderr, to be collected by whatever launches the server")
+	switch config.CassetteMode {
+	case cassetteRecord:
+		reportLine(report, "Cassette", fmt.Sprintf("queries and their results are recorded to %s", config.CassetteFile))
+	case cassetteReplay:
+		reportLine(report, "Cassette", fmt.Sprintf("results are replayed from %s; the database is not contacted", config.CassetteFile))
+	}
+	if config.CaptureWriteOutput {
+		reportLine(report, "Written rows", fmt.Sprintf("up to %d rows touched by each write are returned through an OUTPUT clause", config.CaptureOutputRows))
+	}
+	if config.SessionTagging {
+		reportLine(report, "Connection labels", "SESSION_CONTEXT keys mcp_server, mcp_session, tool and request_id, and CONTEXT_INFO, identify each tool call to server-side auditing")
+	}
+	if config.QueryComments {
+		reportLine(report, "Statement comments", "each statement starts with /* mcp tool=... session=... req=... */, visible in sp_whoisactive, Query Store and traces")
+	}
+	switch {
+	case config.ResultHMACKey != "":
+		reportLine(report, "Result integrity", "each result carries a SHA-256 digest and an HMAC-SHA256 keyed with MSSQL_RESULT_HMAC_KEY over its columns and rows")
+	case config.ResultDigest:
+		reportLine(report, "Result integrity", "each result carries a SHA-256 digest of its columns and rows; without MSSQL_RESULT_HMAC_KEY it detects corruption, not deliberate alteration")
+	}
+	reportLine(report, "Server-side auditing", "not configured by this server; use SQL Server Audit to record activity in the database")
+}
@@ -0,0 +1,67 @@
+package mssqlmcp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// sessionOptionValues maps the SET options operators may apply to every
+// connection to the pattern their value must match. Values are validated
+// because they are spliced into the session initialization batch.
+var sessionOptionValues = map[string]*regexp.Regexp{
+	"ANSI_NULLS":              onOffValue,
+	"ANSI_NULL_DFLT_ON":       onOffValue,
+	"ANSI_PADDING":            onOffValue,
+	"ANSI_WARNINGS":           onOffValue,
+	"ARITHABORT":              onOffValue,
+	"CONCAT_NULL_YIELDS_NULL": onOffValue,
+	"NUMERIC_ROUNDABORT":      onOffValue,
+	"QUOTED_IDENTIFIER":       onOffValue,
+	"XACT_ABORT":              onOffValue,
+	"NOCOUNT":                 onOffValue,
+	"DATEFIRST":               regexp.MustCompile(`^[1-7]$`),
+	"DATEFORMAT":              regexp.MustCompile(`(?i)^(mdy|dmy|ymd|ydm|myd|dym)$`),
+	"LANGUAGE":                regexp.MustCompile(`^(\w+|\[[^\]]+\])$`),
+	"LOCK_TIMEOUT":            regexp.MustCompile(`^-?\d+$`),
+	"DEADLOCK_PRIORITY":       regexp.MustCompile(`(?i)^(LOW|NORMAL|HIGH|-?\d+)$`),
+	"TEXTSIZE":                regexp.MustCompile(`^-?\d+$`),
+}
+
+var onOffValue = regexp.MustCompile(`(?i)^(ON|OFF)$`)
+
+// sessionInitSQL builds the batch run on every new or reset connection from
+// options such as "ANSI_NULLS ON" or "DATEFIRST 1".
+func sessionInitSQL(options []string) (string, error) {
+	var statements []string
+	for _, option := range options {
+		fields := strings.Fields(option)
+		if len(fields) != 2 {
+			return "", fmt.Errorf("invalid session option %q (expected NAME VALUE)", option)
+		}
+
+		name := strings.ToUpper(fields[0])
+		pattern, ok := sessionOptionValues[name]
+		if !ok {
+			return "", fmt.Errorf("unsupported session option %s", fields[0])
+		}
+		if !pattern.MatchString(fields[1]) {
+			return "", fmt.Errorf("invalid value %q for session option %s", fields[1], name)
+		}
+		statements = append(statements, fmt.Sprintf("SET %s %s;", name, fields[1]))
+	}
+	return strings.Join(statements, " "), nil
+}
+
+// withEnglishMessages adds SET LANGUAGE us_english to the session options
+// unless they already choose a language, so error messages come back in
+// English whatever the login's default language is. The language also sets
+// DATEFIRST and DATEFORMAT, which options listed after it still override.
+func withEnglishMessages(options []string) []string {
+	for _, option := range options {
+		if fields := strings.Fields(option); len(fields) > 0 && strings.EqualFold(fields[0], "LANGUAGE") {
+			return options
+		}
+	}
+	return append([]string{"LANGUAGE us_english"}, options...)
+}
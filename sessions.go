@@ -0,0 +1,352 @@
+package mssqlmcp
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// stickySession pins one pooled connection to an MCP client session so that
+// session state, such as an open transaction, survives across tool calls.
+type stickySession struct {
+	mu       sync.Mutex
+	id       string
+	conn     *sql.Conn
+	tx       *sql.Tx
+	lastUsed time.Time
+	timer    *time.Timer
+	closed   bool
+}
+
+var (
+	sessionPoolMu sync.Mutex
+	sessionPool   *sql.DB
+
+	sessionsMu sync.Mutex
+	sessions   = make(map[string]*stickySession)
+)
+
+// getSessionPool returns the long-lived pool sticky sessions draw their
+// connections from, opening it on first use.
+func getSessionPool(config *DbConfig) (*sql.DB, error) {
+	sessionPoolMu.Lock()
+	defer sessionPoolMu.Unlock()
+
+	if sessionPool == nil {
+		db, err := getConnection(config)
+		if err != nil {
+			return nil, err
+		}
+		sessionPool = db
+	}
+	return sessionPool, nil
+}
+
+// sessionIDFromContext identifies the MCP client session of a request.
+func sessionIDFromContext(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return "default"
+}
+
+// acquireSession returns the sticky session of the calling client, pinning a
+// new connection if it has none. Connecting may take the dial and login
+// timeouts, so it happens without holding sessionsMu and other clients'
+// sessions stay usable meanwhile.
+func acquireSession(ctx context.Context, config *DbConfig) (*stickySession, error) {
+	id := sessionIDFromContext(ctx)
+
+	sessionsMu.Lock()
+	sess, ok := sessions[id]
+	sessionsMu.Unlock()
+	if ok {
+		return sess, nil
+	}
+
+	pool, err := getSessionPool(config)
+	if err != nil {
+		return nil, fmt.Errorf("database connection error: %v", err)
+	}
+
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("database connection error: %v", err)
+	}
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	// Another call of the same client may have pinned a connection meanwhile
+	if sess, ok := sessions[id]; ok {
+		conn.Close()
+		return sess, nil
+	}
+
+	timeout := time.Duration(config.SessionIdleTimeout) * time.Second
+	sess = &stickySession{id: id, conn: conn, lastUsed: time.Now()}
+	sess.timer = time.AfterFunc(timeout, func() { expireSession(sess, timeout) })
+	sessions[id] = sess
+
+	log.Printf("Pinned connection for session %s", id)
+	return sess, nil
+}
+
+// touch records activity on the session, postponing its idle expiry. The
+// caller must hold sess.mu.
+func (sess *stickySession) touch(config *DbConfig) {
+	timeout := time.Duration(config.SessionIdleTimeout) * time.Second
+	sess.lastUsed = time.Now()
+	sess.timer.Reset(timeout)
+}
+
+// expireSession releases a session that has been idle for the timeout,
+// rolling back any transaction left open.
+func expireSession(sess *stickySession, timeout time.Duration) {
+	sess.mu.Lock()
+	idle := time.Since(sess.lastUsed) >= timeout
+	sess.mu.Unlock()
+
+	if idle {
+		releaseSession(sess, "idle timeout")
+	}
+}
+
+// releaseSession rolls back any open transaction and returns the pinned
+// connection to the pool.
+func releaseSession(sess *stickySession, reason string) {
+	sessionsMu.Lock()
+	if sessions[sess.id] == sess {
+		delete(sessions, sess.id)
+	}
+	sessionsMu.Unlock()
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.closed {
+		return
+	}
+	sess.closed = true
+	sess.timer.Stop()
+
+	if sess.tx != nil {
+		if err := sess.tx.Rollback(); err != nil {
+			log.Printf("Error rolling back transaction of session %s: %v", sess.id, err)
+		} else {
+			log.Printf("Rolled back open transaction of session %s (%s)", sess.id, reason)
+		}
+		sess.tx = nil
+	}
+	sess.conn.Close()
+	log.Printf("Released connection of session %s (%s)", sess.id, reason)
+}
+
+// withSession runs fn while holding the calling client's sticky session.
+func withSession(ctx context.Context, fn func(sess *stickySession, config *DbConfig) error) error {
+	config, err := getDbConfig()
+	if err != nil {
+		return err
+	}
+
+	sess, err := acquireSession(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	sess.mu.Lock()
+	if sess.closed {
+		// Lost a race with expiry; start over with a fresh connection
+		sess.mu.Unlock()
+		return withSession(ctx, fn)
+	}
+	sess.touch(config)
+	// The pinned connection outlives calls, so it is relabelled for each
+	if config.SessionTagging {
+		var db queryer = sess.conn
+		if sess.tx != nil {
+			db = sess.tx
+		}
+		if _, err := db.ExecContext(ctx, sessionContextSQL(queryTagFromContext(ctx))); err != nil {
+			log.Printf("Tagging session %s failed: %v", sess.id, err)
+		}
+	}
+	err = fn(sess, config)
+	sess.mu.Unlock()
+
+	// A broken connection cannot be reused by later calls of this session
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		releaseSession(sess, "connection lost")
+	}
+	return err
+}
+
+type maxRowsKey struct{}
+
+// withMaxRows limits the rows executeSessionQuery reads for requests made
+// with the returned context.
+func withMaxRows(ctx context.Context, maxRows int) context.Context {
+	return context.WithValue(ctx, maxRowsKey{}, maxRows)
+}
+
+// executeSessionQuery executes a query on the caller's sticky session, inside
+// its open transaction if there is one. Without sticky sessions it behaves
+// like executeQuery. Results are capped at the row limit set by withMaxRows;
+// without sticky sessions the remaining rows can then be paged with
+// fetch_more.
+func executeSessionQuery(ctx context.Context, query string, fetchResults bool, args ...interface{}) (map[string]interface{}, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return nil, err
+	}
+	maxRows, _ := ctx.Value(maxRowsKey{}).(int)
+
+	return withCassette(config, query, maxRows, args, func() (map[string]interface{}, error) {
+		return runSessionQuery(ctx, config, query, fetchResults, maxRows, args...)
+	})
+}
+
+// runSessionQuery is executeSessionQuery once the configuration and row limit
+// are known.
+func runSessionQuery(ctx context.Context, config *DbConfig, query string, fetchResults bool, maxRows int, args ...interface{}) (map[string]interface{}, error) {
+	// A transaction held by handle takes precedence over everything else
+	if handle := transactionHandleFromContext(ctx); handle != "" {
+		var data map[string]interface{}
+		err := withHeldTransaction(ctx, handle, func(tx *sql.Tx, config *DbConfig) error {
+			var err error
+			data, err = runQueryLimited(tx, config, query, fetchResults, maxRows, args...)
+			return err
+		})
+		return data, err
+	}
+
+	if !config.StickySessions {
+		// Large results are held open so fetch_more can page through them
+		if fetchResults && maxRows > 0 {
+			return runPagedQuery(ctx, config, query, maxRows, args...)
+		}
+
+		db, err := getConnection(config)
+		if err != nil {
+			return nil, fmt.Errorf("database connection error: %v", err)
+		}
+		defer db.Close()
+
+		return runQueryLimited(db, config, query, fetchResults, maxRows, args...)
+	}
+
+	var data map[string]interface{}
+	err := withSession(ctx, func(sess *stickySession, config *DbConfig) error {
+		var db queryer = sess.conn
+		if sess.tx != nil {
+			db = sess.tx
+		}
+
+		var err error
+		data, err = runQueryLimited(db, config, query, fetchResults, maxRows, args...)
+		return err
+	})
+	return data, err
+}
+
+var isolationLevels = map[string]sql.IsolationLevel{
+	"READ UNCOMMITTED": sql.LevelReadUncommitted,
+	"READ COMMITTED":   sql.LevelReadCommitted,
+	"REPEATABLE READ":  sql.LevelRepeatableRead,
+	"SNAPSHOT":         sql.LevelSnapshot,
+	"SERIALIZABLE":     sql.LevelSerializable,
+}
+
+// registerTransactionTools adds begin/commit/rollback tools operating on the
+// caller's sticky session.
+func registerTransactionTools(s *server.MCPServer) {
+	beginTool := mcp.NewTool("begin_transaction",
+		mcp.WithDescription("Start a transaction on this session's connection. Subsequent queries run inside it until commit_transaction or rollback_transaction is called; an idle transaction is rolled back automatically."),
+		mcp.WithString("isolation_level",
+			mcp.Description("Transaction isolation level"),
+			mcp.Enum("READ UNCOMMITTED", "READ COMMITTED", "REPEATABLE READ", "SNAPSHOT", "SERIALIZABLE"),
+		),
+	)
+
+	s.AddTool(beginTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		levelName, _ := request.Params.Arguments["isolation_level"].(string)
+		if levelName == "" {
+			levelName = "READ COMMITTED"
+		}
+		level, ok := isolationLevels[levelName]
+		if !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("Unknown isolation level: %s", levelName)), nil
+		}
+
+		var message string
+		err := withSession(ctx, func(sess *stickySession, config *DbConfig) error {
+			if sess.tx != nil {
+				return errors.New("a transaction is already open in this session")
+			}
+
+			// The transaction must not be tied to the request context, which
+			// ends with this tool call
+			tx, err := sess.conn.BeginTx(context.Background(), &sql.TxOptions{Isolation: level})
+			if err != nil {
+				return err
+			}
+			sess.tx = tx
+
+			message = fmt.Sprintf("Transaction started (%s). It will be rolled back automatically after %d seconds of inactivity.", levelName, config.SessionIdleTimeout)
+			return nil
+		})
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error starting transaction: %v", err)), nil
+		}
+
+		log.Printf("Transaction started in session %s", sessionIDFromContext(ctx))
+		return mcp.NewToolResultText(message), nil
+	})
+
+	commitTool := mcp.NewTool("commit_transaction",
+		mcp.WithDescription("Commit the transaction open in this session"),
+	)
+
+	s.AddTool(commitTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		err := endSessionTransaction(ctx, true)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error committing transaction: %v", err)), nil
+		}
+		return mcp.NewToolResultText("Transaction committed"), nil
+	})
+
+	rollbackTool := mcp.NewTool("rollback_transaction",
+		mcp.WithDescription("Roll back the transaction open in this session, discarding its changes"),
+	)
+
+	s.AddTool(rollbackTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		err := endSessionTransaction(ctx, false)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error rolling back transaction: %v", err)), nil
+		}
+		return mcp.NewToolResultText("Transaction rolled back"), nil
+	})
+}
+
+func endSessionTransaction(ctx context.Context, commit bool) error {
+	return withSession(ctx, func(sess *stickySession, config *DbConfig) error {
+		if sess.tx == nil {
+			return errors.New("no transaction is open in this session")
+		}
+
+		tx := sess.tx
+		sess.tx = nil
+		if commit {
+			return tx.Commit()
+		}
+		return tx.Rollback()
+	})
+}
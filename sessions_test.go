@@ -0,0 +1,92 @@
+package mssqlmcp
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingConnector hands out connections once release is closed, so tests
+// can observe what happens while a session is still connecting.
+type blockingConnector struct {
+	connecting chan struct{}
+	release    chan struct{}
+}
+
+func (c blockingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.connecting <- struct{}{}
+	select {
+	case <-c.release:
+		return stubConn{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c blockingConnector) Driver() driver.Driver { return nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (stubConn) Close() error                              { return nil }
+func (stubConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func TestAcquireSessionConnectsOutsideLock(t *testing.T) {
+	config := testConfig(t)
+	connector := blockingConnector{connecting: make(chan struct{}, 2), release: make(chan struct{})}
+	sessionPoolMu.Lock()
+	sessionPool = sql.OpenDB(connector)
+	sessionPoolMu.Unlock()
+	t.Cleanup(func() {
+		CloseSession(sessionIDFromContext(context.Background()))
+		sessionPoolMu.Lock()
+		sessionPool.Close()
+		sessionPool = nil
+		sessionPoolMu.Unlock()
+	})
+
+	// Two calls of one client connect concurrently
+	var wg sync.WaitGroup
+	acquired := make([]*stickySession, 2)
+	for i := range acquired {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sess, err := acquireSession(context.Background(), config)
+			if err != nil {
+				t.Error(err)
+			}
+			acquired[i] = sess
+		}()
+	}
+	for range acquired {
+		select {
+		case <-connector.connecting:
+		case <-time.After(5 * time.Second):
+			close(connector.release)
+			t.Fatal("a call waited for another call's connection attempt")
+		}
+	}
+
+	// Other clients' sessions are not held up by the connection attempts
+	done := make(chan struct{})
+	go func() {
+		CloseSession("another-client")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sessions stayed locked while a connection was opened")
+	}
+
+	close(connector.release)
+	wg.Wait()
+	if acquired[0] == nil || acquired[0] != acquired[1] {
+		t.Errorf("concurrent calls of one client pinned sessions %p and %p, want one", acquired[0], acquired[1])
+	}
+}
@@ -0,0 +1,116 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// How long a snapshot resolved from MSSQL_SNAPSHOT_PATTERN is reused before
+// looking for a newer one
+const SNAPSHOT_RESOLVE_INTERVAL = time.Minute
+
+var (
+	snapshotMu         sync.Mutex
+	resolvedSnapshot   string
+	snapshotResolvedAt time.Time
+)
+
+// resolveSnapshotDatabase returns the database snapshot queries should run
+// against: MSSQL_SNAPSHOT_DATABASE when set, otherwise the most recently
+// created snapshot of the configured database whose name matches the LIKE
+// pattern in MSSQL_SNAPSHOT_PATTERN.
+func resolveSnapshotDatabase(config *DbConfig) (string, error) {
+	if config.SnapshotDatabase != "" {
+		return config.SnapshotDatabase, nil
+	}
+
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	if resolvedSnapshot != "" && time.Since(snapshotResolvedAt) < SNAPSHOT_RESOLVE_INTERVAL {
+		return resolvedSnapshot, nil
+	}
+
+	db, err := openDatabase(config, config.Database)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	data, err := runQuery(db, config, `SELECT TOP (1) name
+		FROM sys.databases
+		WHERE source_database_id = DB_ID(@p1) AND name LIKE @p2 AND state_desc = 'ONLINE'
+		ORDER BY create_date DESC`, true, config.Database, config.SnapshotPattern)
+	if err != nil {
+		return "", fmt.Errorf("resolving snapshot: %v", err)
+	}
+	rows := data["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		return "", fmt.Errorf("no online snapshot of %s matches %q", config.Database, config.SnapshotPattern)
+	}
+
+	resolvedSnapshot = fmt.Sprintf("%v", rows[0]["name"])
+	snapshotResolvedAt = time.Now()
+	return resolvedSnapshot, nil
+}
+
+// registerSnapshotTools adds a tool listing the snapshots of the configured
+// database.
+func registerSnapshotTools(s *server.MCPServer) {
+	snapshotsTool := mcp.NewTool("list_snapshots", append([]mcp.ToolOption{
+		mcp.WithDescription("List the database snapshots of the configured database with their creation time, and show which one queries currently run against"),
+	}, listFilterOptions(false)...)...)
+
+	s.AddTool(snapshotsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+
+		filter := listFilterFromArguments(request.Params.Arguments)
+		conditions, args := filter.conditions("", "name", []interface{}{config.Database})
+
+		// sys.databases is server-wide, so the listing works from a snapshot too
+		data, err := executeQuery(`SELECT name, create_date, state_desc
+			FROM sys.databases
+			WHERE source_database_id = DB_ID(@p1)`+conditions+`
+			ORDER BY create_date DESC`+filter.paging(), true, args...)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error listing snapshots: %v", err)), nil
+		}
+
+		current := config.Database + " (live database)"
+		if config.SnapshotDatabase != "" || config.SnapshotPattern != "" {
+			current, err = resolveSnapshotDatabase(config)
+			if err != nil {
+				current = fmt.Sprintf("unresolved (%v)", err)
+			}
+		}
+
+		note := filter.page(data)
+		rows := data["rows"].([]map[string]interface{})
+		if len(rows) == 0 {
+			if note != "" {
+				return mcp.NewToolResultText(note), nil
+			}
+			if filter.Name != "" {
+				return mcp.NewToolResultText(fmt.Sprintf("No snapshots of %s match %s. Queries run against: %s", config.Database, filter.Name, current)), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("No snapshots of %s exist. Queries run against: %s", config.Database, current)), nil
+		}
+
+		result, err := formatResults(data)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error formatting results: %v", err)), nil
+		}
+		if note != "" {
+			result += "\n\n" + note
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Queries run against: %s\n\n%s", current, result)), nil
+	})
+}
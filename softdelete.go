@@ -0,0 +1,51 @@
+package mssqlmcp
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Soft-delete columns are declared in MSSQL_SOFT_DELETE_COLUMNS as
+// [schema.][table.]column patterns with * wildcards, for example
+// "is_deleted,dbo.Orders.deleted_at". Missing parts match any schema/table.
+
+// isSoftDeleteColumn reports whether a column is declared as a soft-delete marker.
+func isSoftDeleteColumn(config *DbConfig, schema, table, column string) bool {
+	name := strings.ToLower(schema + "." + table + "." + column)
+	for _, pattern := range config.SoftDeleteColumns {
+		switch strings.Count(pattern, ".") {
+		case 0:
+			pattern = "*.*." + pattern
+		case 1:
+			pattern = "*." + pattern
+		}
+		if matched, _ := path.Match(strings.ToLower(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// softDeletePredicate returns the condition selecting live rows: flag columns
+// must be zero, timestamp-style columns must be NULL.
+func softDeletePredicate(column, dataType string) string {
+	switch strings.ToLower(dataType) {
+	case "bit", "tinyint", "smallint", "int", "bigint":
+		return formatIdentifier(column) + " = 0"
+	}
+	return formatIdentifier(column) + " IS NULL"
+}
+
+// softDeleteConditions lists the live-row predicates for a table's declared
+// soft-delete columns.
+func softDeleteConditions(config *DbConfig, schema, table string, columns []map[string]interface{}) []string {
+	var conditions []string
+	for _, column := range columns {
+		name := fmt.Sprintf("%v", column["COLUMN_NAME"])
+		if isSoftDeleteColumn(config, schema, table, name) {
+			conditions = append(conditions, softDeletePredicate(name, fmt.Sprintf("%v", column["DATA_TYPE"])))
+		}
+	}
+	return conditions
+}
@@ -0,0 +1,1203 @@
+package mssqlmcp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type sqlTokenKind int
+
+const (
+	tokenWord sqlTokenKind = iota
+	tokenQuotedIdentifier
+	tokenString
+	tokenNumber
+	tokenVariable
+	tokenComment
+	tokenSymbol
+)
+
+// sqlToken is a lexical token of a T-SQL statement. Whitespace is dropped;
+// Pos is the byte offset of the token in the original text and Depth the
+// parenthesis nesting level it appears at.
+type sqlToken struct {
+	Kind  sqlTokenKind
+	Text  string
+	Pos   int
+	Depth int
+}
+
+// isKeyword reports whether the token is the given (upper-case) unquoted word.
+func (t sqlToken) isKeyword(word string) bool {
+	return t.Kind == tokenWord && strings.EqualFold(t.Text, word)
+}
+
+// tokenizeSQL splits T-SQL text into tokens, understanding string literals,
+// bracketed/quoted identifiers and both comment styles so keywords inside
+// them are never mistaken for statement structure.
+func tokenizeSQL(query string) []sqlToken {
+	var tokens []sqlToken
+	depth := 0
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		start := i
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+			continue
+
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokenComment, query[start:i], start, depth})
+
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			// Block comments nest in T-SQL
+			nesting := 0
+			for i < len(query) {
+				if strings.HasPrefix(query[i:], "/*") {
+					nesting++
+					i += 2
+				} else if strings.HasPrefix(query[i:], "*/") {
+					nesting--
+					i += 2
+					if nesting == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			tokens = append(tokens, sqlToken{tokenComment, query[start:i], start, depth})
+
+		case c == '\'' || ((c == 'N' || c == 'n') && i+1 < len(query) && query[i+1] == '\''):
+			if c != '\'' {
+				i++
+			}
+			i = scanDelimited(query, i+1, '\'')
+			tokens = append(tokens, sqlToken{tokenString, query[start:i], start, depth})
+
+		case c == '[':
+			i = scanDelimited(query, i+1, ']')
+			tokens = append(tokens, sqlToken{tokenQuotedIdentifier, query[start:i], start, depth})
+
+		case c == '"':
+			i = scanDelimited(query, i+1, '"')
+			tokens = append(tokens, sqlToken{tokenQuotedIdentifier, query[start:i], start, depth})
+
+		case c == '@':
+			i++
+			for i < len(query) && isIdentifierChar(query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokenVariable, query[start:i], start, depth})
+
+		case c >= '0' && c <= '9':
+			for i < len(query) && (isIdentifierChar(query[i]) || query[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokenNumber, query[start:i], start, depth})
+
+		case isIdentifierStart(c):
+			for i < len(query) && isIdentifierChar(query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokenWord, query[start:i], start, depth})
+
+		case c == '(':
+			i++
+			tokens = append(tokens, sqlToken{tokenSymbol, "(", start, depth})
+			depth++
+
+		case c == ')':
+			i++
+			if depth > 0 {
+				depth--
+			}
+			tokens = append(tokens, sqlToken{tokenSymbol, ")", start, depth})
+
+		default:
+			i++
+			tokens = append(tokens, sqlToken{tokenSymbol, query[start:i], start, depth})
+		}
+	}
+	return tokens
+}
+
+// scanDelimited returns the offset just past the closing delimiter, treating a
+// doubled delimiter as an escaped character.
+func scanDelimited(query string, i int, delimiter byte) int {
+	for i < len(query) {
+		if query[i] == delimiter {
+			if i+1 < len(query) && query[i+1] == delimiter {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return i
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || c == '#' || c >= 0x80 || unicode.IsLetter(rune(c))
+}
+
+func isIdentifierChar(c byte) bool {
+	return isIdentifierStart(c) || c == '$' || (c >= '0' && c <= '9')
+}
+
+// significantTokens drops comments, which never affect statement structure.
+func significantTokens(tokens []sqlToken) []sqlToken {
+	result := make([]sqlToken, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Kind != tokenComment {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// findTopLevelKeyword returns the index of the first token at or after start
+// that is one of the given keywords outside any parentheses, or -1.
+func findTopLevelKeyword(tokens []sqlToken, start int, keywords ...string) int {
+	for i := start; i < len(tokens); i++ {
+		if tokens[i].Depth != 0 {
+			continue
+		}
+		for _, keyword := range keywords {
+			if tokens[i].isKeyword(keyword) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// skipParenthesized returns the index just past the parenthesized group that
+// opens at tokens[open].
+func skipParenthesized(tokens []sqlToken, open int) int {
+	depth := tokens[open].Depth
+	for i := open + 1; i < len(tokens); i++ {
+		if tokens[i].Text == ")" && tokens[i].Depth == depth {
+			return i + 1
+		}
+	}
+	return len(tokens)
+}
+
+// injectOutputClause rewrites a single INSERT, UPDATE or DELETE statement so it
+// returns the affected rows through an OUTPUT clause. It reports false when the
+// statement is of another kind, already has an OUTPUT clause, or is too
+// complex to rewrite safely (CTEs, multiple statements).
+func injectOutputClause(query string) (string, bool) {
+	tokens := significantTokens(tokenizeSQL(query))
+	if len(tokens) == 0 {
+		return query, false
+	}
+
+	// Only rewrite single statements; a trailing semicolon is fine
+	for i, t := range tokens {
+		if t.Text == ";" && i != len(tokens)-1 {
+			return query, false
+		}
+	}
+	if findTopLevelKeyword(tokens, 0, "OUTPUT") >= 0 {
+		return query, false
+	}
+
+	if tokens[len(tokens)-1].Text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return query, false
+	}
+
+	insertAt := -1
+	clause := ""
+	switch {
+	case tokens[0].isKeyword("INSERT"):
+		clause = "OUTPUT inserted.*"
+		insertAt = findTopLevelKeyword(tokens, 1, "VALUES", "SELECT", "DEFAULT")
+
+	case tokens[0].isKeyword("UPDATE"):
+		clause = "OUTPUT inserted.*"
+		set := findTopLevelKeyword(tokens, 1, "SET")
+		if set < 0 {
+			return query, false
+		}
+		insertAt = findTopLevelKeyword(tokens, set+1, "FROM", "WHERE", "OPTION")
+		if insertAt < 0 {
+			insertAt = len(tokens)
+		}
+
+	case tokens[0].isKeyword("DELETE"):
+		clause = "OUTPUT deleted.*"
+		target := 1
+		if target < len(tokens) && tokens[target].isKeyword("TOP") {
+			target++
+			if target < len(tokens) && tokens[target].Text == "(" {
+				target = skipParenthesized(tokens, target)
+			}
+			if target < len(tokens) && tokens[target].isKeyword("PERCENT") {
+				target++
+			}
+		}
+		if target < len(tokens) && tokens[target].isKeyword("FROM") {
+			target++
+		}
+		insertAt = findTopLevelKeyword(tokens, target+1, "FROM", "WHERE", "OPTION")
+		if insertAt < 0 {
+			insertAt = len(tokens)
+		}
+	}
+
+	if insertAt < 0 {
+		return query, false
+	}
+
+	// At the end of the statement the clause goes right after the last token,
+	// ahead of any trailing semicolon or comment
+	if insertAt < len(tokens) {
+		pos := tokens[insertAt].Pos
+		return query[:pos] + clause + " " + query[pos:], true
+	}
+	last := tokens[len(tokens)-1]
+	pos := last.Pos + len(last.Text)
+	return query[:pos] + " " + clause + query[pos:], true
+}
+
+// appendOptionClause adds OPTION (...) with the given query hints to the end
+// of a single statement, ahead of any trailing semicolon or comment. The
+// statement may follow DECLARE and SET statements preparing its variables;
+// the hints apply to it alone.
+func appendOptionClause(query string, hints []string) (string, error) {
+	tokens := significantTokens(tokenizeSQL(query))
+	if len(tokens) > 0 && tokens[len(tokens)-1].Text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	// Only statements ending in a semicolon can be told apart; the last one
+	// takes the hints
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if tokens[i].Text == ";" && tokens[i].Depth == 0 {
+			for j, start := 0, 0; j <= i; j++ {
+				if tokens[j].Text == ";" && tokens[j].Depth == 0 {
+					if start < j && !tokens[start].isKeyword("DECLARE") && !tokens[start].isKeyword("SET") {
+						return "", errors.New("hints can only be applied to a single statement, optionally preceded by DECLARE and SET")
+					}
+					start = j + 1
+				}
+			}
+			tokens = tokens[i+1:]
+			break
+		}
+	}
+	if len(tokens) == 0 {
+		return "", errors.New("empty query")
+	}
+	if findTopLevelKeyword(tokens, 0, "OPTION") >= 0 {
+		return "", errors.New("the query already has an OPTION clause")
+	}
+
+	last := tokens[len(tokens)-1]
+	pos := last.Pos + len(last.Text)
+	return query[:pos] + " OPTION (" + strings.Join(hints, ", ") + ")" + query[pos:], nil
+}
+
+// scriptBatch is one batch of a script split at GO separators.
+type scriptBatch struct {
+	Text string
+	// Line the batch starts on, counting from 1
+	Line int
+	// Times the batch runs, from a count after GO
+	Repeat int
+}
+
+// splitBatches splits a script at GO separators, which like sqlcmd it only
+// recognizes alone on a line, optionally with a repeat count ("GO 5") or a
+// trailing comment. GO inside strings and comments is left alone, and
+// batches holding nothing but whitespace and comments are dropped.
+func splitBatches(script string) ([]scriptBatch, error) {
+	tokens := tokenizeSQL(script)
+	var batches []scriptBatch
+	start := 0
+	for i, token := range tokens {
+		if !token.isKeyword("GO") {
+			continue
+		}
+		lineStart := strings.LastIndexByte(script[:token.Pos], '\n') + 1
+		if strings.TrimSpace(script[lineStart:token.Pos]) != "" {
+			continue
+		}
+
+		end := token.Pos + len(token.Text)
+		repeat := 1
+		next := i + 1
+		if next < len(tokens) && tokens[next].Kind == tokenNumber && !strings.Contains(script[end:tokens[next].Pos], "\n") {
+			count, err := strconv.Atoi(tokens[next].Text)
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("invalid GO count %q", tokens[next].Text)
+			}
+			repeat = count
+			end = tokens[next].Pos + len(tokens[next].Text)
+			next++
+		}
+		if next < len(tokens) && !strings.Contains(script[end:tokens[next].Pos], "\n") {
+			if !strings.HasPrefix(tokens[next].Text, "--") {
+				continue
+			}
+			end = tokens[next].Pos + len(tokens[next].Text)
+		}
+
+		batches = appendBatch(batches, script, start, lineStart, repeat)
+		start = end
+	}
+	return appendBatch(batches, script, start, len(script), 1), nil
+}
+
+func appendBatch(batches []scriptBatch, script string, start, end, repeat int) []scriptBatch {
+	text := script[start:end]
+	tokens := significantTokens(tokenizeSQL(text))
+	if len(tokens) == 0 {
+		return batches
+	}
+	line := 1 + strings.Count(script[:start+tokens[0].Pos], "\n")
+	return append(batches, scriptBatch{Text: strings.TrimSpace(text), Line: line, Repeat: repeat})
+}
+
+// isPlainPredicate reports whether text can be appended after WHERE without
+// escaping the clause: balanced parentheses, no statement separators, no
+// comments and no keywords that would start another clause or statement.
+func isPlainPredicate(text string) bool {
+	depth := 0
+	for _, t := range tokenizeSQL(text) {
+		switch {
+		case t.Kind == tokenComment || t.Text == ";":
+			return false
+		case t.Text == "(":
+			depth++
+		case t.Text == ")":
+			depth--
+			if depth < 0 {
+				return false
+			}
+		case t.Depth == 0 && t.Kind == tokenWord:
+			for _, keyword := range []string{"ORDER", "GROUP", "HAVING", "UNION", "EXCEPT", "INTERSECT", "OPTION", "FOR", "INTO"} {
+				if t.isKeyword(keyword) {
+					return false
+				}
+			}
+		}
+	}
+	return depth == 0
+}
+
+// unquoteIdentifier strips [brackets] or "double quotes" from an identifier.
+func unquoteIdentifier(name string) string {
+	if len(name) >= 2 {
+		switch {
+		case name[0] == '[' && name[len(name)-1] == ']':
+			return strings.ReplaceAll(name[1:len(name)-1], "]]", "]")
+		case name[0] == '"' && name[len(name)-1] == '"':
+			return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+		}
+	}
+	return name
+}
+
+// unquoteString returns the text of a 'string' or N'string' literal.
+func unquoteString(literal string) string {
+	if len(literal) > 0 && (literal[0] == 'N' || literal[0] == 'n') {
+		literal = literal[1:]
+	}
+	if len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'' {
+		return strings.ReplaceAll(literal[1:len(literal)-1], "''", "'")
+	}
+	return literal
+}
+
+// parseObjectName splits a possibly schema-qualified and bracketed object
+// name such as [dbo].[Orders], dbo.Orders or Orders. Unqualified names are
+// assumed to live in the dbo schema.
+func parseObjectName(name string) (string, string, error) {
+	var parts []string
+	expectName := true
+	for _, t := range tokenizeSQL(name) {
+		switch {
+		case expectName && (t.Kind == tokenWord || t.Kind == tokenQuotedIdentifier):
+			parts = append(parts, unquoteIdentifier(t.Text))
+			expectName = false
+		case !expectName && t.Text == ".":
+			expectName = true
+		default:
+			return "", "", fmt.Errorf("invalid object name: %q", name)
+		}
+	}
+
+	switch {
+	case len(parts) == 1 && !expectName:
+		return "dbo", parts[0], nil
+	case len(parts) == 2 && !expectName:
+		return parts[0], parts[1], nil
+	}
+	return "", "", fmt.Errorf("invalid object name: %q (expected object or schema.object)", name)
+}
+
+// reservedWords are the T-SQL reserved keywords, which must be bracketed when
+// used as identifiers.
+var reservedWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`ADD ALL ALTER AND ANY AS ASC AUTHORIZATION BACKUP BEGIN BETWEEN BREAK BROWSE
+		BULK BY CASCADE CASE CHECK CHECKPOINT CLOSE CLUSTERED COALESCE COLLATE COLUMN COMMIT COMPUTE CONSTRAINT
+		CONTAINS CONTAINSTABLE CONTINUE CONVERT CREATE CROSS CURRENT CURRENT_DATE CURRENT_TIME CURRENT_TIMESTAMP
+		CURRENT_USER CURSOR DATABASE DBCC DEALLOCATE DECLARE DEFAULT DELETE DENY DESC DISK DISTINCT DISTRIBUTED
+		DOUBLE DROP DUMP ELSE END ERRLVL ESCAPE EXCEPT EXEC EXECUTE EXISTS EXIT EXTERNAL FETCH FILE FILLFACTOR FOR
+		FOREIGN FREETEXT FREETEXTTABLE FROM FULL FUNCTION GOTO GRANT GROUP HAVING HOLDLOCK IDENTITY IDENTITY_INSERT
+		IDENTITYCOL IF IN INDEX INNER INSERT INTERSECT INTO IS JOIN KEY KILL LEFT LIKE LINENO LOAD MERGE NATIONAL
+		NOCHECK NONCLUSTERED NOT NULL NULLIF OF OFF OFFSETS ON OPEN OPENDATASOURCE OPENQUERY OPENROWSET OPENXML
+		OPTION OR ORDER OUTER OVER PERCENT PIVOT PLAN PRECISION PRIMARY PRINT PROC PROCEDURE PUBLIC RAISERROR READ
+		READTEXT RECONFIGURE REFERENCES REPLICATION RESTORE RESTRICT RETURN REVERT REVOKE RIGHT ROLLBACK ROWCOUNT
+		ROWGUIDCOL RULE SAVE SCHEMA SECURITYAUDIT SELECT SEMANTICKEYPHRASETABLE SEMANTICSIMILARITYDETAILSTABLE
+		SEMANTICSIMILARITYTABLE SESSION_USER SET SETUSER SHUTDOWN SOME STATISTICS SYSTEM_USER TABLE TABLESAMPLE
+		TEXTSIZE THEN TO TOP TRAN TRANSACTION TRIGGER TRUNCATE TRY_CONVERT TSEQUAL UNION UNIQUE UNPIVOT UPDATE
+		UPDATETEXT USE USER VALUES VARYING VIEW WAITFOR WHEN WHERE WHILE WITH WITHIN WRITETEXT`) {
+		reservedWords[word] = true
+	}
+}
+
+func isReservedWord(word string) bool {
+	return reservedWords[strings.ToUpper(word)]
+}
+
+// needsQuoting reports whether a name is not a regular identifier, i.e. it is a
+// reserved word, contains spaces or other special characters, or starts with
+// a digit.
+func needsQuoting(name string) bool {
+	if name == "" || isReservedWord(name) {
+		return true
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (unicode.IsDigit(r) || r == '$' || r == '#' || r == '@'):
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// formatIdentifier brackets a name only when T-SQL requires it, keeping
+// generated helper queries readable while still valid.
+func formatIdentifier(name string) string {
+	if needsQuoting(name) {
+		return quoteIdentifier(name)
+	}
+	return name
+}
+
+// quoteString renders a value as a Unicode string literal.
+func quoteString(value string) string {
+	return "N'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// formatObjectName renders schema.object using formatIdentifier on both parts.
+func formatObjectName(schema, object string) string {
+	return formatIdentifier(schema) + "." + formatIdentifier(object)
+}
+
+// objectReference is a table-like object named in a statement.
+type objectReference struct {
+	Parts    []string // unquoted multi-part name, e.g. ["dbo", "Orders"]
+	Alias    string
+	Pos      int
+	End      int    // offset just past the name, before any call arguments or alias
+	Function bool   // table-valued function call rather than a table or view
+	Target   string // keyword of the statement changing it: INSERT, UPDATE, DELETE, MERGE or INTO
+}
+
+// Name renders the reference as written, without quoting.
+func (r objectReference) Name() string {
+	return strings.Join(r.Parts, ".")
+}
+
+// IsTemporary reports whether the reference is a #temp table.
+func (r objectReference) IsTemporary() bool {
+	return strings.HasPrefix(r.Parts[len(r.Parts)-1], "#")
+}
+
+// findObjectReferences lists the tables, views and table-valued functions a
+// statement reads or writes, skipping CTE names, table variables and
+// subqueries. The target of UPDATE o or DELETE o naming the alias of a table
+// in the statement's FROM clause is left out, as that table is listed; names
+// anywhere else are taken as objects even when they equal an alias. It is a
+// best-effort analysis of the token stream, not a parser: checks that must
+// not miss an object use resolveObjectReferences.
+func findObjectReferences(query string) []objectReference {
+	references, _ := scanObjectReferences(query)
+	return references
+}
+
+// resolveObjectReferences is findObjectReferences for the checks that must
+// see every object a statement uses, such as the object access lists and
+// tenant scoping. Besides the table sources it lists the schema-qualified
+// function calls anywhere in the statement, as those of scalar functions in
+// a select list, and it fails when a table source has a shape it cannot
+// read, so that the caller refuses the statement rather than miss what it
+// reads.
+func resolveObjectReferences(query string) ([]objectReference, error) {
+	references, err := scanObjectReferences(query)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := significantTokens(tokenizeSQL(query))
+	listed := make(map[int]bool, len(references))
+	aliases := make(map[string]bool)
+	for _, reference := range references {
+		listed[reference.Pos] = true
+		aliases[strings.ToLower(reference.Parts[len(reference.Parts)-1])] = true
+		if reference.Alias != "" {
+			aliases[strings.ToLower(reference.Alias)] = true
+		}
+	}
+	for i, t := range tokens {
+		if !isNameToken(t) || listed[t.Pos] || (i > 0 && (tokens[i-1].Text == "." || tokens[i-1].Text == ":")) {
+			continue
+		}
+		reference, _, ok := parseObjectReference(tokens, i, false)
+		if !ok || len(reference.Parts) < 2 {
+			continue
+		}
+		next := i
+		for next < len(tokens) && tokens[next].Pos < reference.End {
+			next++
+		}
+		if next >= len(tokens) || tokens[next].Text != "(" {
+			continue
+		}
+		reference.Alias, reference.Function = "", true
+		references = append(references, reference)
+	}
+
+	// alias.column.nodes(...) and the like call a method of an xml column.
+	// Two-part calls are left in: column.value(...) cannot be told from a
+	// call of schema.value(...), so the policy applies to it as to a
+	// function.
+	kept := references[:0]
+	for _, reference := range references {
+		if reference.Function && len(reference.Parts) == 3 && aliases[strings.ToLower(reference.Parts[0])] &&
+			xmlMethods[reference.Parts[2]] {
+			continue
+		}
+		kept = append(kept, reference)
+	}
+	return kept, nil
+}
+
+// xmlMethods are the methods of the xml type, whose names are case-sensitive.
+var xmlMethods = map[string]bool{"value": true, "query": true, "exist": true, "nodes": true, "modify": true}
+
+// scanObjectReferences implements findObjectReferences, also returning an
+// error when a table source could not be read.
+func scanObjectReferences(query string) ([]objectReference, error) {
+	tokens := significantTokens(tokenizeSQL(query))
+	ctes := cteNames(tokens)
+
+	var references []objectReference
+	var unresolved error
+	add := func(reference objectReference, target string) {
+		reference.Target = target
+		if len(reference.Parts) > 1 || !ctes[strings.ToLower(reference.Parts[0])] {
+			references = append(references, reference)
+		}
+	}
+	handled := make(map[int]bool)
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		target := ""
+		for _, keyword := range []string{"UPDATE", "DELETE", "INSERT", "MERGE", "INTO"} {
+			if t.isKeyword(keyword) {
+				target = keyword
+			}
+		}
+		source := t.isKeyword("FROM") || t.isKeyword("JOIN") || t.isKeyword("APPLY") || t.isKeyword("USING")
+		if handled[i] || !(target != "" || source || t.isKeyword("TABLE")) {
+			continue
+		}
+
+		if t.isKeyword("FROM") && !startsFromClause(tokens, i) {
+			continue
+		}
+
+		j := i + 1
+		if t.isKeyword("UPDATE") || t.isKeyword("DELETE") || t.isKeyword("INSERT") || t.isKeyword("MERGE") {
+			// ON DELETE NO ACTION and the like in foreign keys name no table
+			if i > 0 && tokens[i-1].isKeyword("ON") {
+				continue
+			}
+			j = skipTop(tokens, j)
+			// DELETE FROM t, INSERT INTO t and MERGE INTO t, or without
+			// FROM or INTO
+			if j < len(tokens) && (tokens[j].isKeyword("FROM") && t.isKeyword("DELETE") || tokens[j].isKeyword("INTO")) {
+				handled[j] = true
+				j++
+			}
+		}
+		if !source {
+			// Only table sources can be function calls; elsewhere a
+			// parenthesis starts a column list
+			if reference, _, ok := parseObjectReference(tokens, j, false); ok {
+				add(reference, target)
+			}
+			continue
+		}
+
+		// FROM a, b lists several sources
+		starts := []int{j}
+		if t.isKeyword("FROM") {
+			starts = append(starts, fromListItems(tokens, i)...)
+		}
+		for _, j := range starts {
+			found, next, ok := parseTableSource(tokens, j)
+			if !ok || !endsTableSource(tokens, next) {
+				if unresolved == nil {
+					at := len(query)
+					if j < len(tokens) {
+						at = tokens[j].Pos
+					}
+					unresolved = fmt.Errorf("the table source at %q is not understood", truncateString(strings.TrimSpace(query[at:]), 40))
+				}
+				continue
+			}
+			for _, reference := range found {
+				add(reference, target)
+			}
+		}
+	}
+
+	// UPDATE o ... FROM dbo.Orders o names the alias
+	aliases := make(map[string]bool)
+	for _, reference := range references {
+		if reference.Alias != "" && reference.Target == "" {
+			aliases[strings.ToLower(reference.Alias)] = true
+		}
+	}
+	listed := references[:0]
+	for _, reference := range references {
+		if reference.Target != "" && len(reference.Parts) == 1 && !reference.Function && aliases[strings.ToLower(reference.Parts[0])] {
+			continue
+		}
+		listed = append(listed, reference)
+	}
+	// In the order they are written, which the sources of a FROM list are
+	// not found in
+	sort.SliceStable(listed, func(i, j int) bool { return listed[i].Pos < listed[j].Pos })
+	return listed, unresolved
+}
+
+// startsFromClause reports whether the FROM at tokens[i] introduces table
+// sources, as opposed to TRIM(chars FROM string), IS [NOT] DISTINCT FROM,
+// FOR SYSTEM_TIME FROM ... TO and FETCH ... FROM cursor.
+func startsFromClause(tokens []sqlToken, i int) bool {
+	if tokens[i].Depth > 0 && isInsideCall(tokens, i, "TRIM") {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	previous := tokens[i-1]
+	for _, word := range []string{"DISTINCT", "SYSTEM_TIME", "FETCH", "NEXT", "PRIOR", "FIRST", "LAST"} {
+		if previous.isKeyword(word) {
+			return false
+		}
+	}
+	// FETCH ABSOLUTE n FROM and FETCH RELATIVE n FROM
+	return !(i > 1 && (tokens[i-2].isKeyword("ABSOLUTE") || tokens[i-2].isKeyword("RELATIVE")))
+}
+
+// fromListEnds are the keywords ending a FROM clause: its own clauses and
+// the statements that may follow it without a semicolon.
+var fromListEnds = map[string]bool{}
+
+func init() {
+	for _, word := range append(strings.Fields(`WHERE GROUP HAVING ORDER UNION EXCEPT INTERSECT FOR WINDOW INTO
+		END ELSE SET WITH COMMIT ROLLBACK SAVE OPEN CLOSE FETCH DEALLOCATE BREAK CONTINUE GRANT DENY REVOKE`),
+		statementKeywords...) {
+		fromListEnds[word] = true
+	}
+}
+
+// fromListItems returns the positions of the table sources after the first
+// in the FROM clause at tokens[from]: those following a comma at the
+// clause's own nesting level. Commas anywhere deeper separate arguments or
+// list items, never sources.
+func fromListItems(tokens []sqlToken, from int) []int {
+	var items []int
+	depth := tokens[from].Depth
+	cases := 0
+	for k := from + 1; k < len(tokens); k++ {
+		t := tokens[k]
+		if t.Depth < depth {
+			break
+		}
+		if t.Depth > depth {
+			continue
+		}
+		next := func(text string) bool {
+			return k+1 < len(tokens) && (tokens[k+1].isKeyword(text) || tokens[k+1].Text == text)
+		}
+		switch {
+		case t.Text == ",":
+			items = append(items, k+1)
+		case t.Text == ";":
+			return items
+		case t.isKeyword("CASE"):
+			cases++
+		case t.isKeyword("END") && cases > 0:
+			cases--
+		case t.isKeyword("FOR") && next("SYSTEM_TIME"), t.isKeyword("WITH") && next("("):
+			// A temporal clause or table hints, not FOR XML or a CTE
+		case cases == 0 && t.Kind == tokenWord && fromListEnds[strings.ToUpper(t.Text)]:
+			return items
+		}
+	}
+	return items
+}
+
+// endsTableSource reports whether tokens[i] may follow a table source: the
+// end of the statement, a comma, a closing parenthesis, or a keyword such as
+// JOIN, ON or WHERE. Anything else means the source was not read correctly.
+func endsTableSource(tokens []sqlToken, i int) bool {
+	if i >= len(tokens) {
+		return true
+	}
+	t := tokens[i]
+	switch {
+	case t.Text == "," || t.Text == ")" || t.Text == ";":
+		return true
+	case t.Kind == tokenWord:
+		return isReservedWord(t.Text) || t.isKeyword("APPLY") || t.isKeyword("WINDOW") || t.isKeyword("OUTPUT")
+	}
+	return false
+}
+
+// parseTableSource reads the table source starting at tokens[i] in a FROM
+// clause, JOIN, APPLY or MERGE ... USING: a table, view or function call, a
+// derived table, a table variable, a parenthesized join or a rowset function
+// such as CONTAINSTABLE, with its temporal clause, alias, TABLESAMPLE clause,
+// table hints and PIVOT. It returns the objects the source names, including
+// the tables rowset functions read, and the index after it; it reports false
+// when the source has a shape it does not know.
+func parseTableSource(tokens []sqlToken, i int) ([]objectReference, int, bool) {
+	if i >= len(tokens) {
+		return nil, i, false
+	}
+	var references []objectReference
+	// The alias names references[0] when the source is an object
+	named, aliased := false, false
+	opens := func(k int) bool { return k < len(tokens) && tokens[k].Text == "(" }
+
+	switch t := tokens[i]; {
+	case t.Text == "(" && i+1 < len(tokens) && (tokens[i+1].isKeyword("SELECT") || tokens[i+1].isKeyword("WITH") || tokens[i+1].isKeyword("VALUES")):
+		// A derived table, whose own FROM is found in turn
+		i = skipParenthesized(tokens, i)
+	case t.Text == "(":
+		// A parenthesized join; the sources after the first are found at
+		// their JOIN
+		inner, next, ok := parseTableSource(tokens, i+1)
+		if !ok || !endsTableSource(tokens, next) {
+			return nil, i, false
+		}
+		references = inner
+		i = skipParenthesized(tokens, i)
+	case t.Kind == tokenVariable:
+		// A table variable, or @x.nodes(...) of an xml variable
+		i++
+		if i+2 < len(tokens) && tokens[i].Text == "." && isNameToken(tokens[i+1]) && opens(i+2) {
+			i = skipParenthesized(tokens, i+2)
+		}
+	case t.Kind == tokenWord && isReservedWord(t.Text) && opens(i+1):
+		switch strings.ToUpper(t.Text) {
+		case "CONTAINSTABLE", "FREETEXTTABLE", "SEMANTICKEYPHRASETABLE", "SEMANTICSIMILARITYTABLE", "SEMANTICSIMILARITYDETAILSTABLE":
+			// The table searched is the first argument
+			table, next, ok := parseObjectReference(tokens, i+2, false)
+			if !ok || next >= len(tokens) || tokens[next].Text != "," {
+				return nil, i, false
+			}
+			table.Alias = ""
+			references = append(references, table)
+		case "OPENQUERY", "OPENROWSET", "OPENDATASOURCE", "OPENXML":
+			// Governed by MSSQL_EXTERNAL_DATA_POLICY
+		default:
+			return nil, i, false
+		}
+		i = skipParenthesized(tokens, i+1)
+		// OPENDATASOURCE(...).database.schema.object
+		for i+1 < len(tokens) && tokens[i].Text == "." && isNameToken(tokens[i+1]) {
+			i += 2
+		}
+	default:
+		reference, next, ok := parseObjectReference(tokens, i, true)
+		if !ok {
+			return nil, i, false
+		}
+		references = append(references, reference)
+		named = true
+		if reference.Function {
+			open := i
+			for tokens[open].Text != "(" {
+				open++
+			}
+			tables, ok := rowsetFunctionTables(tokens, reference, open)
+			if !ok {
+				return nil, i, false
+			}
+			references = append(references, tables...)
+		}
+		aliased = reference.Alias != ""
+		i = next
+	}
+
+	for i < len(tokens) {
+		t := tokens[i]
+		switch {
+		case t.isKeyword("FOR") && i+1 < len(tokens) && tokens[i+1].isKeyword("SYSTEM_TIME"):
+			next, ok := skipSystemTime(tokens, i+2)
+			if !ok {
+				return nil, i, false
+			}
+			i = next
+		case t.isKeyword("WITH") && opens(i+1):
+			// Table hints, or the columns of OPENJSON
+			i = skipParenthesized(tokens, i+1)
+		case t.isKeyword("TABLESAMPLE"):
+			i++
+			if i < len(tokens) && tokens[i].isKeyword("SYSTEM") {
+				i++
+			}
+			if !opens(i) {
+				return nil, i, false
+			}
+			i = skipParenthesized(tokens, i)
+			if i < len(tokens) && tokens[i].isKeyword("REPEATABLE") && opens(i+1) {
+				i = skipParenthesized(tokens, i+1)
+			}
+		case (t.isKeyword("PIVOT") || t.isKeyword("UNPIVOT")) && opens(i+1):
+			// The pivoted result takes an alias of its own
+			i = skipParenthesized(tokens, i+1)
+			named, aliased = false, false
+		case t.Text == "(":
+			// Column aliases, as in (VALUES ...) v (a, b), or a table hint
+			// written without WITH
+			i = skipParenthesized(tokens, i)
+		case !aliased && (t.isKeyword("AS") || isNameToken(t) && !t.isKeyword("OUTPUT") && !t.isKeyword("APPLY") && !t.isKeyword("WINDOW")):
+			if t.isKeyword("AS") {
+				i++
+			}
+			if i >= len(tokens) || !isNameToken(tokens[i]) {
+				return nil, i, false
+			}
+			if named {
+				references[0].Alias = unquoteIdentifier(tokens[i].Text)
+			}
+			aliased = true
+			i++
+		default:
+			return references, i, true
+		}
+	}
+	return references, i, true
+}
+
+// skipSystemTime returns the index past the period of a FOR SYSTEM_TIME
+// clause starting at tokens[i]: ALL, AS OF t, FROM t1 TO t2, BETWEEN t1 AND
+// t2 or CONTAINED IN (t1, t2), where each time is a literal or variable.
+func skipSystemTime(tokens []sqlToken, i int) (int, bool) {
+	time := func(k int) bool {
+		return k < len(tokens) && (tokens[k].Kind == tokenString || tokens[k].Kind == tokenVariable)
+	}
+	keyword := func(k int, word string) bool {
+		return k < len(tokens) && tokens[k].isKeyword(word)
+	}
+	switch {
+	case keyword(i, "ALL"):
+		return i + 1, true
+	case keyword(i, "AS") && keyword(i+1, "OF") && time(i+2):
+		return i + 3, true
+	case keyword(i, "FROM") && time(i+1) && keyword(i+2, "TO") && time(i+3),
+		keyword(i, "BETWEEN") && time(i+1) && keyword(i+2, "AND") && time(i+3):
+		return i + 4, true
+	case keyword(i, "CONTAINED") && keyword(i+1, "IN") && i+2 < len(tokens) && tokens[i+2].Text == "(":
+		return skipParenthesized(tokens, i+2), true
+	}
+	return i, false
+}
+
+// builtinRowsetFunctions are the table-valued functions of SQL Server that
+// take no schema, as opposed to user-defined ones called without theirs.
+var builtinRowsetFunctions = map[string]bool{
+	"OPENJSON": true, "STRING_SPLIT": true, "GENERATE_SERIES": true, "CHANGETABLE": true, "PREDICT": true,
+}
+
+// IsBuiltin reports whether the reference calls one of SQL Server's own
+// rowset functions, such as OPENJSON.
+func (r objectReference) IsBuiltin() bool {
+	return r.Function && len(r.Parts) == 1 && builtinRowsetFunctions[strings.ToUpper(r.Parts[0])]
+}
+
+// rowsetFunctionTables returns the tables named in the arguments of a
+// built-in rowset function reading one, CHANGETABLE(CHANGES t, ...) and
+// PREDICT(..., DATA = t), whose opening parenthesis is tokens[open]. It
+// reports false when the table argument cannot be read.
+func rowsetFunctionTables(tokens []sqlToken, reference objectReference, open int) ([]objectReference, bool) {
+	if !reference.IsBuiltin() {
+		return nil, true
+	}
+	argument := -1
+	switch strings.ToUpper(reference.Parts[0]) {
+	case "CHANGETABLE":
+		if open+1 < len(tokens) && (tokens[open+1].isKeyword("CHANGES") || tokens[open+1].isKeyword("VERSION")) {
+			argument = open + 2
+		}
+	case "PREDICT":
+		end := skipParenthesized(tokens, open)
+		for k := open + 1; k+2 < end; k++ {
+			if tokens[k].Depth == tokens[open].Depth+1 && tokens[k].isKeyword("DATA") && tokens[k+1].Text == "=" {
+				argument = k + 2
+			}
+		}
+	default:
+		return nil, true
+	}
+	if argument < 0 {
+		return nil, false
+	}
+	table, _, ok := parseObjectReference(tokens, argument, false)
+	if !ok {
+		return nil, false
+	}
+	table.Alias = ""
+	return []objectReference{table}, true
+}
+
+// cteNames returns the lower-cased names of the common table expressions a
+// statement defines, introduced as "WITH name AS (" or ", name AS (".
+func cteNames(tokens []sqlToken) map[string]bool {
+	ctes := make(map[string]bool)
+	for i := 1; i+2 < len(tokens); i++ {
+		if (tokens[i-1].isKeyword("WITH") || tokens[i-1].Text == ",") && isNameToken(tokens[i]) &&
+			tokens[i+1].isKeyword("AS") && tokens[i+2].Text == "(" {
+			ctes[strings.ToLower(unquoteIdentifier(tokens[i].Text))] = true
+		}
+	}
+	return ctes
+}
+
+// writeTargets lists the tables a statement changes: the targets of INSERT,
+// UPDATE, DELETE, MERGE and SELECT ... INTO, and the tables of CREATE,
+// ALTER, DROP and TRUNCATE TABLE and CREATE INDEX. Table variables are
+// listed by their @name, and an alias given to UPDATE or DELETE is resolved
+// to its table. It reports false when the statement changes something it
+// cannot attribute to a table, such as through EXEC or a bare procedure
+// call, GRANT, CREATE PROCEDURE, DBCC, KILL, SHUTDOWN, DISABLE TRIGGER or an
+// update through a CTE: every write isWriteOperation counts must either be
+// listed here or make it report false.
+func writeTargets(query string) ([]objectReference, bool) {
+	tokens := significantTokens(tokenizeSQL(query))
+	ctes := cteNames(tokens)
+	references := findObjectReferences(query)
+
+	var targets []objectReference
+	target := func(i int) bool {
+		if i >= len(tokens) {
+			return false
+		}
+		if tokens[i].Kind == tokenVariable {
+			if strings.HasPrefix(tokens[i].Text, "@@") {
+				return false
+			}
+			targets = append(targets, objectReference{Parts: []string{tokens[i].Text}, Pos: tokens[i].Pos, End: tokens[i].Pos + len(tokens[i].Text)})
+			return true
+		}
+		reference, _, ok := parseObjectReference(tokens, i, false)
+		if !ok {
+			return false
+		}
+		if len(reference.Parts) == 1 {
+			name := reference.Parts[0]
+			for _, candidate := range references {
+				if candidate.Alias != "" && strings.EqualFold(candidate.Alias, name) && !candidate.Function {
+					reference = candidate
+					break
+				}
+			}
+			if len(reference.Parts) == 1 && ctes[strings.ToLower(name)] {
+				return false
+			}
+		}
+		targets = append(targets, reference)
+		return true
+	}
+	skip := func(i int, words ...string) int {
+		for _, word := range words {
+			if i < len(tokens) && tokens[i].isKeyword(word) {
+				i++
+			}
+		}
+		return i
+	}
+
+	for i, t := range tokens {
+		if t.Kind != tokenWord {
+			continue
+		}
+		// The actions of a MERGE apply to its target, listed with the MERGE
+		if i > 0 && tokens[i-1].isKeyword("THEN") {
+			continue
+		}
+		// A batch starting with a name calls that procedure, as if with EXEC
+		if i == 0 && isNameToken(t) && !t.isKeyword("RECEIVE") {
+			return nil, false
+		}
+		next := func(word string) bool {
+			return i+1 < len(tokens) && tokens[i+1].isKeyword(word)
+		}
+		ok := true
+		switch {
+		case t.isKeyword("CREATE"):
+			j := skip(i+1, "UNIQUE", "CLUSTERED", "NONCLUSTERED", "COLUMNSTORE")
+			switch {
+			case j < len(tokens) && tokens[j].isKeyword("TABLE"):
+				ok = target(j + 1)
+			case j < len(tokens) && tokens[j].isKeyword("INDEX"):
+				// CREATE INDEX name ON table
+				ok = j+3 < len(tokens) && tokens[j+2].isKeyword("ON") && target(j+3)
+			default:
+				ok = false
+			}
+		case t.isKeyword("ALTER"), t.isKeyword("TRUNCATE"):
+			// ALTER TABLE t ALTER COLUMN c is listed with the first ALTER
+			if t.isKeyword("ALTER") && i+1 < len(tokens) && tokens[i+1].isKeyword("COLUMN") {
+				continue
+			}
+			ok = i+1 < len(tokens) && tokens[i+1].isKeyword("TABLE") && target(i+2)
+		case t.isKeyword("DROP"):
+			// ALTER TABLE t DROP COLUMN c is listed with its ALTER
+			if i+1 < len(tokens) && (tokens[i+1].isKeyword("COLUMN") || tokens[i+1].isKeyword("CONSTRAINT")) {
+				continue
+			}
+			ok = i+1 < len(tokens) && tokens[i+1].isKeyword("TABLE") && target(skip(i+2, "IF", "EXISTS"))
+		case t.isKeyword("INSERT"), t.isKeyword("MERGE"):
+			ok = target(skip(skipTop(tokens, i+1), "INTO"))
+		case t.isKeyword("UPDATE"):
+			ok = target(skipTop(tokens, i+1))
+		case t.isKeyword("DELETE"):
+			ok = target(skip(skipTop(tokens, i+1), "FROM"))
+		case t.isKeyword("INTO"):
+			// SELECT ... INTO t and OUTPUT ... INTO t; INSERT INTO and MERGE
+			// INTO were listed with their statement
+			if i > 0 && (tokens[i-1].isKeyword("INSERT") || tokens[i-1].isKeyword("MERGE")) {
+				continue
+			}
+			ok = target(i + 1)
+		case t.isKeyword("EXEC"), t.isKeyword("EXECUTE"), t.isKeyword("GRANT"), t.isKeyword("REVOKE"),
+			t.isKeyword("DENY"), t.isKeyword("UPSERT"), t.isKeyword("USE"), t.isKeyword("BULK"),
+			t.isKeyword("BACKUP"), t.isKeyword("RESTORE"), t.isKeyword("DBCC"), t.isKeyword("KILL"),
+			t.isKeyword("SHUTDOWN"), t.isKeyword("RECONFIGURE"), t.isKeyword("CHECKPOINT"),
+			t.isKeyword("WRITETEXT"), t.isKeyword("UPDATETEXT"), t.isKeyword("SETUSER"):
+			ok = false
+		case t.isKeyword("ENABLE"), t.isKeyword("DISABLE"):
+			ok = !next("TRIGGER")
+		case t.isKeyword("SEND"):
+			ok = !next("ON")
+		case t.isKeyword("RECEIVE"):
+			ok = i > 0 && tokens[i-1].Text != ";"
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	return targets, true
+}
+
+// skipTop returns the index past the TOP (n) [PERCENT] clause starting at
+// tokens[i], as in UPDATE TOP (10) PERCENT t or DELETE TOP (10) FROM t, or
+// i when there is none.
+func skipTop(tokens []sqlToken, i int) int {
+	if i+1 < len(tokens) && tokens[i].isKeyword("TOP") && tokens[i+1].Text == "(" {
+		i = skipParenthesized(tokens, i+1)
+		if i < len(tokens) && tokens[i].isKeyword("PERCENT") {
+			i++
+		}
+	}
+	return i
+}
+
+func isNameToken(t sqlToken) bool {
+	return (t.Kind == tokenWord && !isReservedWord(t.Text)) || t.Kind == tokenQuotedIdentifier
+}
+
+// isInsideCall reports whether tokens[i] sits in the argument list of a call to
+// the named function.
+func isInsideCall(tokens []sqlToken, i int, function string) bool {
+	for j := i - 1; j > 0; j-- {
+		if tokens[j].Text == "(" && tokens[j].Depth == tokens[i].Depth-1 {
+			return tokens[j-1].isKeyword(function)
+		}
+	}
+	return false
+}
+
+// parseObjectReference reads a multi-part object name with its optional alias
+// starting at tokens[i]. It returns the index of the first token after it.
+func parseObjectReference(tokens []sqlToken, i int, allowCall bool) (objectReference, int, bool) {
+	if i >= len(tokens) || !isNameToken(tokens[i]) {
+		return objectReference{}, i, false
+	}
+
+	reference := objectReference{Pos: tokens[i].Pos}
+	for i < len(tokens) {
+		if isNameToken(tokens[i]) {
+			reference.Parts = append(reference.Parts, unquoteIdentifier(tokens[i].Text))
+			i++
+		}
+		// db..table leaves the schema part empty
+		if i < len(tokens) && tokens[i].Text == "." {
+			if i+1 < len(tokens) && tokens[i+1].Text == "." {
+				reference.Parts = append(reference.Parts, "")
+			}
+			i++
+			continue
+		}
+		break
+	}
+	if len(reference.Parts) == 0 {
+		return objectReference{}, i, false
+	}
+	reference.End = tokens[i-1].Pos + len(tokens[i-1].Text)
+
+	if allowCall && i < len(tokens) && tokens[i].Text == "(" {
+		reference.Function = true
+		i = skipParenthesized(tokens, i)
+	}
+
+	// Only the common "name [AS] alias" shape is recognized
+	if i < len(tokens) && tokens[i].isKeyword("AS") {
+		i++
+	}
+	if i < len(tokens) && isNameToken(tokens[i]) && !tokens[i].isKeyword("OUTPUT") && !tokens[i].isKeyword("APPLY") {
+		reference.Alias = unquoteIdentifier(tokens[i].Text)
+		i++
+	}
+	return reference, i, true
+}
@@ -0,0 +1,191 @@
+package mssqlmcp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenizeSQL(t *testing.T) {
+	tokens := tokenizeSQL("SELECT [Delete], N'it''s -- DROP' /* a /* nested */ UPDATE */ FROM (dbo.t) -- DELETE\nWHERE @x = 1.5")
+	want := []sqlToken{
+		{tokenWord, "SELECT", 0, 0},
+		{tokenQuotedIdentifier, "[Delete]", 7, 0},
+		{tokenSymbol, ",", 15, 0},
+		{tokenString, "N'it''s -- DROP'", 17, 0},
+		{tokenComment, "/* a /* nested */ UPDATE */", 34, 0},
+		{tokenWord, "FROM", 62, 0},
+		{tokenSymbol, "(", 67, 0},
+		{tokenWord, "dbo", 68, 1},
+		{tokenSymbol, ".", 71, 1},
+		{tokenWord, "t", 72, 1},
+		{tokenSymbol, ")", 73, 0},
+		{tokenComment, "-- DELETE", 75, 0},
+		{tokenWord, "WHERE", 85, 0},
+		{tokenVariable, "@x", 91, 0},
+		{tokenSymbol, "=", 94, 0},
+		{tokenNumber, "1.5", 96, 0},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("tokenizeSQL = %v, want %v", tokens, want)
+	}
+}
+
+func TestSplitBatches(t *testing.T) {
+	script := "SELECT 'GO'\nGO\n-- only a comment\nGO\nSELECT 1 /*\nGO\n*/\ngo 3 -- three times\nSELECT GO FROM t\nGO"
+	batches, err := splitBatches(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []scriptBatch{
+		{Text: "SELECT 'GO'", Line: 1, Repeat: 1},
+		{Text: "SELECT 1 /*\nGO\n*/", Line: 5, Repeat: 3},
+		{Text: "SELECT GO FROM t", Line: 9, Repeat: 1},
+	}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("splitBatches = %+v, want %+v", batches, want)
+	}
+
+	if _, err := splitBatches("SELECT 1\nGO 0"); err == nil {
+		t.Error("GO 0 accepted")
+	}
+}
+
+func TestLocalWrites(t *testing.T) {
+	for query, local := range map[string]bool{
+		"DECLARE @t TABLE (x int); INSERT INTO @t VALUES (1); SELECT * FROM @t":                                true,
+		"CREATE TABLE #work (x int); INSERT INTO #work SELECT CustomerID FROM dbo.Customers; DROP TABLE #work": true,
+		"INSERT INTO ##shared VALUES (1)": false,
+		"xp_cmdshell 'whoami'; DECLARE @t TABLE (x int); INSERT INTO @t VALUES (1); SELECT * FROM @t": false,
+		"DECLARE @t TABLE (x int); INSERT INTO @t VALUES (1); SHUTDOWN":                               false,
+		"DECLARE @t TABLE (x int); INSERT INTO @t VALUES (1); KILL 55":                                false,
+		"DECLARE @t TABLE (x int); INSERT INTO @t VALUES (1); BACKUP DATABASE x TO DISK = 'x.bak'":    false,
+		"DECLARE @t TABLE (x int); INSERT INTO @t VALUES (1); DBCC SHRINKDATABASE(0)":                 false,
+		"DECLARE @t TABLE (x int); INSERT INTO @t VALUES (1); RECONFIGURE":                            false,
+		"DECLARE @t TABLE (x int); INSERT INTO @t VALUES (1); DISABLE TRIGGER ALL ON dbo.Orders":      false,
+		"DECLARE @t TABLE (x int); INSERT INTO @t VALUES (1); WRITETEXT dbo.Docs.body @ptr 'x'":       false,
+	} {
+		if got, _ := localWrites(query); got != local {
+			t.Errorf("localWrites(%q) = %v, want %v", query, got, local)
+		}
+	}
+}
+
+func TestWritableTables(t *testing.T) {
+	t.Setenv("MSSQL_WRITABLE_TABLES", "staging.*")
+
+	config := testConfig(t)
+	for statement, allowed := range map[string]bool{
+		"INSERT INTO staging.x VALUES (1)":           true,
+		"UPDATE s SET x = 1 FROM staging.x AS s":     true,
+		"DELETE FROM dbo.Orders":                     false,
+		"DISABLE TRIGGER ALL ON dbo.Orders":          false,
+		"DBCC SHRINKDATABASE(0)":                     false,
+		"WRITETEXT dbo.Docs.body @ptr 'x'":           false,
+		"INSERT INTO staging.x VALUES (1); KILL 55":  false,
+		"INSERT INTO staging.x VALUES (1); SHUTDOWN": false,
+		"EXEC staging.load":                          false,
+	} {
+		if err := checkWritableTables(config, statement); (err == nil) != allowed {
+			t.Errorf("checkWritableTables(%q) = %v, want allowed %v", statement, err, allowed)
+		}
+	}
+}
+
+func TestDryRunnable(t *testing.T) {
+	for statement, allowed := range map[string]bool{
+		"UPDATE dbo.Orders SET Note = 'x' WHERE OrderID = 1":         true,
+		"UPDATE dbo.Orders SET Note = 'x' WHERE OrderID = 1; COMMIT": false,
+		"DELETE FROM dbo.Orders WHERE OrderID = 1; COMMIT TRAN":      false,
+		"SAVE TRANSACTION s; DELETE FROM dbo.Orders":                 false,
+		"EXEC dbo.ArchiveOrders":                                     false,
+		"dbo.ArchiveOrders":                                          false,
+	} {
+		if err := checkDryRunnable(statement); (err == nil) != allowed {
+			t.Errorf("checkDryRunnable(%q) = %v, want allowed %v", statement, err, allowed)
+		}
+	}
+}
+
+func TestFindObjectReferences(t *testing.T) {
+	for query, want := range map[string][]string{
+		"SELECT * FROM dbo.A WITH (NOLOCK), dbo.B":                                      {"dbo.A", "dbo.B"},
+		"SELECT * FROM dbo.A a WITH (NOLOCK, INDEX(ix)), dbo.B AS b":                    {"dbo.A a", "dbo.B b"},
+		"SELECT * FROM dbo.A (NOLOCK), dbo.B":                                           {"dbo.A()", "dbo.B"},
+		"SELECT * FROM dbo.A a TABLESAMPLE SYSTEM (10 PERCENT) REPEATABLE (5), dbo.B":   {"dbo.A a", "dbo.B"},
+		"SELECT * FROM dbo.A a TABLESAMPLE (100 ROWS), dbo.B":                           {"dbo.A a", "dbo.B"},
+		"SELECT * FROM dbo.A FOR SYSTEM_TIME ALL, dbo.B":                                {"dbo.A", "dbo.B"},
+		"SELECT * FROM dbo.A FOR SYSTEM_TIME AS OF '2024-01-01' AS h, dbo.B":            {"dbo.A h", "dbo.B"},
+		"SELECT * FROM dbo.A FOR SYSTEM_TIME FROM @a TO @b h JOIN dbo.B b ON 1 = 1":     {"dbo.A h", "dbo.B b"},
+		"SELECT * FROM dbo.A FOR SYSTEM_TIME CONTAINED IN (@a, @b), dbo.B":              {"dbo.A", "dbo.B"},
+		"SELECT * FROM (SELECT x FROM dbo.A) AS d, dbo.B":                               {"dbo.A", "dbo.B"},
+		"SELECT * FROM (VALUES (1, 2)) v (a, b), dbo.B":                                 {"dbo.B"},
+		"SELECT * FROM @t t, dbo.B":                                                     {"dbo.B"},
+		"SELECT * FROM (dbo.A a JOIN dbo.B b ON a.id = b.id), dbo.C":                    {"dbo.A a", "dbo.B b", "dbo.C"},
+		"SELECT * FROM dbo.A a JOIN dbo.B b ON b.id = COALESCE(a.x, a.y), dbo.C":        {"dbo.A a", "dbo.B b", "dbo.C"},
+		"SELECT * FROM dbo.A PIVOT (SUM(x) FOR y IN ([1], [2])) AS p, dbo.B":            {"dbo.A", "dbo.B"},
+		"SELECT * FROM CONTAINSTABLE(dbo.A, Body, 'x') AS k JOIN dbo.B b ON 1 = 1":      {"dbo.A", "dbo.B b"},
+		"SELECT * FROM FREETEXTTABLE(A, *, 'x') k, dbo.B":                               {"A", "dbo.B"},
+		"SELECT * FROM CHANGETABLE(CHANGES dbo.A, @v) AS c":                             {"CHANGETABLE() c", "dbo.A"},
+		"SELECT * FROM OPENJSON(@j) WITH (a int '$.a') AS j, dbo.B":                     {"OPENJSON() j", "dbo.B"},
+		"SELECT a, b FROM dbo.A WHERE x IN (1, 2) ORDER BY a, b":                        {"dbo.A"},
+		"SELECT a FROM dbo.A GROUP BY a, b SELECT c, d FROM dbo.B":                      {"dbo.A", "dbo.B"},
+		"SELECT CASE WHEN a IS DISTINCT FROM b THEN 1 END, TRIM('x' FROM c) FROM dbo.A": {"dbo.A"},
+		"DECLARE c CURSOR FOR SELECT x FROM dbo.A; FETCH NEXT FROM c INTO @x":           {"dbo.A"},
+		"INSERT INTO dbo.A (x, y) SELECT x, y FROM dbo.B":                               {"dbo.A", "dbo.B"},
+	} {
+		var got []string
+		for _, reference := range findObjectReferences(query) {
+			name := reference.Name()
+			if reference.Function {
+				name += "()"
+			}
+			if reference.Alias != "" {
+				name += " " + reference.Alias
+			}
+			got = append(got, name)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("findObjectReferences(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestResolveObjectReferences(t *testing.T) {
+	for query, want := range map[string][]string{
+		"SELECT dbo.Fn(x), LEFT(x, 1) FROM dbo.A":                            {"dbo.A", "dbo.Fn()"},
+		"SELECT * FROM dbo.A WHERE x > Sales.dbo.Limit()":                    {"dbo.A", "Sales.dbo.Limit()"},
+		"SELECT a.Doc.value('.', 'int'), Doc.value('.', 'int') FROM dbo.A a": {"dbo.A", "Doc.value()"},
+		"SELECT A.dbo.Secret() FROM dbo.T AS A":                              {"dbo.T", "A.dbo.Secret()"},
+		"SELECT geography::Point(1, 2, 4326).STAsText()":                     nil,
+	} {
+		references, err := resolveObjectReferences(query)
+		if err != nil {
+			t.Errorf("resolveObjectReferences(%q): %v", query, err)
+			continue
+		}
+		var got []string
+		for _, reference := range references {
+			name := reference.Name()
+			if reference.Function {
+				name += "()"
+			}
+			got = append(got, name)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("resolveObjectReferences(%q) = %q, want %q", query, got, want)
+		}
+	}
+
+	// Sources that cannot be read fail rather than drop what follows them
+	for _, query := range []string{
+		"SELECT * FROM ::fn_virtualfilestats(1, 1), dbo.B",
+		"SELECT * FROM dbo.A FOR SYSTEM_TIME AS OF GETDATE(), dbo.B",
+		"SELECT * FROM dbo.A a b, dbo.B",
+		"SELECT * FROM dbo.A TABLESAMPLE 10, dbo.B",
+		"SELECT * FROM CONTAINSTABLE(@t, *, 'x') k",
+	} {
+		if references, err := resolveObjectReferences(query); err == nil {
+			t.Errorf("resolveObjectReferences(%q) = %v, want an error", query, references)
+		}
+	}
+}
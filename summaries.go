@@ -0,0 +1,215 @@
+package mssqlmcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often configured table summaries are recomputed by default
+const DEFAULT_SUMMARY_INTERVAL = 3600 // seconds
+
+// tableSummary caches the profile of every summarized column of a table.
+type tableSummary struct {
+	Schema     string            `json:"schema"`
+	Table      string            `json:"table"`
+	RowCount   int64             `json:"rowCount"`
+	Profiles   map[string]string `json:"profiles"` // keyed by lower-case column name
+	ComputedAt time.Time         `json:"computedAt"`
+}
+
+var (
+	summariesMu sync.Mutex
+	summaries   = make(map[string]*tableSummary)
+)
+
+func summaryKey(schema, table string) string {
+	return strings.ToLower(schema + "." + table)
+}
+
+// cachedProfile returns the summarized profile of a column, with a note on
+// how old it is. Masked columns are profiled afresh, as a summary saved
+// before the column was masked would show its values.
+func cachedProfile(config *DbConfig, schema, table, column string) (string, bool) {
+	if columnMasked(config, schema, table, column) {
+		return "", false
+	}
+
+	summariesMu.Lock()
+	defer summariesMu.Unlock()
+
+	summary, ok := summaries[summaryKey(schema, table)]
+	if !ok {
+		return "", false
+	}
+	profile, ok := summary.Profiles[strings.ToLower(column)]
+	if !ok {
+		return "", false
+	}
+
+	age := time.Since(summary.ComputedAt).Round(time.Minute)
+	return fmt.Sprintf("%s\nFrom the local summary computed %s ago (%s); pass refresh=true to query the table instead.\n",
+		profile, age, summary.ComputedAt.Format(time.RFC3339)), true
+}
+
+// summaryTarget is a table to summarize, with the columns to profile (all
+// columns when empty), parsed from entries such as dbo.Orders or
+// dbo.Orders:OrderDate|Status in MSSQL_SUMMARY_TABLES.
+type summaryTarget struct {
+	schema, table string
+	columns       []string
+}
+
+func parseSummaryTargets(entries []string) ([]summaryTarget, error) {
+	var targets []summaryTarget
+	for _, entry := range entries {
+		name, columns, _ := strings.Cut(entry, ":")
+		schema, table, err := parseObjectName(name)
+		if err != nil {
+			return nil, err
+		}
+		target := summaryTarget{schema: schema, table: table}
+		for _, column := range strings.Split(columns, "|") {
+			if column = strings.TrimSpace(column); column != "" {
+				target.columns = append(target.columns, column)
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// summarizeTable profiles the target's columns with profileColumn, which
+// samples large tables, and records the result.
+func summarizeTable(target summaryTarget) error {
+	columns := target.columns
+	if len(columns) == 0 {
+		rows, err := getTableColumns(target.schema, target.table)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			columns = append(columns, fmt.Sprintf("%v", row["COLUMN_NAME"]))
+		}
+	}
+
+	rowCount, err := estimateRowCount(target.schema, target.table)
+	if err != nil {
+		return err
+	}
+
+	summary := &tableSummary{
+		Schema:   target.schema,
+		Table:    target.table,
+		RowCount: rowCount,
+		Profiles: make(map[string]string),
+	}
+	for _, column := range columns {
+		profile, err := profileColumn(target.schema, target.table, column)
+		if err != nil {
+			log.Printf("Error summarizing %s.%s.%s: %v", target.schema, target.table, column, err)
+			continue
+		}
+		summary.Profiles[strings.ToLower(column)] = profile
+	}
+	summary.ComputedAt = time.Now()
+
+	summariesMu.Lock()
+	summaries[summaryKey(target.schema, target.table)] = summary
+	summariesMu.Unlock()
+	return nil
+}
+
+// loadSummaries restores summaries saved by an earlier run.
+func loadSummaries(path string) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var saved []*tableSummary
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return err
+	}
+
+	summariesMu.Lock()
+	defer summariesMu.Unlock()
+	for _, summary := range saved {
+		summaries[summaryKey(summary.Schema, summary.Table)] = summary
+	}
+	return nil
+}
+
+// saveSummaries writes all summaries to the file, replacing it atomically.
+func saveSummaries(path string) error {
+	summariesMu.Lock()
+	saved := make([]*tableSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		saved = append(saved, summary)
+	}
+	content, err := json.MarshalIndent(saved, "", "  ")
+	summariesMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	temporary := path + ".tmp"
+	if err := os.WriteFile(temporary, content, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(temporary, path)
+}
+
+// startSummaryJob keeps summaries of the tables in MSSQL_SUMMARY_TABLES
+// current, recomputing them every MSSQL_SUMMARY_INTERVAL seconds and saving
+// them to MSSQL_SUMMARY_FILE when set.
+func startSummaryJob(config *DbConfig) {
+	if len(config.SummaryTables) == 0 {
+		return
+	}
+
+	targets, err := parseSummaryTargets(config.SummaryTables)
+	if err != nil {
+		log.Printf("Invalid MSSQL_SUMMARY_TABLES: %v", err)
+		return
+	}
+	if config.SummaryFile != "" {
+		if err := loadSummaries(config.SummaryFile); err != nil {
+			log.Printf("Could not load summaries from %s: %v", config.SummaryFile, err)
+		}
+	}
+
+	interval := time.Duration(config.SummaryInterval) * time.Second
+	go func() {
+		for {
+			for _, target := range targets {
+				// Summaries restored from disk are reused until they are due
+				summariesMu.Lock()
+				existing := summaries[summaryKey(target.schema, target.table)]
+				summariesMu.Unlock()
+				if existing != nil && time.Since(existing.ComputedAt) < interval {
+					continue
+				}
+
+				if err := summarizeTable(target); err != nil {
+					log.Printf("Error summarizing %s.%s: %v", target.schema, target.table, err)
+				}
+			}
+			if config.SummaryFile != "" {
+				if err := saveSummaries(config.SummaryFile); err != nil {
+					log.Printf("Could not save summaries to %s: %v", config.SummaryFile, err)
+				}
+			}
+			time.Sleep(time.Minute)
+		}
+	}()
+	log.Printf("Maintaining summaries of %d tables every %s", len(targets), interval)
+}
@@ -0,0 +1,134 @@
+package mssqlmcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Value of the mcp_server key, naming this server to server-side auditing
+const SESSION_CONTEXT_SERVER = "mssql_mcp_server_go"
+
+// queryTag attributes the queries of a tool call to the conversation and
+// call they serve.
+type queryTag struct {
+	Session   string
+	Tool      string
+	RequestID string
+}
+
+type queryTagKey struct{}
+
+var (
+	// The call being served; stdio clients send one call at a time, so
+	// queries issued without a context belong to it
+	activeTagMu sync.Mutex
+	activeTag   *queryTag
+
+	// Stands in for the session ID of stdio clients, which all share one
+	processSessionID = newRequestID()
+)
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// tagToolCalls is middleware giving each tool call a request ID and making
+// its tag the one connections are labelled with while it runs.
+func tagToolCalls(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		session := sessionIDFromContext(ctx)
+		if session == "default" {
+			session = processSessionID
+		}
+		tag := &queryTag{Session: session, Tool: request.Params.Name, RequestID: newRequestID()}
+		log.Printf("Tool call %s, request %s", tag.Tool, tag.RequestID)
+
+		activeTagMu.Lock()
+		activeTag = tag
+		activeTagMu.Unlock()
+		defer func() {
+			activeTagMu.Lock()
+			if activeTag == tag {
+				activeTag = nil
+			}
+			activeTagMu.Unlock()
+		}()
+
+		return next(context.WithValue(ctx, queryTagKey{}, tag), request)
+	}
+}
+
+// queryTagFromContext returns the tag of the tool call a context belongs to,
+// or of the call being served when the context carries none.
+func queryTagFromContext(ctx context.Context) *queryTag {
+	if tag, ok := ctx.Value(queryTagKey{}).(*queryTag); ok {
+		return tag
+	}
+	return activeQueryTag()
+}
+
+// activeQueryTag returns the tag of the call being served, or nil between
+// calls.
+func activeQueryTag() *queryTag {
+	activeTagMu.Lock()
+	defer activeTagMu.Unlock()
+	return activeTag
+}
+
+// sessionContextSQL labels a connection with the tag in SESSION_CONTEXT
+// (mcp_server, mcp_session, tool and request_id) and CONTEXT_INFO, where SQL
+// Audit and extended events can read it. Without a tag only mcp_server is
+// set. sp_set_session_context is skipped on servers before SQL Server 2016.
+func sessionContextSQL(tag *queryTag) string {
+	values := [][2]string{{"mcp_server", SESSION_CONTEXT_SERVER}}
+	contextInfo := "mcp"
+	if tag != nil {
+		values = append(values, [][2]string{
+			{"mcp_session", tag.Session},
+			{"tool", tag.Tool},
+			{"request_id", tag.RequestID},
+		}...)
+		contextInfo = fmt.Sprintf("mcp %s %s %s", tag.Session, tag.Tool, tag.RequestID)
+	}
+
+	var statements []string
+	for _, value := range values {
+		statements = append(statements, fmt.Sprintf("EXEC sys.sp_set_session_context @key = %s, @value = %s;", quoteString(value[0]), quoteString(value[1])))
+	}
+	if len(contextInfo) > 128 {
+		contextInfo = contextInfo[:128]
+	}
+	return fmt.Sprintf("IF OBJECT_ID('sys.sp_set_session_context') IS NOT NULL BEGIN %s END; SET CONTEXT_INFO 0x%s;",
+		strings.Join(statements, " "), hex.EncodeToString([]byte(contextInfo)))
+}
+
+// tagQuery prefixes a statement with a comment naming the tool call it
+// serves, e.g. /* mcp tool=execute_sql session=... req=... */, which
+// sp_whoisactive, Query Store and traces show with the statement text. The
+// request ID makes each call's text unique, so cached plans are not reused
+// across calls; MSSQL_QUERY_COMMENTS=false turns the comments off.
+func tagQuery(ctx context.Context, config *DbConfig, query string) string {
+	if !config.QueryComments {
+		return query
+	}
+	tag := queryTagFromContext(ctx)
+	if tag == nil {
+		return query
+	}
+	// The values must not end the comment early
+	clean := strings.NewReplacer("*/", "", "/*", "", "\n", " ", "\r", " ")
+	return fmt.Sprintf("/* mcp tool=%s session=%s req=%s */ %s",
+		clean.Replace(tag.Tool), clean.Replace(tag.Session), clean.Replace(tag.RequestID), query)
+}
@@ -0,0 +1,175 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Maximum number of rows query_history returns when no limit is given
+const DEFAULT_HISTORY_ROWS = 100
+
+// temporalTable describes the system versioning of a table.
+type temporalTable struct {
+	HistoryTable string // schema.table holding previous row versions
+	PeriodStart  string
+	PeriodEnd    string
+}
+
+// getTemporalTable returns the versioning details of a system-versioned
+// temporal table, or nil for any other table.
+func getTemporalTable(schema, table string) (*temporalTable, error) {
+	data, err := executeQuery(`SELECT OBJECT_SCHEMA_NAME(t.history_table_id) + '.' + OBJECT_NAME(t.history_table_id) AS history_table,
+			cs.name AS period_start, ce.name AS period_end
+		FROM sys.tables t
+		JOIN sys.periods p ON p.object_id = t.object_id
+		JOIN sys.columns cs ON cs.object_id = t.object_id AND cs.column_id = p.start_column_id
+		JOIN sys.columns ce ON ce.object_id = t.object_id AND ce.column_id = p.end_column_id
+		WHERE t.object_id = OBJECT_ID(@p1) AND t.temporal_type = 2`, true, quoteIdentifier(schema)+"."+quoteIdentifier(table))
+	if err != nil {
+		return nil, err
+	}
+
+	rows := data["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &temporalTable{
+		HistoryTable: fmt.Sprintf("%v", rows[0]["history_table"]),
+		PeriodStart:  fmt.Sprintf("%v", rows[0]["period_start"]),
+		PeriodEnd:    fmt.Sprintf("%v", rows[0]["period_end"]),
+	}, nil
+}
+
+// temporalNote explains how to query the history of a temporal table.
+func temporalNote(temporal *temporalTable) string {
+	return fmt.Sprintf("This is a system-versioned temporal table: previous row versions are kept in %s and each row is valid from %s to %s (UTC). "+
+		"Query past states with FOR SYSTEM_TIME AS OF / BETWEEN, or the query_history tool.",
+		temporal.HistoryTable, temporal.PeriodStart, temporal.PeriodEnd)
+}
+
+// registerTemporalTools adds a tool for querying the history of system-versioned tables.
+func registerTemporalTools(s *server.MCPServer) {
+	historyTool := mcp.NewTool("query_history",
+		mcp.WithDescription("Query past versions of rows in a system-versioned temporal table, either as they were at one point in time or every version valid during a period. Times are UTC."),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Temporal table name, optionally schema-qualified (e.g. dbo.Employees)"),
+		),
+		mcp.WithString("as_of",
+			mcp.Description("Return rows as they were at this time, e.g. 2024-05-14T09:00:00"),
+		),
+		mcp.WithString("from",
+			mcp.Description("Start of a period; with to, return every row version valid at some point in the period"),
+		),
+		mcp.WithString("to",
+			mcp.Description("End of the period started by from"),
+		),
+		mcp.WithString("where",
+			mcp.Description("Optional filter selecting the rows of interest, e.g. EmployeeID = 42"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of rows to return (default 100)"),
+		),
+		mcp.WithString("tenant",
+			mcp.Description("Tenant to query on a multi-tenant database, unless the server is pinned to one"),
+		),
+	)
+
+	s.AddTool(historyTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, ok := request.Params.Arguments["table"].(string)
+		if !ok || name == "" {
+			return mcp.NewToolResultError("Table is required"), nil
+		}
+		schema, table, err := resolveObjectName(name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		asOf, _ := request.Params.Arguments["as_of"].(string)
+		from, _ := request.Params.Arguments["from"].(string)
+		to, _ := request.Params.Arguments["to"].(string)
+		filter, _ := request.Params.Arguments["where"].(string)
+		limit := DEFAULT_HISTORY_ROWS
+		if value, ok := request.Params.Arguments["limit"].(float64); ok && value > 0 {
+			limit = int(value)
+		}
+
+		var period string
+		var args []interface{}
+		switch {
+		case asOf != "" && from == "" && to == "":
+			period = "AS OF @p1"
+			args = append(args, asOf)
+		case asOf == "" && from != "" && to != "":
+			period = "BETWEEN @p1 AND @p2"
+			args = append(args, from, to)
+		default:
+			return mcp.NewToolResultError("Provide either as_of, or both from and to"), nil
+		}
+
+		temporal, err := getTemporalTable(schema, table)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading table: %v", err)), nil
+		}
+		if temporal == nil {
+			return mcp.NewToolResultError(fmt.Sprintf("%s.%s is not a system-versioned temporal table", schema, table)), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		columns, err := getTableColumns(schema, table)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading table: %v", err)), nil
+		}
+		tenant, _ := request.Params.Arguments["tenant"].(string)
+		conditions, err := tenantConditions(config, tenant, schema, table, columns)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Query not permitted: %v", err)), nil
+		}
+		if strings.TrimSpace(filter) != "" {
+			// Subqueries in the filter are checked and scoped like any query
+			const prefix = "SELECT 1 WHERE "
+			scoped, err := checkStatement(config, readAccess, tenant, prefix+filter)
+			if err != nil {
+				return notPermitted("Query", err), nil
+			}
+			filter = strings.TrimPrefix(scoped, prefix)
+			conditions = append(conditions, "("+filter+")")
+		}
+
+		// Period columns are often HIDDEN, so they are selected explicitly
+		query := fmt.Sprintf("SELECT TOP (%d) %s AS valid_from, %s AS valid_to, * FROM %s FOR SYSTEM_TIME %s",
+			limit, quoteIdentifier(temporal.PeriodStart), quoteIdentifier(temporal.PeriodEnd), formatObjectName(schema, table), period)
+		if len(conditions) > 0 {
+			query += " WHERE " + strings.Join(conditions, " AND ")
+		}
+		query += fmt.Sprintf(" ORDER BY %s", quoteIdentifier(temporal.PeriodStart))
+
+		if !isPlainPredicate(filter) || isWriteOperation(query) {
+			log.Printf("Rejected history filter: %s", truncateString(filter, 100))
+			return mcp.NewToolResultError("The where filter must be a single read-only predicate"), nil
+		}
+
+		if err := checkPolicies(config, readAccess, query); err != nil {
+			return notPermitted("Query", err), nil
+		}
+
+		data, err := executeSessionQuery(ctx, query, true, args...)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error executing query: %v", err)), nil
+		}
+
+		result, err := formatResults(data)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error formatting results: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+}
@@ -0,0 +1,33 @@
+package mssqlmcp
+
+import "strings"
+
+// Statements that only fill table variables or create, fill and drop #temp
+// tables leave the user database untouched: table variables live for the
+// batch and #temp tables in tempdb for the caller's session. execute_sql
+// allows them in read-only deployments, so a batch can stage rows in a
+// table variable before its final SELECT and, with sticky sessions, #temp
+// tables can carry intermediate results across tool calls.
+
+// localWrites reports whether the statement writes and every write targets a
+// table variable or a local #temp table, and whether any targets a #temp
+// table. Global ##temp tables are shared between sessions and do not
+// qualify. Statements it does not understand are reported as not local, so
+// they stay subject to the read-only check.
+func localWrites(query string) (local, temp bool) {
+	targets, ok := writeTargets(query)
+	if !ok || len(targets) == 0 {
+		return false, false
+	}
+	for _, target := range targets {
+		name := target.Parts[len(target.Parts)-1]
+		switch {
+		case len(target.Parts) == 1 && strings.HasPrefix(name, "@"):
+		case len(target.Parts) == 1 && strings.HasPrefix(name, "#") && !strings.HasPrefix(name, "##"):
+			temp = true
+		default:
+			return false, false
+		}
+	}
+	return true, temp
+}
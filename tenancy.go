@@ -0,0 +1,442 @@
+package mssqlmcp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Multi-tenant databases keep each tenant's data either in a schema of its
+// own (MSSQL_TENANCY_MODEL=schema, the tenant is the schema name) or in shared
+// tables with a tenant column (MSSQL_TENANCY_MODEL=column, the column named by
+// MSSQL_TENANT_COLUMN). MSSQL_TENANT pins the server to one tenant; otherwise
+// every call reading data must name its tenant.
+
+const (
+	tenancySchema = "schema"
+	tenancyColumn = "column"
+)
+
+// tenantScope returns the tenant a call is scoped to, or "" when tenancy is
+// off. A pinned tenant cannot be overridden by the caller.
+func tenantScope(config *DbConfig, requested string) (string, error) {
+	if config.TenancyModel == "" {
+		return "", nil
+	}
+	if config.Tenant != "" {
+		if requested != "" && requested != config.Tenant {
+			return "", fmt.Errorf("this server is scoped to tenant %s", config.Tenant)
+		}
+		return config.Tenant, nil
+	}
+	if requested == "" {
+		return "", errors.New("the database is multi-tenant; name the tenant to query")
+	}
+	return requested, nil
+}
+
+// isSharedSchema reports whether a schema holds objects common to all
+// tenants: the catalog views and those listed in MSSQL_SHARED_SCHEMAS.
+func isSharedSchema(config *DbConfig, schema string) bool {
+	if strings.EqualFold(schema, "sys") || strings.EqualFold(schema, "INFORMATION_SCHEMA") {
+		return true
+	}
+	for _, shared := range config.SharedSchemas {
+		if strings.EqualFold(shared, schema) {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantPredicate selects the rows of one tenant under column tenancy.
+func tenantPredicate(column, tenant string) string {
+	return formatIdentifier(column) + " = " + quoteString(tenant)
+}
+
+// tenantConditions returns the conditions a generated query over a table
+// needs to stay within the tenant. Under schema tenancy only the tenant's own
+// and shared schemas may be read at all.
+func tenantConditions(config *DbConfig, requested, schema, table string, columns []map[string]interface{}) ([]string, error) {
+	switch config.TenancyModel {
+	case tenancySchema:
+		if isSharedSchema(config, schema) {
+			return nil, nil
+		}
+		tenant, err := tenantScope(config, requested)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(schema, tenant) {
+			return nil, fmt.Errorf("%s.%s belongs to another tenant", schema, table)
+		}
+	case tenancyColumn:
+		for _, column := range columns {
+			name := fmt.Sprintf("%v", column["COLUMN_NAME"])
+			if strings.EqualFold(name, config.TenantColumn) {
+				tenant, err := tenantScope(config, requested)
+				if err != nil {
+					return nil, err
+				}
+				return []string{tenantPredicate(name, tenant)}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// rowFilterClause returns the WHERE clause generated queries apply to a
+// table: the tenant scope, and the exclusion of soft-deleted rows when that is
+// enabled. It is empty when neither applies.
+func rowFilterClause(config *DbConfig, schema, table string) (string, error) {
+	softDelete := config.SoftDeleteFilter && len(config.SoftDeleteColumns) > 0
+	if !softDelete && config.TenancyModel == "" {
+		return "", nil
+	}
+
+	columns, err := getTableColumns(schema, table)
+	if err != nil {
+		return "", err
+	}
+
+	conditions, err := tenantConditions(config, "", schema, table, columns)
+	if err != nil {
+		return "", err
+	}
+	if softDelete {
+		conditions = append(conditions, softDeleteConditions(config, schema, table, columns)...)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), nil
+}
+
+// tenantRowsCheck declares the table variable the rows an INSERT adds to a
+// tenant table are recorded in under column tenancy. Its CHECK constraint
+// fails the INSERT, undoing it, when a row belongs to another tenant.
+const tenantRowsCheck = "DECLARE @tenant_rows TABLE (in_tenant bit NOT NULL CHECK (in_tenant = 1));\n"
+
+// scopeQuery rewrites a user statement so it can only read and change the
+// tenant's data, and refuses what it cannot scope.
+//
+// Under schema tenancy unqualified names are bound to the tenant's schema,
+// other tenants' schemas are refused, and so are changes to shared schemas.
+// Under column tenancy each table or view with the tenant column that is
+// read is replaced by a derived table filtered on it; the table an UPDATE or
+// DELETE changes gets the filter added to the statement's WHERE clause, and
+// the rows an INSERT adds are checked to belong to the tenant. Assigning the
+// tenant column and changing a tenant table any other way, such as by MERGE
+// or TRUNCATE, are refused; objects without the column are shared.
+// Cross-database names, synonyms, under column tenancy user-defined
+// functions, whether table-valued or scalar, changes that cannot be traced
+// to a table and table sources that cannot be read are refused because what
+// they read or change cannot be checked.
+func scopeQuery(config *DbConfig, tenant, query string) (string, error) {
+	if config.TenancyModel == "" {
+		return query, nil
+	}
+
+	tokens := significantTokens(tokenizeSQL(query))
+	index := make(map[int]int, len(tokens))
+	for i, t := range tokens {
+		index[t.Pos] = i
+	}
+	targets, ok := writeTargets(query)
+	if !ok && isWriteOperation(query) {
+		return "", errors.New("the statement changes something that cannot be scoped to a tenant")
+	}
+	if config.TenancyModel == tenancyColumn && assignsColumn(tokens, config.TenantColumn) {
+		return "", fmt.Errorf("the statement assigns the tenant column %s, which could move rows to another tenant", config.TenantColumn)
+	}
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	checkInserts := false
+	references, err := resolveObjectReferences(query)
+	if err != nil {
+		return "", fmt.Errorf("%v, so the statement cannot be scoped to a tenant", err)
+	}
+	referenced := make(map[int]objectReference, len(references))
+	for _, reference := range references {
+		referenced[reference.Pos] = reference
+	}
+
+	// Tables changed other than by INSERT, UPDATE or DELETE, such as by
+	// TRUNCATE TABLE t or CREATE INDEX ... ON t, must not hold tenant rows;
+	// UPDATE o ... FROM t o changes t through its scoped derived table
+	changed := make(map[int]bool)
+	for _, target := range targets {
+		if target.IsTemporary() || strings.HasPrefix(target.Name(), "@") {
+			continue
+		}
+		reference, found := referenced[target.Pos]
+		if found && (reference.Target != "" || !tokens[index[target.Pos]-1].isKeyword("TABLE")) {
+			continue
+		}
+		changed[target.Pos] = true
+		if config.TenancyModel == tenancySchema {
+			if !found {
+				return "", fmt.Errorf("%s cannot be scoped to a tenant", target.Name())
+			}
+			continue
+		}
+		_, column, err := tenantObject(config, target)
+		if err != nil {
+			return "", err
+		}
+		if column != "" {
+			return "", fmt.Errorf("%s holds the data of all tenants and cannot be changed this way", target.Name())
+		}
+	}
+
+	// The table changed by UPDATE t or DELETE t listed again in the
+	// statement's FROM clause is scoped by the WHERE clause
+	sameTarget := make(map[int]bool)
+	for _, reference := range references {
+		if reference.Target != "UPDATE" && reference.Target != "DELETE" {
+			continue
+		}
+		verb := targetVerb(tokens, index[reference.Pos])
+		end, _ := clauseEnd(tokens, verb)
+		for _, other := range references {
+			i := index[other.Pos]
+			if other.Target == "" && other.Alias == "" && !other.Function && other.Pos > reference.Pos && i < end &&
+				tokens[i].Depth == tokens[verb].Depth && strings.EqualFold(other.Name(), reference.Name()) {
+				sameTarget[other.Pos] = true
+			}
+		}
+	}
+
+	// Names are checked before any is looked up, so a statement naming
+	// another tenant's object is refused whatever else it names
+	for _, reference := range references {
+		if reference.IsTemporary() || reference.IsBuiltin() {
+			continue
+		}
+		if len(reference.Parts) > 2 {
+			return "", fmt.Errorf("%s: cross-database references are not permitted on a multi-tenant database", reference.Name())
+		}
+		if len(reference.Parts) == 2 && config.TenancyModel == tenancySchema {
+			if !isSharedSchema(config, reference.Parts[0]) && !strings.EqualFold(reference.Parts[0], tenant) {
+				return "", fmt.Errorf("%s belongs to another tenant", reference.Name())
+			}
+			if (reference.Target != "" || changed[reference.Pos]) && isSharedSchema(config, reference.Parts[0]) {
+				return "", fmt.Errorf("%s is shared by all tenants and cannot be changed", reference.Name())
+			}
+		}
+	}
+
+	for _, reference := range references {
+		if reference.IsTemporary() || reference.IsBuiltin() {
+			continue
+		}
+		qualified := len(reference.Parts) == 2
+
+		objectType, column, err := tenantObject(config, reference)
+		if err != nil {
+			return "", err
+		}
+		if objectType == "SN" {
+			return "", fmt.Errorf("%s is a synonym, which cannot be scoped to a tenant", reference.Name())
+		}
+
+		switch config.TenancyModel {
+		case tenancySchema:
+			if !qualified {
+				edits = append(edits, edit{reference.Pos, reference.Pos, quoteIdentifier(tenant) + "."})
+			}
+		case tenancyColumn:
+			if reference.Function {
+				return "", fmt.Errorf("%s is a function, which cannot be scoped to a tenant", reference.Name())
+			}
+			if column == "" || sameTarget[reference.Pos] {
+				continue
+			}
+			predicate := tenantPredicate(column, tenant)
+			switch reference.Target {
+			case "":
+				text := fmt.Sprintf("(SELECT * FROM %s WHERE %s)", query[reference.Pos:reference.End], predicate)
+				if reference.Alias == "" {
+					// Column references qualified by the table name keep working
+					text += " AS " + quoteIdentifier(reference.Parts[len(reference.Parts)-1])
+				}
+				edits = append(edits, edit{reference.Pos, reference.End, text})
+			case "UPDATE", "DELETE":
+				verb := targetVerb(tokens, index[reference.Pos])
+				end, where := clauseEnd(tokens, verb)
+				if where >= 0 && (where+1 == end || tokens[where+1].isKeyword("CURRENT")) {
+					return "", fmt.Errorf("%s is changed through a cursor, which cannot be scoped to a tenant", reference.Name())
+				}
+				last := tokens[end-1].Pos + len(tokens[end-1].Text)
+				predicate = query[reference.Pos:reference.End] + "." + predicate
+				if where < 0 {
+					edits = append(edits, edit{last, last, " WHERE " + predicate})
+				} else {
+					first := tokens[where+1].Pos
+					edits = append(edits, edit{first, first, "("}, edit{last, last, ") AND " + predicate})
+				}
+			case "INSERT":
+				// Before any OUTPUT clause and the rows inserted, after the
+				// column list
+				i := index[reference.Pos]
+				for i < len(tokens) && tokens[i].Pos < reference.End {
+					i++
+				}
+				if i < len(tokens) && tokens[i].Text == "(" {
+					i = skipParenthesized(tokens, i)
+				}
+				if i >= len(tokens) {
+					return "", fmt.Errorf("the INSERT into %s cannot be scoped to a tenant", reference.Name())
+				}
+				check := fmt.Sprintf("OUTPUT CASE WHEN inserted.%s THEN 1 ELSE 0 END INTO @tenant_rows ", predicate)
+				edits = append(edits, edit{tokens[i].Pos, tokens[i].Pos, check})
+				checkInserts = true
+			default:
+				return "", fmt.Errorf("%s holds the data of all tenants and cannot be changed by %s", reference.Name(), reference.Target)
+			}
+		}
+	}
+
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		query = query[:e.start] + e.text + query[e.end:]
+	}
+	if checkInserts {
+		query = tenantRowsCheck + query
+	}
+	return query, nil
+}
+
+// targetVerb returns the position of the UPDATE or DELETE keyword naming the
+// target at tokens[i], looking back past FROM and TOP (n) [PERCENT].
+func targetVerb(tokens []sqlToken, i int) int {
+	j := i - 1
+	if j >= 0 && tokens[j].isKeyword("FROM") {
+		j--
+	}
+	if j >= 0 && tokens[j].isKeyword("PERCENT") {
+		j--
+	}
+	if j >= 0 && tokens[j].Text == ")" {
+		for j >= 0 && !(tokens[j].Text == "(" && tokens[j].Depth == tokens[i].Depth) {
+			j--
+		}
+		j -= 2 // the parenthesis and TOP
+	}
+	return j
+}
+
+// Keywords starting a statement, which end the clauses of an UPDATE or
+// DELETE written without a semicolon
+var statementKeywords = []string{"SELECT", "INSERT", "UPDATE", "DELETE", "MERGE", "EXEC", "EXECUTE", "DECLARE", "IF",
+	"WHILE", "BEGIN", "PRINT", "RAISERROR", "THROW", "TRUNCATE", "DROP", "CREATE", "ALTER", "WAITFOR", "RETURN", "GOTO",
+	"USE", "OPTION"}
+
+// clauseEnd returns the position just past the last clause of the UPDATE or
+// DELETE at tokens[verb] that a condition can be added to, before any
+// OPTION clause, semicolon or following statement, and the position of its
+// WHERE keyword, or -1.
+func clauseEnd(tokens []sqlToken, verb int) (int, int) {
+	depth := tokens[verb].Depth
+	where := -1
+	seenSet := false
+	for i := verb + 1; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.Depth < depth || t.Text == ";" && t.Depth == depth {
+			return i, where
+		}
+		if t.Depth != depth || t.Kind != tokenWord {
+			continue
+		}
+		switch {
+		case t.isKeyword("WHERE"):
+			where = i
+		case t.isKeyword("SET") && !seenSet && tokens[verb].isKeyword("UPDATE"):
+			seenSet = true
+		case t.isKeyword("SET"):
+			return i, where
+		case t.isKeyword("WITH") && (i+1 >= len(tokens) || tokens[i+1].Text != "("):
+			// WITH (NOLOCK) is a table hint; otherwise a CTE follows
+			return i, where
+		default:
+			for _, keyword := range statementKeywords {
+				if t.isKeyword(keyword) {
+					return i, where
+				}
+			}
+		}
+	}
+	return len(tokens), where
+}
+
+// assignsColumn reports whether a SET clause, of an UPDATE or of a SET
+// statement such as SET @v = column = value, writes a column of the given
+// name.
+func assignsColumn(tokens []sqlToken, column string) bool {
+	for i, t := range tokens {
+		if (t.Kind != tokenWord && t.Kind != tokenQuotedIdentifier) || !strings.EqualFold(unquoteIdentifier(t.Text), column) {
+			continue
+		}
+		assigned := i+1 < len(tokens) && tokens[i+1].Text == "=" ||
+			i+2 < len(tokens) && strings.Contains("+-*/%&|^", tokens[i+1].Text) && tokens[i+2].Text == "="
+		if !assigned {
+			continue
+		}
+		// Assignments follow SET, unlike comparisons and the column = expression
+		// aliases of a select list
+		for j := i - 1; j >= 0; j-- {
+			if tokens[j].Depth != t.Depth || tokens[j].Kind != tokenWord {
+				continue
+			}
+			if tokens[j].isKeyword("SET") {
+				return true
+			}
+			if isClauseKeyword(tokens[j]) {
+				break
+			}
+		}
+	}
+	return false
+}
+
+// isClauseKeyword reports whether a token starts a clause other than SET.
+func isClauseKeyword(t sqlToken) bool {
+	for _, keyword := range []string{"SELECT", "FROM", "WHERE", "ON", "HAVING", "VALUES", "OUTPUT", "BY", "INTO", "JOIN", "APPLY", "USING"} {
+		if t.isKeyword(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantObject returns the type of a referenced object and the name of its
+// tenant column, or "" for either when there is none.
+func tenantObject(config *DbConfig, reference objectReference) (string, string, error) {
+	parts := make([]string, len(reference.Parts))
+	for i, part := range reference.Parts {
+		parts[i] = quoteIdentifier(part)
+	}
+
+	data, err := executeQuery(`SELECT o.type, c.name AS tenant_column
+		FROM sys.all_objects o
+		LEFT JOIN sys.all_columns c ON c.object_id = o.object_id AND c.name = @p2
+		WHERE o.object_id = OBJECT_ID(@p1)`, true, strings.Join(parts, "."), config.TenantColumn)
+	if err != nil {
+		return "", "", err
+	}
+
+	rows := data["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		return "", "", nil
+	}
+	column := ""
+	if rows[0]["tenant_column"] != nil {
+		column = fmt.Sprintf("%v", rows[0]["tenant_column"])
+	}
+	return strings.TrimSpace(fmt.Sprintf("%v", rows[0]["type"])), column, nil
+}
@@ -0,0 +1,29 @@
+package mssqlmcp
+
+import (
+	"strings"
+	"testing"
+)
+
+// The statements are refused on their names alone, before any object is
+// looked up in the database.
+func TestScopeQueryRefusesOtherTenants(t *testing.T) {
+	t.Setenv("MSSQL_TENANCY_MODEL", "schema")
+	t.Setenv("MSSQL_TENANT", "tenantA")
+
+	config := testConfig(t)
+	for query, refusal := range map[string]string{
+		"SELECT * FROM tenantA.Lookup l WITH (NOLOCK), tenantB.Orders":                 "tenantB.Orders belongs to another tenant",
+		"SELECT * FROM tenantA.Lookup FOR SYSTEM_TIME ALL, tenantB.Secret":             "tenantB.Secret belongs to another tenant",
+		"SELECT * FROM tenantA.Lookup TABLESAMPLE (10 PERCENT), tenantB.Orders":        "tenantB.Orders belongs to another tenant",
+		"SELECT * FROM CONTAINSTABLE(tenantB.Docs, Body, 'x') AS k":                    "tenantB.Docs belongs to another tenant",
+		"SELECT tenantB.Balance(l.id) FROM tenantA.Lookup l":                           "tenantB.Balance belongs to another tenant",
+		"SELECT * FROM tenantA.Lookup FOR SYSTEM_TIME AS OF GETDATE(), tenantB.Orders": "not understood",
+		"SELECT * FROM tenantA.Lookup l x, tenantB.Orders":                             "not understood",
+	} {
+		scoped, err := scopeQuery(config, config.Tenant, query)
+		if err == nil || !strings.Contains(err.Error(), refusal) {
+			t.Errorf("scopeQuery(%q) = %q, %v; want an error saying %q", query, scoped, err, refusal)
+		}
+	}
+}
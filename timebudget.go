@@ -0,0 +1,120 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Tool that grants a session more time once its budget is spent
+const continueExplorationTool = "continue_exploration"
+
+// sessionTime is the time the tool calls of one MCP session have taken and
+// the time they may take before the user is asked.
+type sessionTime struct {
+	used    time.Duration
+	allowed time.Duration
+	grants  int
+}
+
+var (
+	sessionTimesMu sync.Mutex
+	sessionTimes   = make(map[string]*sessionTime)
+)
+
+// budgetSessionID identifies the session a tool call is charged to.
+func budgetSessionID(ctx context.Context) string {
+	if session := sessionIDFromContext(ctx); session != "default" {
+		return session
+	}
+	return processSessionID
+}
+
+// sessionTimeFor returns the accounting of a session, starting it with one
+// budget's worth of time.
+func sessionTimeFor(id string, budget time.Duration) *sessionTime {
+	account, ok := sessionTimes[id]
+	if !ok {
+		account = &sessionTime{allowed: budget}
+		sessionTimes[id] = account
+	}
+	return account
+}
+
+// enforceTimeBudget is middleware charging the duration of each tool call,
+// nearly all of it spent waiting on the database, to the calling session.
+// Once a session has used its MSSQL_SESSION_TIME_BUDGET, calls are refused
+// until continue_exploration records that the user agreed to go on.
+func enforceTimeBudget(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		config, err := getDbConfig()
+		if err != nil || config.SessionTimeBudget <= 0 || request.Params.Name == continueExplorationTool {
+			return next(ctx, request)
+		}
+		budget := time.Duration(config.SessionTimeBudget) * time.Second
+		id := budgetSessionID(ctx)
+
+		sessionTimesMu.Lock()
+		account := sessionTimeFor(id, budget)
+		used, allowed := account.used, account.allowed
+		sessionTimesMu.Unlock()
+		if used >= allowed {
+			log.Printf("Session %s is over its time budget (%s of %s), refusing %s", id, used.Round(time.Second), allowed, request.Params.Name)
+			return mcp.NewToolResultError(fmt.Sprintf("This session has spent %s of database time, its budget of %s (MSSQL_SESSION_TIME_BUDGET). "+
+				"Stop and ask the user whether to keep exploring; if they agree, call %s with user_confirmed set to true to get another %s.",
+				used.Round(time.Second), allowed, continueExplorationTool, budget)), nil
+		}
+
+		start := time.Now()
+		result, err := next(ctx, request)
+		sessionTimesMu.Lock()
+		account.used += time.Since(start)
+		sessionTimesMu.Unlock()
+		return result, err
+	}
+}
+
+// registerTimeBudgetTools adds continue_exploration when a session time
+// budget is configured.
+func registerTimeBudgetTools(s *server.MCPServer) {
+	config, err := getDbConfig()
+	if err != nil || config.SessionTimeBudget <= 0 {
+		return
+	}
+	budget := time.Duration(config.SessionTimeBudget) * time.Second
+
+	continueTool := mcp.NewTool(continueExplorationTool,
+		mcp.WithDescription(fmt.Sprintf("Grant this session another %s of database time once its budget is spent. Only call it after the user has explicitly agreed to continue; never on your own initiative.", budget)),
+		mcp.WithBoolean("user_confirmed",
+			mcp.Required(),
+			mcp.Description("True when the user has explicitly confirmed in the conversation that exploration should continue"),
+		),
+	)
+
+	s.AddTool(continueTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if confirmed, _ := request.Params.Arguments["user_confirmed"].(bool); !confirmed {
+			return mcp.NewToolResultError("The user has to confirm that exploration should continue; ask them first"), nil
+		}
+		id := budgetSessionID(ctx)
+
+		sessionTimesMu.Lock()
+		account := sessionTimeFor(id, budget)
+		if account.used < account.allowed {
+			remaining := account.allowed - account.used
+			sessionTimesMu.Unlock()
+			return mcp.NewToolResultText(fmt.Sprintf("The budget is not spent yet: %s of database time remain.", remaining.Round(time.Second))), nil
+		}
+		account.allowed = account.used + budget
+		account.grants++
+		grants := account.grants
+		sessionTimesMu.Unlock()
+
+		log.Printf("Session %s granted another %s of database time (grant %d)", id, budget, grants)
+		return mcp.NewToolResultText(fmt.Sprintf("Granted another %s of database time. Exploration can continue.", budget)), nil
+	})
+}
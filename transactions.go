@@ -0,0 +1,237 @@
+package mssqlmcp
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Maximum number of transactions held open by handle at once. Unlike cursors
+// none is closed to make room, as that would discard its changes.
+const MAX_OPEN_TRANSACTIONS = 5
+
+// heldTransaction is a transaction on a dedicated connection, addressed by a
+// handle across tool calls.
+type heldTransaction struct {
+	mu       sync.Mutex
+	handle   string
+	conn     *sql.Conn
+	tx       *sql.Tx
+	lastUsed time.Time
+	timer    *time.Timer
+	closed   bool
+}
+
+type transactionHandleKey struct{}
+
+var (
+	transactionsMu sync.Mutex
+	transactions   = make(map[string]*heldTransaction)
+)
+
+// withTransactionHandle makes queries run with the context execute inside
+// the transaction with the given handle.
+func withTransactionHandle(ctx context.Context, handle string) context.Context {
+	if handle == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, transactionHandleKey{}, handle)
+}
+
+func transactionHandleFromContext(ctx context.Context) string {
+	handle, _ := ctx.Value(transactionHandleKey{}).(string)
+	return handle
+}
+
+// beginHeldTransaction opens a transaction on a connection of its own and
+// returns its handle.
+func beginHeldTransaction(config *DbConfig, level sql.IsolationLevel) (string, error) {
+	transactionsMu.Lock()
+	open := len(transactions)
+	transactionsMu.Unlock()
+	if open >= MAX_OPEN_TRANSACTIONS {
+		return "", fmt.Errorf("%d transactions are already open; commit or roll one back first", open)
+	}
+
+	pool, err := getSessionPool(config)
+	if err != nil {
+		return "", fmt.Errorf("database connection error: %v", err)
+	}
+	// Neither the connection nor the transaction may be tied to the request
+	// context, which ends with this tool call
+	conn, err := pool.Conn(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("database connection error: %v", err)
+	}
+	tx, err := conn.BeginTx(context.Background(), &sql.TxOptions{Isolation: level})
+	if err != nil {
+		conn.Close()
+		return "", err
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		tx.Rollback()
+		conn.Close()
+		return "", err
+	}
+	held := &heldTransaction{handle: hex.EncodeToString(token), conn: conn, tx: tx, lastUsed: time.Now()}
+	timeout := time.Duration(config.SessionIdleTimeout) * time.Second
+	held.timer = time.AfterFunc(timeout, func() { expireTransaction(held, timeout) })
+
+	transactionsMu.Lock()
+	transactions[held.handle] = held
+	transactionsMu.Unlock()
+	return held.handle, nil
+}
+
+// withHeldTransaction runs fn inside the transaction with the given handle.
+func withHeldTransaction(ctx context.Context, handle string, fn func(tx *sql.Tx, config *DbConfig) error) error {
+	config, err := getDbConfig()
+	if err != nil {
+		return err
+	}
+
+	transactionsMu.Lock()
+	held, ok := transactions[handle]
+	transactionsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("no open transaction has handle %s; it may have been committed, rolled back or expired", handle)
+	}
+
+	held.mu.Lock()
+	defer held.mu.Unlock()
+	if held.closed {
+		return fmt.Errorf("transaction %s has ended", handle)
+	}
+	held.lastUsed = time.Now()
+	held.timer.Reset(time.Duration(config.SessionIdleTimeout) * time.Second)
+
+	if config.SessionTagging {
+		if _, err := held.tx.ExecContext(ctx, sessionContextSQL(queryTagFromContext(ctx))); err != nil {
+			log.Printf("Tagging transaction %s failed: %v", handle, err)
+		}
+	}
+	return fn(held.tx, config)
+}
+
+// endHeldTransaction commits or rolls back the transaction with the given
+// handle and returns its connection to the pool.
+func endHeldTransaction(handle string, commit bool) error {
+	transactionsMu.Lock()
+	held, ok := transactions[handle]
+	delete(transactions, handle)
+	transactionsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("no open transaction has handle %s; it may have been committed, rolled back or expired", handle)
+	}
+
+	held.mu.Lock()
+	defer held.mu.Unlock()
+	if held.closed {
+		return fmt.Errorf("transaction %s has ended", handle)
+	}
+	held.closed = true
+	held.timer.Stop()
+	defer held.conn.Close()
+
+	if commit {
+		return held.tx.Commit()
+	}
+	return held.tx.Rollback()
+}
+
+// expireTransaction rolls back a transaction that has been idle for the
+// timeout.
+func expireTransaction(held *heldTransaction, timeout time.Duration) {
+	held.mu.Lock()
+	idle := time.Since(held.lastUsed) >= timeout
+	held.mu.Unlock()
+
+	if idle {
+		if err := endHeldTransaction(held.handle, false); err != nil {
+			log.Printf("Error rolling back idle transaction %s: %v", held.handle, err)
+			return
+		}
+		log.Printf("Rolled back transaction %s (idle timeout)", held.handle)
+	}
+}
+
+// registerTransactionHandleTools adds transactions addressed by handle, for
+// multi-step writes without sticky sessions. The handle is passed to
+// execute_sql, execute_write and call_procedure to run inside it.
+func registerTransactionHandleTools(s *server.MCPServer) {
+	beginTool := mcp.NewTool("begin_transaction",
+		mcp.WithDescription("Start a transaction on a dedicated connection and return its handle. Pass the handle as transaction to execute_write, execute_sql and call_procedure to run statements inside it, then end it with commit_transaction or rollback_transaction; an idle transaction is rolled back automatically."),
+		mcp.WithString("isolation_level",
+			mcp.Description("Transaction isolation level"),
+			mcp.Enum("READ UNCOMMITTED", "READ COMMITTED", "REPEATABLE READ", "SNAPSHOT", "SERIALIZABLE"),
+		),
+	)
+
+	s.AddTool(beginTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		levelName, _ := request.Params.Arguments["isolation_level"].(string)
+		if levelName == "" {
+			levelName = "READ COMMITTED"
+		}
+		level, ok := isolationLevels[levelName]
+		if !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("Unknown isolation level: %s", levelName)), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		handle, err := beginHeldTransaction(config, level)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error starting transaction: %v", err)), nil
+		}
+
+		log.Printf("Transaction %s started", handle)
+		return mcp.NewToolResultText(fmt.Sprintf("Transaction started (%s) with handle %s. It will be rolled back automatically after %d seconds of inactivity.",
+			levelName, handle, config.SessionIdleTimeout)), nil
+	})
+
+	commitTool := mcp.NewTool("commit_transaction",
+		mcp.WithDescription("Commit the transaction with the given handle"),
+		mcp.WithString("transaction",
+			mcp.Required(),
+			mcp.Description("Handle returned by begin_transaction"),
+		),
+	)
+
+	s.AddTool(commitTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		handle, _ := request.Params.Arguments["transaction"].(string)
+		if err := endHeldTransaction(handle, true); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error committing transaction: %v", err)), nil
+		}
+		log.Printf("Transaction %s committed", handle)
+		return mcp.NewToolResultText("Transaction committed"), nil
+	})
+
+	rollbackTool := mcp.NewTool("rollback_transaction",
+		mcp.WithDescription("Roll back the transaction with the given handle, discarding its changes"),
+		mcp.WithString("transaction",
+			mcp.Required(),
+			mcp.Description("Handle returned by begin_transaction"),
+		),
+	)
+
+	s.AddTool(rollbackTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		handle, _ := request.Params.Arguments["transaction"].(string)
+		if err := endHeldTransaction(handle, false); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error rolling back transaction: %v", err)), nil
+		}
+		log.Printf("Transaction %s rolled back", handle)
+		return mcp.NewToolResultText("Transaction rolled back"), nil
+	})
+}
@@ -0,0 +1,184 @@
+package mssqlmcp
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+// tableTypeColumn is a column of a user-defined table type.
+type tableTypeColumn struct {
+	Name string
+	Type string
+	// Identity and computed columns take no value; the server fills them
+	Generated bool
+}
+
+// getTableTypeColumns reads the columns of a user-defined table type in
+// declaration order.
+func getTableTypeColumns(schema, name string) ([]tableTypeColumn, error) {
+	data, err := executeQuery(`SELECT c.name, TYPE_NAME(c.system_type_id) AS type_name,
+			CASE WHEN c.is_identity = 1 OR c.is_computed = 1 THEN 1 ELSE 0 END AS is_generated
+		FROM sys.table_types tt
+		JOIN sys.columns c ON c.object_id = tt.type_table_object_id
+		WHERE tt.schema_id = SCHEMA_ID(@p1) AND tt.name = @p2
+		ORDER BY c.column_id`, true, schema, name)
+	if err != nil {
+		return nil, err
+	}
+	rows := data["rows"].([]map[string]interface{})
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("table type %s.%s not found", schema, name)
+	}
+
+	columns := make([]tableTypeColumn, 0, len(rows))
+	for _, row := range rows {
+		columns = append(columns, tableTypeColumn{
+			Name:      fmt.Sprintf("%v", row["name"]),
+			Type:      fmt.Sprintf("%v", row["type_name"]),
+			Generated: row["is_generated"] == int64(1),
+		})
+	}
+	return columns, nil
+}
+
+// tableValuedParameter binds rows as a table-valued parameter of a
+// user-defined table type, e.g. dbo.IdList. A row is an object keyed by
+// column name, an array of values in column order, or, for a type with one
+// column, the bare value, so a list of IDs is just [1, 2, 3]. The driver
+// sends a TVP as a slice of structs, so a struct type is built to match the
+// table type's columns.
+func tableValuedParameter(typeName string, rows []interface{}) (interface{}, error) {
+	schema, name, err := parseObjectName(typeName)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := getTableTypeColumns(schema, name)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]reflect.StructField, len(columns))
+	var settable []int
+	for i, column := range columns {
+		fields[i] = reflect.StructField{Name: fmt.Sprintf("Column%d", i), Type: tvpFieldType(column.Type)}
+		if column.Generated {
+			fields[i].Tag = `tvp:"@identity"`
+			continue
+		}
+		settable = append(settable, i)
+	}
+	rowType := reflect.StructOf(fields)
+
+	table := reflect.MakeSlice(reflect.SliceOf(rowType), 0, len(rows))
+	for n, value := range rows {
+		row := reflect.New(rowType).Elem()
+		set := func(i int, value interface{}) error {
+			converted, err := tvpFieldValue(fields[i].Type, value)
+			if err != nil {
+				return fmt.Errorf("row %d, column %s: %v", n+1, columns[i].Name, err)
+			}
+			row.Field(i).Set(reflect.ValueOf(converted))
+			return nil
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, cell := range v {
+				i := -1
+				for _, candidate := range settable {
+					if strings.EqualFold(columns[candidate].Name, key) {
+						i = candidate
+					}
+				}
+				if i < 0 {
+					return nil, fmt.Errorf("row %d: table type %s.%s has no settable column %s", n+1, schema, name, key)
+				}
+				if err := set(i, cell); err != nil {
+					return nil, err
+				}
+			}
+		case []interface{}:
+			if len(v) > len(settable) {
+				return nil, fmt.Errorf("row %d has %d values but table type %s.%s takes %d", n+1, len(v), schema, name, len(settable))
+			}
+			for j, cell := range v {
+				if err := set(settable[j], cell); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			if len(settable) != 1 {
+				return nil, fmt.Errorf("row %d: give rows of table type %s.%s as objects or arrays, as it has %d columns", n+1, schema, name, len(settable))
+			}
+			if err := set(settable[0], v); err != nil {
+				return nil, err
+			}
+		}
+		table = reflect.Append(table, row)
+	}
+
+	return mssql.TVP{TypeName: formatObjectName(schema, name), Value: table.Interface()}, nil
+}
+
+// tvpFieldType is the Go type a table type column is sent as. Types without
+// a closer match are sent as text, which the server converts on arrival.
+func tvpFieldType(typeName string) reflect.Type {
+	switch strings.ToLower(typeName) {
+	case "tinyint", "smallint", "int", "bigint":
+		return reflect.TypeOf(sql.NullInt64{})
+	case "bit":
+		return reflect.TypeOf(sql.NullBool{})
+	case "float", "real":
+		return reflect.TypeOf(sql.NullFloat64{})
+	}
+	return reflect.TypeOf(sql.NullString{})
+}
+
+// tvpFieldValue converts a JSON value to the Go type of a TVP column.
+func tvpFieldValue(fieldType reflect.Type, value interface{}) (interface{}, error) {
+	text := fmt.Sprintf("%v", value)
+	switch v := value.(type) {
+	case nil:
+		return reflect.Zero(fieldType).Interface(), nil
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		text = "0"
+		if v {
+			text = "1"
+		}
+	case map[string]interface{}, []interface{}:
+		return nil, fmt.Errorf("unsupported value %v", value)
+	}
+
+	switch fieldType {
+	case reflect.TypeOf(sql.NullInt64{}):
+		if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) <= maxExactJSONInteger {
+			return sql.NullInt64{Int64: int64(f), Valid: true}, nil
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", text)
+		}
+		return sql.NullInt64{Int64: n, Valid: true}, nil
+	case reflect.TypeOf(sql.NullBool{}):
+		b, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bit %q", text)
+		}
+		return sql.NullBool{Bool: b, Valid: true}, nil
+	case reflect.TypeOf(sql.NullFloat64{}):
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", text)
+		}
+		return sql.NullFloat64{Float64: f, Valid: true}, nil
+	}
+	return sql.NullString{String: text, Valid: true}, nil
+}
@@ -0,0 +1,237 @@
+package mssqlmcp
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Most parameters one upsert binds; SQL Server accepts 2100 per request
+const MAX_UPSERT_PARAMETERS = 2000
+
+// upsertStatement builds the batch updating each row by its key columns and
+// inserting it when no row matched. UPDATE then INSERT under UPDLOCK and
+// SERIALIZABLE is used rather than MERGE: the key range stays locked between
+// the two, so concurrent upserts of the same key cannot both insert, and it
+// avoids MERGE's history of wrong results under concurrency. Values are
+// bound as parameters @r<row>_<column>.
+func upsertStatement(schema, table string, keys []string, rows []map[string]interface{}) (string, []interface{}, error) {
+	columns, err := getTableColumns(schema, table)
+	if err != nil {
+		return "", nil, err
+	}
+	names := make(map[string]string, len(columns))
+	for _, column := range columns {
+		name := fmt.Sprintf("%v", column["COLUMN_NAME"])
+		names[strings.ToLower(name)] = name
+	}
+	column := func(name string) (string, error) {
+		if actual, ok := names[strings.ToLower(strings.Trim(name, "[]"))]; ok {
+			return actual, nil
+		}
+		return "", fmt.Errorf("%s.%s has no column %s", schema, table, name)
+	}
+
+	var keyColumns []string
+	isKey := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		name, err := column(key)
+		if err != nil {
+			return "", nil, err
+		}
+		if !isKey[name] {
+			keyColumns = append(keyColumns, name)
+			isKey[name] = true
+		}
+	}
+
+	target := formatObjectName(schema, table)
+	var batch strings.Builder
+	var args []interface{}
+	// Inside a caller's transaction a savepoint stands in for a transaction
+	// of its own, so a failure undoes the upsert but not the earlier work
+	batch.WriteString("SET NOCOUNT ON;\nDECLARE @outer int = @@TRANCOUNT, @matched int, @updated int = 0, @inserted int = 0;\n")
+	batch.WriteString("BEGIN TRY\nIF @outer = 0 BEGIN TRANSACTION; ELSE SAVE TRANSACTION mcp_upsert;\n")
+	for i, row := range rows {
+		// Columns in a fixed order, so the batch text is the same for the same rows
+		given := make([]string, 0, len(row))
+		values := make(map[string]interface{}, len(row))
+		for name, value := range row {
+			actual, err := column(name)
+			if err != nil {
+				return "", nil, fmt.Errorf("row %d: %v", i+1, err)
+			}
+			given = append(given, actual)
+			values[actual] = value
+		}
+		sort.Strings(given)
+
+		var conditions, assignments, insertColumns, insertValues []string
+		parameters := make(map[string]string, len(given))
+		for j, name := range given {
+			value, err := parameterValue(values[name])
+			if err != nil {
+				return "", nil, fmt.Errorf("row %d, column %s: %v", i+1, name, err)
+			}
+			parameter := fmt.Sprintf("r%d_%d", i, j)
+			args = append(args, sql.Named(parameter, value))
+			parameters[name] = "@" + parameter
+			insertColumns = append(insertColumns, formatIdentifier(name))
+			insertValues = append(insertValues, "@"+parameter)
+			if !isKey[name] {
+				assignments = append(assignments, fmt.Sprintf("%s = @%s", formatIdentifier(name), parameter))
+			}
+		}
+		for _, key := range keyColumns {
+			parameter, ok := parameters[key]
+			if !ok {
+				return "", nil, fmt.Errorf("row %d has no value for key column %s", i+1, key)
+			}
+			conditions = append(conditions, fmt.Sprintf("%s = %s", formatIdentifier(key), parameter))
+		}
+
+		where := strings.Join(conditions, " AND ")
+		if len(assignments) > 0 {
+			batch.WriteString(fmt.Sprintf("UPDATE %s WITH (UPDLOCK, SERIALIZABLE) SET %s WHERE %s;\nSET @matched = @@ROWCOUNT;\n",
+				target, strings.Join(assignments, ", "), where))
+		} else {
+			// Only keys given: nothing to update, only whether the row exists
+			batch.WriteString(fmt.Sprintf("SELECT @matched = COUNT(*) FROM %s WITH (UPDLOCK, SERIALIZABLE) WHERE %s;\n", target, where))
+		}
+		batch.WriteString(fmt.Sprintf("IF @matched = 0 BEGIN INSERT INTO %s (%s) VALUES (%s); SET @inserted += 1; END ELSE SET @updated += @matched;\n",
+			target, strings.Join(insertColumns, ", "), strings.Join(insertValues, ", ")))
+	}
+	batch.WriteString("IF @outer = 0 COMMIT TRANSACTION;\nEND TRY\nBEGIN CATCH\n")
+	batch.WriteString("IF @outer = 0 AND @@TRANCOUNT > 0 ROLLBACK TRANSACTION;\nELSE IF XACT_STATE() = 1 ROLLBACK TRANSACTION mcp_upsert;\nTHROW;\nEND CATCH;\n")
+	batch.WriteString("SELECT @updated AS rows_updated, @inserted AS rows_inserted;")
+
+	if len(args) > MAX_UPSERT_PARAMETERS {
+		return "", nil, fmt.Errorf("the rows need %d parameters, more than the %d one upsert binds; split them into smaller calls", len(args), MAX_UPSERT_PARAMETERS)
+	}
+	return batch.String(), args, nil
+}
+
+// showUpsert renders the generated batch with the values bound to its
+// parameters.
+func showUpsert(statement string, args []interface{}) string {
+	var text strings.Builder
+	text.WriteString("```sql\n" + statement + "\n```\n\nParameters:\n")
+	for _, arg := range args {
+		named := arg.(sql.NamedArg)
+		text.WriteString(fmt.Sprintf("- @%s = %v\n", named.Name, named.Value))
+	}
+	text.WriteString("\nNothing was executed; repeat the call without show_sql to run it.")
+	return text.String()
+}
+
+// registerUpsertTool adds a tool inserting or updating rows by key. Like
+// execute_write, it is only registered when MSSQL_ALLOW_WRITE is set.
+func registerUpsertTool(s *server.MCPServer) {
+	upsertTool := mcp.NewTool("upsert",
+		mcp.WithDescription("Insert rows into a table, or update the existing rows with the same key, in one transaction. Columns not given keep their current values on update and their defaults on insert. Set show_sql to see the generated SQL without running it."),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Target table, optionally schema-qualified"),
+		),
+		mcp.WithArray("keys",
+			mcp.Required(),
+			mcp.Description("Columns identifying a row, e.g. [\"OrderID\"]; every row must give them"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithArray("rows",
+			mcp.Required(),
+			mcp.Description("Rows as objects keyed by column name, e.g. [{\"OrderID\": 7, \"Status\": \"shipped\"}]; give a {value, type} object to bind a specific SQL Server type, as with execute_sql"),
+			mcp.Items(map[string]interface{}{"type": "object"}),
+		),
+		mcp.WithBoolean("show_sql",
+			mcp.Description("Return the generated SQL and its parameters without executing it"),
+		),
+		mcp.WithString("transaction",
+			mcp.Description("Handle from begin_transaction to run the upsert inside that transaction"),
+		),
+	)
+
+	s.AddTool(upsertTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, _ := request.Params.Arguments["table"].(string)
+		if name == "" {
+			return mcp.NewToolResultError("Table is required"), nil
+		}
+		var keys []string
+		if values, ok := request.Params.Arguments["keys"].([]interface{}); ok {
+			for _, value := range values {
+				if key, ok := value.(string); ok && key != "" {
+					keys = append(keys, key)
+				}
+			}
+		}
+		if len(keys) == 0 {
+			return mcp.NewToolResultError("At least one key column is required"), nil
+		}
+		var rows []map[string]interface{}
+		values, _ := request.Params.Arguments["rows"].([]interface{})
+		for i, value := range values {
+			row, ok := value.(map[string]interface{})
+			if !ok || len(row) == 0 {
+				return mcp.NewToolResultError(fmt.Sprintf("Row %d is not an object of column values", i+1)), nil
+			}
+			rows = append(rows, row)
+		}
+		if len(rows) == 0 {
+			return mcp.NewToolResultError("At least one row is required"), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		// The generated statement does not set or check the tenant
+		if config.TenancyModel != "" {
+			return mcp.NewToolResultError("upsert is not available with tenant isolation (MSSQL_TENANCY_MODEL); use execute_write"), nil
+		}
+
+		schema, table, err := resolveObjectName(name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		// The table is checked before its columns are read to build the
+		// statement, and the statement as it will run
+		if err := checkPolicies(config, writeAccess, "INSERT INTO "+formatObjectName(schema, table)+" DEFAULT VALUES"); err != nil {
+			return notPermitted("Statement", err), nil
+		}
+		statement, args, err := upsertStatement(schema, table, keys, rows)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error building upsert: %v", err)), nil
+		}
+		if err := checkPolicies(config, writeAccess, statement); err != nil {
+			return notPermitted("Statement", err), nil
+		}
+		if showSQL, _ := request.Params.Arguments["show_sql"].(bool); showSQL {
+			return mcp.NewToolResultText(showUpsert(statement, args)), nil
+		}
+
+		log.Printf("Upserting %d rows into %s.%s", len(rows), schema, table)
+		transaction, _ := request.Params.Arguments["transaction"].(string)
+		start := time.Now()
+		data, err := executeSessionQuery(withTransactionHandle(ctx, transaction), statement, true, args...)
+		if err != nil {
+			log.Printf("Error upserting into %s.%s: %v", schema, table, err)
+			return mcp.NewToolResultError(fmt.Sprintf("Error executing upsert: %v; no rows were changed", err)), nil
+		}
+
+		counts, _ := data["rows"].([]map[string]interface{})
+		if len(counts) != 1 {
+			return mcp.NewToolResultError("Error executing upsert: no row counts were returned"), nil
+		}
+		summary := executionSummary{ElapsedMs: time.Since(start).Milliseconds()}
+		summary.Server, summary.Database = executionSource(config)
+		return mcp.NewToolResultText(fmt.Sprintf("Upserted into %s: %v rows updated, %v rows inserted.\n%s",
+			formatObjectName(schema, table), counts[0]["rows_updated"], counts[0]["rows_inserted"], summary.String())), nil
+	})
+}
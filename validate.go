@@ -0,0 +1,171 @@
+package mssqlmcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// sqlValidation is what the server reports about a statement it compiled
+// without running.
+type sqlValidation struct {
+	SyntaxError  error
+	BindingError string
+	Columns      []map[string]interface{}
+}
+
+// validateSQL checks a statement in two steps, neither of which executes
+// it: SET PARSEONLY reports syntax errors, and
+// sys.dm_exec_describe_first_result_set compiles the statement, reporting
+// missing objects and columns and the shape of its first result set.
+func validateSQL(statement, declarations string) (*sqlValidation, error) {
+	config, err := getDbConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := getConnection(config)
+	if err != nil {
+		return nil, fmt.Errorf("database connection error: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.QueryTimeout)*time.Second)
+	defer cancel()
+
+	// PARSEONLY is a session setting, so all three steps need the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SET PARSEONLY ON"); err != nil {
+		return nil, err
+	}
+	validation := &sqlValidation{}
+	_, validation.SyntaxError = conn.ExecContext(ctx, statement)
+	if _, err := conn.ExecContext(ctx, "SET PARSEONLY OFF"); err != nil {
+		return nil, err
+	}
+	if validation.SyntaxError != nil {
+		return validation, nil
+	}
+
+	var params interface{}
+	if declarations != "" {
+		params = declarations
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT name, system_type_name, is_nullable, error_message
+		FROM sys.dm_exec_describe_first_result_set(@p1, @p2, 0)
+		WHERE is_hidden = 0 OR error_message IS NOT NULL
+		ORDER BY column_ordinal`, statement, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	_, results, _, err := scanRows(rows, config, -1, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range results {
+		if message, ok := row["error_message"].(string); ok {
+			validation.BindingError = message
+			return validation, nil
+		}
+		validation.Columns = append(validation.Columns, row)
+	}
+	return validation, nil
+}
+
+// String renders the validation as a short report.
+func (v *sqlValidation) String() string {
+	var result strings.Builder
+	if v.SyntaxError != nil {
+		result.WriteString(fmt.Sprintf("Syntax: error: %v\n", v.SyntaxError))
+		return result.String()
+	}
+	result.WriteString("Syntax: OK\n")
+	if v.BindingError != "" {
+		result.WriteString(fmt.Sprintf("Objects and columns: error: %s\n", v.BindingError))
+		return result.String()
+	}
+	result.WriteString("Objects and columns: OK\n")
+	if len(v.Columns) == 0 {
+		result.WriteString("Result: no result set\n")
+		return result.String()
+	}
+	result.WriteString("Result columns:\n")
+	for _, column := range v.Columns {
+		nullable := ""
+		if column["is_nullable"] == true {
+			nullable = "?"
+		}
+		name, _ := column["name"].(string)
+		if name == "" {
+			name = "(no name)"
+		}
+		result.WriteString(fmt.Sprintf("  %s %v%s\n", name, column["system_type_name"], nullable))
+	}
+	return result.String()
+}
+
+// registerValidateTool adds a tool checking SQL without running it.
+func registerValidateTool(s *server.MCPServer) {
+	validateTool := mcp.NewTool("validate_sql",
+		mcp.WithDescription("Check a SQL statement without executing it: report syntax errors, references to missing tables or columns, and the columns and types of the result it would return. Use to check generated SQL before running it."),
+		mcp.WithString("statement",
+			mcp.Required(),
+			mcp.Description("The SQL statement to check; only its first result set is described"),
+		),
+		mcp.WithObject("params",
+			mcp.Description("Named parameters referenced in the statement as @name, as for execute_sql; only their types matter"),
+		),
+	)
+
+	s.AddTool(validateTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		statement, ok := request.Params.Arguments["statement"].(string)
+		if !ok || strings.TrimSpace(statement) == "" {
+			return mcp.NewToolResultError("Statement is required"), nil
+		}
+		if batches, err := splitBatches(statement); err == nil && len(batches) > 1 {
+			return mcp.NewToolResultError("The statement holds several batches separated by GO; check each batch on its own"), nil
+		}
+
+		// Describing the result reveals the columns of what the statement
+		// reads, so it must be one the policies let through
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+		access := readAccess
+		if isWriteOperation(statement) {
+			access = writeAccess
+		}
+		if err := checkPolicies(config, access, statement); err != nil {
+			return notPermitted("Statement", err), nil
+		}
+
+		params, _ := request.Params.Arguments["params"].(map[string]interface{})
+		declarations, err := parameterDeclarations(params)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid params: %v", err)), nil
+		}
+
+		validation, err := validateSQL(statement, declarations)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error validating statement: %v", err)), nil
+		}
+
+		report := validation.String()
+		if isWriteOperation(statement) {
+			report += "Note: the statement changes data or structure, so execute_sql refuses it.\n"
+		}
+		return mcp.NewToolResultText(report + "Nothing was executed."), nil
+	})
+}
@@ -0,0 +1,498 @@
+package mssqlmcp
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+
+	// Embedded zone data keeps MSSQL_TIMEZONE working on hosts without it
+	_ "time/tzdata"
+)
+
+// Layouts of the ISO 8601 rendering, by SQL Server type
+const (
+	isoDateLayout           = "2006-01-02"
+	isoTimeLayout           = "15:04:05.9999999"
+	isoDatetimeLayout       = "2006-01-02T15:04:05.9999999"
+	isoDatetimeOffsetLayout = "2006-01-02T15:04:05.9999999Z07:00"
+)
+
+// datetimeLocations resolves the time zone values are displayed in
+// (MSSQL_TIMEZONE) and the zone naive datetime columns are stored in
+// (MSSQL_DATETIME_STORAGE). Either is nil when not configured; naive values
+// are only converted when both are known.
+func datetimeLocations(config *DbConfig) (*time.Location, *time.Location, error) {
+	if config.Timezone == "" {
+		return nil, nil, nil
+	}
+
+	display, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("MSSQL_TIMEZONE: %v", err)
+	}
+
+	switch strings.ToLower(config.DatetimeStorage) {
+	case "", "local":
+		// The server's local zone is not known here
+		return display, nil, nil
+	case "utc":
+		return display, time.UTC, nil
+	}
+	storage, err := time.LoadLocation(config.DatetimeStorage)
+	if err != nil {
+		return nil, nil, fmt.Errorf("MSSQL_DATETIME_STORAGE: %v", err)
+	}
+	return display, storage, nil
+}
+
+// convertValue turns a scanned value into its result representation given
+// the column's type.
+func convertValue(config *DbConfig, columnType *sql.ColumnType, value interface{}) interface{} {
+	databaseType := columnType.DatabaseTypeName()
+	switch databaseType {
+	case "DECIMAL", "NUMERIC", "MONEY", "SMALLMONEY":
+		return formatExactNumber(columnType, value)
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		switch databaseType {
+		case "BINARY", "VARBINARY", "IMAGE", "TIMESTAMP":
+			return formatBinary(config, v)
+		case "UNIQUEIDENTIFIER":
+			return formatUniqueIdentifier(v)
+		}
+		// Character data arrives as strings; other bytes, e.g. of CLR types
+		// such as geography, are only text when they are valid UTF-8
+		if !utf8.Valid(v) {
+			return formatBinary(config, v)
+		}
+		return string(v)
+	case string:
+		// The driver passes varchar bytes through undecoded for collations
+		// whose code page it does not know
+		if !utf8.ValidString(v) {
+			return strings.ToValidUTF8(v, "\uFFFD")
+		}
+		return v
+	case time.Time:
+		return formatDatetime(config, databaseType, v)
+	}
+	return value
+}
+
+// exportValue converts a scanned value for a typed file export. It differs
+// from convertValue in what it leaves typed: binary data stays whole as
+// []byte rather than cut at MSSQL_BINARY_MAX_BYTES, and dates and naive
+// datetimes stay time.Time, converted as formatDatetime would but not
+// formatted. Exact numbers keep their decimal text for the writer to store
+// by the column's type.
+func exportValue(config *DbConfig, columnType *sql.ColumnType, value interface{}) interface{} {
+	if binary, ok := binaryValue(columnType, value); ok {
+		return binary
+	}
+	if v, ok := value.(time.Time); ok {
+		switch columnType.DatabaseTypeName() {
+		case "DATE":
+			return v
+		case "DATETIME", "DATETIME2", "SMALLDATETIME":
+			return displayDatetime(config, v)
+		}
+	}
+	return convertValue(config, columnType, value)
+}
+
+// binaryValue returns the bytes of a scanned value that convertValue would
+// render as binary, reporting false for text, numbers and other values.
+func binaryValue(columnType *sql.ColumnType, value interface{}) ([]byte, bool) {
+	v, ok := value.([]byte)
+	if !ok {
+		return nil, false
+	}
+	switch columnType.DatabaseTypeName() {
+	case "BINARY", "VARBINARY", "IMAGE", "TIMESTAMP":
+		return v, true
+	case "DECIMAL", "NUMERIC", "MONEY", "SMALLMONEY", "UNIQUEIDENTIFIER":
+		return nil, false
+	}
+	return v, !utf8.Valid(v)
+}
+
+// formatUniqueIdentifier renders a uniqueidentifier as SQL Server displays
+// it. Its first three groups are stored little-endian, so the raw bytes are
+// not the textual order.
+func formatUniqueIdentifier(value []byte) string {
+	var id mssql.UniqueIdentifier
+	if err := id.Scan(value); err != nil {
+		return "0x" + strings.ToUpper(hex.EncodeToString(value))
+	}
+	return id.String()
+}
+
+// formatExactNumber keeps decimal and money values as exact strings with the
+// column's scale (19.90, not 19.9), so they are never rounded through
+// float64 on the way to the client.
+func formatExactNumber(columnType *sql.ColumnType, value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		// The driver already renders these as exact decimal text
+		return string(v)
+	case string:
+		return v
+	case float64:
+		scale := int64(4) // money
+		if _, s, ok := columnType.DecimalSize(); ok {
+			scale = s
+		}
+		return strconv.FormatFloat(v, 'f', int(scale), 64)
+	}
+	return value
+}
+
+// formatDatetime renders date and time values as ISO 8601, or with the Go
+// layout in MSSQL_DATETIME_FORMAT, converting them to MSSQL_TIMEZONE when one
+// is configured and the value's zone is known.
+func formatDatetime(config *DbConfig, databaseType string, value time.Time) string {
+	switch databaseType {
+	case "DATE":
+		return value.Format(isoDateLayout)
+	case "TIME":
+		return value.Format(isoTimeLayout)
+	}
+
+	layout := isoDatetimeOffsetLayout
+	switch databaseType {
+	case "DATETIMEOFFSET":
+		if config.DisplayLocation != nil {
+			value = value.In(config.DisplayLocation)
+		}
+	default:
+		// Naive datetimes are kept without an offset unless their storage
+		// zone is known
+		value = displayDatetime(config, value)
+		if config.DisplayLocation == nil || config.StorageLocation == nil {
+			layout = isoDatetimeLayout
+		}
+	}
+
+	switch strings.ToLower(config.DatetimeFormat) {
+	case "", "iso8601":
+		return value.Format(layout)
+	case "rfc3339":
+		return value.Format(time.RFC3339Nano)
+	}
+	return value.Format(config.DatetimeFormat)
+}
+
+// displayDatetime converts a naive datetime to MSSQL_TIMEZONE when its
+// storage zone is configured. Such values arrive as UTC wall clock, so they
+// are reinterpreted in the storage zone first; otherwise they are returned
+// as they are.
+func displayDatetime(config *DbConfig, value time.Time) time.Time {
+	if config.DisplayLocation == nil || config.StorageLocation == nil {
+		return value
+	}
+	return time.Date(value.Year(), value.Month(), value.Day(), value.Hour(), value.Minute(), value.Second(),
+		value.Nanosecond(), config.StorageLocation).In(config.DisplayLocation)
+}
+
+// formatBinary renders binary data as 0x-prefixed hex or as base64
+// (MSSQL_BINARY_FORMAT), keeping only the first MSSQL_BINARY_MAX_BYTES bytes
+// and noting the full length when it cuts the value short.
+func formatBinary(config *DbConfig, value []byte) string {
+	shown := value
+	if config.BinaryMaxBytes > 0 && len(shown) > config.BinaryMaxBytes {
+		shown = shown[:config.BinaryMaxBytes]
+	}
+
+	var text string
+	if strings.EqualFold(config.BinaryFormat, "base64") {
+		text = base64.StdEncoding.EncodeToString(shown)
+	} else {
+		text = "0x" + strings.ToUpper(hex.EncodeToString(shown))
+	}
+	if len(shown) < len(value) {
+		text += fmt.Sprintf("… (%d bytes)", len(value))
+	}
+	return text
+}
+
+// columnInfo describes a result column so clients can interpret its values.
+type columnInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable *bool  `json:"nullable,omitempty"`
+	Source   string `json:"source,omitempty"` // table alias, see annotateColumnSources
+}
+
+// describeColumns reads the SQL type and nullability of each result column.
+func describeColumns(rows *sql.Rows) ([]columnInfo, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]columnInfo, len(columnTypes))
+	for i, columnType := range columnTypes {
+		columns[i] = columnInfo{Name: columnType.Name(), Type: sqlTypeName(columnType)}
+		if nullable, ok := columnType.Nullable(); ok {
+			columns[i].Nullable = &nullable
+		}
+	}
+	return columns, nil
+}
+
+// sqlTypeName renders a column type as it would be declared, e.g.
+// nvarchar(50), varbinary(max) or decimal(10,2).
+func sqlTypeName(columnType *sql.ColumnType) string {
+	name := strings.ToLower(columnType.DatabaseTypeName())
+	switch name {
+	case "char", "varchar", "nchar", "nvarchar", "binary", "varbinary":
+		if length, ok := columnType.Length(); ok {
+			// The driver reports (max) types by their size limit
+			if length >= 1073741822 {
+				return name + "(max)"
+			}
+			return fmt.Sprintf("%s(%d)", name, length)
+		}
+	case "decimal", "numeric":
+		if precision, scale, ok := columnType.DecimalSize(); ok {
+			return fmt.Sprintf("%s(%d,%d)", name, precision, scale)
+		}
+	}
+	return name
+}
+
+// columnTypesComment renders column types as a SQL comment line heading a
+// text result, e.g. "-- id int NOT NULL, name nvarchar(50) NULL".
+func columnTypesComment(columns []columnInfo) string {
+	described := make([]string, len(columns))
+	for i, column := range columns {
+		described[i] = column.Name + " " + column.Type
+		if column.Nullable != nil {
+			if *column.Nullable {
+				described[i] += " NULL"
+			} else {
+				described[i] += " NOT NULL"
+			}
+		}
+		if column.Source != "" {
+			described[i] += " [" + column.Source + "]"
+		}
+	}
+	return "-- " + strings.Join(described, ", ") + "\n"
+}
+
+// truncateCells returns a copy of a result whose text values longer than
+// maxLength characters are shortened, each marked with an ellipsis and its
+// full size, so one huge document cannot take over the response.
+func truncateCells(data map[string]interface{}, maxLength int) map[string]interface{} {
+	truncated := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		truncated[key] = value
+	}
+	for _, key := range []string{"rows", "outputRows"} {
+		rows, ok := data[key].([]map[string]interface{})
+		if !ok {
+			continue
+		}
+		copied := make([]map[string]interface{}, len(rows))
+		for i, row := range rows {
+			copied[i] = make(map[string]interface{}, len(row))
+			for column, value := range row {
+				if text, ok := value.(string); ok {
+					value = truncateText(text, maxLength)
+				}
+				copied[i][column] = value
+			}
+		}
+		truncated[key] = copied
+	}
+	return truncated
+}
+
+// truncateText cuts text to maxLength characters, never inside a UTF-8
+// sequence, appending "… (N bytes)" when anything was removed.
+func truncateText(text string, maxLength int) string {
+	if len(text) <= maxLength {
+		return text
+	}
+	count := 0
+	for i := range text {
+		if count == maxLength {
+			return text[:i] + fmt.Sprintf("… (%d bytes)", len(text))
+		}
+		count++
+	}
+	return text
+}
+
+// prettyPrintRequested reports whether a tool call asked for indented
+// values, falling back to MSSQL_PRETTY_PRINT.
+func prettyPrintRequested(config *DbConfig, arguments map[string]interface{}) bool {
+	if pretty, ok := arguments["pretty"].(bool); ok {
+		return pretty
+	}
+	return config.PrettyPrint
+}
+
+// prettyPrintValues returns a copy of a result whose xml values and text
+// values holding a JSON object or array are indented, so nested documents
+// can be read rather than scanned as one line. Values that do not parse are
+// left as they are.
+func prettyPrintValues(data map[string]interface{}) map[string]interface{} {
+	xmlColumns := make(map[string]bool)
+	if columnTypes, ok := data["columnTypes"].([]columnInfo); ok {
+		for _, column := range columnTypes {
+			xmlColumns[column.Name] = strings.EqualFold(column.Type, "xml")
+		}
+	}
+
+	pretty := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		pretty[key] = value
+	}
+	for _, key := range []string{"rows", "outputRows"} {
+		rows, ok := data[key].([]map[string]interface{})
+		if !ok {
+			continue
+		}
+		copied := make([]map[string]interface{}, len(rows))
+		for i, row := range rows {
+			copied[i] = make(map[string]interface{}, len(row))
+			for column, value := range row {
+				if text, ok := value.(string); ok {
+					if xmlColumns[column] {
+						value = indentXML(text)
+					} else {
+						value = indentJSON(text)
+					}
+				}
+				copied[i][column] = value
+			}
+		}
+		pretty[key] = copied
+	}
+	return pretty
+}
+
+// indentJSON indents text that is a JSON object or array, keeping key order
+// and number formatting.
+func indentJSON(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return text
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(trimmed), "", "  "); err != nil {
+		return text
+	}
+	return indented.String()
+}
+
+// indentXML puts each element of an XML document or fragment on its own
+// line, indented by depth. Elements holding only text stay on one line, and
+// names keep the prefixes they were written with.
+func indentXML(text string) string {
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	decoder.Strict = false
+	var tokens []xml.Token
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return text
+		}
+		tokens = append(tokens, xml.CopyToken(token))
+	}
+
+	var result strings.Builder
+	depth := 0
+	line := func(content string) {
+		if result.Len() > 0 {
+			result.WriteString("\n")
+		}
+		result.WriteString(strings.Repeat("  ", depth) + content)
+	}
+	for i := 0; i < len(tokens); i++ {
+		switch token := tokens[i].(type) {
+		case xml.StartElement:
+			start := xmlStartTag(token)
+			// <a/> and <a>text</a> stay on one line
+			if i+1 < len(tokens) {
+				if _, ok := tokens[i+1].(xml.EndElement); ok {
+					line(start[:len(start)-1] + "/>")
+					i++
+					continue
+				}
+			}
+			if i+2 < len(tokens) {
+				characters, isText := tokens[i+1].(xml.CharData)
+				if _, closes := tokens[i+2].(xml.EndElement); isText && closes {
+					line(start + xmlEscape(string(characters)) + "</" + xmlName(token.Name) + ">")
+					i += 2
+					continue
+				}
+			}
+			line(start)
+			depth++
+		case xml.EndElement:
+			if depth > 0 {
+				depth--
+			}
+			line("</" + xmlName(token.Name) + ">")
+		case xml.CharData:
+			if content := strings.TrimSpace(string(token)); content != "" {
+				line(xmlEscape(content))
+			}
+		case xml.Comment:
+			line("<!--" + string(token) + "-->")
+		case xml.ProcInst:
+			line("<?" + token.Target + " " + string(token.Inst) + "?>")
+		case xml.Directive:
+			line("<!" + string(token) + ">")
+		}
+	}
+	if depth != 0 {
+		return text
+	}
+	return result.String()
+}
+
+func xmlName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+func xmlStartTag(element xml.StartElement) string {
+	var tag strings.Builder
+	tag.WriteString("<" + xmlName(element.Name))
+	for _, attribute := range element.Attr {
+		tag.WriteString(" " + xmlName(attribute.Name) + `="` + xmlEscape(attribute.Value) + `"`)
+	}
+	tag.WriteString(">")
+	return tag.String()
+}
+
+// xmlEscaper escapes text and attribute values, leaving quotes in text and
+// line breaks readable.
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func xmlEscape(text string) string {
+	return xmlEscaper.Replace(text)
+}
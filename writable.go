@@ -0,0 +1,47 @@
+package mssqlmcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tableWritable reports whether a table matches an MSSQL_WRITABLE_TABLES
+// pattern such as staging.* or dbo.Orders; a pattern without a schema
+// stands for one in dbo.
+func tableWritable(config *DbConfig, schema, table string) bool {
+	return objectMatches(config.WritableTables, schema, table)
+}
+
+// checkWritableTables refuses a statement changing a table outside
+// MSSQL_WRITABLE_TABLES, when that is set. Table variables and #temp tables
+// may always be written. Statements whose changes cannot be traced to a
+// table, such as EXEC, CREATE PROCEDURE, DBCC or KILL, are refused outright.
+func checkWritableTables(config *DbConfig, statement string) error {
+	if len(config.WritableTables) == 0 {
+		return nil
+	}
+	// A write with no table to check, should one slip past writeTargets,
+	// is refused as well
+	targets, ok := writeTargets(statement)
+	if !ok || (len(targets) == 0 && isWriteOperation(statement)) {
+		return fmt.Errorf("only INSERT, UPDATE, DELETE and MERGE on tables matching MSSQL_WRITABLE_TABLES (%s) are permitted, and the statement changes something else",
+			strings.Join(config.WritableTables, ", "))
+	}
+	for _, target := range targets {
+		if target.IsTemporary() || strings.HasPrefix(target.Name(), "@") {
+			continue
+		}
+		if len(target.Parts) > 2 {
+			return fmt.Errorf("%s is in another database; only tables matching MSSQL_WRITABLE_TABLES may be written", target.Name())
+		}
+		schema, table := "dbo", target.Parts[len(target.Parts)-1]
+		if len(target.Parts) == 2 && target.Parts[0] != "" {
+			schema = target.Parts[0]
+		}
+		if !tableWritable(config, schema, table) {
+			return fmt.Errorf("%s is not writable; only tables matching MSSQL_WRITABLE_TABLES (%s) may be written",
+				formatObjectName(schema, table), strings.Join(config.WritableTables, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package mssqlmcp
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// identityCapture reads the identity value an INSERT generated back through
+// an output parameter. SCOPE_IDENTITY() stays in the statement's own scope, so
+// triggers inserting elsewhere do not change it.
+const identityCapture = "\nSET @identity = ISNULL(CONVERT(nvarchar(40), SCOPE_IDENTITY()), N'');"
+
+// registerWriteTool adds execute_write, which runs statements that change
+// data or schema. It is only registered when MSSQL_ALLOW_WRITE is set.
+func registerWriteTool(s *server.MCPServer) {
+	writeTool := mcp.NewTool("execute_write",
+		mcp.WithDescription("Execute a statement that changes the database (INSERT, UPDATE, DELETE, MERGE, CREATE, ALTER, DROP, etc.) and report the rows affected and any identity value generated. Changes are real and take effect immediately unless made inside a transaction opened with begin_transaction; there is no undo. Use execute_sql for reads. When MSSQL_WRITABLE_TABLES is set, only the tables it names can be changed. UPDATE and DELETE need a WHERE clause, and may be rolled back when they change more rows than the server allows."),
+		mcp.WithString("statement",
+			mcp.Required(),
+			mcp.Description("The SQL statement to execute, or a script whose batches are separated by GO lines; batches run in order and stop at the first failure"),
+		),
+		mcp.WithObject("params",
+			mcp.Description("Named parameters referenced in the statement as @name, bound rather than spliced into the SQL; give a {value, type} object to bind a specific SQL Server type, as with execute_sql"),
+		),
+		mcp.WithString("transaction",
+			mcp.Description("Handle from begin_transaction to run the statement inside that transaction"),
+		),
+		mcp.WithString("tenant",
+			mcp.Description("Tenant to write to on a multi-tenant database (MSSQL_TENANCY_MODEL), unless the server is pinned to one with MSSQL_TENANT"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Run the statement in a transaction that is rolled back, reporting the rows it would affect and a sample of them, to preview its impact; nothing is changed. Transaction control, procedure calls and dynamic SQL cannot be previewed"),
+		),
+	)
+
+	s.AddTool(writeTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		statement, _ := request.Params.Arguments["statement"].(string)
+		if strings.TrimSpace(statement) == "" {
+			return mcp.NewToolResultError("Statement is required"), nil
+		}
+
+		config, err := getDbConfig()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Configuration error: %v", err)), nil
+		}
+
+		requestedTenant, _ := request.Params.Arguments["tenant"].(string)
+		params, _ := request.Params.Arguments["params"].(map[string]interface{})
+		args, err := queryParameters(params)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid params: %v", err)), nil
+		}
+		transaction, _ := request.Params.Arguments["transaction"].(string)
+		dryRun, _ := request.Params.Arguments["dry_run"].(bool)
+		if dryRun && transaction != "" {
+			return mcp.NewToolResultError("dry_run runs in a transaction of its own and cannot be combined with transaction"), nil
+		}
+
+		// Scripts separated by GO run batch by batch
+		batches, err := splitBatches(statement)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid script: %v", err)), nil
+		}
+		if len(batches) == 0 {
+			return mcp.NewToolResultError("Statement is required"), nil
+		}
+		// The whole script is checked before any of it runs
+		var scoped string
+		for _, batch := range batches {
+			if scoped, err = checkStatement(config, writeAccess, requestedTenant, batch.Text); err != nil {
+				return notPermitted("Statement", err), nil
+			}
+		}
+		if len(batches) > 1 || batches[0].Repeat > 1 {
+			if dryRun {
+				return mcp.NewToolResultError("dry_run previews a single statement; run the batches of the script one at a time"), nil
+			}
+			log.Printf("Executing script of %d batches", len(batches))
+			return mcp.NewToolResultText(runScript(withTransactionHandle(ctx, transaction), config, requestedTenant, batches, args)), nil
+		}
+		statement = batches[0].Text
+
+		if dryRun {
+			log.Printf("Dry run of write: %s", statement)
+			start := time.Now()
+			data, err := dryRunWrite(ctx, config, scoped, args...)
+			if err != nil {
+				log.Printf("Error in dry run of '%s': %v", statement, err)
+				return mcp.NewToolResultError(fmt.Sprintf("Error executing statement (rolled back): %v", err)), nil
+			}
+			addExecutionSummary(config, data, time.Since(start))
+			result, err := formatResults(data)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Error formatting results: %v", err)), nil
+			}
+			if rowCount, _ := data["rowCount"].(int64); config.MaxAffectedRows > 0 && rowCount > int64(config.MaxAffectedRows) {
+				result += fmt.Sprintf("\nRun for real, the statement would be rolled back: it changes more than the %d rows MSSQL_MAX_AFFECTED_ROWS allows.", config.MaxAffectedRows)
+			}
+			return mcp.NewToolResultText("Dry run: the statement ran in a transaction that was rolled back, so nothing was changed. Identity values and sequence numbers it drew stay used, and triggers ran.\n" + result), nil
+		}
+
+		log.Printf("Executing write: %s", statement)
+
+		// Rows captured through an OUTPUT clause already carry their identity
+		var identity string
+		_, taken := params["identity"]
+		_, takenWithAt := params["@identity"]
+		captureIdentity := isInsertStatement(statement) && !config.CaptureWriteOutput && !taken && !takenWithAt
+		if captureIdentity {
+			scoped += identityCapture
+			args = append(args, sql.Named("identity", sql.Out{Dest: &identity}))
+		}
+
+		start := time.Now()
+		data, err := executeSessionQuery(withTransactionHandle(ctx, transaction), scoped, false, args...)
+		if err != nil {
+			log.Printf("Error executing write '%s': %v", statement, err)
+			return mcp.NewToolResultError(fmt.Sprintf("Error executing statement: %v", err)), nil
+		}
+		addExecutionSummary(config, data, time.Since(start))
+
+		result, err := formatResults(data)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error formatting results: %v", err)), nil
+		}
+		if identity != "" {
+			result += fmt.Sprintf("\nIdentity value generated: %s", identity)
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+}
+
+// dryRunWrite executes a write statement in a transaction of its own on a
+// fresh connection and rolls it back, returning the rows affected and, when
+// an OUTPUT clause can be added, a sample of the rows as they would be.
+// Statements that could end the transaction themselves are refused, and the
+// transaction is checked to still be open before it is rolled back.
+func dryRunWrite(ctx context.Context, config *DbConfig, statement string, args ...interface{}) (map[string]interface{}, error) {
+	if err := checkDryRunnable(statement); err != nil {
+		return nil, err
+	}
+
+	db, err := getConnection(config)
+	if err != nil {
+		return nil, fmt.Errorf("database connection error: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.QueryTimeout)*time.Second)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	data, err := func() (map[string]interface{}, error) {
+		if outputStatement, ok := injectOutputClause(statement); ok {
+			data, err := executeWithOutput(ctx, tx, config, outputStatement, args...)
+			if err == nil || !isOutputClauseRejected(err) {
+				return data, err
+			}
+			log.Printf("OUTPUT clause rejected, dry run without sample rows: %v", err)
+		}
+		res, err := tx.ExecContext(ctx, tagQuery(ctx, config, statement), args...)
+		if err != nil {
+			return nil, err
+		}
+		rowCount, _ := res.RowsAffected()
+		return map[string]interface{}{"rowCount": rowCount}, nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions int
+	if err := tx.QueryRowContext(ctx, "SELECT @@TRANCOUNT").Scan(&transactions); err != nil {
+		return nil, fmt.Errorf("could not confirm the dry run's transaction is still open, so its changes may have been kept: %v", err)
+	}
+	if transactions == 0 {
+		log.Printf("Dry run transaction ended by the statement: %s", truncateString(statement, 100))
+		return nil, fmt.Errorf("the statement ended the dry run's transaction, so its changes were NOT rolled back and may have been committed")
+	}
+	if err := tx.Rollback(); err != nil {
+		return nil, fmt.Errorf("rolling back the dry run failed, so its changes may have been kept: %v", err)
+	}
+	return data, nil
+}
+
+// checkDryRunnable refuses statements a dry run cannot contain: transaction
+// control, which would commit or end the dry run's transaction, and
+// procedure calls and dynamic SQL, which may do so out of sight.
+func checkDryRunnable(statement string) error {
+	tokens := significantTokens(tokenizeSQL(statement))
+	for i, t := range tokens {
+		if t.Kind != tokenWord {
+			continue
+		}
+		next := func(words ...string) bool {
+			for _, word := range words {
+				if i+1 < len(tokens) && tokens[i+1].isKeyword(word) {
+					return true
+				}
+			}
+			return false
+		}
+		switch {
+		case t.isKeyword("COMMIT"), t.isKeyword("ROLLBACK"),
+			t.isKeyword("BEGIN") && next("TRAN", "TRANSACTION", "DISTRIBUTED"),
+			t.isKeyword("SAVE") && next("TRAN", "TRANSACTION"):
+			return fmt.Errorf("dry_run cannot preview transaction control (%s); run the statement inside begin_transaction instead", strings.ToUpper(t.Text))
+		case t.isKeyword("EXEC"), t.isKeyword("EXECUTE"), i == 0 && isNameToken(t):
+			return fmt.Errorf("dry_run cannot preview procedure calls or dynamic SQL, which may commit on their own; run the statement inside begin_transaction instead")
+		}
+	}
+	return nil
+}
+
+// isInsertStatement reports whether a statement starts with INSERT, possibly
+// after a common table expression. Only then is it safe to append the
+// identity capture: after CREATE PROCEDURE and the like it would become part
+// of the object's body.
+func isInsertStatement(statement string) bool {
+	return statementVerb(statement) == "INSERT"
+}
+
+// statementVerb returns the keyword a data statement starts with, one of
+// SELECT, INSERT, UPDATE, DELETE and MERGE, looking past a common table
+// expression, or "" for other statements.
+func statementVerb(statement string) string {
+	tokens := significantTokens(tokenizeSQL(statement))
+	verb := func(t sqlToken) string {
+		for _, keyword := range []string{"SELECT", "INSERT", "UPDATE", "DELETE", "MERGE"} {
+			if t.isKeyword(keyword) {
+				return keyword
+			}
+		}
+		return ""
+	}
+	if len(tokens) == 0 {
+		return ""
+	}
+	if !tokens[0].isKeyword("WITH") {
+		return verb(tokens[0])
+	}
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i].Text == "(" {
+			i = skipParenthesized(tokens, i) - 1
+			continue
+		}
+		if keyword := verb(tokens[i]); keyword != "" {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// runScript executes the batches of a script in order, each as often as its
+// GO count says, and reports the outcome of each. Execution stops at the
+// first failing batch; batches run before it stay applied unless they ran
+// inside a transaction. Each batch is checked again as it runs, so tenant
+// scoping sees the tables earlier batches created.
+func runScript(ctx context.Context, config *DbConfig, requestedTenant string, batches []scriptBatch, args []interface{}) string {
+	var report strings.Builder
+	start := time.Now()
+	for i, batch := range batches {
+		label := fmt.Sprintf("Batch %d of %d (line %d)", i+1, len(batches), batch.Line)
+		if batch.Repeat > 1 {
+			label += fmt.Sprintf(", %d times", batch.Repeat)
+		}
+
+		scoped, err := checkStatement(config, writeAccess, requestedTenant, batch.Text)
+		if err == nil {
+			var rowCount int64
+			for run := 0; run < batch.Repeat && err == nil; run++ {
+				var data map[string]interface{}
+				data, err = executeSessionQuery(ctx, scoped, false, args...)
+				if err == nil {
+					count, _ := data["rowCount"].(int64)
+					rowCount += count
+				}
+			}
+			if err == nil {
+				report.WriteString(fmt.Sprintf("%s: succeeded, %d rows affected\n", label, rowCount))
+				continue
+			}
+		}
+
+		log.Printf("Error executing batch %d at line %d: %v", i+1, batch.Line, err)
+		report.WriteString(fmt.Sprintf("%s: failed: %v\n", label, err))
+		if remaining := len(batches) - i - 1; remaining > 0 {
+			report.WriteString(fmt.Sprintf("Stopped; the remaining %d batches did not run.\n", remaining))
+		}
+		break
+	}
+
+	summary := executionSummary{ElapsedMs: time.Since(start).Milliseconds()}
+	summary.Server, summary.Database = executionSource(config)
+	report.WriteString(summary.String())
+	return report.String()
+}
@@ -0,0 +1,264 @@
+package mssqlmcp
+
+import (
+	"archive/zip"
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of an Excel worksheet
+const (
+	XLSX_MAX_ROWS       = 1048576
+	XLSX_MAX_CELL_CHARS = 32767
+)
+
+// Cell styles defined in xlsxStyles, by index
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleDate
+	xlsxStyleDatetime
+	xlsxStyleHeader
+)
+
+// Excel counts days from 1899-12-30
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Results" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="4"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs></styleSheet>`
+
+// streamXLSX exports a query as a workbook, writing rows into the sheet as
+// they are read (see exportRows). Values are converted with exportValue, so
+// dates, datetimes and exact numbers are typed cells whatever
+// MSSQL_DATETIME_FORMAT says, and binary values are written whole, up to
+// the size limit of a cell.
+func streamXLSX(config *DbConfig, path, query string) (int64, int, error) {
+	exportConfig := *config
+	exportConfig.BinaryMaxBytes = 0
+
+	var (
+		file        *os.File
+		sheet       *xlsxWriter
+		columnTypes []*sql.ColumnType
+	)
+	begin := func(columns []string, types []*sql.ColumnType, masked []bool) error {
+		columnTypes = types
+		sqlTypes := make([]string, len(types))
+		for i, columnType := range types {
+			sqlTypes[i] = strings.ToLower(columnType.DatabaseTypeName())
+		}
+
+		var err error
+		if file, err = os.Create(path); err != nil {
+			return err
+		}
+		sheet, err = newXLSXWriter(file, columns, sqlTypes)
+		return err
+	}
+	write := func(values []interface{}) error {
+		for i, value := range values {
+			if value == nil {
+				continue
+			}
+			value = exportValue(&exportConfig, columnTypes[i], value)
+			if binary, ok := value.([]byte); ok {
+				value = formatBinary(&exportConfig, binary)
+			}
+			values[i] = value
+		}
+		return sheet.WriteRow(values)
+	}
+
+	count, err := exportRows(config, query, begin, write)
+	if err == nil {
+		err = sheet.Close()
+	}
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, len(columnTypes), nil
+}
+
+// xlsxWriter writes a single-sheet workbook row by row. The fixed parts of
+// the package go first so the sheet can be streamed into the archive last.
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	types   []string
+	row     int
+}
+
+// newXLSXWriter starts a workbook and writes its bold header row. types
+// holds the SQL type of each column, which decides how values are stored.
+func newXLSXWriter(w io.Writer, columns []string, types []string) (*xlsxWriter, error) {
+	archive := zip.NewWriter(w)
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		writer, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(writer, part.content); err != nil {
+			return nil, err
+		}
+	}
+	writer, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	x := &xlsxWriter{archive: archive, sheet: bufio.NewWriterSize(writer, 1<<16), types: types, row: 1}
+	x.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews><sheetData>`)
+	x.sheet.WriteString(`<row r="1">`)
+	for i, column := range columns {
+		writeXLSXText(x.sheet, xlsxCellName(i, 1), column, xlsxStyleHeader)
+	}
+	_, err = x.sheet.WriteString(`</row>`)
+	return x, err
+}
+
+// WriteRow adds a row of values, in column order.
+func (x *xlsxWriter) WriteRow(values []interface{}) error {
+	if x.row == XLSX_MAX_ROWS {
+		return fmt.Errorf("the rows do not fit in a worksheet (at most %d)", XLSX_MAX_ROWS-1)
+	}
+	x.row++
+	x.sheet.WriteString(fmt.Sprintf(`<row r="%d">`, x.row))
+	for i, value := range values {
+		writeXLSXCell(x.sheet, xlsxCellName(i, x.row), value, x.types[i])
+	}
+	_, err := x.sheet.WriteString(`</row>`)
+	return err
+}
+
+// Close ends the sheet and the archive; the underlying writer stays open.
+func (x *xlsxWriter) Close() error {
+	x.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.archive.Close()
+}
+
+// writeXLSXCell writes one value as a typed cell. NULL leaves the cell out.
+func writeXLSXCell(sheet *bufio.Writer, name string, value interface{}, sqlType string) {
+	baseType, _, _ := strings.Cut(sqlType, "(")
+	switch v := value.(type) {
+	case nil:
+		return
+	case bool:
+		flag := 0
+		if v {
+			flag = 1
+		}
+		sheet.WriteString(fmt.Sprintf(`<c r="%s" t="b"><v>%d</v></c>`, name, flag))
+		return
+	case int64:
+		sheet.WriteString(fmt.Sprintf(`<c r="%s"><v>%d</v></c>`, name, v))
+		return
+	case float64:
+		sheet.WriteString(fmt.Sprintf(`<c r="%s"><v>%s</v></c>`, name, strconv.FormatFloat(v, 'g', -1, 64)))
+		return
+	case json.Number:
+		sheet.WriteString(fmt.Sprintf(`<c r="%s"><v>%s</v></c>`, name, v))
+		return
+	case time.Time:
+		style := xlsxStyleDatetime
+		if baseType == "date" {
+			style = xlsxStyleDate
+		}
+		sheet.WriteString(fmt.Sprintf(`<c r="%s" s="%d"><v>%s</v></c>`, name, style, xlsxSerial(v)))
+		return
+	case string:
+		switch baseType {
+		case "decimal", "numeric", "money", "smallmoney":
+			// Exact decimal text is a valid cell value as is
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				sheet.WriteString(fmt.Sprintf(`<c r="%s"><v>%s</v></c>`, name, v))
+				return
+			}
+		case "date":
+			if t, err := time.Parse(isoDateLayout, v); err == nil {
+				sheet.WriteString(fmt.Sprintf(`<c r="%s" s="%d"><v>%s</v></c>`, name, xlsxStyleDate, xlsxSerial(t)))
+				return
+			}
+		case "datetime", "datetime2", "smalldatetime":
+			// Converted to MSSQL_TIMEZONE they carry an offset; keep the wall clock
+			t, err := time.Parse(isoDatetimeLayout, v)
+			if err != nil {
+				t, err = time.Parse(isoDatetimeOffsetLayout, v)
+			}
+			if err == nil {
+				sheet.WriteString(fmt.Sprintf(`<c r="%s" s="%d"><v>%s</v></c>`, name, xlsxStyleDatetime, xlsxSerial(t)))
+				return
+			}
+		}
+		writeXLSXText(sheet, name, v, xlsxStyleDefault)
+		return
+	}
+	writeXLSXText(sheet, name, fmt.Sprintf("%v", value), xlsxStyleDefault)
+}
+
+// writeXLSXText writes an inline string cell, cut to the cell size limit.
+func writeXLSXText(sheet *bufio.Writer, name, text string, style int) {
+	text = truncateText(text, XLSX_MAX_CELL_CHARS-20)
+	sheet.WriteString(fmt.Sprintf(`<c r="%s" t="inlineStr"`, name))
+	if style != xlsxStyleDefault {
+		sheet.WriteString(fmt.Sprintf(` s="%d"`, style))
+	}
+	sheet.WriteString(`><is><t xml:space="preserve">`)
+	xml.EscapeText(sheet, []byte(text))
+	sheet.WriteString(`</t></is></c>`)
+}
+
+// xlsxSerial converts a wall-clock time to an Excel date serial number.
+func xlsxSerial(t time.Time) string {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return strconv.FormatFloat(wall.Sub(xlsxEpoch).Hours()/24, 'f', -1, 64)
+}
+
+// xlsxCellName returns the A1-style name of a cell, with a zero-based column.
+func xlsxCellName(column, row int) string {
+	letters := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		letters = string(rune('A'+(column-1)%26)) + letters
+	}
+	return fmt.Sprintf("%s%d", letters, row)
+}
@@ -0,0 +1,67 @@
+package mssqlmcp
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readXLSXSheet returns the worksheet XML of a workbook written by xlsxWriter.
+func readXLSXSheet(t *testing.T, workbook []byte) string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(workbook), int64(len(workbook)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet, err := archive.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sheet.Close()
+	content, err := io.ReadAll(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestXLSXWriterTypedCells(t *testing.T) {
+	var workbook bytes.Buffer
+	sheet, err := newXLSXWriter(&workbook, []string{"day", "created", "amount", "note", "missing"},
+		[]string{"date", "datetime2", "decimal", "nvarchar", "int"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := []interface{}{
+		time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC),
+		"12345678901234.5678",
+		"a < b",
+		nil,
+	}
+	if err := sheet.WriteRow(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := sheet.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content := readXLSXSheet(t, workbook.Bytes())
+	for _, cell := range []string{
+		`<c r="A1" t="inlineStr" s="3"><is><t xml:space="preserve">day</t></is></c>`,
+		`<c r="A2" s="1"><v>45352</v></c>`,
+		`<c r="B2" s="2"><v>45352.75</v></c>`,
+		`<c r="C2"><v>12345678901234.5678</v></c>`,
+		`<c r="D2" t="inlineStr"><is><t xml:space="preserve">a &lt; b</t></is></c>`,
+	} {
+		if !strings.Contains(content, cell) {
+			t.Errorf("sheet lacks %s:\n%s", cell, content)
+		}
+	}
+	if strings.Contains(content, `r="E2"`) {
+		t.Errorf("NULL was written as a cell:\n%s", content)
+	}
+}